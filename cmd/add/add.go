@@ -1,31 +1,55 @@
 package add
 
 import (
-	"database/sql"
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
 	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/output"
 	"github.com/dnote/cli/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var content string
+var file string
+var splitOn string
+var tags []string
+var public bool
 
 var example = `
  * Open an editor to write content
  dnote add git
 
  * Skip the editor by providing content directly
- dnote add git -c "time is a part of the commit hash"`
+ dnote add git -c "time is a part of the commit hash"
+
+ * Tag the note. Hashtags in the content are also added as tags
+ dnote add git -t vcs -c "rebase with #autosquash"
+
+ * Read the content from a pipe
+ git log -1 | dnote add git
+
+ * Add the content of a file
+ dnote add git --file ./notes.md
+
+ * Add a note for each part of a file separated by a line of "---"
+ dnote add git --file ./notes.md --split-on ---
+
+ * Add a public note
+ dnote add git --public -c "git bisect finds the commit introducing a bug"`
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) != 1 {
 		return errors.New("Incorrect number of argument")
 	}
+	if content != "" && file != "" {
+		return errors.New("Cannot use both --content and --file")
+	}
 
 	return nil
 }
@@ -42,7 +66,11 @@ func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
 	}
 
 	f := cmd.Flags()
-	f.StringVarP(&content, "content", "c", "", "The new content for the note")
+	f.StringVarP(&content, "content", "c", "", "The new content for the note. '-' reads it from stdin")
+	f.StringVarP(&file, "file", "f", "", "The file to read the content from")
+	f.StringVarP(&splitOn, "split-on", "", "", "The line separating the contents of several notes")
+	f.StringSliceVarP(&tags, "tag", "t", []string{}, "The tags for the note")
+	f.BoolVar(&public, "public", false, "Publish the note on the site built by 'dnote site build'")
 
 	return cmd
 }
@@ -51,28 +79,33 @@ func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		bookName := args[0]
 
-		if content == "" {
-			fpath := core.GetDnoteTmpContentPath(ctx)
-			err := core.GetEditorInput(ctx, fpath, &content)
-			if err != nil {
-				return errors.Wrap(err, "Failed to get editor input")
-			}
+		c, err := getContent(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting the content")
 		}
 
-		if content == "" {
+		contents := []string{c}
+		if splitOn != "" {
+			contents = splitContent(c, splitOn)
+		}
+		if len(contents) == 0 || contents[0] == "" {
 			return errors.New("Empty content")
 		}
 
 		ts := time.Now().Unix()
-		err := writeNote(ctx, bookName, content, ts)
-		if err != nil {
-			return errors.Wrap(err, "Failed to write note")
+		noteUUIDs := []string{}
+		for _, c := range contents {
+			noteUUID, err := WriteNote(ctx, bookName, c, tags, public, ts)
+			if err != nil {
+				return errors.Wrap(err, "Failed to write note")
+			}
+
+			noteUUIDs = append(noteUUIDs, noteUUID)
 		}
 
-		log.Successf("added to %s\n", bookName)
-		fmt.Printf("\n------------------------content------------------------\n")
-		fmt.Printf("%s", content)
-		fmt.Printf("\n-------------------------------------------------------\n")
+		if err := printResult(ctx, bookName, contents, noteUUIDs); err != nil {
+			return errors.Wrap(err, "printing the result")
+		}
 
 		if err := core.CheckUpdate(ctx); err != nil {
 			log.Error(errors.Wrap(err, "automatically checking updates").Error())
@@ -82,45 +115,138 @@ func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	}
 }
 
-func writeNote(ctx infra.DnoteCtx, bookLabel string, content string, ts int64) error {
-	tx, err := ctx.DB.Begin()
-	if err != nil {
-		return errors.Wrap(err, "beginning a transaction")
-	}
+// getContent returns the content of the new note from the flags, stdin or an
+// editor
+func getContent(ctx infra.DnoteCtx) (string, error) {
+	switch {
+	case file != "":
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", errors.Wrap(err, "reading the file")
+		}
 
-	var bookUUID string
-	err = tx.QueryRow("SELECT uuid FROM books WHERE label = ?", bookLabel).Scan(&bookUUID)
-	if err == sql.ErrNoRows {
-		bookUUID = utils.GenerateUUID()
-		_, err = tx.Exec("INSERT INTO books (uuid, label) VALUES (?, ?)", bookUUID, bookLabel)
+		return core.SanitizeContent(string(b)), nil
+	case content == "-" || (content == "" && !utils.IsStdinTerminal()):
+		c, err := utils.ReadStdin()
 		if err != nil {
-			tx.Rollback()
-			return errors.Wrap(err, "creating the book")
+			return "", errors.Wrap(err, "reading stdin")
 		}
 
-		err = core.LogActionAddBook(tx, bookLabel)
+		return core.SanitizeContent(c), nil
+	case content != "":
+		return content, nil
+	}
+
+	var ret string
+	fpath := core.GetDnoteTmpContentPath(ctx)
+	if err := core.GetEditorInput(ctx, fpath, &ret); err != nil {
+		return "", errors.Wrap(err, "Failed to get editor input")
+	}
+
+	return ret, nil
+}
+
+// splitContent splits the content into the contents of several notes at the
+// lines consisting of the separator. Empty contents are left out.
+func splitContent(content, sep string) []string {
+	ret := []string{}
+
+	var lines []string
+	flush := func() {
+		c := strings.Trim(strings.Join(lines, "\n"), "\r\n")
+		if strings.TrimSpace(c) != "" {
+			ret = append(ret, c)
+		}
+
+		lines = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == sep {
+			flush()
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+	flush()
+
+	return ret
+}
+
+// printResult prints the added notes
+func printResult(ctx infra.DnoteCtx, bookLabel string, contents, noteUUIDs []string) error {
+	if output.IsText() {
+		if len(contents) > 1 {
+			log.Successf("added %d notes to %s\n", len(contents), bookLabel)
+			return nil
+		}
+
+		log.Successf("added to %s\n", bookLabel)
+		fmt.Printf("\n------------------------content------------------------\n")
+		fmt.Printf("%s", contents[0])
+		fmt.Printf("\n-------------------------------------------------------\n")
+
+		return nil
+	}
+
+	notes := []output.Note{}
+	for _, noteUUID := range noteUUIDs {
+		note, err := output.GetNote(ctx.DB, noteUUID)
 		if err != nil {
-			tx.Rollback()
-			return errors.Wrap(err, "logging action")
+			return errors.Wrap(err, "getting the note")
 		}
-	} else if err != nil {
-		return errors.Wrap(err, "finding the book")
+
+		notes = append(notes, note)
+	}
+
+	if len(notes) == 1 {
+		return output.Print(notes[0])
+	}
+
+	return output.Print(notes)
+}
+
+// WriteNote adds a note, tags it and logs the actions. It returns the uuid of
+// the note.
+func WriteNote(ctx infra.DnoteCtx, bookLabel string, content string, tags []string, public bool, ts int64) (string, error) {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return "", errors.Wrap(err, "beginning a transaction")
+	}
+
+	bookUUID, err := core.GetOrCreateBook(tx, bookLabel)
+	if err != nil {
+		tx.Rollback()
+		return "", errors.Wrap(err, "getting the book")
 	}
 
 	noteUUID := utils.GenerateUUID()
 	_, err = tx.Exec(`INSERT INTO notes (uuid, book_uuid, content, added_on, public)
-		VALUES (?, ?, ?, ?, ?);`, noteUUID, bookUUID, content, ts, false)
+		VALUES (?, ?, ?, ?, ?);`, noteUUID, bookUUID, content, ts, public)
 	if err != nil {
 		tx.Rollback()
-		return errors.Wrap(err, "creating the note")
+		return "", errors.Wrap(err, "creating the note")
 	}
-	err = core.LogActionAddNote(tx, noteUUID, bookLabel, content, ts)
+	err = core.LogActionAddNote(tx, noteUUID, bookLabel, content, public, ts)
 	if err != nil {
 		tx.Rollback()
-		return errors.Wrap(err, "logging action")
+		return "", errors.Wrap(err, "logging action")
+	}
+
+	noteTags := core.MergeTags(tags, core.ExtractHashtags(content))
+	if len(noteTags) > 0 {
+		if err = core.SetNoteTags(tx, noteUUID, noteTags); err != nil {
+			tx.Rollback()
+			return "", errors.Wrap(err, "tagging the note")
+		}
+		if err = core.LogActionSetNoteTags(tx, noteUUID, noteTags, ts); err != nil {
+			tx.Rollback()
+			return "", errors.Wrap(err, "logging action")
+		}
 	}
 
 	tx.Commit()
 
-	return nil
+	return noteUUID, nil
 }
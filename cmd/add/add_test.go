@@ -0,0 +1,44 @@
+package add
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+)
+
+func TestSplitContent(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input:    "foo",
+			expected: []string{"foo"},
+		},
+		{
+			input:    "foo\n---\nbar\nbaz\n",
+			expected: []string{"foo", "bar\nbaz"},
+		},
+		{
+			input:    "---\nfoo\n\n---\n\n---\n  indented\n--- \n",
+			expected: []string{"foo", "  indented"},
+		},
+		{
+			input:    "foo --- bar\n----\nbaz",
+			expected: []string{"foo --- bar\n----\nbaz"},
+		},
+		{
+			input:    "---\n\n---",
+			expected: []string{},
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			got := splitContent(tc.input, "---")
+
+			testutils.AssertDeepEqual(t, got, tc.expected, "result mismatch")
+		})
+	}
+}
@@ -1,13 +1,14 @@
 package cat
 
 import (
-	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
 	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/output"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -56,35 +57,44 @@ type noteInfo struct {
 func NewRun(ctx infra.DnoteCtx) core.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		db := ctx.DB
-		bookLabel := args[0]
-		noteID := args[1]
-
-		var bookUUID string
-		err := db.QueryRow("SELECT uuid FROM books WHERE label = ?", bookLabel).Scan(&bookUUID)
-		if err == sql.ErrNoRows {
-			return errors.Errorf("book '%s' not found", bookLabel)
-		} else if err != nil {
-			return errors.Wrap(err, "querying the book")
+
+		note, err := core.FindNoteByArgs(ctx, args)
+		if err != nil {
+			return err
 		}
 
 		var info noteInfo
 		err = db.QueryRow(`SELECT books.label, notes.uuid, notes.content, notes.added_on, notes.edited_on
 			FROM notes
 			INNER JOIN books ON books.uuid = notes.book_uuid
-			WHERE notes.id = ? AND books.uuid = ?`, noteID, bookUUID).
+			WHERE notes.uuid = ?`, note.UUID).
 			Scan(&info.BookLabel, &info.UUID, &info.Content, &info.AddedOn, &info.EditedOn)
-		if err == sql.ErrNoRows {
-			return errors.Errorf("note %s not found in the book '%s'", noteID, bookLabel)
-		} else if err != nil {
+		if err != nil {
 			return errors.Wrap(err, "querying the note")
 		}
 
+		if !output.IsText() {
+			note, err := output.GetNote(db, info.UUID)
+			if err != nil {
+				return errors.Wrap(err, "getting the note")
+			}
+
+			return output.Print(note)
+		}
+
 		log.Infof("book name: %s\n", info.BookLabel)
 		log.Infof("note uuid: %s\n", info.UUID)
 		log.Infof("created at: %s\n", time.Unix(info.AddedOn, 0).Format("Jan 2, 2006 3:04pm (MST)"))
 		if info.EditedOn != 0 {
 			log.Infof("updated at: %s\n", time.Unix(info.EditedOn, 0).Format("Jan 2, 2006 3:04pm (MST)"))
 		}
+		tags, err := core.GetNoteTags(db, info.UUID)
+		if err != nil {
+			return errors.Wrap(err, "getting tags")
+		}
+		if len(tags) > 0 {
+			log.Infof("tags: %s\n", strings.Join(tags, ", "))
+		}
 		fmt.Printf("\n------------------------content------------------------\n")
 		fmt.Printf("%s", info.Content)
 		fmt.Printf("\n-------------------------------------------------------\n")
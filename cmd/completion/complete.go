@@ -0,0 +1,324 @@
+package completion
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// CompleteCmdName is the name of the hidden command called by the completion
+// scripts
+const CompleteCmdName = "__complete"
+
+// IsCompleting returns true if the arguments of the program run the complete
+// command
+func IsCompleting(args []string) bool {
+	return len(args) > 1 && args[1] == CompleteCmdName
+}
+
+// candidate is a word suggested for completion
+type candidate struct {
+	value       string
+	description string
+}
+
+// argKind is the kind of a positional argument
+type argKind int
+
+const (
+	bookArg argKind = iota
+	noteArg
+	shellArg
+)
+
+// positionalArgs are the kinds of the positional arguments of the commands
+var positionalArgs = map[string][]argKind{
+	"dnote add":        {bookArg},
+	"dnote view":       {bookArg, noteArg},
+	"dnote ls":         {bookArg, noteArg},
+	"dnote cat":        {bookArg, noteArg},
+	"dnote edit":       {bookArg, noteArg},
+	"dnote remove":     {bookArg, noteArg},
+	"dnote history":    {bookArg, noteArg},
+	"dnote resolve":    {bookArg, noteArg},
+	"dnote publish":    {bookArg, noteArg},
+	"dnote unpublish":  {bookArg, noteArg},
+	"dnote mv":         {bookArg, noteArg, bookArg},
+	"dnote completion": {shellArg},
+}
+
+// NewCompleteCmd returns a new hidden command printing the candidates for the
+// last argument, given the arguments typed so far
+func NewCompleteCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                CompleteCmdName,
+		Hidden:             true,
+		DisableFlagParsing: true,
+		RunE:               newCompleteRun(ctx),
+	}
+
+	return cmd
+}
+
+func newCompleteRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		candidates, err := complete(ctx, cmd.Root(), args)
+		if err != nil {
+			return errors.Wrap(err, "completing")
+		}
+
+		for _, c := range candidates {
+			if c.description == "" {
+				fmt.Println(c.value)
+			} else {
+				fmt.Printf("%s\t%s\n", c.value, c.description)
+			}
+		}
+
+		return nil
+	}
+}
+
+// complete returns the candidates for the last word. The words are the
+// arguments of the program typed so far, the last one being partial.
+func complete(ctx infra.DnoteCtx, root *cobra.Command, words []string) ([]candidate, error) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	partial := words[len(words)-1]
+	typed := words[:len(words)-1]
+
+	cmd, rest, err := root.Find(typed)
+	if err != nil {
+		return nil, nil
+	}
+
+	if len(typed) > 0 {
+		if f := lookupFlag(cmd, typed[len(typed)-1]); f != nil && needsValue(f, typed[len(typed)-1]) {
+			ret, err := completeFlagValue(ctx, f)
+			if err != nil {
+				return nil, err
+			}
+
+			return filterPrefix(ret, partial), nil
+		}
+	}
+
+	if strings.HasPrefix(partial, "-") {
+		return filterPrefix(completeFlags(cmd), partial), nil
+	}
+
+	args := positional(cmd, rest)
+	if cmd.HasAvailableSubCommands() && len(args) == 0 {
+		return filterPrefix(completeCommands(cmd), partial), nil
+	}
+
+	kinds := positionalArgs[cmd.CommandPath()]
+	if len(args) >= len(kinds) {
+		return nil, nil
+	}
+
+	var ret []candidate
+	switch kinds[len(args)] {
+	case bookArg:
+		ret, err = getBooks(ctx.DB)
+	case noteArg:
+		ret, err = getNotes(ctx.DB, args[len(args)-1])
+	case shellArg:
+		for shell := range scripts {
+			ret = append(ret, candidate{value: shell})
+		}
+		sort.Slice(ret, func(i, j int) bool { return ret[i].value < ret[j].value })
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return filterPrefix(ret, partial), nil
+}
+
+// filterPrefix returns the candidates starting with the prefix
+func filterPrefix(candidates []candidate, prefix string) []candidate {
+	ret := []candidate{}
+	for _, c := range candidates {
+		if strings.HasPrefix(c.value, prefix) {
+			ret = append(ret, c)
+		}
+	}
+
+	return ret
+}
+
+// lookupFlag returns the flag of the command given by the word, or nil if the
+// word is not a flag
+func lookupFlag(cmd *cobra.Command, word string) *pflag.Flag {
+	var f *pflag.Flag
+
+	if strings.HasPrefix(word, "--") {
+		name := strings.SplitN(strings.TrimPrefix(word, "--"), "=", 2)[0]
+		if f = cmd.Flags().Lookup(name); f == nil {
+			f = cmd.InheritedFlags().Lookup(name)
+		}
+	} else if strings.HasPrefix(word, "-") && len(word) == 2 {
+		if f = cmd.Flags().ShorthandLookup(word[1:]); f == nil {
+			f = cmd.InheritedFlags().ShorthandLookup(word[1:])
+		}
+	}
+
+	return f
+}
+
+// needsValue returns true if the next word is the value of the flag
+func needsValue(f *pflag.Flag, word string) bool {
+	return f.NoOptDefVal == "" && !strings.Contains(word, "=")
+}
+
+// positional returns the positional arguments among the arguments of the command
+func positional(cmd *cobra.Command, args []string) []string {
+	ret := []string{}
+
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			ret = append(ret, args[i])
+			continue
+		}
+
+		if f := lookupFlag(cmd, args[i]); f != nil && needsValue(f, args[i]) {
+			i++
+		}
+	}
+
+	return ret
+}
+
+// completeCommands returns the subcommands of the command
+func completeCommands(cmd *cobra.Command) []candidate {
+	ret := []candidate{}
+	for _, c := range cmd.Commands() {
+		if !c.IsAvailableCommand() {
+			continue
+		}
+
+		ret = append(ret, candidate{value: c.Name(), description: c.Short})
+	}
+
+	return ret
+}
+
+// completeFlags returns the flags of the command
+func completeFlags(cmd *cobra.Command) []candidate {
+	ret := []candidate{}
+
+	add := func(f *pflag.Flag) {
+		if f.Hidden {
+			return
+		}
+
+		ret = append(ret, candidate{value: "--" + f.Name, description: f.Usage})
+	}
+	cmd.Flags().VisitAll(add)
+	cmd.InheritedFlags().VisitAll(add)
+
+	return ret
+}
+
+// completeFlagValue returns the values of the flag
+func completeFlagValue(ctx infra.DnoteCtx, f *pflag.Flag) ([]candidate, error) {
+	switch f.Name {
+	case "book":
+		return getBooks(ctx.DB)
+	case "tag", "untag":
+		return getTags(ctx.DB)
+	case "output":
+		return []candidate{{value: "text"}, {value: "json"}, {value: "yaml"}, {value: "tsv"}}, nil
+	}
+
+	return nil, nil
+}
+
+// getBooks returns the labels of the books
+func getBooks(db *sql.DB) ([]candidate, error) {
+	rows, err := db.Query(`SELECT books.label, count(notes.uuid)
+		FROM books
+		INNER JOIN notes ON notes.book_uuid = books.uuid
+		GROUP BY books.uuid
+		ORDER BY books.label ASC`)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	ret := []candidate{}
+	for rows.Next() {
+		var label string
+		var count int
+		if err := rows.Scan(&label, &count); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		description := fmt.Sprintf("%d notes", count)
+		if count == 1 {
+			description = "1 note"
+		}
+
+		ret = append(ret, candidate{value: label, description: description})
+	}
+
+	return ret, nil
+}
+
+// getNotes returns the indices of the notes in the book with their excerpts
+func getNotes(db *sql.DB, bookLabel string) ([]candidate, error) {
+	rows, err := db.Query(`SELECT notes.id, notes.content
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE books.label = ?
+		ORDER BY notes.id ASC`, bookLabel)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []candidate{}
+	for rows.Next() {
+		var id int
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		description := strings.Replace(core.Excerpt(content), "\t", " ", -1)
+		ret = append(ret, candidate{value: strconv.Itoa(id), description: description})
+	}
+
+	return ret, nil
+}
+
+// getTags returns the labels of the tags
+func getTags(db *sql.DB) ([]candidate, error) {
+	rows, err := db.Query("SELECT label FROM tags ORDER BY label ASC")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying tags")
+	}
+	defer rows.Close()
+
+	ret := []candidate{}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, candidate{value: label})
+	}
+
+	return ret, nil
+}
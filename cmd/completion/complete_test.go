@@ -0,0 +1,138 @@
+package completion
+
+import (
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/spf13/cobra"
+)
+
+func newTestRoot() *cobra.Command {
+	run := func(cmd *cobra.Command, args []string) {}
+
+	root := &cobra.Command{Use: "dnote"}
+	root.PersistentFlags().String("output", "text", "The output format")
+
+	view := &cobra.Command{Use: "view", Short: "List books, notes or view a content", Run: run}
+	edit := &cobra.Command{Use: "edit", Aliases: []string{"e"}, Short: "Edit a note or a book", Run: run}
+	edit.Flags().StringP("book", "b", "", "The book name to edit")
+	edit.Flags().StringSliceP("tag", "t", []string{}, "The tags to add to the note")
+	edit.Flags().Bool("dry", false, "A boolean flag")
+	mv := &cobra.Command{Use: "mv", Short: "Move a note to another book", Run: run}
+	hidden := &cobra.Command{Use: CompleteCmdName, Hidden: true, Run: run}
+	completion := &cobra.Command{Use: "completion", Short: "Print the shell completion script", Run: run}
+
+	root.AddCommand(view, edit, mv, hidden, completion)
+
+	return root
+}
+
+func values(candidates []candidate) []string {
+	ret := []string{}
+	for _, c := range candidates {
+		ret = append(ret, c.value)
+	}
+
+	return ret
+}
+
+func TestComplete(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../../tmp", "../../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.MustExec(t, "setting up a tag", ctx.DB, "INSERT INTO tags (uuid, label) VALUES (?, ?)", "tag-uuid", "es6")
+
+	testCases := []struct {
+		name     string
+		words    []string
+		expected []string
+	}{
+		{
+			name:     "commands",
+			words:    []string{""},
+			expected: []string{"completion", "edit", "mv", "view"},
+		},
+		{
+			name:     "command prefix",
+			words:    []string{"e"},
+			expected: []string{"edit"},
+		},
+		{
+			name:     "book",
+			words:    []string{"view", "li"},
+			expected: []string{"linux"},
+		},
+		{
+			name:     "note",
+			words:    []string{"edit", "js", ""},
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "note with an alias and flags",
+			words:    []string{"e", "--dry", "-t", "es6", "js", ""},
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "destination book",
+			words:    []string{"mv", "js", "1", ""},
+			expected: []string{"js", "linux"},
+		},
+		{
+			name:     "too many arguments",
+			words:    []string{"view", "js", "1", ""},
+			expected: []string{},
+		},
+		{
+			name:     "flags",
+			words:    []string{"edit", "--"},
+			expected: []string{"--book", "--dry", "--tag", "--output"},
+		},
+		{
+			name:     "book flag",
+			words:    []string{"edit", "-b", "j"},
+			expected: []string{"js"},
+		},
+		{
+			name:     "tag flag",
+			words:    []string{"edit", "js", "1", "--tag", ""},
+			expected: []string{"es6"},
+		},
+		{
+			name:     "output flag",
+			words:    []string{"view", "--output", "y"},
+			expected: []string{"yaml"},
+		},
+		{
+			name:     "shell",
+			words:    []string{"completion", ""},
+			expected: []string{"bash", "fish", "zsh"},
+		},
+		{
+			name:     "unknown command",
+			words:    []string{"foo", ""},
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			candidates, err := complete(ctx, newTestRoot(), tc.words)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testutils.AssertDeepEqual(t, values(candidates), tc.expected, "candidates mismatch")
+		})
+	}
+
+	t.Run("description", func(t *testing.T) {
+		candidates, err := complete(ctx, newTestRoot(), []string{"view", "linux", ""})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testutils.AssertDeepEqual(t, candidates, []candidate{{value: "3", description: "wc -l to count words"}}, "candidates mismatch")
+	})
+}
@@ -0,0 +1,101 @@
+package completion
+
+import (
+	"fmt"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Enable the completion in the current bash session
+ source <(dnote completion bash)
+
+ * Enable the completion for zsh
+ dnote completion zsh > "${fpath[1]}/_dnote"
+
+ * Enable the completion for fish
+ dnote completion fish > ~/.config/fish/completions/dnote.fish`
+
+// scripts are the completion scripts for the shells. They get the candidates
+// from the hidden complete command, one per line with an optional description
+// after a tab.
+var scripts = map[string]string{
+	"bash": `# bash completion for dnote
+
+_dnote() {
+    local IFS=$'\n'
+    COMPREPLY=($(dnote __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1))
+}
+
+complete -F _dnote dnote
+`,
+	"zsh": `#compdef dnote
+
+_dnote() {
+    local -a candidates
+    local line value
+    for line in "${(@f)$(dnote __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+        [[ -z "$line" ]] && continue
+        value="${${line%%$'\t'*}//:/\\:}"
+        if [[ "$line" == *$'\t'* ]]; then
+            candidates+=("$value:${line#*$'\t'}")
+        else
+            candidates+=("$value")
+        fi
+    done
+
+    _describe 'dnote' candidates
+}
+
+if [[ "$funcstack[1]" == "_dnote" ]]; then
+    _dnote "$@"
+else
+    compdef _dnote dnote
+fi
+`,
+	"fish": `# fish completion for dnote
+
+function __dnote_complete
+    set -l args (commandline -opc)
+    set -e args[1]
+    dnote __complete $args (commandline -ct) 2>/dev/null
+end
+
+complete -c dnote -f -a '(__dnote_complete)'
+`,
+}
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of argument")
+	}
+	if _, ok := scripts[args[0]]; !ok {
+		return errors.Errorf("unsupported shell '%s'. use one of bash, zsh and fish", args[0])
+	}
+
+	return nil
+}
+
+// NewCmd returns a new completion command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "completion <bash|zsh|fish>",
+		Short:   "Print the shell completion script",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		fmt.Print(scripts[args[0]])
+
+		return nil
+	}
+}
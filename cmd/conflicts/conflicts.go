@@ -0,0 +1,62 @@
+package conflicts
+
+import (
+	"github.com/dnote/cli/cmd/ls"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * List the notes that were edited on another machine while being edited locally
+ dnote conflicts
+ `
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new conflicts command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "conflicts",
+		Short:   "List the unresolved sync conflicts",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		conflicts, err := core.GetConflicts(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "getting conflicts")
+		}
+
+		if len(conflicts) == 0 {
+			log.Infof("no conflicts\n")
+			return nil
+		}
+
+		log.Infof("%d conflicts. resolve them with `dnote resolve <book> <index>`\n", len(conflicts))
+		for _, c := range conflicts {
+			ours, _ := ls.FormatContent(c.Ours)
+			theirs, _ := ls.FormatContent(c.Theirs)
+
+			log.Plainf("%s %s\n", log.SprintfBlue(c.BookLabel), log.SprintfYellow("(%d)", c.NoteID))
+			log.Plainf("  ours:   %s\n", ours)
+			log.Plainf("  theirs: %s\n", theirs)
+		}
+
+		return nil
+	}
+}
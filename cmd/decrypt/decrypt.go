@@ -0,0 +1,57 @@
+package decrypt
+
+import (
+	"os"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Store the database without encryption
+ dnote decrypt`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new decrypt command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "decrypt",
+		Short:   "Store the database on this machine without encryption",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if ctx.Store == nil {
+			return errors.New("the database is not encrypted")
+		}
+
+		if err := infra.WriteDB(ctx.DB, infra.GetDBPath(ctx.DnoteDir)); err != nil {
+			return errors.Wrap(err, "writing the database")
+		}
+
+		ctx.Store.Discard()
+		if err := os.Remove(ctx.Store.Path); err != nil {
+			return errors.Wrap(err, "removing the encrypted database")
+		}
+
+		log.Success("decrypted the database\n")
+
+		return nil
+	}
+}
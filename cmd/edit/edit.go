@@ -1,25 +1,44 @@
 package edit
 
 import (
-	"database/sql"
 	"io/ioutil"
+	"strings"
 	"time"
 
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
 	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/output"
+	"github.com/dnote/cli/picker"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var newContent string
+var tags []string
+var untags []string
+var targetBookName string
+var newName string
 
 var example = `
   * Edit the note by index in a book
   dnote edit js 3
 
+  * Edit the note by the id shown by "dnote view"
+  dnote edit 4f2a
+
+  * Pick the note to edit in a book, or in all books
+  dnote edit js
+  dnote edit
+
 	* Skip the prompt by providing new content directly
-	dnote edit js 3 -c "new content"`
+	dnote edit js 3 -c "new content"
+
+	* Add and remove tags without changing the content
+	dnote edit js 3 -t es6 --untag es5
+
+	* Rename a book
+	dnote edit --book js --name javascript`
 
 // NewCmd returns a new edit command
 func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
@@ -34,12 +53,27 @@ func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
 
 	f := cmd.Flags()
 	f.StringVarP(&newContent, "content", "c", "", "The new content for the note")
+	f.StringSliceVarP(&tags, "tag", "t", []string{}, "The tags to add to the note")
+	f.StringSliceVar(&untags, "untag", []string{}, "The tags to remove from the note")
+	f.StringVarP(&targetBookName, "book", "b", "", "The book name to edit")
+	f.StringVarP(&newName, "name", "n", "", "The new name for the book")
 
 	return cmd
 }
 
 func preRun(cmd *cobra.Command, args []string) error {
-	if len(args) != 2 {
+	if targetBookName != "" {
+		if len(args) != 0 {
+			return errors.New("Incorrect number of argument")
+		}
+		if newName == "" {
+			return errors.New("Missing the new name for the book")
+		}
+
+		return nil
+	}
+
+	if len(args) > 2 {
 		return errors.New("Incorrect number of argument")
 	}
 
@@ -48,67 +82,165 @@ func preRun(cmd *cobra.Command, args []string) error {
 
 func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
-		db := ctx.DB
-		bookLabel := args[0]
-		noteID := args[1]
+		if targetBookName != "" {
+			if err := renameBook(ctx, targetBookName, newName); err != nil {
+				return errors.Wrap(err, "renaming the book")
+			}
 
-		bookUUID, err := core.GetBookUUID(ctx, bookLabel)
-		if err != nil {
-			return errors.Wrap(err, "finding book uuid")
+			return nil
 		}
 
-		var noteUUID, oldContent string
-		err = db.QueryRow("SELECT uuid, content FROM notes WHERE id = ? AND book_uuid = ?", noteID, bookUUID).Scan(&noteUUID, &oldContent)
-		if err == sql.ErrNoRows {
-			return errors.Errorf("note %s not found in the book '%s'", noteID, bookLabel)
+		db := ctx.DB
+
+		note, err := picker.FindNote(ctx, args)
+		if errors.Cause(err) == picker.ErrCancelled {
+			log.Warnf("aborted by user\n")
+			return nil
 		} else if err != nil {
-			return errors.Wrap(err, "querying the book")
+			return err
 		}
+		noteUUID, oldContent := note.UUID, note.Content
 
-		if newContent == "" {
-			fpath := core.GetDnoteTmpContentPath(ctx)
+		tagOnly := newContent == "" && (len(tags) > 0 || len(untags) > 0)
+		if tagOnly {
+			newContent = oldContent
+		}
 
-			e := ioutil.WriteFile(fpath, []byte(oldContent), 0644)
-			if e != nil {
-				return errors.Wrap(e, "preparing tmp content file")
+		if newContent == "" {
+			newContent, err = EditContent(ctx, oldContent)
+			if err != nil {
+				return errors.Wrap(err, "getting editor input")
 			}
+		}
 
-			e = core.GetEditorInput(ctx, fpath, &newContent)
-			if e != nil {
-				return errors.Wrap(err, "getting editor input")
+		change, err := WriteNote(ctx, note, newContent, tags, untags)
+		if err != nil {
+			return err
+		}
+
+		if !output.IsText() {
+			note, err := output.GetNote(db, noteUUID)
+			if err != nil {
+				return errors.Wrap(err, "getting the note")
 			}
+
+			return output.Print(note)
 		}
 
-		if oldContent == newContent {
-			return errors.New("Nothing changed")
+		if change.TagsChanged {
+			log.Printf("tags: %s\n", strings.Join(change.Tags, ", "))
 		}
+		log.Printf("new content: %s\n", change.Content)
+		log.Success("edited the note\n")
 
-		ts := time.Now().Unix()
-		newContent = core.SanitizeContent(newContent)
+		return nil
+	}
+}
 
-		tx, err := db.Begin()
-		if err != nil {
-			return errors.Wrap(err, "beginning a transaction")
+// EditContent launches the editor to edit the content and returns the result
+func EditContent(ctx infra.DnoteCtx, content string) (string, error) {
+	fpath := core.GetDnoteTmpContentPath(ctx)
+	if err := ioutil.WriteFile(fpath, []byte(content), 0644); err != nil {
+		return "", errors.Wrap(err, "preparing tmp content file")
+	}
+
+	var ret string
+	if err := core.GetEditorInput(ctx, fpath, &ret); err != nil {
+		return "", errors.Wrap(err, "getting editor input")
+	}
+
+	return ret, nil
+}
+
+// Change is the result of editing a note
+type Change struct {
+	Content     string
+	Tags        []string
+	TagsChanged bool
+}
+
+// WriteNote replaces the content of the note, adds and removes the tags, and
+// logs the actions. The hashtags in the content are kept in sync with the tags.
+func WriteNote(ctx infra.DnoteCtx, note core.NoteRef, content string, addTags, removeTags []string) (Change, error) {
+	db := ctx.DB
+
+	oldTags, err := core.GetNoteTags(db, note.UUID)
+	if err != nil {
+		return Change{}, errors.Wrap(err, "getting tags")
+	}
+
+	// Hashtags removed from the content are no longer the tags of the note
+	newTags := core.SubtractTags(core.MergeTags(
+		core.SubtractTags(oldTags, core.ExtractHashtags(note.Content)),
+		core.ExtractHashtags(content),
+		addTags,
+	), removeTags)
+
+	contentChanged := note.Content != content
+	tagsChanged := strings.Join(oldTags, ",") != strings.Join(newTags, ",")
+	if !contentChanged && !tagsChanged {
+		return Change{}, errors.New("Nothing changed")
+	}
+
+	ts := time.Now().Unix()
+	content = core.SanitizeContent(content)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Change{}, errors.Wrap(err, "beginning a transaction")
+	}
+
+	if contentChanged {
+		if err = core.UpdateNoteContent(tx, note.UUID, note.BookLabel, content, ts); err != nil {
+			tx.Rollback()
+			return Change{}, errors.Wrap(err, "updating the note")
 		}
-		_, err = tx.Exec(`UPDATE notes
-			SET content = ?, edited_on = ?
-			WHERE id = ? AND book_uuid = ?`, newContent, ts, noteID, bookUUID)
-		if err != nil {
+	}
+
+	if tagsChanged {
+		if err = core.SetNoteTags(tx, note.UUID, newTags); err != nil {
 			tx.Rollback()
-			return errors.Wrap(err, "updating the note")
+			return Change{}, errors.Wrap(err, "updating the tags")
 		}
 
-		err = core.LogActionEditNote(tx, noteUUID, bookLabel, newContent, ts)
-		if err != nil {
+		if err = core.LogActionSetNoteTags(tx, note.UUID, newTags, ts); err != nil {
 			tx.Rollback()
-			return errors.Wrap(err, "logging an action")
+			return Change{}, errors.Wrap(err, "logging an action")
 		}
+	}
 
-		tx.Commit()
+	tx.Commit()
 
-		log.Printf("new content: %s\n", newContent)
-		log.Success("edited the note\n")
+	return Change{Content: content, Tags: newTags, TagsChanged: tagsChanged}, nil
+}
 
-		return nil
+func renameBook(ctx infra.DnoteCtx, oldLabel, newLabel string) error {
+	if oldLabel == newLabel {
+		return errors.New("Nothing changed")
+	}
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if err := core.RenameBook(tx, oldLabel, newLabel, time.Now().Unix()); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "updating the book")
 	}
+
+	tx.Commit()
+
+	if !output.IsText() {
+		var count int
+		if err := ctx.DB.QueryRow("SELECT count(*) FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ?", newLabel).Scan(&count); err != nil {
+			return errors.Wrap(err, "counting notes")
+		}
+
+		return output.Print(output.Book{Label: newLabel, NoteCount: count})
+	}
+
+	log.Successf("renamed %s to %s\n", oldLabel, newLabel)
+
+	return nil
 }
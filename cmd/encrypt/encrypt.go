@@ -0,0 +1,69 @@
+package encrypt
+
+import (
+	"os"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/term"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Encrypt the database with a passphrase
+ dnote encrypt
+
+ * Run a command without the passphrase prompt
+ DNOTE_PASSPHRASE=secret dnote view`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new encrypt command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "encrypt",
+		Short:   "Encrypt the database on this machine with a passphrase",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if ctx.Store != nil {
+			return errors.New("the database is already encrypted")
+		}
+
+		passphrase, err := term.AskPassphrase("passphrase", true)
+		if err != nil {
+			return errors.Wrap(err, "getting the passphrase")
+		}
+
+		if err := infra.EncryptDB(ctx.DB, infra.GetEncryptedDBPath(ctx.DnoteDir), passphrase); err != nil {
+			return errors.Wrap(err, "encrypting the database")
+		}
+
+		dbPath := infra.GetDBPath(ctx.DnoteDir)
+		for _, path := range []string{dbPath, dbPath + "-journal", dbPath + "-wal", dbPath + "-shm"} {
+			if err := os.RemoveAll(path); err != nil {
+				return errors.Wrapf(err, "removing %s", path)
+			}
+		}
+
+		log.Successf("encrypted the database. the passphrase is asked when running dnote, unless set in DNOTE_PASSPHRASE\n")
+		log.Warnf("the unencrypted database has been deleted, but its contents may still be recoverable from the disk until they are overwritten. use full disk encryption to protect them\n")
+
+		return nil
+	}
+}
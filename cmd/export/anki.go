@@ -0,0 +1,136 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/dnote/cli/cmd/ls"
+	"github.com/pkg/errors"
+)
+
+// clozeRe matches the cloze markers in a note such as '{{answer}}'. Markers
+// already numbered the way Anki does, such as '{{c2::answer}}', are matched too.
+var clozeRe = regexp.MustCompile(`\{\{(?:c\d+::)?(.+?)\}\}`)
+
+// numberedClozeRe matches the cloze markers numbered the way Anki does
+var numberedClozeRe = regexp.MustCompile(`^\{\{c\d+::`)
+
+// ankiHeader returns the header of a deck file telling Anki how to import the
+// columns. The uuid of a note is used as its guid so that exporting again
+// updates the cards imported before instead of duplicating them.
+func ankiHeader(notetype string) string {
+	return fmt.Sprintf(`#separator:tab
+#html:true
+#notetype:%s
+#guid column:1
+#deck column:4
+#tags column:5
+`, notetype)
+}
+
+// splitCard splits the content of a note into the front and the back of a
+// card. The first line is the front and the rest is the back.
+func splitCard(content string) (string, string) {
+	front, isExcerpt := ls.FormatContent(content)
+	if !isExcerpt {
+		return front, ""
+	}
+
+	back := content[strings.Index(content, "\n")+1:]
+
+	return front, strings.TrimSpace(back)
+}
+
+// toCloze numbers the cloze markers in the content the way Anki does, each
+// marker making a card. It returns false if the content has no markers.
+func toCloze(content string) (string, bool) {
+	if !clozeRe.MatchString(content) {
+		return content, false
+	}
+
+	var n int
+	ret := clozeRe.ReplaceAllStringFunc(content, func(m string) string {
+		if numberedClozeRe.MatchString(m) {
+			return m
+		}
+
+		n++
+		return fmt.Sprintf("{{c%d::%s}}", n, clozeRe.FindStringSubmatch(m)[1])
+	})
+
+	return ret, true
+}
+
+// ankiField escapes the text to be a field of a deck file, in which the fields
+// are HTML separated by tabs
+func ankiField(s string) string {
+	s = html.EscapeString(s)
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\n", "<br>", -1)
+	s = strings.Replace(s, "\t", "&nbsp;&nbsp;&nbsp;&nbsp;", -1)
+
+	return s
+}
+
+// ankiTags returns the tags field. Anki separates tags with spaces.
+func ankiTags(tags []string) string {
+	ret := []string{}
+	for _, tag := range tags {
+		ret = append(ret, strings.Replace(tag, " ", "_", -1))
+	}
+
+	return strings.Join(ret, " ")
+}
+
+// renderAnki renders the notes in the archive as a deck file to be imported in
+// Anki, with a deck for each book. If cloze is true, the notes are made into
+// cloze cards and the notes without cloze markers are left out. It returns the
+// number of the notes left out.
+func renderAnki(archive Archive, cloze bool) ([]byte, int) {
+	var buf bytes.Buffer
+	var skipped int
+
+	notetype := "Basic"
+	if cloze {
+		notetype = "Cloze"
+	}
+	buf.WriteString(ankiHeader(notetype))
+
+	for _, book := range archive.Books {
+		for _, note := range book.Notes {
+			var front, back string
+			if cloze {
+				text, ok := toCloze(note.Content)
+				if !ok {
+					skipped++
+					continue
+				}
+
+				front = strings.TrimSpace(text)
+			} else {
+				front, back = splitCard(note.Content)
+			}
+
+			fields := []string{note.UUID, ankiField(front), ankiField(back), ankiField(book.Label), ankiTags(note.Tags)}
+			buf.WriteString(strings.Join(fields, "\t"))
+			buf.WriteString("\n")
+		}
+	}
+
+	return buf.Bytes(), skipped
+}
+
+// writeAnki writes the deck file to be imported in Anki to the given path. It
+// returns the number of the notes left out.
+func writeAnki(archive Archive, path string, cloze bool) (int, error) {
+	b, skipped := renderAnki(archive, cloze)
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return 0, errors.Wrap(err, "writing the file")
+	}
+
+	return skipped, nil
+}
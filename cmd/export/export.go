@@ -0,0 +1,304 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var format string
+var out string
+var bookName string
+var cloze bool
+
+var example = `
+  * Export all notes to Markdown files, one per book
+  dnote export --format markdown --out ./notes
+
+  * Back up all notes to a JSON file
+  dnote export --format json --out ./dnote.json
+
+  * Export a book to an HTML file
+  dnote export --format html --book js --out ./notes
+
+  * Export all notes to a file to be imported in Anki
+  dnote export --format anki --out ./dnote.txt
+
+  * Export the notes with {{cloze}} markers as cloze cards
+  dnote export --format anki --cloze --out ./cloze.txt`
+
+// ArchiveVersion is the version of the JSON archive format
+const ArchiveVersion = 1
+
+// Archive is a JSON export of notes and books
+type Archive struct {
+	Version    int           `json:"version"`
+	ExportedOn int64         `json:"exported_on"`
+	Books      []ArchiveBook `json:"books"`
+}
+
+// ArchiveBook is a book in an archive
+type ArchiveBook struct {
+	UUID  string        `json:"uuid"`
+	Label string        `json:"label"`
+	Notes []ArchiveNote `json:"notes"`
+}
+
+// ArchiveNote is a note in an archive
+type ArchiveNote struct {
+	UUID     string   `json:"uuid"`
+	Content  string   `json:"content"`
+	AddedOn  int64    `json:"added_on"`
+	EditedOn int64    `json:"edited_on"`
+	Public   bool     `json:"public"`
+	Tags     []string `json:"tags"`
+}
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	switch format {
+	case "markdown", "md", "json", "html", "anki":
+	default:
+		return errors.Errorf("Unsupported format '%s'", format)
+	}
+	if cloze && format != "anki" {
+		return errors.New("--cloze is only supported by the anki format")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new export command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "export",
+		Short:   "Export notes to files",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&format, "format", "f", "markdown", "The format of the export (markdown, json, html, anki)")
+	f.StringVarP(&out, "out", "o", "", "The directory or the file to write the export to")
+	f.StringVarP(&bookName, "book", "b", "", "The book name to export")
+	f.BoolVar(&cloze, "cloze", false, "Make the notes into cloze cards by their {{...}} markers in the anki format")
+
+	return cmd
+}
+
+// GetArchive returns the archive of all notes, or the notes in the book with the
+// given label if it is not empty. Books are ordered by label and notes are in
+// the order they were added.
+func GetArchive(ctx infra.DnoteCtx, bookLabel string) (Archive, error) {
+	db := ctx.DB
+	ret := Archive{
+		Version:    ArchiveVersion,
+		ExportedOn: time.Now().Unix(),
+		Books:      []ArchiveBook{},
+	}
+
+	queryTmpl := "SELECT uuid, label FROM books"
+	args := []interface{}{}
+	if bookLabel != "" {
+		if _, err := core.GetBookUUID(ctx, bookLabel); err != nil {
+			return ret, errors.Wrap(err, "finding the book")
+		}
+
+		queryTmpl = fmt.Sprintf("%s WHERE label = ?", queryTmpl)
+		args = append(args, bookLabel)
+	}
+	queryTmpl = fmt.Sprintf("%s ORDER BY label ASC", queryTmpl)
+
+	rows, err := db.Query(queryTmpl, args...)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b ArchiveBook
+		if err := rows.Scan(&b.UUID, &b.Label); err != nil {
+			return ret, errors.Wrap(err, "scanning a book")
+		}
+
+		ret.Books = append(ret.Books, b)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning books")
+	}
+
+	for i := range ret.Books {
+		notes, err := getArchiveNotes(ctx, ret.Books[i].UUID)
+		if err != nil {
+			return ret, errors.Wrapf(err, "getting notes in '%s'", ret.Books[i].Label)
+		}
+
+		ret.Books[i].Notes = notes
+	}
+
+	return ret, nil
+}
+
+func getArchiveNotes(ctx infra.DnoteCtx, bookUUID string) ([]ArchiveNote, error) {
+	db := ctx.DB
+	ret := []ArchiveNote{}
+
+	rows, err := db.Query(`SELECT uuid, content, added_on, edited_on, public
+		FROM notes
+		WHERE book_uuid = ?
+		ORDER BY added_on ASC, id ASC`, bookUUID)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n ArchiveNote
+		if err := rows.Scan(&n.UUID, &n.Content, &n.AddedOn, &n.EditedOn, &n.Public); err != nil {
+			return ret, errors.Wrap(err, "scanning a note")
+		}
+
+		ret = append(ret, n)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning notes")
+	}
+
+	for i := range ret {
+		tags, err := core.GetNoteTags(db, ret[i].UUID)
+		if err != nil {
+			return ret, errors.Wrap(err, "getting tags")
+		}
+
+		ret[i].Tags = tags
+	}
+
+	return ret, nil
+}
+
+// ReadArchive reads the JSON archive at the given path
+func ReadArchive(path string) (Archive, error) {
+	var ret Archive
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ret, errors.Wrap(err, "reading the file")
+	}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return ret, errors.Wrap(err, "unmarshalling the archive")
+	}
+	if ret.Version != ArchiveVersion {
+		return ret, errors.Errorf("unsupported archive version %d", ret.Version)
+	}
+
+	return ret, nil
+}
+
+func writeJSON(archive Archive, path string) error {
+	b, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling the archive")
+	}
+
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return errors.Wrap(err, "writing the file")
+	}
+
+	return nil
+}
+
+// bookFilename returns a name of the file for the book that is safe to use on
+// any platform
+func bookFilename(label, ext string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+
+		return r
+	}, label)
+
+	return fmt.Sprintf("%s.%s", name, ext)
+}
+
+// getOutPath returns the path to write the export to. If out is a directory, a
+// file named after the given default name is written in it.
+func getOutPath(out, defaultName string) string {
+	if out == "" {
+		return defaultName
+	}
+
+	if info, err := os.Stat(out); err == nil && info.IsDir() {
+		return filepath.Join(out, defaultName)
+	}
+
+	return out
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		archive, err := GetArchive(ctx, bookName)
+		if err != nil {
+			return errors.Wrap(err, "getting notes")
+		}
+
+		var path string
+		var noteCount int
+		for _, book := range archive.Books {
+			noteCount += len(book.Notes)
+		}
+
+		switch format {
+		case "json":
+			path = getOutPath(out, "dnote.json")
+			if err := writeJSON(archive, path); err != nil {
+				return errors.Wrap(err, "writing JSON")
+			}
+		case "markdown", "md":
+			path = out
+			if path == "" {
+				path = "dnote"
+			}
+			if err := writeMarkdown(archive, path); err != nil {
+				return errors.Wrap(err, "writing Markdown")
+			}
+		case "html":
+			path = out
+			if path == "" {
+				path = "dnote"
+			}
+			if err := writeHTML(archive, path); err != nil {
+				return errors.Wrap(err, "writing HTML")
+			}
+		case "anki":
+			path = getOutPath(out, "dnote.txt")
+			skipped, err := writeAnki(archive, path, cloze)
+			if err != nil {
+				return errors.Wrap(err, "writing the Anki deck")
+			}
+			if skipped > 0 {
+				log.Warnf("left out %d notes without cloze markers\n", skipped)
+				noteCount -= skipped
+			}
+		}
+
+		log.Successf("exported %d notes in %d books to %s\n", noteCount, len(archive.Books), path)
+
+		return nil
+	}
+}
@@ -0,0 +1,273 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestGetArchive(t *testing.T) {
+	testCases := []struct {
+		bookLabel     string
+		expectedBooks []string
+		expectedNotes []int
+	}{
+		{
+			bookLabel:     "",
+			expectedBooks: []string{"js", "linux"},
+			expectedNotes: []int{2, 1},
+		},
+		{
+			bookLabel:     "linux",
+			expectedBooks: []string{"linux"},
+			expectedNotes: []int{1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("book %s", tc.bookLabel), func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../../tmp", "../../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+
+			// Execute
+			archive, err := GetArchive(ctx, tc.bookLabel)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting the archive"))
+			}
+
+			// Test
+			books := []string{}
+			notes := []int{}
+			for _, book := range archive.Books {
+				books = append(books, book.Label)
+				notes = append(notes, len(book.Notes))
+			}
+
+			testutils.AssertEqual(t, archive.Version, ArchiveVersion, "archive version mismatch")
+			testutils.AssertDeepEqual(t, books, tc.expectedBooks, "books mismatch")
+			testutils.AssertDeepEqual(t, notes, tc.expectedNotes, "note counts mismatch")
+		})
+	}
+}
+
+func TestWriteJSON_RoundTrip(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../../tmp", "../../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	db := ctx.DB
+	testutils.MustExec(t, "setting up tag", db, "INSERT INTO tags (uuid, label) VALUES (?, ?)", "date-tag-uuid", "date")
+	testutils.MustExec(t, "setting up note tag", db, "INSERT INTO note_tags (note_uuid, tag_uuid) VALUES (?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "date-tag-uuid")
+	testutils.MustExec(t, "publishing a note", db, "UPDATE notes SET public = ?, edited_on = ? WHERE uuid = ?", true, 1515199999, "3e065d55-6d47-42f2-a6bf-f5844130b2d2")
+
+	archive, err := GetArchive(ctx, "")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the archive"))
+	}
+
+	f, err := ioutil.TempFile("", "dnote-export")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp file"))
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	// Execute
+	if err := writeJSON(archive, f.Name()); err != nil {
+		t.Fatal(errors.Wrap(err, "writing JSON"))
+	}
+	got, err := ReadArchive(f.Name())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the archive"))
+	}
+
+	// Test
+	testutils.AssertDeepEqual(t, got, archive, "archive mismatch")
+	testutils.AssertDeepEqual(t, got.Books[0].Notes[1].Tags, []string{"date"}, "note tags mismatch")
+	testutils.AssertEqual(t, got.Books[1].Notes[0].Public, true, "note public mismatch")
+	testutils.AssertEqual(t, got.Books[1].Notes[0].EditedOn, int64(1515199999), "note edited_on mismatch")
+}
+
+func TestRenderMarkdownBook(t *testing.T) {
+	book := ArchiveBook{
+		UUID:  "js-book-uuid",
+		Label: "js",
+		Notes: []ArchiveNote{
+			{
+				UUID:    "43827b9a-c2b0-4c06-a290-97991c896653",
+				Content: "Booleans have toString()",
+				AddedOn: 1515199943,
+				Tags:    []string{},
+			},
+			{
+				UUID:     "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+				Content:  "Date object implements mathematical comparisons\n",
+				AddedOn:  1515199951,
+				EditedOn: 1515199999,
+				Public:   true,
+				Tags:     []string{"date"},
+			},
+		},
+	}
+
+	b, err := renderMarkdownBook(book)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "rendering"))
+	}
+
+	expected := `---
+book: js
+uuid: 43827b9a-c2b0-4c06-a290-97991c896653
+added_on: 1515199943
+edited_on: 0
+public: false
+---
+Booleans have toString()
+
+---
+book: js
+uuid: f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f
+added_on: 1515199951
+edited_on: 1515199999
+public: true
+tags:
+- date
+---
+Date object implements mathematical comparisons
+`
+	testutils.AssertEqual(t, string(b), expected, "markdown mismatch")
+}
+
+func TestSplitCard(t *testing.T) {
+	testCases := []struct {
+		content       string
+		expectedFront string
+		expectedBack  string
+	}{
+		{
+			content:       "Booleans have toString()",
+			expectedFront: "Booleans have toString()",
+			expectedBack:  "",
+		},
+		{
+			content:       "What does wc -l do?\ncounts lines\n",
+			expectedFront: "What does wc -l do?",
+			expectedBack:  "counts lines",
+		},
+		{
+			content:       " question \n\nfirst line\nsecond line",
+			expectedFront: "question",
+			expectedBack:  "first line\nsecond line",
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			front, back := splitCard(tc.content)
+
+			testutils.AssertEqual(t, front, tc.expectedFront, "front mismatch")
+			testutils.AssertEqual(t, back, tc.expectedBack, "back mismatch")
+		})
+	}
+}
+
+func TestToCloze(t *testing.T) {
+	testCases := []struct {
+		content    string
+		expected   string
+		expectedOK bool
+	}{
+		{
+			content:    "no markers",
+			expected:   "no markers",
+			expectedOK: false,
+		},
+		{
+			content:    "{{wc -l}} counts {{lines}}",
+			expected:   "{{c1::wc -l}} counts {{c2::lines}}",
+			expectedOK: true,
+		},
+		{
+			content:    "{{c3::kept}} and {{numbered}}",
+			expected:   "{{c3::kept}} and {{c1::numbered}}",
+			expectedOK: true,
+		},
+		{
+			content:    "empty {{}} braces",
+			expected:   "empty {{}} braces",
+			expectedOK: false,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			got, ok := toCloze(tc.content)
+
+			testutils.AssertEqual(t, got, tc.expected, "content mismatch")
+			testutils.AssertEqual(t, ok, tc.expectedOK, "ok mismatch")
+		})
+	}
+}
+
+func TestRenderAnki(t *testing.T) {
+	archive := Archive{
+		Version: ArchiveVersion,
+		Books: []ArchiveBook{
+			{
+				UUID:  "js-book-uuid",
+				Label: "js",
+				Notes: []ArchiveNote{
+					{
+						UUID:    "43827b9a-c2b0-4c06-a290-97991c896653",
+						Content: "Booleans have toString()",
+						Tags:    []string{},
+					},
+					{
+						UUID:    "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+						Content: "Compare dates\n\tuse <, > and {{getTime()}}",
+						Tags:    []string{"date", "js"},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("basic", func(t *testing.T) {
+		got, skipped := renderAnki(archive, false)
+
+		expected := `#separator:tab
+#html:true
+#notetype:Basic
+#guid column:1
+#deck column:4
+#tags column:5
+43827b9a-c2b0-4c06-a290-97991c896653	Booleans have toString()		js	
+f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f	Compare dates	use &lt;, &gt; and {{getTime()}}	js	date js
+`
+		testutils.AssertEqual(t, string(got), expected, "deck mismatch")
+		testutils.AssertEqual(t, skipped, 0, "skipped count mismatch")
+	})
+
+	t.Run("cloze", func(t *testing.T) {
+		got, skipped := renderAnki(archive, true)
+
+		expected := `#separator:tab
+#html:true
+#notetype:Cloze
+#guid column:1
+#deck column:4
+#tags column:5
+f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f	Compare dates<br>&nbsp;&nbsp;&nbsp;&nbsp;use &lt;, &gt; and {{c1::getTime()}}		js	date js
+`
+		testutils.AssertEqual(t, string(got), expected, "deck mismatch")
+		testutils.AssertEqual(t, skipped, 1, "skipped count mismatch")
+	})
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"bytes"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var htmlFuncs = template.FuncMap{
+	"filename": func(label string) string {
+		return bookFilename(label, "html")
+	},
+	"time": func(ts int64) string {
+		return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+	},
+}
+
+var indexTmpl = template.Must(template.New("index").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Dnote</title>
+</head>
+<body>
+<h1>Dnote</h1>
+<ul>
+{{- range .Books}}
+<li><a href="{{filename .Label}}">{{.Label}}</a> ({{len .Notes}})</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+var bookTmpl = template.Must(template.New("book").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Label}}</title>
+</head>
+<body>
+<h1>{{.Label}}</h1>
+{{- range .Notes}}
+<article id="{{.UUID}}" data-uuid="{{.UUID}}" data-added-on="{{.AddedOn}}" data-edited-on="{{.EditedOn}}" data-public="{{.Public}}">
+<pre>{{.Content}}</pre>
+<footer>
+<time datetime="{{time .AddedOn}}">{{time .AddedOn}}</time>
+{{- if .EditedOn}} (edited <time datetime="{{time .EditedOn}}">{{time .EditedOn}}</time>){{end}}
+{{- range .Tags}} <span class="tag">#{{.}}</span>{{end}}
+</footer>
+</article>
+{{- end}}
+</body>
+</html>
+`))
+
+// writeHTML writes an HTML page for each book in the archive, and an index
+// page linking to them, to the directory at the given path
+func writeHTML(archive Archive, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "creating the directory")
+	}
+
+	var buf bytes.Buffer
+	if err := indexTmpl.Execute(&buf, archive); err != nil {
+		return errors.Wrap(err, "rendering the index")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), buf.Bytes(), 0644); err != nil {
+		return errors.Wrap(err, "writing the index")
+	}
+
+	for _, book := range archive.Books {
+		buf.Reset()
+		if err := bookTmpl.Execute(&buf, book); err != nil {
+			return errors.Wrapf(err, "rendering '%s'", book.Label)
+		}
+
+		path := filepath.Join(dir, bookFilename(book.Label, "html"))
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return errors.Wrapf(err, "writing '%s'", path)
+		}
+	}
+
+	return nil
+}
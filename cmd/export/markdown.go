@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// FrontMatterDelimiter delimits the front-matter of a note in a Markdown export
+const FrontMatterDelimiter = "---"
+
+// FrontMatter is the metadata of a note in a Markdown export
+type FrontMatter struct {
+	Book     string   `yaml:"book"`
+	UUID     string   `yaml:"uuid"`
+	AddedOn  int64    `yaml:"added_on"`
+	EditedOn int64    `yaml:"edited_on"`
+	Public   bool     `yaml:"public"`
+	Tags     []string `yaml:"tags,omitempty"`
+}
+
+// renderMarkdownBook renders the notes in the book, each preceded by its
+// front-matter
+func renderMarkdownBook(book ArchiveBook) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for i, note := range book.Notes {
+		fm := FrontMatter{
+			Book:     book.Label,
+			UUID:     note.UUID,
+			AddedOn:  note.AddedOn,
+			EditedOn: note.EditedOn,
+			Public:   note.Public,
+			Tags:     note.Tags,
+		}
+
+		b, err := yaml.Marshal(fm)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshalling the front-matter")
+		}
+
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(FrontMatterDelimiter + "\n")
+		buf.Write(b)
+		buf.WriteString(FrontMatterDelimiter + "\n")
+		buf.WriteString(note.Content)
+		if !strings.HasSuffix(note.Content, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeMarkdown writes a Markdown file for each book in the archive to the
+// directory at the given path
+func writeMarkdown(archive Archive, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "creating the directory")
+	}
+
+	for _, book := range archive.Books {
+		b, err := renderMarkdownBook(book)
+		if err != nil {
+			return errors.Wrapf(err, "rendering '%s'", book.Label)
+		}
+
+		path := filepath.Join(dir, bookFilename(book.Label, "md"))
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			return errors.Wrapf(err, "writing '%s'", path)
+		}
+	}
+
+	return nil
+}
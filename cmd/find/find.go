@@ -0,0 +1,245 @@
+package find
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var bookName string
+var tag string
+
+var example = `
+  * Find notes by keywords
+  dnote find rpoplpush
+
+  * Find notes by a phrase
+  dnote find "merge sort"
+
+  * Find notes containing words that start with a prefix
+  dnote find partiti*
+
+  * Find notes within a book
+  dnote find "merge sort" -b algorithm
+
+  * Find notes with a tag
+  dnote find "merge sort" -t interview`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Missing search query")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new find command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "find <query>",
+		Short:   "Find notes by keywords",
+		Aliases: []string{"f"},
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&bookName, "book", "b", "", "The book name to find notes in")
+	f.StringVarP(&tag, "tag", "t", "", "The tag of the notes to find")
+
+	return cmd
+}
+
+// noteInfo is an information about the note matching the query
+type noteInfo struct {
+	ID        int
+	BookLabel string
+	Snippet   string
+}
+
+var (
+	highlightStart = "<dnotehl>"
+	highlightEnd   = "</dnotehl>"
+	highlightRe    = regexp.MustCompile(fmt.Sprintf("%s(.*?)%s", highlightStart, highlightEnd))
+)
+
+// escapeTerm quotes the given term so that it is matched literally
+func escapeTerm(term string) string {
+	return fmt.Sprintf(`"%s"`, strings.Replace(term, `"`, `""`, -1))
+}
+
+// buildQuery turns the user input into a FTS5 query. Words are matched
+// individually, text surrounded by double quotes is matched as a phrase, and a
+// trailing '*' turns a word or a phrase into a prefix query. Everything else is
+// escaped so that it is not interpreted as FTS5 syntax.
+func buildQuery(input string) string {
+	terms := []string{}
+
+	var buf []rune
+	var inPhrase bool
+
+	flush := func(prefix bool) {
+		term := string(buf)
+		buf = buf[:0]
+
+		if strings.TrimSpace(term) == "" {
+			return
+		}
+
+		ret := escapeTerm(term)
+		if prefix {
+			ret = ret + "*"
+		}
+
+		terms = append(terms, ret)
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if inPhrase {
+			if r != '"' {
+				buf = append(buf, r)
+				continue
+			}
+
+			inPhrase = false
+			prefix := i+1 < len(runes) && runes[i+1] == '*'
+			if prefix {
+				i++
+			}
+			flush(prefix)
+			continue
+		}
+
+		switch {
+		case r == '"':
+			flush(false)
+			inPhrase = true
+		case r == ' ' || r == '\t' || r == '\n':
+			flush(false)
+		case r == '*' && (i+1 == len(runes) || runes[i+1] == ' '):
+			flush(true)
+		default:
+			buf = append(buf, r)
+		}
+	}
+	flush(false)
+
+	return strings.Join(terms, " ")
+}
+
+// joinArgs joins the command line arguments into a query. An argument
+// containing spaces is treated as a phrase because the shell has already
+// stripped the quotes the user surrounded it with.
+func joinArgs(args []string) string {
+	parts := []string{}
+
+	for _, arg := range args {
+		if strings.Contains(arg, " ") && !strings.Contains(arg, `"`) {
+			arg = fmt.Sprintf(`"%s"`, arg)
+		}
+
+		parts = append(parts, arg)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// formatSnippet prepares the snippet returned by the search index to be
+// printed by replacing the highlight markers with colors
+func formatSnippet(snippet string) string {
+	ret := strings.Replace(snippet, "\r\n", " ", -1)
+	ret = strings.Replace(ret, "\n", " ", -1)
+
+	return highlightRe.ReplaceAllStringFunc(ret, func(s string) string {
+		match := highlightRe.FindStringSubmatch(s)
+		return log.SprintfRed("%s", match[1])
+	})
+}
+
+// findNotes returns the notes matching the query in the order of relevance
+func findNotes(ctx infra.DnoteCtx, query, bookLabel, tagLabel string) ([]noteInfo, error) {
+	db := ctx.DB
+
+	queryTmpl := fmt.Sprintf(`SELECT notes.id, books.label, snippet(note_fts, 0, '%s', '%s', '...', 28)
+		FROM note_fts
+		INNER JOIN notes ON notes.id = note_fts.rowid
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE note_fts MATCH ?`, highlightStart, highlightEnd)
+	args := []interface{}{buildQuery(query)}
+
+	if bookLabel != "" {
+		bookUUID, err := core.GetBookUUID(ctx, bookLabel)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding book uuid")
+		}
+
+		queryTmpl = fmt.Sprintf("%s AND notes.book_uuid = ?", queryTmpl)
+		args = append(args, bookUUID)
+	}
+
+	if tagLabel != "" {
+		queryTmpl = fmt.Sprintf(`%s AND notes.uuid IN (
+			SELECT note_tags.note_uuid FROM note_tags
+			INNER JOIN tags ON tags.uuid = note_tags.tag_uuid
+			WHERE tags.label = ?)`, queryTmpl)
+		args = append(args, core.NormalizeTag(tagLabel))
+	}
+
+	queryTmpl = fmt.Sprintf("%s ORDER BY rank", queryTmpl)
+
+	rows, err := db.Query(queryTmpl, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	infos := []noteInfo{}
+	for rows.Next() {
+		var info noteInfo
+		if err := rows.Scan(&info.ID, &info.BookLabel, &info.Snippet); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		infos = append(infos, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanning rows")
+	}
+
+	return infos, nil
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		query := joinArgs(args)
+		if buildQuery(query) == "" {
+			return errors.New("Empty search query")
+		}
+
+		infos, err := findNotes(ctx, query, bookName, tag)
+		if err != nil {
+			return errors.Wrap(err, "finding notes")
+		}
+
+		if len(infos) == 0 {
+			log.Infof("no notes matched %s\n", query)
+			return nil
+		}
+
+		for _, info := range infos {
+			log.Plainf("%s %s %s\n", log.SprintfBlue(info.BookLabel), log.SprintfYellow("(%d)", info.ID), formatSnippet(info.Snippet))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,134 @@
+package find
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestBuildQuery(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "foo",
+			expected: `"foo"`,
+		},
+		{
+			input:    "foo  bar",
+			expected: `"foo" "bar"`,
+		},
+		{
+			input:    `"foo bar"`,
+			expected: `"foo bar"`,
+		},
+		{
+			input:    `"foo bar"* baz`,
+			expected: `"foo bar"* "baz"`,
+		},
+		{
+			input:    "partiti*",
+			expected: `"partiti"*`,
+		},
+		{
+			input:    "a*b",
+			expected: `"a*b"`,
+		},
+		{
+			input:    "NOT foo:bar -baz",
+			expected: `"NOT" "foo:bar" "-baz"`,
+		},
+		{
+			input:    `"unclosed phrase`,
+			expected: `"unclosed phrase"`,
+		},
+		{
+			input:    `  "" * `,
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			testutils.AssertEqual(t, buildQuery(tc.input), tc.expected, "query mismatch")
+		})
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	testutils.AssertEqual(t, joinArgs([]string{"merge sort", "array"}), `"merge sort" array`, "result mismatch")
+	testutils.AssertEqual(t, joinArgs([]string{`"merge sort"*`}), `"merge sort"*`, "result mismatch")
+}
+
+func TestFindNotes(t *testing.T) {
+	testCases := []struct {
+		query       string
+		bookLabel   string
+		tagLabel    string
+		expectedIDs []int
+	}{
+		{
+			query:       "toString",
+			expectedIDs: []int{2},
+		},
+		{
+			query:       "objects",
+			expectedIDs: []int{1},
+		},
+		{
+			query:       `"mathematical comparisons"`,
+			expectedIDs: []int{1},
+		},
+		{
+			query:       `"comparisons mathematical"`,
+			expectedIDs: []int{},
+		},
+		{
+			query:       "co*",
+			expectedIDs: []int{1, 3},
+		},
+		{
+			query:       "co*",
+			bookLabel:   "linux",
+			expectedIDs: []int{3},
+		},
+		{
+			query:       "python",
+			expectedIDs: []int{},
+		},
+		{
+			query:       "co*",
+			tagLabel:    "Date",
+			expectedIDs: []int{1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s in %s tagged %s", tc.query, tc.bookLabel, tc.tagLabel), func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../../tmp", "../../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			testutils.MustExec(t, "setting up tag", ctx.DB, "INSERT INTO tags (uuid, label) VALUES (?, ?)", "date-tag-uuid", "date")
+			testutils.MustExec(t, "setting up note tag", ctx.DB, "INSERT INTO note_tags (note_uuid, tag_uuid) VALUES (?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "date-tag-uuid")
+
+			// Execute
+			infos, err := findNotes(ctx, tc.query, tc.bookLabel, tc.tagLabel)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "finding notes"))
+			}
+
+			// Test
+			ids := []int{}
+			for _, info := range infos {
+				ids = append(ids, info.ID)
+			}
+
+			testutils.AssertDeepEqual(t, ids, tc.expectedIDs, "note ids mismatch")
+		})
+	}
+}
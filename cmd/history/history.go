@@ -0,0 +1,112 @@
+package history
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dnote/cli/cmd/ls"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var revNumber int
+
+var example = `
+ * List the previous versions of a note
+ dnote history js 3
+
+ * List the previous versions of a note by the id shown by "dnote view"
+ dnote history 4f2a
+
+ * See the content of a previous version
+ dnote history js 3 --rev 2
+ `
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new history command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "history <book name?> <note index>",
+		Short:   "List the previous versions of a note",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.IntVarP(&revNumber, "rev", "r", 0, "The number of the revision to see")
+
+	return cmd
+}
+
+func formatTime(ts int64) string {
+	return time.Unix(ts, 0).Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		db := ctx.DB
+
+		note, err := core.FindNoteByArgs(ctx, args)
+		if err != nil {
+			return err
+		}
+
+		var addedOn, editedOn int64
+		err = db.QueryRow("SELECT added_on, edited_on FROM notes WHERE uuid = ?", note.UUID).Scan(&addedOn, &editedOn)
+		if err != nil {
+			return errors.Wrap(err, "querying the note")
+		}
+
+		revs, err := core.GetNoteRevisions(db, note.UUID)
+		if err != nil {
+			return errors.Wrap(err, "getting revisions")
+		}
+
+		if revNumber != 0 {
+			if revNumber < 1 || revNumber > len(revs) {
+				return errors.Errorf("revision %d not found. the note has %d revisions", revNumber, len(revs))
+			}
+
+			rev := revs[revNumber-1]
+			log.Infof("revision: %d\n", rev.Number)
+			log.Infof("written at: %s\n", formatTime(rev.CreatedOn))
+			fmt.Printf("\n------------------------content------------------------\n")
+			fmt.Printf("%s", rev.Content)
+			fmt.Printf("\n-------------------------------------------------------\n")
+
+			return nil
+		}
+
+		if len(revs) == 0 {
+			log.Infof("note %d in %s has no previous versions\n", note.ID, note.BookLabel)
+			return nil
+		}
+
+		log.Infof("history of note %d in %s\n", note.ID, note.BookLabel)
+
+		for _, rev := range revs {
+			excerpt, _ := ls.FormatContent(rev.Content)
+			log.Plainf("%s %s %s\n", log.SprintfYellow("(%d)", rev.Number), log.SprintfGray(formatTime(rev.CreatedOn)), excerpt)
+		}
+
+		currentTs := addedOn
+		if editedOn != 0 {
+			currentTs = editedOn
+		}
+		excerpt, _ := ls.FormatContent(note.Content)
+		log.Plainf("%s %s %s\n", log.SprintfYellow("(current)"), log.SprintfGray(formatTime(currentTs)), excerpt)
+
+		return nil
+	}
+}
@@ -0,0 +1,275 @@
+// Package importer implements the import command. It is not named after the
+// command because import is a reserved word.
+package importer
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var dryRun bool
+
+var example = `
+  * Import a directory of Markdown files
+  dnote import ./notes
+
+  * Import a JSON export
+  dnote import ./dnote.json
+
+  * See what would be imported without importing
+  dnote import ./notes --dry-run`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new import command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "import <path>",
+		Short:   "Import notes from Markdown files or a JSON export",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&dryRun, "dry-run", "", false, "Show what would be imported without importing")
+
+	return cmd
+}
+
+// note is a note to be imported
+type note struct {
+	BookLabel string
+	UUID      string
+	Content   string
+	AddedOn   int64
+	EditedOn  int64
+	Public    bool
+	Tags      []string
+}
+
+// result is a summary of an import
+type result struct {
+	NoteCount      int
+	BookCount      int
+	DuplicateCount int
+}
+
+// readNotes reads the notes to import from the file or the directory at the given path
+func readNotes(path string) ([]note, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the path")
+	}
+
+	if info.IsDir() {
+		return readMarkdownDir(path)
+	}
+
+	if isJSON(path) {
+		return readJSON(path)
+	}
+
+	return readMarkdownFile(path, "")
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// importer imports notes, skipping the ones that already exist
+type importer struct {
+	tx *sql.Tx
+	ts int64
+	// hashes of the content of the existing notes by book label
+	hashes map[string]map[string]bool
+	books  map[string]bool
+}
+
+func (i *importer) isDuplicate(n note) (bool, error) {
+	if n.UUID != "" {
+		var count int
+		err := i.tx.QueryRow(`SELECT
+			(SELECT count(*) FROM notes WHERE uuid = ?) +
+			(SELECT count(*) FROM trash_notes WHERE uuid = ?)`, n.UUID, n.UUID).Scan(&count)
+		if err != nil {
+			return false, errors.Wrap(err, "counting notes")
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	hashes, ok := i.hashes[n.BookLabel]
+	if !ok {
+		hashes = map[string]bool{}
+
+		rows, err := i.tx.Query(`SELECT notes.content
+			FROM notes
+			INNER JOIN books ON books.uuid = notes.book_uuid
+			WHERE books.label = ?`, n.BookLabel)
+		if err != nil {
+			return false, errors.Wrap(err, "querying notes")
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var content string
+			if err := rows.Scan(&content); err != nil {
+				return false, errors.Wrap(err, "scanning a row")
+			}
+
+			hashes[hashContent(content)] = true
+		}
+		if err := rows.Err(); err != nil {
+			return false, errors.Wrap(err, "scanning rows")
+		}
+
+		i.hashes[n.BookLabel] = hashes
+	}
+
+	return hashes[hashContent(n.Content)], nil
+}
+
+func (i *importer) importNote(n note) error {
+	var bookCount int
+	if err := i.tx.QueryRow("SELECT count(*) FROM books WHERE label = ?", n.BookLabel).Scan(&bookCount); err != nil {
+		return errors.Wrap(err, "counting books")
+	}
+	if bookCount == 0 {
+		i.books[n.BookLabel] = true
+	}
+
+	bookUUID, err := core.GetOrCreateBook(i.tx, n.BookLabel)
+	if err != nil {
+		return errors.Wrap(err, "getting the book")
+	}
+
+	if n.UUID == "" {
+		n.UUID = utils.GenerateUUID()
+	}
+	if n.AddedOn == 0 {
+		n.AddedOn = i.ts
+	}
+
+	_, err = i.tx.Exec(`INSERT INTO notes (uuid, book_uuid, content, added_on, edited_on, public)
+		VALUES (?, ?, ?, ?, ?, ?)`, n.UUID, bookUUID, n.Content, n.AddedOn, n.EditedOn, n.Public)
+	if err != nil {
+		return errors.Wrap(err, "creating the note")
+	}
+	if err := core.LogActionAddNote(i.tx, n.UUID, n.BookLabel, n.Content, n.Public, n.AddedOn); err != nil {
+		return errors.Wrap(err, "logging action")
+	}
+
+	// add_note cannot carry the time the note was last edited. An edit at that
+	// time brings it to the other machines, and publishes the note on the
+	// clients that ignore whether an added note is public.
+	if n.EditedOn != 0 {
+		if err := core.LogActionEditNotePublic(i.tx, n.UUID, n.BookLabel, n.Public, n.EditedOn); err != nil {
+			return errors.Wrap(err, "logging action")
+		}
+	}
+
+	tags := core.MergeTags(n.Tags, core.ExtractHashtags(n.Content))
+	if len(tags) > 0 {
+		if err := core.SetNoteTags(i.tx, n.UUID, tags); err != nil {
+			return errors.Wrap(err, "tagging the note")
+		}
+		if err := core.LogActionSetNoteTags(i.tx, n.UUID, tags, n.AddedOn); err != nil {
+			return errors.Wrap(err, "logging action")
+		}
+	}
+
+	i.hashes[n.BookLabel][hashContent(n.Content)] = true
+
+	return nil
+}
+
+// importNotes imports the given notes, skipping duplicates
+func importNotes(tx *sql.Tx, notes []note, ts int64) (result, error) {
+	var ret result
+
+	i := importer{
+		tx:     tx,
+		ts:     ts,
+		hashes: map[string]map[string]bool{},
+		books:  map[string]bool{},
+	}
+
+	for _, n := range notes {
+		n.Content = core.SanitizeContent(n.Content)
+		if n.Content == "" {
+			continue
+		}
+
+		dup, err := i.isDuplicate(n)
+		if err != nil {
+			return ret, errors.Wrap(err, "checking duplicate")
+		}
+		if dup {
+			log.Debug("skipping a duplicate note %s in %s\n", n.UUID, n.BookLabel)
+			ret.DuplicateCount++
+			continue
+		}
+
+		if err := i.importNote(n); err != nil {
+			return ret, errors.Wrapf(err, "importing a note in '%s'", n.BookLabel)
+		}
+
+		ret.NoteCount++
+	}
+
+	ret.BookCount = len(i.books)
+
+	return ret, nil
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		notes, err := readNotes(args[0])
+		if err != nil {
+			return errors.Wrap(err, "reading notes")
+		}
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+
+		res, err := importNotes(tx, notes, time.Now().Unix())
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "importing notes")
+		}
+
+		if dryRun {
+			tx.Rollback()
+
+			log.Infof("would import %d notes and create %d books. %d duplicates would be skipped\n", res.NoteCount, res.BookCount, res.DuplicateCount)
+			return nil
+		}
+
+		tx.Commit()
+
+		log.Successf("imported %d notes and created %d books. %d duplicates skipped\n", res.NoteCount, res.BookCount, res.DuplicateCount)
+
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(errors.Wrap(err, "creating the directory"))
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the file"))
+	}
+}
+
+func TestReadMarkdownDir(t *testing.T) {
+	// Setup
+	dir, err := ioutil.TempDir("", "dnote-import")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "linux.md"), "# find\nfind - walk the directory\n\n# wc\n\nwc -l to count lines\n")
+	writeFile(t, filepath.Join(dir, "golang", "defer.md"), "# defer\ndeferred calls run in LIFO order\n")
+	writeFile(t, filepath.Join(dir, "js.md"), `---
+book: javascript
+uuid: 43827b9a-c2b0-4c06-a290-97991c896653
+added_on: 1515199943
+edited_on: 0
+public: false
+---
+Booleans have toString()
+
+---
+book: javascript
+uuid: f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f
+added_on: 1515199951
+edited_on: 1515199999
+public: true
+tags:
+- date
+---
+Date object implements mathematical comparisons
+---
+still the same note
+`)
+	writeFile(t, filepath.Join(dir, "image.png"), "not a note")
+
+	// Execute
+	notes, err := readNotes(dir)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading notes"))
+	}
+
+	// Test
+	testutils.AssertEqual(t, len(notes), 5, "note count mismatch")
+
+	testutils.AssertEqual(t, notes[0].BookLabel, "golang", "note 0 book mismatch")
+	testutils.AssertEqual(t, notes[0].Content, "# defer\ndeferred calls run in LIFO order", "note 0 content mismatch")
+
+	testutils.AssertEqual(t, notes[1].BookLabel, "javascript", "note 1 book mismatch")
+	testutils.AssertEqual(t, notes[1].UUID, "43827b9a-c2b0-4c06-a290-97991c896653", "note 1 uuid mismatch")
+	testutils.AssertEqual(t, notes[1].Content, "Booleans have toString()", "note 1 content mismatch")
+	testutils.AssertEqual(t, notes[1].AddedOn, int64(1515199943), "note 1 added_on mismatch")
+
+	testutils.AssertEqual(t, notes[2].Content, "Date object implements mathematical comparisons\n---\nstill the same note", "note 2 content mismatch")
+	testutils.AssertEqual(t, notes[2].EditedOn, int64(1515199999), "note 2 edited_on mismatch")
+	testutils.AssertEqual(t, notes[2].Public, true, "note 2 public mismatch")
+	testutils.AssertDeepEqual(t, notes[2].Tags, []string{"date"}, "note 2 tags mismatch")
+
+	testutils.AssertEqual(t, notes[3].BookLabel, "linux", "note 3 book mismatch")
+	testutils.AssertEqual(t, notes[3].Content, "# find\nfind - walk the directory", "note 3 content mismatch")
+	testutils.AssertEqual(t, notes[4].Content, "# wc\n\nwc -l to count lines", "note 4 content mismatch")
+}
+
+func TestReadJSON_Legacy(t *testing.T) {
+	// Setup
+	dir, err := ioutil.TempDir("", "dnote-import")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dnote.json")
+	writeFile(t, path, `{
+  "linux": {"name": "linux", "notes": [{"uuid": "3e065d55-6d47-42f2-a6bf-f5844130b2d2", "content": "wc -l to count words", "added_on": 1515199961, "edited_on": 0, "public": false}]},
+  "js": {"name": "js", "notes": [{"uuid": "43827b9a-c2b0-4c06-a290-97991c896653", "content": "Booleans have toString()", "added_on": 1515199943, "edited_on": 1515199950, "public": true}]}
+}`)
+
+	// Execute
+	notes, err := readNotes(path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading notes"))
+	}
+
+	// Test
+	testutils.AssertEqual(t, len(notes), 2, "note count mismatch")
+	testutils.AssertEqual(t, notes[0].BookLabel, "js", "note 0 book mismatch")
+	testutils.AssertEqual(t, notes[0].EditedOn, int64(1515199950), "note 0 edited_on mismatch")
+	testutils.AssertEqual(t, notes[0].Public, true, "note 0 public mismatch")
+	testutils.AssertEqual(t, notes[1].BookLabel, "linux", "note 1 book mismatch")
+	testutils.AssertEqual(t, notes[1].UUID, "3e065d55-6d47-42f2-a6bf-f5844130b2d2", "note 1 uuid mismatch")
+}
+
+func TestImportNotes(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../../tmp", "../../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup1(t, ctx)
+
+	notes := []note{
+		// duplicate by uuid
+		{BookLabel: "js", UUID: "43827b9a-c2b0-4c06-a290-97991c896653", Content: "Booleans have toString() method"},
+		// duplicate by content
+		{BookLabel: "js", Content: "Booleans have toString()\n"},
+		{BookLabel: "js", UUID: "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", Content: "Date object implements mathematical comparisons", AddedOn: 1515199951, EditedOn: 1515199999, Public: true, Tags: []string{"date"}},
+		{BookLabel: "golang", Content: "defer runs in LIFO order"},
+		// duplicate within the import
+		{BookLabel: "golang", Content: "defer runs in LIFO order"},
+	}
+
+	// Execute
+	db := ctx.DB
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	res, err := importNotes(tx, notes, 1517629805)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "importing notes"))
+	}
+	tx.Commit()
+
+	// Test
+	testutils.AssertEqual(t, res.NoteCount, 2, "imported note count mismatch")
+	testutils.AssertEqual(t, res.BookCount, 1, "created book count mismatch")
+	testutils.AssertEqual(t, res.DuplicateCount, 3, "duplicate count mismatch")
+
+	var noteCount, bookCount int
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.AssertEqual(t, noteCount, 3, "note count mismatch")
+	testutils.AssertEqual(t, bookCount, 3, "book count mismatch")
+
+	var addedOn, editedOn int64
+	var public bool
+	testutils.MustScan(t, "scanning the note",
+		db.QueryRow("SELECT added_on, edited_on, public FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &addedOn, &editedOn, &public)
+	testutils.AssertEqual(t, addedOn, int64(1515199951), "added_on mismatch")
+	testutils.AssertEqual(t, editedOn, int64(1515199999), "edited_on mismatch")
+	testutils.AssertEqual(t, public, true, "public mismatch")
+
+	var golangAddedOn int64
+	testutils.MustScan(t, "scanning the golang note",
+		db.QueryRow("SELECT added_on FROM notes WHERE content = ?", "defer runs in LIFO order"), &golangAddedOn)
+	testutils.AssertEqual(t, golangAddedOn, int64(1517629805), "default added_on mismatch")
+
+	rows, err := db.Query("SELECT type FROM actions ORDER BY rowid ASC")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "querying actions"))
+	}
+	defer rows.Close()
+
+	actionTypes := []string{}
+	for rows.Next() {
+		var actionType string
+		if err := rows.Scan(&actionType); err != nil {
+			t.Fatal(errors.Wrap(err, "scanning an action"))
+		}
+		actionTypes = append(actionTypes, actionType)
+	}
+
+	expectedActionTypes := []string{
+		actions.ActionAddNote,
+		actions.ActionEditNote,
+		"set_note_tags",
+		actions.ActionAddBook,
+		actions.ActionAddNote,
+	}
+	testutils.AssertDeepEqual(t, actionTypes, expectedActionTypes, "action types mismatch")
+}
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dnote/cli/cmd/export"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+)
+
+func isJSON(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".json"
+}
+
+// readJSON reads the notes from a JSON export or a legacy dnote file, in which
+// books are keyed by their names
+func readJSON(path string) ([]note, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the file")
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling the file")
+	}
+
+	_, hasVersion := probe["version"]
+	_, hasBooks := probe["books"]
+	if hasVersion && hasBooks {
+		archive, err := export.ReadArchive(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading the archive")
+		}
+
+		return fromArchive(archive), nil
+	}
+
+	var dnote infra.Dnote
+	if err := json.Unmarshal(b, &dnote); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling the legacy file")
+	}
+
+	return fromLegacy(dnote), nil
+}
+
+func fromArchive(archive export.Archive) []note {
+	ret := []note{}
+
+	for _, book := range archive.Books {
+		for _, n := range book.Notes {
+			ret = append(ret, note{
+				BookLabel: book.Label,
+				UUID:      n.UUID,
+				Content:   n.Content,
+				AddedOn:   n.AddedOn,
+				EditedOn:  n.EditedOn,
+				Public:    n.Public,
+				Tags:      n.Tags,
+			})
+		}
+	}
+
+	return ret
+}
+
+func fromLegacy(dnote infra.Dnote) []note {
+	ret := []note{}
+
+	labels := []string{}
+	for label := range dnote {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		for _, n := range dnote[label].Notes {
+			ret = append(ret, note{
+				BookLabel: label,
+				UUID:      n.UUID,
+				Content:   n.Content,
+				AddedOn:   n.AddedOn,
+				EditedOn:  n.EditedOn,
+				Public:    n.Public,
+			})
+		}
+	}
+
+	return ret
+}
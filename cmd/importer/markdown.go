@@ -0,0 +1,200 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnote/cli/cmd/export"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+func isMarkdown(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".txt":
+		return true
+	}
+
+	return false
+}
+
+// readMarkdownDir reads the notes from the Markdown files in the directory. A
+// file in a subdirectory belongs to the book named after the subdirectory, and
+// a file at the root belongs to the book named after the file, unless the
+// front-matter of the note specifies the book.
+func readMarkdownDir(root string) ([]note, error) {
+	ret := []note{}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+		if !isMarkdown(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return errors.Wrap(err, "getting the relative path")
+		}
+
+		var bookLabel string
+		if rel != "." {
+			bookLabel = filepath.ToSlash(rel)
+		}
+
+		notes, err := readMarkdownFile(path, bookLabel)
+		if err != nil {
+			return errors.Wrapf(err, "reading '%s'", path)
+		}
+
+		ret = append(ret, notes...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walking the directory")
+	}
+
+	return ret, nil
+}
+
+// readMarkdownFile reads the notes in the Markdown file. If the file has
+// front-matters, as exported by the export command, each front-matter starts a
+// note. Otherwise, each top-level heading starts a note.
+func readMarkdownFile(path, bookLabel string) ([]note, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the file")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the file info")
+	}
+
+	if bookLabel == "" {
+		name := filepath.Base(path)
+		bookLabel = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	lines := strings.Split(strings.Replace(string(b), "\r\n", "\n", -1), "\n")
+	if _, _, ok := parseFrontMatter(lines, 0); ok {
+		return splitFrontMatter(lines, bookLabel), nil
+	}
+
+	ret := []note{}
+	for _, content := range splitHeadings(lines) {
+		ret = append(ret, note{
+			BookLabel: bookLabel,
+			Content:   content,
+			AddedOn:   info.ModTime().Unix(),
+		})
+	}
+
+	return ret, nil
+}
+
+// parseFrontMatter parses the front-matter starting at the given line. It
+// returns the front-matter and the index of the line after it.
+func parseFrontMatter(lines []string, start int) (export.FrontMatter, int, bool) {
+	var ret export.FrontMatter
+
+	if start >= len(lines) || strings.TrimSpace(lines[start]) != export.FrontMatterDelimiter {
+		return ret, 0, false
+	}
+
+	for end := start + 1; end < len(lines); end++ {
+		if strings.TrimSpace(lines[end]) != export.FrontMatterDelimiter {
+			continue
+		}
+
+		body := strings.Join(lines[start+1:end], "\n")
+		if err := yaml.UnmarshalStrict([]byte(body), &ret); err != nil {
+			return ret, 0, false
+		}
+		if ret.UUID == "" && ret.Book == "" && ret.AddedOn == 0 {
+			return ret, 0, false
+		}
+
+		return ret, end + 1, true
+	}
+
+	return ret, 0, false
+}
+
+func splitFrontMatter(lines []string, bookLabel string) []note {
+	ret := []note{}
+
+	i := 0
+	for i < len(lines) {
+		fm, start, ok := parseFrontMatter(lines, i)
+		if !ok {
+			break
+		}
+
+		end := start
+		for end < len(lines) {
+			if _, _, next := parseFrontMatter(lines, end); next {
+				break
+			}
+			end++
+		}
+
+		n := note{
+			BookLabel: bookLabel,
+			UUID:      fm.UUID,
+			Content:   strings.TrimSpace(strings.Join(lines[start:end], "\n")),
+			AddedOn:   fm.AddedOn,
+			EditedOn:  fm.EditedOn,
+			Public:    fm.Public,
+			Tags:      fm.Tags,
+		}
+		if fm.Book != "" {
+			n.BookLabel = fm.Book
+		}
+
+		ret = append(ret, n)
+		i = end
+	}
+
+	return ret
+}
+
+// splitHeadings splits the lines into contents each starting with a top-level
+// heading. Text before the first heading is a content of its own.
+func splitHeadings(lines []string) []string {
+	ret := []string{}
+
+	var buf []string
+	flush := func() {
+		content := strings.TrimSpace(strings.Join(buf, "\n"))
+		if content != "" {
+			ret = append(ret, content)
+		}
+		buf = nil
+	}
+
+	inCode := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "```") {
+			inCode = !inCode
+		}
+		if !inCode && strings.HasPrefix(line, "# ") {
+			flush()
+		}
+
+		buf = append(buf, line)
+	}
+	flush()
+
+	return ret
+}
@@ -0,0 +1,241 @@
+package keys
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/term"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+  * Encrypt the notes synced from this machine with a passphrase
+  dnote keys init
+
+  * Add the passphrase used on another machine after a sync asks for it
+  dnote keys add
+
+  * Encrypt all notes with a new passphrase
+  dnote keys rotate`
+
+// NewCmd returns a new keys command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "keys",
+		Short:   "Manage the keys for encrypting synced notes",
+		Example: example,
+	}
+
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Encrypt the synced notes with a passphrase",
+		RunE:  newInitRun(ctx),
+	}
+	addCmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add the passphrase used on another machine",
+		RunE:  newAddRun(ctx),
+	}
+	rotateCmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Encrypt all notes with a new passphrase",
+		RunE:  newRotateRun(ctx),
+	}
+
+	cmd.AddCommand(initCmd)
+	cmd.AddCommand(addCmd)
+	cmd.AddCommand(rotateCmd)
+
+	return cmd
+}
+
+func newInitRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		config, err := core.ReadConfig(ctx)
+		if err != nil {
+			return errors.Wrap(err, "reading the config")
+		}
+		if len(config.EncryptionKeys) > 0 {
+			return errors.New("encryption is already enabled. to change the passphrase, run `dnote keys rotate`")
+		}
+
+		passphrase, err := term.AskPassphrase("passphrase", true)
+		if err != nil {
+			return errors.Wrap(err, "getting the passphrase")
+		}
+
+		key, err := core.GenerateEncryptionKey(passphrase)
+		if err != nil {
+			return errors.Wrap(err, "generating the key")
+		}
+		if err := core.AddEncryptionKey(ctx, key); err != nil {
+			return errors.Wrap(err, "saving the key")
+		}
+
+		log.Successf("enabled encryption. use the same passphrase on other machines\n")
+
+		return nil
+	}
+}
+
+func newAddRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		salt, err := core.GetMissingKeySalt(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "getting the missing key")
+		}
+		if salt == "" {
+			return errors.New("no key is missing. to enable encryption, run `dnote keys init`")
+		}
+
+		passphrase, err := term.AskPassphrase("passphrase", false)
+		if err != nil {
+			return errors.Wrap(err, "getting the passphrase")
+		}
+
+		key, err := core.NewEncryptionKey(passphrase, salt)
+		if err != nil {
+			return errors.Wrap(err, "deriving the key")
+		}
+		if err := core.AddEncryptionKey(ctx, key); err != nil {
+			return errors.Wrap(err, "saving the key")
+		}
+		if err := core.SetMissingKeySalt(ctx.DB, ""); err != nil {
+			return errors.Wrap(err, "clearing the missing key")
+		}
+
+		log.Successf("added the key. run `dnote sync` to continue\n")
+
+		return nil
+	}
+}
+
+// logReencryption logs the actions for the content and the tags of every note
+// so that the next sync uploads them encrypted with the current key
+func logReencryption(tx *sql.Tx, ts int64) (int, error) {
+	rows, err := tx.Query(`SELECT notes.uuid, books.label, notes.content
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid`)
+	if err != nil {
+		return 0, errors.Wrap(err, "querying notes")
+	}
+
+	type note struct {
+		uuid      string
+		bookLabel string
+		content   string
+	}
+	notes := []note{}
+	for rows.Next() {
+		var n note
+		if err := rows.Scan(&n.uuid, &n.bookLabel, &n.content); err != nil {
+			rows.Close()
+			return 0, errors.Wrap(err, "scanning a row")
+		}
+
+		notes = append(notes, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, errors.Wrap(err, "scanning rows")
+	}
+
+	tags, err := getTags(tx)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting tags")
+	}
+
+	for _, n := range notes {
+		if err := core.LogActionEditNote(tx, n.uuid, n.bookLabel, n.content, ts); err != nil {
+			return 0, errors.Wrap(err, "logging an action")
+		}
+
+		if len(tags[n.uuid]) > 0 {
+			if err := core.LogActionSetNoteTags(tx, n.uuid, tags[n.uuid], ts); err != nil {
+				return 0, errors.Wrap(err, "logging an action for the tags")
+			}
+		}
+	}
+
+	return len(notes), nil
+}
+
+// getTags returns the tags of the notes keyed by the note uuid
+func getTags(tx *sql.Tx) (map[string][]string, error) {
+	ret := map[string][]string{}
+
+	rows, err := tx.Query(`SELECT note_tags.note_uuid, tags.label
+		FROM note_tags
+		INNER JOIN tags ON tags.uuid = note_tags.tag_uuid
+		ORDER BY tags.label ASC`)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying tags")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteUUID, label string
+		if err := rows.Scan(&noteUUID, &label); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret[noteUUID] = append(ret[noteUUID], label)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+func newRotateRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		config, err := core.ReadConfig(ctx)
+		if err != nil {
+			return errors.Wrap(err, "reading the config")
+		}
+		if len(config.EncryptionKeys) == 0 {
+			return errors.New("encryption is not enabled. run `dnote keys init`")
+		}
+
+		passphrase, err := term.AskPassphrase("new passphrase", true)
+		if err != nil {
+			return errors.Wrap(err, "getting the passphrase")
+		}
+
+		key, err := core.GenerateEncryptionKey(passphrase)
+		if err != nil {
+			return errors.Wrap(err, "generating the key")
+		}
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+
+		count, err := logReencryption(tx, time.Now().Unix())
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "re-encrypting notes")
+		}
+
+		if err := tx.Commit(); err != nil {
+			return errors.Wrap(err, "committing the transaction")
+		}
+
+		// The actions are encrypted with the current key when they are synced.
+		// If the key cannot be saved, they are synced with the previous one.
+		// The previous keys are kept to decrypt the contents synced before.
+		if err := core.AddEncryptionKey(ctx, key); err != nil {
+			return errors.Wrap(err, "saving the key")
+		}
+
+		log.Successf("rotated the key. %d notes will be uploaded with the new key on the next sync\n", count)
+
+		return nil
+	}
+}
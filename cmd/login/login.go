@@ -10,8 +10,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var remoteName string
+
 var example = `
-  dnote login`
+  * Log in to Dnote cloud
+  dnote login
+
+  * Set the API key of a remote added by "dnote remote add"
+  dnote login --remote team`
 
 // NewCmd returns a new login command
 func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
@@ -22,11 +28,23 @@ func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
 		RunE:    newRun(ctx),
 	}
 
+	f := cmd.Flags()
+	f.StringVarP(&remoteName, "remote", "r", core.DefaultRemote, "The name of the remote to log in to")
+
 	return cmd
 }
 
 func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
+		if remoteName != core.DefaultRemote {
+			if _, err := core.GetRemote(ctx, remoteName); err != nil {
+				return errors.Wrap(err, "getting the remote")
+			}
+
+			log.Infof("logging in to %s\n", remoteName)
+			return readAPIKey(ctx)
+		}
+
 		log.Plain("\n")
 		log.Plain("   _(  )_( )_\n")
 		log.Plain("  (_   _    _)\n")
@@ -34,31 +52,28 @@ func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 		log.Plain("Welcome to Dnote Cloud :)\n\n")
 		log.Plain("A home for your engineering microlessons\n")
 		log.Plain("You can register at https://dnote.io/cloud\n\n")
-		log.Printf("API key: ")
-
-		var apiKey string
-		if _, err := fmt.Scanln(&apiKey); err != nil {
-			return err
-		}
 
-		if apiKey == "" {
-			return errors.New("Empty API key")
-		}
+		return readAPIKey(ctx)
+	}
+}
 
-		config, err := core.ReadConfig(ctx)
-		if err != nil {
-			return err
-		}
+func readAPIKey(ctx infra.DnoteCtx) error {
+	log.Printf("API key: ")
 
-		config.APIKey = apiKey
-		err = core.WriteConfig(ctx, config)
-		if err != nil {
-			return errors.Wrap(err, "Failed to write to config file")
-		}
+	var apiKey string
+	if _, err := fmt.Scanln(&apiKey); err != nil {
+		return err
+	}
 
-		log.Success("configured\n")
+	if apiKey == "" {
+		return errors.New("Empty API key")
+	}
 
-		return nil
+	if err := core.SetRemoteAPIKey(ctx, remoteName, apiKey); err != nil {
+		return errors.Wrap(err, "Failed to save the API key")
 	}
 
+	log.Success("configured\n")
+
+	return nil
 }
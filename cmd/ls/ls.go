@@ -8,6 +8,7 @@ import (
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
 	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/output"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -67,16 +68,27 @@ func NewRun(ctx infra.DnoteCtx) core.RunEFunc {
 	}
 }
 
-// bookInfo is an information about the book to be printed on screen
-type bookInfo struct {
-	BookLabel string
-	NoteCount int
-}
+// noteQuery selects the notes to be printed on screen
+const noteQuery = `SELECT notes.uuid, notes.id, books.label, notes.content, notes.added_on, notes.edited_on, notes.public
+	FROM notes
+	INNER JOIN books ON books.uuid = notes.book_uuid`
+
+// scanNotes returns the notes selected by noteQuery
+func scanNotes(rows *sql.Rows) ([]output.Note, error) {
+	ret := []output.Note{}
+	for rows.Next() {
+		var note output.Note
+		if err := rows.Scan(&note.UUID, &note.ID, &note.Book, &note.Content, &note.AddedOn, &note.EditedOn, &note.Public); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
 
-// noteInfo is an information about the note to be printed on screen
-type noteInfo struct {
-	ID      int
-	Content string
+		ret = append(ret, note)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
 }
 
 // getNewlineIdx returns the index of newline character in a string
@@ -92,9 +104,9 @@ func getNewlineIdx(str string) int {
 	return ret
 }
 
-// formatContent returns an excerpt of the given raw note content and a boolean
+// FormatContent returns an excerpt of the given raw note content and a boolean
 // indicating if the returned string has been excertped
-func formatContent(noteContent string) (string, bool) {
+func FormatContent(noteContent string) (string, bool) {
 	newlineIdx := getNewlineIdx(noteContent)
 
 	if newlineIdx > -1 {
@@ -106,76 +118,143 @@ func formatContent(noteContent string) (string, bool) {
 	return strings.Trim(noteContent, " "), false
 }
 
-func printBooks(ctx infra.DnoteCtx) error {
-	db := ctx.DB
-
+// GetBooks returns the books with notes in the order of their labels
+func GetBooks(db *sql.DB) ([]output.Book, error) {
 	rows, err := db.Query(`SELECT books.label, count(notes.uuid) note_count
 	FROM books
 	INNER JOIN notes ON notes.book_uuid = books.uuid
 	GROUP BY books.uuid
 	ORDER BY books.label ASC;`)
 	if err != nil {
-		return errors.Wrap(err, "querying books")
+		return nil, errors.Wrap(err, "querying books")
 	}
 	defer rows.Close()
 
-	infos := []bookInfo{}
+	ret := []output.Book{}
 	for rows.Next() {
-		var info bookInfo
-		err = rows.Scan(&info.BookLabel, &info.NoteCount)
+		var info output.Book
+		err = rows.Scan(&info.Label, &info.NoteCount)
 		if err != nil {
-			return errors.Wrap(err, "scanning a row")
+			return ret, errors.Wrap(err, "scanning a row")
 		}
 
-		infos = append(infos, info)
+		ret = append(ret, info)
+	}
+
+	return ret, nil
+}
+
+// GetNotes returns the notes in the book in the order they were added
+func GetNotes(db *sql.DB, bookLabel string) ([]output.Note, error) {
+	var bookUUID string
+	err := db.QueryRow("SELECT uuid FROM books WHERE label = ?", bookLabel).Scan(&bookUUID)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("book not found")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "querying the book")
+	}
+
+	rows, err := db.Query(noteQuery+" WHERE notes.book_uuid = ? ORDER BY notes.added_on ASC;", bookUUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	return scanNotes(rows)
+}
+
+func printBooks(ctx infra.DnoteCtx) error {
+	infos, err := GetBooks(ctx.DB)
+	if err != nil {
+		return errors.Wrap(err, "getting books")
+	}
+
+	if !output.IsText() {
+		return output.Print(infos)
 	}
 
 	for _, info := range infos {
-		log.Printf("%s %s\n", info.BookLabel, log.SprintfYellow("(%d)", info.NoteCount))
+		log.Printf("%s %s\n", info.Label, log.SprintfYellow("(%d)", info.NoteCount))
 	}
 
 	return nil
 }
 
 func printNotes(ctx infra.DnoteCtx, bookName string) error {
+	infos, err := GetNotes(ctx.DB, bookName)
+	if err != nil {
+		return errors.Wrap(err, "getting notes")
+	}
+
+	if !output.IsText() {
+		return output.Print(infos)
+	}
+
+	log.Infof("on book %s\n", bookName)
+
+	for _, info := range infos {
+		content, isExcerpt := FormatContent(info.Content)
+
+		index := log.SprintfYellow("(%d)", info.ID)
+		if isExcerpt {
+			content = fmt.Sprintf("%s %s", content, log.SprintfYellow("[---More---]"))
+		}
+
+		log.Plainf("%s %s %s\n", index, log.SprintfGray(core.ShortUUID(info.UUID)), content)
+	}
+
+	return nil
+}
+
+// PrintTaggedNotes prints the notes with the given tag. If a book label is given,
+// only the notes in the book are printed.
+func PrintTaggedNotes(ctx infra.DnoteCtx, tag, bookLabel string) error {
 	db := ctx.DB
 
-	var bookUUID string
-	err := db.QueryRow("SELECT uuid FROM books WHERE label = ?", bookName).Scan(&bookUUID)
-	if err == sql.ErrNoRows {
-		return errors.New("book not found")
-	} else if err != nil {
-		return errors.Wrap(err, "querying the book")
+	queryTmpl := noteQuery + `
+	INNER JOIN note_tags ON note_tags.note_uuid = notes.uuid
+	INNER JOIN tags ON tags.uuid = note_tags.tag_uuid
+	WHERE tags.label = ?`
+	queryArgs := []interface{}{core.NormalizeTag(tag)}
+
+	if bookLabel != "" {
+		bookUUID, err := core.GetBookUUID(ctx, bookLabel)
+		if err != nil {
+			return errors.Wrap(err, "finding book uuid")
+		}
+
+		queryTmpl = fmt.Sprintf("%s AND notes.book_uuid = ?", queryTmpl)
+		queryArgs = append(queryArgs, bookUUID)
 	}
 
-	rows, err := db.Query(`SELECT id, content FROM notes WHERE book_uuid = ? ORDER BY added_on ASC;`, bookUUID)
+	queryTmpl = fmt.Sprintf("%s ORDER BY books.label ASC, notes.added_on ASC", queryTmpl)
+
+	rows, err := db.Query(queryTmpl, queryArgs...)
 	if err != nil {
 		return errors.Wrap(err, "querying notes")
 	}
 	defer rows.Close()
 
-	infos := []noteInfo{}
-	for rows.Next() {
-		var info noteInfo
-		err = rows.Scan(&info.ID, &info.Content)
-		if err != nil {
-			return errors.Wrap(err, "scanning a row")
-		}
+	infos, err := scanNotes(rows)
+	if err != nil {
+		return errors.Wrap(err, "scanning notes")
+	}
 
-		infos = append(infos, info)
+	if !output.IsText() {
+		return output.Print(infos)
 	}
 
-	log.Infof("on book %s\n", bookName)
+	log.Infof("tagged %s\n", core.NormalizeTag(tag))
 
 	for _, info := range infos {
-		content, isExcerpt := formatContent(info.Content)
+		content, isExcerpt := FormatContent(info.Content)
 
 		index := log.SprintfYellow("(%d)", info.ID)
 		if isExcerpt {
 			content = fmt.Sprintf("%s %s", content, log.SprintfYellow("[---More---]"))
 		}
 
-		log.Plainf("%s %s\n", index, content)
+		log.Plainf("%s %s %s %s\n", log.SprintfBlue(info.Book), index, log.SprintfGray(core.ShortUUID(info.UUID)), content)
 	}
 
 	return nil
@@ -0,0 +1,71 @@
+package mv
+
+import (
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Move a note to another book
+ dnote mv js 3 javascript
+
+ * Move a note by the id shown by "dnote view"
+ dnote mv 4f2a javascript
+ `
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new mv command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "mv <book name?> <note index> <destination book name>",
+		Short:   "Move a note to another book",
+		Aliases: []string{"move"},
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		db := ctx.DB
+		destLabel := args[len(args)-1]
+
+		note, err := core.FindNoteByArgs(ctx, args[:len(args)-1])
+		if err != nil {
+			return err
+		}
+
+		if note.BookLabel == destLabel {
+			return errors.New("Nothing changed")
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.MoveNote(tx, note.UUID, note.BookLabel, destLabel, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "moving the note")
+		}
+		tx.Commit()
+
+		log.Successf("moved the note from %s to %s\n", note.BookLabel, destLabel)
+
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package publish
+
+import (
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/output"
+	"github.com/dnote/cli/picker"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Publish a note by its index in a book
+ dnote publish js 3
+
+ * Publish a note by the id shown by "dnote view"
+ dnote publish 4f2a`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 2 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new publish command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "publish <book name?> <note index?>",
+		Short:   "Publish a note on the site built by 'dnote site build'",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    NewRun(ctx, true),
+	}
+
+	return cmd
+}
+
+// NewRun returns a function setting whether the note given by the arguments is
+// public
+func NewRun(ctx infra.DnoteCtx, public bool) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		db := ctx.DB
+
+		note, err := picker.FindNote(ctx, args)
+		if errors.Cause(err) == picker.ErrCancelled {
+			log.Warnf("aborted by user\n")
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var current bool
+		if err := db.QueryRow("SELECT public FROM notes WHERE uuid = ?", note.UUID).Scan(&current); err != nil {
+			return errors.Wrap(err, "querying the note")
+		}
+		if current == public {
+			return errors.New("Nothing changed")
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.SetNotePublic(tx, note.UUID, note.BookLabel, public, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "updating the note")
+		}
+		tx.Commit()
+
+		if !output.IsText() {
+			n, err := output.GetNote(db, note.UUID)
+			if err != nil {
+				return errors.Wrap(err, "getting the note")
+			}
+
+			return output.Print(n)
+		}
+
+		if public {
+			log.Successf("published the note in %s\n", note.BookLabel)
+		} else {
+			log.Successf("unpublished the note in %s\n", note.BookLabel)
+		}
+
+		return nil
+	}
+}
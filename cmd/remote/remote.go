@@ -0,0 +1,240 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var apiKey string
+var bookLabels []string
+
+var example = `
+  * Add a remote syncing the books "work" and "ops"
+  dnote remote add team https://notes.example.com --api-key 1a2b3c --book work --book ops
+
+  * Sync another book with a remote
+  dnote remote assign team design
+
+  * List the remotes
+  dnote remote list
+
+  * Sync with a remote by default
+  dnote remote use team
+
+  * Remove a remote
+  dnote remote remove team`
+
+// NewCmd returns a new remote command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "remote",
+		Short:   "Manage the servers to sync with",
+		Example: example,
+	}
+
+	addCmd := &cobra.Command{
+		Use:     "add <name> <endpoint>",
+		Short:   "Add a remote",
+		PreRunE: addPreRun,
+		RunE:    newAddRun(ctx),
+	}
+	addCmd.Flags().StringVarP(&apiKey, "api-key", "", "", "The API key for the remote. It can also be set by \"dnote login --remote <name>\"")
+	addCmd.Flags().StringSliceVarP(&bookLabels, "book", "b", []string{}, "The name of a book to sync with the remote instead of the default remote")
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the remotes",
+		Aliases: []string{"ls"},
+		RunE:    newListRun(ctx),
+	}
+	removeCmd := &cobra.Command{
+		Use:     "remove <name>",
+		Short:   "Remove a remote",
+		Aliases: []string{"rm"},
+		PreRunE: namePreRun,
+		RunE:    newRemoveRun(ctx),
+	}
+	assignCmd := &cobra.Command{
+		Use:     "assign <name> <book name>",
+		Short:   "Sync a book with the remote instead of the default remote",
+		PreRunE: addPreRun,
+		RunE:    newAssignRun(ctx),
+	}
+	useCmd := &cobra.Command{
+		Use:     "use <name>",
+		Short:   "Sync with the remote by default",
+		PreRunE: namePreRun,
+		RunE:    newUseRun(ctx),
+	}
+
+	cmd.AddCommand(addCmd)
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(removeCmd)
+	cmd.AddCommand(useCmd)
+	cmd.AddCommand(assignCmd)
+
+	return cmd
+}
+
+func addPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+func namePreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+func newAddRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		endpoint := args[1]
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.AddRemote(tx, name, endpoint, apiKey); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "adding the remote")
+		}
+		for _, label := range bookLabels {
+			if err := core.AssignBook(tx, name, label); err != nil {
+				tx.Rollback()
+				return errors.Wrapf(err, "assigning the book '%s'", label)
+			}
+		}
+		tx.Commit()
+
+		log.Successf("added remote %s\n", name)
+		if len(bookLabels) == 0 {
+			log.Infof("no book is synced with it yet. to sync a book, run `dnote remote assign %s <book name>`\n", name)
+		}
+		if apiKey == "" {
+			log.Infof("to set the API key, run `dnote login --remote %s`\n", name)
+		}
+
+		return nil
+	}
+}
+
+func newListRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		remotes, err := core.GetRemotes(ctx)
+		if err != nil {
+			return errors.Wrap(err, "getting remotes")
+		}
+		current, err := core.GetCurrentRemoteName(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "getting the current remote")
+		}
+
+		for _, r := range remotes {
+			marker := " "
+			if r.Name == current {
+				marker = "*"
+			}
+
+			endpoint := r.Endpoint
+			if endpoint == "" {
+				endpoint = "(no endpoint)"
+			}
+
+			books := ""
+			if r.Name != core.DefaultRemote {
+				labels, err := core.GetRemoteBookLabels(ctx.DB, r.Name)
+				if err != nil {
+					return errors.Wrapf(err, "getting the books of '%s'", r.Name)
+				}
+
+				books = fmt.Sprintf(" (books: %s)", strings.Join(labels, ", "))
+			}
+
+			log.Plainf("%s %s %s%s\n", marker, log.SprintfBlue(r.Name), endpoint, books)
+		}
+
+		return nil
+	}
+}
+
+func newRemoveRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		labels, err := core.GetRemoteBookLabels(ctx.DB, name)
+		if err != nil {
+			return errors.Wrap(err, "getting the books of the remote")
+		}
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.RemoveRemote(tx, name); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "removing the remote")
+		}
+		tx.Commit()
+
+		log.Successf("removed remote %s\n", name)
+		if len(labels) > 0 {
+			log.Warnf("the books %s will be synced with the default remote\n", strings.Join(labels, ", "))
+		}
+
+		return nil
+	}
+}
+
+func newUseRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.UseRemote(tx, name); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "switching the remote")
+		}
+		tx.Commit()
+
+		log.Successf("syncing with %s by default\n", name)
+
+		return nil
+	}
+}
+
+func newAssignRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		label := args[1]
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.AssignBook(tx, name, label); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "assigning the book")
+		}
+		tx.Commit()
+
+		log.Successf("syncing %s with %s\n", label, name)
+
+		return nil
+	}
+}
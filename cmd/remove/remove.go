@@ -1,12 +1,13 @@
 package remove
 
 import (
-	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
 	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/picker"
 	"github.com/dnote/cli/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -18,6 +19,13 @@ var example = `
   * Delete a note by its index from a book
   dnote delete js 2
 
+  * Delete a note by the id shown by "dnote view"
+  dnote delete 4f2a
+
+  * Pick the note to delete in a book, or in all books
+  dnote delete js
+  dnote delete
+
   * Delete a book
   dnote delete -b js`
 
@@ -46,14 +54,7 @@ func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 			return nil
 		}
 
-		if len(args) < 2 {
-			return errors.New("Missing argument")
-		}
-
-		targetBook := args[0]
-		noteID := args[1]
-
-		if err := removeNote(ctx, noteID, targetBook); err != nil {
+		if err := removeNote(ctx, args); err != nil {
 			return errors.Wrap(err, "removing the note")
 		}
 
@@ -61,21 +62,17 @@ func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	}
 }
 
-func removeNote(ctx infra.DnoteCtx, noteID, bookLabel string) error {
+func removeNote(ctx infra.DnoteCtx, args []string) error {
 	db := ctx.DB
 
-	bookUUID, err := core.GetBookUUID(ctx, bookLabel)
-	if err != nil {
-		return errors.Wrap(err, "finding book uuid")
-	}
-
-	var noteUUID, noteContent string
-	err = db.QueryRow("SELECT uuid, content FROM notes WHERE id = ? AND book_uuid = ?", noteID, bookUUID).Scan(&noteUUID, &noteContent)
-	if err == sql.ErrNoRows {
-		return errors.Errorf("note %s not found in the book '%s'", noteID, bookLabel)
+	note, err := picker.FindNote(ctx, args)
+	if errors.Cause(err) == picker.ErrCancelled {
+		log.Warnf("aborted by user\n")
+		return nil
 	} else if err != nil {
-		return errors.Wrap(err, "querying the book")
+		return err
 	}
+	noteUUID, noteContent, bookLabel := note.UUID, note.Content, note.BookLabel
 
 	// todo: multiline
 	log.Printf("content: \"%s\"\n", noteContent)
@@ -94,15 +91,14 @@ func removeNote(ctx infra.DnoteCtx, noteID, bookLabel string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	if _, err = tx.Exec("DELETE FROM notes WHERE uuid = ? AND book_uuid = ?", noteUUID, bookUUID); err != nil {
-		return errors.Wrap(err, "removing the note")
-	}
-	if err = core.LogActionRemoveNote(tx, noteUUID, bookLabel); err != nil {
-		return errors.Wrap(err, "logging the remove_note action")
+	// The remove_note action is logged when the trash is emptied
+	if err = core.TrashNote(tx, noteUUID, time.Now().Unix()); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "moving the note to the trash")
 	}
 	tx.Commit()
 
-	log.Successf("removed from %s\n", bookLabel)
+	log.Successf("moved to the trash from %s\n", bookLabel)
 
 	return nil
 }
@@ -129,19 +125,15 @@ func removeBook(ctx infra.DnoteCtx, bookLabel string) error {
 		return errors.Wrap(err, "beginning a transaction")
 	}
 
-	if _, err = tx.Exec("DELETE FROM notes WHERE book_uuid = ?", bookUUID); err != nil {
-		return errors.Wrap(err, "removing notes in the book")
-	}
-	if _, err = tx.Exec("DELETE FROM books WHERE uuid = ?", bookUUID); err != nil {
-		return errors.Wrap(err, "removing the book")
-	}
-	if err = core.LogActionRemoveBook(tx, bookLabel); err != nil {
-		return errors.Wrap(err, "loging the remove_book action")
+	// The remove_book action is logged when the trash is emptied
+	if err = core.TrashBook(tx, bookUUID, time.Now().Unix()); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "moving the book to the trash")
 	}
 
 	tx.Commit()
 
-	log.Success("removed book\n")
+	log.Success("moved book to the trash\n")
 
 	return nil
 }
@@ -0,0 +1,144 @@
+package resolve
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var ours bool
+var theirs bool
+var edit bool
+
+var example = `
+ * Keep the local content of a note
+ dnote resolve js 3 --ours
+
+ * Take the content from another machine
+ dnote resolve js 3 --theirs
+
+ * Merge both contents in the editor
+ dnote resolve js 3 --edit
+ `
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	var count int
+	for _, f := range []bool{ours, theirs, edit} {
+		if f {
+			count++
+		}
+	}
+	if count != 1 {
+		return errors.New("Specify one of --ours, --theirs or --edit")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new resolve command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "resolve <book name> <note index>",
+		Short:   "Resolve a sync conflict of a note",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.BoolVarP(&ours, "ours", "", false, "Keep the local content")
+	f.BoolVarP(&theirs, "theirs", "", false, "Take the content from another machine")
+	f.BoolVarP(&edit, "edit", "", false, "Merge the contents in the editor")
+
+	return cmd
+}
+
+// getMergedContent lets the user merge the contents of the conflict in the editor
+func getMergedContent(ctx infra.DnoteCtx, c core.Conflict) (string, error) {
+	var ret string
+
+	fpath := core.GetDnoteTmpContentPath(ctx)
+	if err := ioutil.WriteFile(fpath, []byte(core.MergeConflict(c.Ours, c.Theirs)), 0644); err != nil {
+		return ret, errors.Wrap(err, "preparing tmp content file")
+	}
+
+	if err := core.GetEditorInput(ctx, fpath, &ret); err != nil {
+		return ret, errors.Wrap(err, "getting editor input")
+	}
+
+	if core.HasConflictMarkers(ret) {
+		return ret, errors.New("the content still has conflict markers")
+	}
+
+	return core.SanitizeContent(ret), nil
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		db := ctx.DB
+		bookLabel := args[0]
+		noteID := args[1]
+
+		bookUUID, err := core.GetBookUUID(ctx, bookLabel)
+		if err != nil {
+			return errors.Wrap(err, "finding book uuid")
+		}
+
+		var noteUUID, content string
+		err = db.QueryRow("SELECT uuid, content FROM notes WHERE id = ? AND book_uuid = ?", noteID, bookUUID).Scan(&noteUUID, &content)
+		if err == sql.ErrNoRows {
+			return errors.Errorf("note %s not found in the book '%s'", noteID, bookLabel)
+		} else if err != nil {
+			return errors.Wrap(err, "querying the note")
+		}
+
+		c, err := core.GetConflict(db, noteUUID)
+		if err != nil {
+			return errors.Wrap(err, "getting the conflict")
+		}
+
+		newContent := content
+		if theirs {
+			newContent = c.Theirs
+		} else if edit {
+			newContent, err = getMergedContent(ctx, c)
+			if err != nil {
+				return errors.Wrap(err, "merging the contents")
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+
+		if newContent != content {
+			if err := core.UpdateNoteContent(tx, noteUUID, bookLabel, newContent, time.Now().Unix()); err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "updating the note")
+			}
+		}
+
+		if err := core.RemoveConflict(tx, noteUUID); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "removing the conflict")
+		}
+
+		tx.Commit()
+
+		log.Printf("content: %s\n", newContent)
+		log.Successf("resolved the conflict\n")
+
+		return nil
+	}
+}
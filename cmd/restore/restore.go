@@ -0,0 +1,89 @@
+package restore
+
+import (
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var revNumber int
+
+var example = `
+ * Restore a note to a previous version listed by "dnote history"
+ dnote restore js 3 --rev 2
+
+ * Restore a note by the id shown by "dnote view"
+ dnote restore 4f2a --rev 2
+ `
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("Incorrect number of arguments")
+	}
+	if revNumber == 0 {
+		return errors.New("Missing revision number")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new restore command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore <book name?> <note index>",
+		Short:   "Restore a note to a previous version",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.IntVarP(&revNumber, "rev", "r", 0, "The number of the revision to restore")
+
+	return cmd
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		db := ctx.DB
+
+		note, err := core.FindNoteByArgs(ctx, args)
+		if err != nil {
+			return err
+		}
+
+		revs, err := core.GetNoteRevisions(db, note.UUID)
+		if err != nil {
+			return errors.Wrap(err, "getting revisions")
+		}
+		if revNumber < 1 || revNumber > len(revs) {
+			return errors.Errorf("revision %d not found. the note has %d revisions", revNumber, len(revs))
+		}
+
+		rev := revs[revNumber-1]
+		if rev.Content == note.Content {
+			return errors.New("Nothing changed")
+		}
+
+		ts := time.Now().Unix()
+
+		tx, err := db.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.UpdateNoteContent(tx, note.UUID, note.BookLabel, rev.Content, ts); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "updating the note")
+		}
+		tx.Commit()
+
+		log.Printf("new content: %s\n", rev.Content)
+		log.Successf("restored the note to revision %d\n", rev.Number)
+
+		return nil
+	}
+}
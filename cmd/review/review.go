@@ -0,0 +1,211 @@
+package review
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/dnote/cli/cmd/cat"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var bookLabel string
+var limit int
+var newLimit int
+
+var example = `
+ * Review the notes due today
+ dnote review
+
+ * Review the notes in a book
+ dnote review --book javascript
+
+ * Review at most 50 notes a day, 20 of which are new
+ dnote review --limit 50 --new 20`
+
+// prompt lists the answers to the question after a note is shown
+const prompt = "0-2 forgot, 3 hard, 4 good, 5 easy, s skip, q quit"
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of arguments")
+	}
+	if limit < 0 || newLimit < 0 {
+		return errors.New("Limits cannot be negative")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new review command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "review",
+		Short:   "Review the notes with spaced repetition",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&bookLabel, "book", "b", "", "The book to review the notes in")
+	f.IntVar(&limit, "limit", 20, "The maximum number of notes to review a day")
+	f.IntVar(&newLimit, "new", 10, "The maximum number of new notes to review a day")
+
+	return cmd
+}
+
+// answer is the response of the user to a note under review
+type answer struct {
+	grade int
+	skip  bool
+	quit  bool
+}
+
+// parseAnswer parses the input of the user. It returns false if the input is not
+// a valid answer.
+func parseAnswer(s string) (answer, bool) {
+	switch s {
+	case "s":
+		return answer{skip: true}, true
+	case "q":
+		return answer{quit: true}, true
+	}
+
+	grade, err := strconv.Atoi(s)
+	if err != nil || grade < core.MinGrade || grade > core.MaxGrade {
+		return answer{}, false
+	}
+
+	return answer{grade: grade}, true
+}
+
+func askAnswer() (answer, error) {
+	for {
+		s, err := utils.Ask(prompt)
+		if err != nil {
+			return answer{}, errors.Wrap(err, "getting the answer")
+		}
+
+		if a, ok := parseAnswer(s); ok {
+			return a, nil
+		}
+
+		log.Warnf("invalid answer %q\n", s)
+	}
+}
+
+// saveReview reschedules the note with the grade and logs the action if the
+// reviews are synced
+func saveReview(ctx infra.DnoteCtx, noteUUID string, grade int, ts int64, syncReviews bool) error {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	r, _, err := core.GetReview(tx, noteUUID)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "getting the review")
+	}
+
+	r = core.Schedule(r, grade, ts)
+	if err := core.SaveReview(tx, r); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving the review")
+	}
+
+	if syncReviews {
+		if err := core.LogActionReviewNote(tx, r); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "logging action")
+		}
+	}
+
+	tx.Commit()
+
+	return nil
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		config, err := core.ReadConfig(ctx)
+		if err != nil {
+			return errors.Wrap(err, "reading the config")
+		}
+
+		var bookUUID string
+		if bookLabel != "" {
+			bookUUID, err = core.GetBookUUID(ctx, bookLabel)
+			if err != nil {
+				return errors.Wrap(err, "finding the book")
+			}
+		}
+
+		now := time.Now()
+		reviewed, added, err := core.CountReviews(ctx.DB, core.StartOfDay(now))
+		if err != nil {
+			return errors.Wrap(err, "counting the reviews of today")
+		}
+
+		noteUUIDs, err := core.GetDueNotes(ctx.DB, bookUUID, now.Unix(), limit-reviewed, newLimit-added)
+		if err != nil {
+			return errors.Wrap(err, "getting the due notes")
+		}
+
+		if len(noteUUIDs) == 0 {
+			return printNothingDue(ctx, bookUUID)
+		}
+
+		var count int
+		for i, noteUUID := range noteUUIDs {
+			log.Infof("note %d of %d\n", i+1, len(noteUUIDs))
+			if err := cat.NewRun(ctx)(cmd, []string{noteUUID}); err != nil {
+				return errors.Wrap(err, "printing the note")
+			}
+
+			a, err := askAnswer()
+			if err != nil {
+				return err
+			}
+			if a.quit {
+				break
+			}
+			if a.skip {
+				continue
+			}
+
+			if err := saveReview(ctx, noteUUID, a.grade, time.Now().Unix(), config.SyncReviews); err != nil {
+				return errors.Wrap(err, "saving the review")
+			}
+
+			count++
+		}
+
+		if count == 1 {
+			log.Successf("reviewed 1 note\n")
+		} else {
+			log.Successf("reviewed %d notes\n", count)
+		}
+
+		return nil
+	}
+}
+
+func printNothingDue(ctx infra.DnoteCtx, bookUUID string) error {
+	log.Info("no notes to review\n")
+
+	nextDue, err := core.GetNextDue(ctx.DB, bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "getting the next review")
+	}
+	if nextDue > time.Now().Unix() {
+		log.Infof("next review: %s\n", time.Unix(nextDue, 0).Format("Jan 2, 2006 3:04pm (MST)"))
+	}
+
+	return nil
+}
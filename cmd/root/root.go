@@ -3,16 +3,39 @@ package root
 import (
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
 	"github.com/dnote/cli/migrate"
+	"github.com/dnote/cli/output"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var outputFormat string
+
 var root = &cobra.Command{
-	Use:           "dnote",
-	Short:         "Dnote - Instantly capture what you learn while coding",
-	SilenceErrors: true,
-	SilenceUsage:  true,
+	Use:               "dnote",
+	Short:             "Dnote - Instantly capture what you learn while coding",
+	SilenceErrors:     true,
+	SilenceUsage:      true,
+	PersistentPreRunE: setOutput,
+}
+
+func init() {
+	root.PersistentFlags().StringVar(&outputFormat, "output", "text", "The output format: text, json, yaml or tsv")
+}
+
+// setOutput sets the output format. In the structured formats, the messages for
+// humans are printed to stderr in plain text.
+func setOutput(cmd *cobra.Command, args []string) error {
+	if err := output.SetFormat(outputFormat); err != nil {
+		return err
+	}
+
+	if !output.IsText() {
+		log.SetPlain()
+	}
+
+	return nil
 }
 
 // Register adds a new command
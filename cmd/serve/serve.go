@@ -0,0 +1,189 @@
+package serve
+
+import (
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/server"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var addr string
+var dir string
+
+var example = `
+  * Run a sync server on port 3000 of this machine
+  dnote serve
+
+  * Listen on every interface, for a reverse proxy terminating TLS on another host
+  dnote serve --addr :3000
+
+  * Add a user and print the API key
+  dnote serve user add alice
+
+  * List the users
+  dnote serve user list
+
+  * Remove a user along with the notes
+  dnote serve user remove alice`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+func userPreRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return errors.New("Incorrect number of arguments")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new serve command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "serve",
+		Short:   "Run a self-hosted sync server",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	cmd.Flags().StringVarP(&addr, "addr", "", "127.0.0.1:3000", "The address to listen on. The server speaks plain HTTP, so serve other machines through a reverse proxy terminating TLS")
+	cmd.PersistentFlags().StringVarP(&dir, "dir", "", "", "The directory to store the server data in (default $DNOTE_DIR/server)")
+
+	userCmd := &cobra.Command{
+		Use:   "user",
+		Short: "Manage the users of the sync server",
+	}
+
+	addCmd := &cobra.Command{
+		Use:     "add <name>",
+		Short:   "Add a user and print the API key",
+		PreRunE: userPreRun,
+		RunE:    newAddUserRun(ctx),
+	}
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the users",
+		Aliases: []string{"ls"},
+		RunE:    newListUsersRun(ctx),
+	}
+	removeCmd := &cobra.Command{
+		Use:     "remove <name>",
+		Short:   "Remove a user along with the notes",
+		PreRunE: userPreRun,
+		RunE:    newRemoveUserRun(ctx),
+	}
+
+	userCmd.AddCommand(addCmd)
+	userCmd.AddCommand(listCmd)
+	userCmd.AddCommand(removeCmd)
+	cmd.AddCommand(userCmd)
+
+	return cmd
+}
+
+func openServer(ctx infra.DnoteCtx) (*server.Server, error) {
+	path := dir
+	if path == "" {
+		path = filepath.Join(ctx.DnoteDir, "server")
+	}
+
+	s, err := server.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening the server store in %s", path)
+	}
+
+	return s, nil
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		s, err := openServer(ctx)
+		if err != nil {
+			return errors.Wrap(err, "opening the server")
+		}
+		defer s.Close()
+
+		log.Infof("listening on %s\n", addr)
+		if err := http.ListenAndServe(addr, s); err != nil {
+			return errors.Wrap(err, "serving")
+		}
+
+		return nil
+	}
+}
+
+func newAddUserRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		s, err := openServer(ctx)
+		if err != nil {
+			return errors.Wrap(err, "opening the server")
+		}
+		defer s.Close()
+
+		apiKey, err := s.AddUser(args[0])
+		if err != nil {
+			return errors.Wrap(err, "adding the user")
+		}
+
+		log.Successf("added user %s\n", args[0])
+		log.Printf("API key: %s\n", apiKey)
+
+		return nil
+	}
+}
+
+func newListUsersRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		s, err := openServer(ctx)
+		if err != nil {
+			return errors.Wrap(err, "opening the server")
+		}
+		defer s.Close()
+
+		users, err := s.GetUsers()
+		if err != nil {
+			return errors.Wrap(err, "getting users")
+		}
+
+		if len(users) == 0 {
+			log.Infof("no users\n")
+			return nil
+		}
+
+		for _, u := range users {
+			log.Plainf("%s %s\n", log.SprintfBlue(u.Name), time.Unix(u.CreatedOn, 0).Format("Jan 2, 2006 3:04pm (MST)"))
+		}
+
+		return nil
+	}
+}
+
+func newRemoveUserRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		s, err := openServer(ctx)
+		if err != nil {
+			return errors.Wrap(err, "opening the server")
+		}
+		defer s.Close()
+
+		if err := s.RemoveUser(args[0]); err != nil {
+			return errors.Wrap(err, "removing the user")
+		}
+
+		log.Successf("removed user %s\n", args[0])
+
+		return nil
+	}
+}
@@ -0,0 +1,250 @@
+package site
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dnote/cli/core"
+	"github.com/pkg/errors"
+)
+
+// recentCount is the number of the recent notes on the index page
+const recentCount = 20
+
+// bookFilename returns the name of the index page of the book. The characters
+// other than letters, digits, '.', '_' and '-' are replaced so that the name is
+// safe in a path and in a link. The number tells apart the labels with the same
+// name.
+func bookFilename(label string, n int) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+
+		return '-'
+	}, label)
+
+	if n > 0 {
+		return fmt.Sprintf("%s-%d.html", name, n)
+	}
+
+	return fmt.Sprintf("%s.html", name)
+}
+
+// formatTime returns the time in RFC 3339 as required by Atom
+func formatTime(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+// pageData is the data for rendering the page of a book or a note
+type pageData struct {
+	Site Site
+	Book Book
+	Note Note
+}
+
+var siteFuncs = template.FuncMap{
+	"time": formatTime,
+	"date": func(ts int64) string {
+		return time.Unix(ts, 0).UTC().Format("Jan 2, 2006")
+	},
+	"excerpt": core.Excerpt,
+	"recent": func(notes []Note) []Note {
+		if len(notes) > recentCount {
+			return notes[:recentCount]
+		}
+
+		return notes
+	},
+}
+
+const headTmpl = `{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.}}</title>
+{{- end}}`
+
+var indexTmpl = template.Must(template.New("index").Funcs(siteFuncs).Parse(headTmpl + `{{template "head" .Title}}
+<link rel="alternate" type="application/atom+xml" title="{{.Title}}" href="feed.xml">
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<h2>Books</h2>
+<ul>
+{{- range .Books}}
+<li><a href="books/{{.Filename}}">{{.Label}}</a> ({{len .Notes}})</li>
+{{- end}}
+</ul>
+<h2>Recent</h2>
+<ul>
+{{- range recent .Notes}}
+<li><a href="notes/{{.UUID}}.html">{{excerpt .Content}}</a> in <a href="books/{{.Book.Filename}}">{{.Book.Label}}</a> <time datetime="{{time .AddedOn}}">{{date .AddedOn}}</time></li>
+{{- end}}
+</ul>
+<p><a href="feed.xml">Feed</a></p>
+</body>
+</html>
+`))
+
+var bookTmpl = template.Must(template.New("book").Funcs(siteFuncs).Parse(headTmpl + `{{template "head" .Book.Label}}
+<link rel="alternate" type="application/atom+xml" title="{{.Site.Title}}" href="../feed.xml">
+</head>
+<body>
+<p><a href="../index.html">{{.Site.Title}}</a></p>
+<h1>{{.Book.Label}}</h1>
+<ul>
+{{- range .Book.Notes}}
+<li><a href="../notes/{{.UUID}}.html">{{excerpt .Content}}</a> <time datetime="{{time .AddedOn}}">{{date .AddedOn}}</time></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+var noteTmpl = template.Must(template.New("note").Funcs(siteFuncs).Parse(headTmpl + `{{template "head" (excerpt .Note.Content)}}
+<link rel="alternate" type="application/atom+xml" title="{{.Site.Title}}" href="../feed.xml">
+</head>
+<body>
+<p><a href="../index.html">{{.Site.Title}}</a> / <a href="../books/{{.Note.Book.Filename}}">{{.Note.Book.Label}}</a></p>
+<article id="{{.Note.UUID}}">
+<pre>{{.Note.Content}}</pre>
+<footer>
+<time datetime="{{time .Note.AddedOn}}">{{date .Note.AddedOn}}</time>
+{{- if .Note.EditedOn}} (edited <time datetime="{{time .Note.EditedOn}}">{{date .Note.EditedOn}}</time>){{end}}
+{{- range .Note.Tags}} <span class="tag">#{{.}}</span>{{end}}
+</footer>
+</article>
+</body>
+</html>
+`))
+
+// renderFile renders the template with the data into the file at the path
+func renderFile(path string, tmpl *template.Template, data interface{}) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return errors.Wrap(err, "rendering")
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, "writing '%s'", path)
+	}
+
+	return nil
+}
+
+// atomFeed is an Atom feed as defined by RFC 4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+// link returns the link to the path in the site. It is relative to the root of
+// the site if the base URL is not set.
+func (s Site) link(path string) string {
+	if s.BaseURL == "" {
+		return path
+	}
+
+	return fmt.Sprintf("%s/%s", s.BaseURL, path)
+}
+
+// feed returns the Atom feed of the notes. The entries are identified by the
+// uuids of the notes so that they stay the same if the site moves.
+func (s Site) feed() atomFeed {
+	ret := atomFeed{
+		Title:   s.Title,
+		ID:      "urn:dnote:site",
+		Updated: formatTime(0),
+		Author:  atomAuthor{Name: s.Title},
+		Links: []atomLink{
+			{Href: s.link("feed.xml"), Rel: "self"},
+			{Href: s.link("index.html")},
+		},
+		Entries: []atomEntry{},
+	}
+	if s.BaseURL != "" {
+		ret.ID = s.BaseURL + "/"
+	}
+
+	// The notes are ordered by the time they were updated
+	if len(s.Notes) > 0 {
+		ret.Updated = formatTime(s.Notes[0].Updated())
+	}
+
+	for _, note := range s.Notes {
+		entry := atomEntry{
+			Title:     core.Excerpt(note.Content),
+			ID:        "urn:uuid:" + note.UUID,
+			Published: formatTime(note.AddedOn),
+			Updated:   formatTime(note.Updated()),
+			Link:      atomLink{Href: s.link("notes/" + note.UUID + ".html")},
+			Content:   atomContent{Type: "text", Body: note.Content},
+		}
+
+		entry.Categories = append(entry.Categories, atomCategory{Term: note.Book.Label})
+		for _, tag := range note.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+
+		ret.Entries = append(ret.Entries, entry)
+	}
+
+	return ret
+}
+
+// writeFeed writes the Atom feed of the site to the path
+func writeFeed(path string, s Site) error {
+	b, err := xml.MarshalIndent(s.feed(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling the feed")
+	}
+
+	b = append([]byte(xml.Header), b...)
+	b = append(b, '\n')
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return errors.Wrapf(err, "writing '%s'", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dnote/cli/cmd/export"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var out string
+var title string
+var baseURL string
+
+var example = `
+ * Build the site of the public notes
+ dnote site build --out ./public
+
+ * Build the site with absolute links in the feed
+ dnote site build --out ./public --title "TIL" --base-url https://til.example.com`
+
+// NewCmd returns a new site command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "site",
+		Short: "Build a static site of the public notes",
+	}
+
+	buildCmd := &cobra.Command{
+		Use:     "build",
+		Short:   "Render the public notes into a static HTML site",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newBuildRun(ctx),
+	}
+
+	f := buildCmd.Flags()
+	f.StringVarP(&out, "out", "o", "", "The directory to write the site to")
+	f.StringVar(&title, "title", "Dnote", "The title of the site")
+	f.StringVar(&baseURL, "base-url", "", "The URL the site is served at, for the links in the feed")
+
+	cmd.AddCommand(buildCmd)
+
+	return cmd
+}
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+	if out == "" {
+		return errors.New("Missing the directory to write the site to")
+	}
+
+	return nil
+}
+
+func newBuildRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		archive, err := export.GetArchive(ctx, "")
+		if err != nil {
+			return errors.Wrap(err, "getting the notes")
+		}
+
+		s := newSite(archive, title, baseURL)
+		if err := s.write(out); err != nil {
+			return errors.Wrap(err, "writing the site")
+		}
+
+		log.Successf("built the site with %d notes in %d books to %s\n", len(s.Notes), len(s.Books), out)
+
+		return nil
+	}
+}
+
+// Site is the content of the site
+type Site struct {
+	Title   string
+	BaseURL string
+	Books   []Book
+	// Notes are all public notes, the most recently updated first
+	Notes []Note
+}
+
+// Book is a book with public notes
+type Book struct {
+	Label string
+	// Filename is the name of the index page of the book
+	Filename string
+	Notes    []Note
+}
+
+// Note is a public note
+type Note struct {
+	export.ArchiveNote
+	Book *Book
+}
+
+// Updated returns the time the note was last changed
+func (n Note) Updated() int64 {
+	if n.EditedOn > n.AddedOn {
+		return n.EditedOn
+	}
+
+	return n.AddedOn
+}
+
+// newSite returns the site of the public notes in the archive
+func newSite(archive export.Archive, title, baseURL string) Site {
+	ret := Site{Title: title, BaseURL: strings.TrimRight(baseURL, "/"), Books: []Book{}, Notes: []Note{}}
+
+	filenames := map[string]bool{}
+	for _, b := range archive.Books {
+		// Labels differing only in the characters left out of the file names
+		// are told apart by a number
+		filename := bookFilename(b.Label, 0)
+		for i := 2; filenames[filename]; i++ {
+			filename = bookFilename(b.Label, i)
+		}
+
+		book := Book{Label: b.Label, Filename: filename}
+		for _, n := range b.Notes {
+			if n.Public {
+				book.Notes = append(book.Notes, Note{ArchiveNote: n})
+			}
+		}
+
+		if len(book.Notes) > 0 {
+			filenames[filename] = true
+			ret.Books = append(ret.Books, book)
+		}
+	}
+
+	for i := range ret.Books {
+		for j := range ret.Books[i].Notes {
+			ret.Books[i].Notes[j].Book = &ret.Books[i]
+			ret.Notes = append(ret.Notes, ret.Books[i].Notes[j])
+		}
+	}
+
+	sort.SliceStable(ret.Notes, func(i, j int) bool {
+		return ret.Notes[i].Updated() > ret.Notes[j].Updated()
+	})
+
+	return ret
+}
+
+// write renders the site into the directory. The pages of the books and the
+// notes from a previous build are removed so that unpublished notes do not stay
+// on the site.
+func (s Site) write(dir string) error {
+	for _, sub := range []string{"books", "notes"} {
+		path := filepath.Join(dir, sub)
+		if err := os.RemoveAll(path); err != nil {
+			return errors.Wrapf(err, "removing '%s'", path)
+		}
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return errors.Wrapf(err, "creating '%s'", path)
+		}
+	}
+
+	if err := renderFile(filepath.Join(dir, "index.html"), indexTmpl, s); err != nil {
+		return errors.Wrap(err, "writing the index")
+	}
+
+	for _, book := range s.Books {
+		path := filepath.Join(dir, "books", book.Filename)
+		if err := renderFile(path, bookTmpl, pageData{Site: s, Book: book}); err != nil {
+			return errors.Wrapf(err, "writing the page of '%s'", book.Label)
+		}
+	}
+
+	for _, note := range s.Notes {
+		path := filepath.Join(dir, "notes", note.UUID+".html")
+		if err := renderFile(path, noteTmpl, pageData{Site: s, Note: note}); err != nil {
+			return errors.Wrapf(err, "writing the page of '%s'", note.UUID)
+		}
+	}
+
+	if err := writeFeed(filepath.Join(dir, "feed.xml"), s); err != nil {
+		return errors.Wrap(err, "writing the feed")
+	}
+
+	return nil
+}
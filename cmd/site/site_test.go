@@ -0,0 +1,137 @@
+package site
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dnote/cli/cmd/export"
+	"github.com/dnote/cli/testutils"
+	"github.com/dnote/cli/utils"
+)
+
+func newTestArchive() export.Archive {
+	return export.Archive{
+		Books: []export.ArchiveBook{
+			{
+				Label: "c/c++",
+				Notes: []export.ArchiveNote{
+					{UUID: "note-1", Content: "pointers", AddedOn: 100, Public: true},
+				},
+			},
+			{
+				Label: "c+c++",
+				Notes: []export.ArchiveNote{
+					{UUID: "note-2", Content: "templates\nare <generic>", AddedOn: 200, EditedOn: 400, Public: true, Tags: []string{"generics"}},
+				},
+			},
+			{
+				Label: "js",
+				Notes: []export.ArchiveNote{
+					{UUID: "note-3", Content: "private", AddedOn: 300},
+					{UUID: "note-4", Content: "closures", AddedOn: 300, Public: true},
+				},
+			},
+			{
+				Label: "private",
+				Notes: []export.ArchiveNote{
+					{UUID: "note-5", Content: "secret", AddedOn: 500},
+				},
+			},
+		},
+	}
+}
+
+func TestNewSite(t *testing.T) {
+	s := newSite(newTestArchive(), "TIL", "https://til.example.com/")
+
+	testutils.AssertEqual(t, s.BaseURL, "https://til.example.com", "base url mismatch")
+	testutils.AssertEqual(t, len(s.Books), 3, "books count mismatch")
+	testutils.AssertEqual(t, s.Books[0].Filename, "c-c--.html", "book 1 filename mismatch")
+	testutils.AssertEqual(t, s.Books[1].Filename, "c-c---2.html", "book 2 filename mismatch")
+	testutils.AssertEqual(t, len(s.Books[2].Notes), 1, "private notes should be left out")
+
+	uuids := []string{}
+	for _, n := range s.Notes {
+		uuids = append(uuids, n.UUID)
+	}
+	testutils.AssertDeepEqual(t, uuids, []string{"note-2", "note-4", "note-1"}, "notes should be ordered by the update time")
+	testutils.AssertEqual(t, s.Notes[0].Book.Label, "c+c++", "book of the note mismatch")
+}
+
+func TestFeed(t *testing.T) {
+	s := newSite(newTestArchive(), "TIL", "https://til.example.com")
+
+	b, err := xml.Marshal(s.feed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(b, &feed); err != nil {
+		t.Fatal(err)
+	}
+
+	testutils.AssertEqual(t, feed.ID, "https://til.example.com/", "feed id mismatch")
+	testutils.AssertEqual(t, feed.Updated, "1970-01-01T00:06:40Z", "feed updated mismatch")
+	testutils.AssertEqual(t, feed.Links[0].Href, "https://til.example.com/feed.xml", "self link mismatch")
+	testutils.AssertEqual(t, len(feed.Entries), 3, "entries count mismatch")
+
+	entry := feed.Entries[0]
+	testutils.AssertEqual(t, entry.ID, "urn:uuid:note-2", "entry id mismatch")
+	testutils.AssertEqual(t, entry.Title, "templates...", "entry title mismatch")
+	testutils.AssertEqual(t, entry.Published, "1970-01-01T00:03:20Z", "entry published mismatch")
+	testutils.AssertEqual(t, entry.Link.Href, "https://til.example.com/notes/note-2.html", "entry link mismatch")
+	testutils.AssertEqual(t, entry.Content.Body, "templates\nare <generic>", "entry content mismatch")
+	testutils.AssertDeepEqual(t, entry.Categories, []atomCategory{{Term: "c+c++"}, {Term: "generics"}}, "entry categories mismatch")
+
+	relative := newSite(newTestArchive(), "TIL", "").feed()
+	testutils.AssertEqual(t, relative.ID, "urn:dnote:site", "feed id mismatch")
+	testutils.AssertEqual(t, relative.Entries[0].Link.Href, "notes/note-2.html", "relative link mismatch")
+}
+
+func TestWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnote-site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A page of a note unpublished since the last build
+	if err := os.MkdirAll(filepath.Join(dir, "notes"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	stalePath := filepath.Join(dir, "notes", "note-5.html")
+	if err := ioutil.WriteFile(stalePath, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	s := newSite(newTestArchive(), "TIL", "")
+	if err := s.write(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	for _, path := range []string{"index.html", "feed.xml", "books/c-c--.html", "books/js.html", "notes/note-1.html", "notes/note-4.html"} {
+		testutils.AssertEqual(t, utils.FileExists(filepath.Join(dir, path)), true, path+" does not exist")
+	}
+	testutils.AssertEqual(t, utils.FileExists(stalePath), false, "page of an unpublished note exists")
+	testutils.AssertEqual(t, utils.FileExists(filepath.Join(dir, "notes", "note-3.html")), false, "page of a private note exists")
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutils.AssertEqual(t, strings.Contains(string(index), `<a href="books/c-c---2.html">c&#43;c&#43;&#43;</a> (1)`), true, "index does not link to the book")
+
+	note, err := ioutil.ReadFile(filepath.Join(dir, "notes", "note-2.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutils.AssertEqual(t, strings.Contains(string(note), "<pre>templates\nare &lt;generic&gt;</pre>"), true, "note content is not escaped")
+	testutils.AssertEqual(t, strings.Contains(string(note), `<span class="tag">#generics</span>`), true, "note tags are not rendered")
+}
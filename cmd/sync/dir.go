@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/actions"
+	"github.com/pkg/errors"
+)
+
+// segmentExt is the extension of the files holding the batches of actions. A
+// segment is named after its sequence number, which serves as the bookmark.
+const segmentExt = ".json"
+
+// dirTransport syncs through a directory shared by the machines, such as a
+// mounted drive. Each sync appends a segment of actions to the directory.
+type dirTransport struct {
+	path string
+}
+
+func (t *dirTransport) send(actionSlice []actions.Action, bookmark int) error {
+	if err := os.MkdirAll(t.path, 0755); err != nil {
+		return errors.Wrap(err, "creating the directory")
+	}
+
+	if _, err := writeSegment(t.path, actionSlice); err != nil {
+		return errors.Wrap(err, "writing a segment")
+	}
+
+	return nil
+}
+
+func (t *dirTransport) receive(bookmark int) (responseData, error) {
+	return readSegments(t.path, bookmark)
+}
+
+// getSegments returns the sequence numbers of the segments in the directory in order
+func getSegments(dir string) ([]int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the directory")
+	}
+
+	ret := []int{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+
+		ret = append(ret, seq)
+	}
+
+	sort.Ints(ret)
+
+	return ret, nil
+}
+
+func segmentPath(dir string, seq int) string {
+	return filepath.Join(dir, fmt.Sprintf("%010d%s", seq, segmentExt))
+}
+
+// writeSegment writes the actions in a new segment after the last one and
+// returns its sequence number. A segment is never overwritten even if another
+// machine writes one at the same time.
+func writeSegment(dir string, actionSlice []actions.Action) (int, error) {
+	if len(actionSlice) == 0 {
+		return 0, nil
+	}
+
+	b, err := json.Marshal(actionSlice)
+	if err != nil {
+		return 0, errors.Wrap(err, "marshalling actions")
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".segment")
+	if err != nil {
+		return 0, errors.Wrap(err, "creating a temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return 0, errors.Wrap(err, "writing the temporary file")
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, errors.Wrap(err, "closing the temporary file")
+	}
+
+	for {
+		segments, err := getSegments(dir)
+		if err != nil {
+			return 0, errors.Wrap(err, "getting segments")
+		}
+
+		seq := 1
+		if len(segments) > 0 {
+			seq = segments[len(segments)-1] + 1
+		}
+
+		// Linking fails if the segment exists, unlike renaming
+		err = os.Link(tmp.Name(), segmentPath(dir, seq))
+		if err == nil {
+			return seq, nil
+		}
+		if !os.IsExist(err) {
+			return 0, errors.Wrap(err, "linking the segment")
+		}
+	}
+}
+
+// readSegments returns the actions in the segments after the bookmark
+func readSegments(dir string, bookmark int) (responseData, error) {
+	ret := responseData{Actions: []actions.Action{}, Bookmark: bookmark}
+
+	segments, err := getSegments(dir)
+	if os.IsNotExist(errors.Cause(err)) {
+		return ret, nil
+	} else if err != nil {
+		return ret, errors.Wrap(err, "getting segments")
+	}
+
+	for _, seq := range segments {
+		if seq <= bookmark {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(segmentPath(dir, seq))
+		if err != nil {
+			return ret, errors.Wrapf(err, "reading segment %d", seq)
+		}
+
+		var actionSlice []actions.Action
+		if err := json.Unmarshal(b, &actionSlice); err != nil {
+			return ret, errors.Wrapf(err, "unmarshalling segment %d", seq)
+		}
+
+		ret.Actions = append(ret.Actions, actionSlice...)
+		ret.Bookmark = seq
+	}
+
+	return ret, nil
+}
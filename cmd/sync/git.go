@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// gitPushAttempts is the number of times to retry pushing a segment when
+// another machine pushed first
+const gitPushAttempts = 5
+
+// gitTransport syncs through a git repository. Each sync commits a segment of
+// actions to a clone of the repository and pushes it.
+type gitTransport struct {
+	url string
+	// dir is the path to the clone
+	dir string
+}
+
+func (t *gitTransport) git(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = t.dir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(out), errors.Wrapf(err, "running git %s: %s", args[0], strings.TrimSpace(string(out)))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// update clones the repository if needed and resets the clone to the remote branch
+func (t *gitTransport) update() error {
+	if !utils.FileExists(filepath.Join(t.dir, ".git")) {
+		if err := os.MkdirAll(t.dir, 0755); err != nil {
+			return errors.Wrap(err, "creating the directory")
+		}
+		if _, err := t.git("clone", "--quiet", t.url, "."); err != nil {
+			return errors.Wrap(err, "cloning the repository")
+		}
+		if email, _ := t.git("config", "user.email"); email == "" {
+			if _, err := t.git("config", "user.email", "dnote@localhost"); err != nil {
+				return errors.Wrap(err, "configuring the user email")
+			}
+			if _, err := t.git("config", "user.name", "dnote"); err != nil {
+				return errors.Wrap(err, "configuring the user name")
+			}
+		}
+	}
+
+	if _, err := t.git("fetch", "--quiet", "origin"); err != nil {
+		return errors.Wrap(err, "fetching")
+	}
+
+	branch, err := t.git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return errors.Wrap(err, "getting the branch")
+	}
+
+	// The repository is empty until the first push
+	remoteBranch := fmt.Sprintf("origin/%s", branch)
+	if _, err := t.git("rev-parse", "--verify", "--quiet", remoteBranch); err != nil {
+		return nil
+	}
+
+	if _, err := t.git("reset", "--quiet", "--hard", remoteBranch); err != nil {
+		return errors.Wrap(err, "resetting to the remote branch")
+	}
+
+	return nil
+}
+
+func (t *gitTransport) send(actionSlice []actions.Action, bookmark int) error {
+	if len(actionSlice) == 0 {
+		return nil
+	}
+
+	var pushErr error
+	for i := 0; i < gitPushAttempts; i++ {
+		if err := t.update(); err != nil {
+			return errors.Wrap(err, "updating the clone")
+		}
+
+		seq, err := writeSegment(t.dir, actionSlice)
+		if err != nil {
+			return errors.Wrap(err, "writing a segment")
+		}
+		if _, err := t.git("add", filepath.Base(segmentPath(t.dir, seq))); err != nil {
+			return errors.Wrap(err, "adding the segment")
+		}
+		if _, err := t.git("commit", "--quiet", "-m", fmt.Sprintf("Add %d actions", len(actionSlice))); err != nil {
+			return errors.Wrap(err, "committing the segment")
+		}
+
+		if _, pushErr = t.git("push", "--quiet", "origin", "HEAD"); pushErr == nil {
+			return nil
+		}
+
+		// Another machine pushed first. Discard the commit and write the segment
+		// after theirs.
+		if _, err := t.git("reset", "--quiet", "--hard", "HEAD~1"); err != nil {
+			// The commit is the first one in the repository
+			if _, err := t.git("update-ref", "-d", "HEAD"); err != nil {
+				return errors.Wrap(err, "discarding the commit")
+			}
+		}
+	}
+
+	return errors.Wrap(pushErr, "pushing the segment")
+}
+
+func (t *gitTransport) receive(bookmark int) (responseData, error) {
+	if err := t.update(); err != nil {
+		return responseData{}, errors.Wrap(err, "updating the clone")
+	}
+
+	return readSegments(t.dir, bookmark)
+}
@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/dnote/actions"
+	"github.com/pkg/errors"
+)
+
+type syncPayload struct {
+	Bookmark int    `json:"bookmark"`
+	Actions  []byte `json:"actions"` // gziped
+}
+
+// httpTransport syncs with a server implementing the dnote sync protocol. The
+// server stores the actions and returns the delta in a single request.
+type httpTransport struct {
+	endpoint string
+	apiKey   string
+	version  string
+	// body is the response to the last request
+	body []byte
+}
+
+func (t *httpTransport) send(actionSlice []actions.Action, bookmark int) error {
+	payload, err := newPayload(actionSlice, bookmark)
+	if err != nil {
+		return errors.Wrap(err, "getting the request payload")
+	}
+
+	resp, err := t.postActions(payload)
+	if err != nil {
+		return errors.Wrap(err, "posting to the server")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading the response body")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("Server error: %s", string(body))
+	}
+
+	t.body = body
+
+	return nil
+}
+
+func (t *httpTransport) receive(bookmark int) (responseData, error) {
+	var ret responseData
+	if err := json.Unmarshal(t.body, &ret); err != nil {
+		return ret, errors.Wrap(err, "unmarshalling the payload")
+	}
+
+	return ret, nil
+}
+
+func newPayload(actions []actions.Action, bookmark int) (*bytes.Buffer, error) {
+	compressedActions, err := compressActions(actions)
+	if err != nil {
+		return &bytes.Buffer{}, errors.Wrap(err, "compressing actions")
+	}
+
+	payload := syncPayload{
+		Bookmark: bookmark,
+		Actions:  compressedActions,
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return &bytes.Buffer{}, errors.Wrap(err, "marshalling paylaod into JSON")
+	}
+
+	ret := bytes.NewBuffer(b)
+	return ret, nil
+}
+
+func compressActions(actions []actions.Action) ([]byte, error) {
+	b, err := json.Marshal(&actions)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling actions into JSON")
+	}
+
+	var buf bytes.Buffer
+	g := gzip.NewWriter(&buf)
+
+	_, err = g.Write(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "writing to gzip writer")
+	}
+
+	if err = g.Close(); err != nil {
+		return nil, errors.Wrap(err, "closing gzip writer")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (t *httpTransport) postActions(payload io.Reader) (*http.Response, error) {
+	endpoint := fmt.Sprintf("%s/v1/sync", t.endpoint)
+	req, err := http.NewRequest("POST", endpoint, payload)
+	if err != nil {
+		return &http.Response{}, errors.Wrap(err, "forming an HTTP request")
+	}
+
+	req.Header.Set("Authorization", t.apiKey)
+	req.Header.Set("CLI-Version", t.version)
+
+	client := http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return &http.Response{}, errors.Wrap(err, "making a request")
+	}
+
+	return resp, nil
+}
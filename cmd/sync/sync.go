@@ -1,25 +1,28 @@
 package sync
 
 import (
-	"bytes"
-	"compress/gzip"
 	"database/sql"
-	"encoding/json"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 
 	"github.com/dnote/actions"
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
 	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/output"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var remoteName string
+
 var example = `
-  dnote sync`
+  * Sync with the current remote
+  dnote sync
+
+  * Sync with a remote added by "dnote remote add"
+  dnote sync --remote team
+
+  * Sync the current remote with another endpoint
+  dnote sync --remote https://dnote.example.com/api`
 
 // NewCmd returns a new sync command
 func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
@@ -31,6 +34,9 @@ func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
 		RunE:    newRun(ctx),
 	}
 
+	f := cmd.Flags()
+	f.StringVarP(&remoteName, "remote", "r", "", "The name of the remote to sync with, or an endpoint to sync the current remote with")
+
 	return cmd
 }
 
@@ -39,92 +45,235 @@ type responseData struct {
 	Bookmark int              `json:"bookmark"`
 }
 
-type syncPayload struct {
-	Bookmark int    `json:"bookmark"`
-	Actions  []byte `json:"actions"` // gziped
+// prepareJournal records the local actions to be sent to the remote in the
+// journal and returns them. The actions acknowledged by the remote in an
+// interrupted sync are not sent again. The actions sent in an interrupted sync
+// without an acknowledgement are sent again because the remote might not have
+// received them.
+func prepareJournal(db *sql.DB, remoteName string) ([]actions.Action, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "beginning a transaction")
+	}
+
+	if _, err := tx.Exec("DELETE FROM sync_journal WHERE remote = ? AND acknowledged = ?", remoteName, false); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "clearing unacknowledged actions")
+	}
+
+	ret, err := getLocalActions(tx, remoteName)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "getting local actions")
+	}
+
+	for _, action := range ret {
+		if _, err := tx.Exec("INSERT INTO sync_journal (remote, action_uuid, acknowledged) VALUES (?, ?, ?)", remoteName, action.UUID, false); err != nil {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "recording an action in the journal")
+		}
+	}
+
+	tx.Commit()
+
+	return ret, nil
+}
+
+// countAcknowledged returns the number of actions acknowledged by the remote in
+// an interrupted sync
+func countAcknowledged(db *sql.DB, remoteName string) (int, error) {
+	var ret int
+	if err := db.QueryRow("SELECT count(*) FROM sync_journal WHERE remote = ? AND acknowledged = ?", remoteName, true).Scan(&ret); err != nil {
+		return ret, errors.Wrap(err, "counting acknowledged actions")
+	}
+
+	return ret, nil
+}
+
+// acknowledgeJournal marks the actions in the journal as received by the remote
+func acknowledgeJournal(db *sql.DB, remoteName string) error {
+	if _, err := db.Exec("UPDATE sync_journal SET acknowledged = ? WHERE remote = ?", true, remoteName); err != nil {
+		return errors.Wrap(err, "updating the journal")
+	}
+
+	return nil
+}
+
+// applyDelta records the local actions acknowledged by the remote, reduces the
+// actions returned by the remote and advances the bookmark. A local action is
+// deleted once every remote it is for has acknowledged it. The books added by a
+// remote other than the default one are assigned to it. Either all of them take
+// effect or none does. It returns the number of new conflicts.
+func applyDelta(ctx infra.DnoteCtx, remote core.Remote, respData responseData) (int, error) {
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return 0, errors.Wrap(err, "beginning a transaction")
+	}
+
+	localActions, err := getAcknowledgedActions(tx, remote.Name)
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "getting acknowledged actions")
+	}
+
+	_, err = tx.Exec(`DELETE FROM pending_actions
+		WHERE remote = ? AND action_uuid IN (SELECT action_uuid FROM sync_journal WHERE remote = ? AND acknowledged = ?)`, remote.Name, remote.Name, true)
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "clearing acknowledged actions")
+	}
+	if _, err = tx.Exec("DELETE FROM actions WHERE uuid NOT IN (SELECT action_uuid FROM pending_actions)"); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "deleting received actions")
+	}
+
+	var lastBookRowID int
+	if err := tx.QueryRow("SELECT coalesce(max(rowid), 0) FROM books").Scan(&lastBookRowID); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "getting the last book")
+	}
+
+	// The actions quarantined by an older version are older than the returned ones
+	if _, err := core.ReduceQuarantined(ctx, tx); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "reducing quarantined actions")
+	}
+
+	conflictCount, err := core.ReduceAllWithConflicts(ctx, tx, respData.Actions, localActions)
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "reducing returned actions")
+	}
+
+	if remote.Name != core.DefaultRemote {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO remote_books (remote, book_uuid)
+			SELECT ?, uuid FROM books WHERE rowid > ?`, remote.Name, lastBookRowID)
+		if err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "assigning the added books")
+		}
+	}
+
+	if err = core.UpdateRemoteBookmark(tx, remote.Name, respData.Bookmark); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "updating the bookmark")
+	}
+
+	if _, err = tx.Exec("DELETE FROM sync_journal WHERE remote = ?", remote.Name); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "clearing the journal")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "committing the transaction")
+	}
+
+	return conflictCount, nil
+}
+
+// handleKeyError remembers the key needed to decrypt the contents from another
+// machine so that the user can add it
+func handleKeyError(db *sql.DB, keyErr *core.KeyError) error {
+	if err := core.SetMissingKeySalt(db, keyErr.Salt); err != nil {
+		return errors.Wrap(err, "saving the missing key")
+	}
+
+	if keyErr.Wrong {
+		return errors.New("the notes from another machine could not be decrypted with the passphrase. run `dnote keys add` with the right passphrase, then sync again")
+	}
+
+	return errors.New("the notes from another machine are encrypted with a passphrase this machine does not have. run `dnote keys add` with the passphrase, then sync again")
 }
 
 func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		db := ctx.DB
 
-		config, err := core.ReadConfig(ctx)
+		remote, err := core.GetRemote(ctx, remoteName)
 		if err != nil {
-			return errors.Wrap(err, "reading the config")
+			return errors.Wrap(err, "getting the remote")
 		}
-		if config.APIKey == "" {
-			log.Error("login required. please run `dnote login`\n")
+		t, err := newTransport(ctx, remote)
+		if err == errLoginRequired {
+			if remote.Name == core.DefaultRemote {
+				log.Error("login required. please run `dnote login`\n")
+			} else {
+				log.Errorf("login required. please run `dnote login --remote %s`\n", remote.Name)
+			}
 			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "getting the transport")
 		}
-
-		var bookmark int
-		err = db.QueryRow("SELECT value FROM system WHERE key = ?", "bookmark").Scan(&bookmark)
-		if err != nil {
-			return errors.Wrap(err, "getting bookmark")
+		if remote.Name != core.DefaultRemote {
+			log.Infof("syncing with %s (%s)\n", remote.Name, remote.Endpoint)
 		}
 
-		actions, err := getLocalActions(db)
+		ackCount, err := countAcknowledged(db, remote.Name)
 		if err != nil {
-			return errors.Wrap(err, "getting local actions")
+			return errors.Wrap(err, "reading the journal")
 		}
-
-		payload, err := newPayload(actions, bookmark)
-		if err != nil {
-			return errors.Wrap(err, "getting the request payload")
+		if ackCount > 0 {
+			log.Infof("resuming the interrupted sync. %d changes were already written\n", ackCount)
 		}
 
-		log.Infof("writing changes (total %d).", len(actions))
-		resp, err := postActions(ctx, config.APIKey, payload)
+		actions, err := prepareJournal(db, remote.Name)
 		if err != nil {
-			return errors.Wrap(err, "posting to the server")
+			return errors.Wrap(err, "preparing the journal")
 		}
 
-		body, err := ioutil.ReadAll(resp.Body)
+		// Contents are encrypted only when they leave this machine
+		encrypted, err := core.EncryptActions(ctx, actions)
 		if err != nil {
-			return errors.Wrap(err, "reading the response body")
+			return errors.Wrap(err, "encrypting the changes")
 		}
 
-		if resp.StatusCode != http.StatusOK {
-			bodyStr := string(body)
-
-			fmt.Println("")
-			return errors.Errorf("Server error: %s", bodyStr)
+		log.Infof("writing changes (total %d).", len(actions))
+		if err := t.send(encrypted, remote.Bookmark); err != nil {
+			log.Raw("\n")
+			return errors.Wrap(err, "sending the changes")
 		}
 
-		fmt.Println(" done.")
-
-		var respData responseData
-		if err = json.Unmarshal(body, &respData); err != nil {
-			return errors.Wrap(err, "unmarshalling the payload")
+		// The remote has successfully stored our actions. Remember it so that
+		// they are not sent again even if the rest of the sync fails.
+		if err := acknowledgeJournal(db, remote.Name); err != nil {
+			return errors.Wrap(err, "acknowledging actions")
 		}
 
-		// First, remove our actions because server has successfully ingested them
-		if _, err = db.Exec("DELETE FROM actions"); err != nil {
-			return errors.Wrap(err, "deleting actions")
-		}
+		log.Raw(" done.\n")
 
-		tx, err := db.Begin()
+		respData, err := t.receive(remote.Bookmark)
 		if err != nil {
-			return errors.Wrap(err, "beginning a transaction")
+			return errors.Wrap(err, "receiving the changes")
 		}
 
 		log.Infof("resolving delta (total %d).", len(respData.Actions))
-		if err := core.ReduceAll(ctx, tx, respData.Actions); err != nil {
-			tx.Rollback()
-			return errors.Wrap(err, "reducing returned actions")
-		}
-
-		if _, err = tx.Exec("UPDATE system SET value = ? WHERE key = ?", respData.Bookmark, "bookmark"); err != nil {
-			tx.Rollback()
-			return errors.Wrap(err, "updating the bookmark")
+		conflictCount, err := applyDelta(ctx, remote, respData)
+		if keyErr, ok := errors.Cause(err).(*core.KeyError); ok {
+			log.Raw("\n")
+			return handleKeyError(db, keyErr)
+		} else if err != nil {
+			log.Raw("\n")
+			return errors.Wrap(err, "applying the delta")
 		}
 
-		fmt.Println(" done.")
+		log.Raw(" done.\n")
 
-		tx.Commit()
+		if conflictCount > 0 {
+			log.Warnf("%d notes were also edited on another machine. to resolve, see `dnote conflicts`\n", conflictCount)
+		}
 
 		log.Success("success\n")
 
+		if err := output.Print(output.Sync{
+			Remote:    remote.Name,
+			Sent:      len(actions),
+			Received:  len(respData.Actions),
+			Conflicts: conflictCount,
+			Bookmark:  respData.Bookmark,
+		}); err != nil {
+			return errors.Wrap(err, "printing the result")
+		}
+
 		if err := core.CheckUpdate(ctx); err != nil {
 			log.Error(errors.Wrap(err, "automatically checking updates").Error())
 		}
@@ -133,70 +282,48 @@ func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	}
 }
 
-func newPayload(actions []actions.Action, bookmark int) (*bytes.Buffer, error) {
-	compressedActions, err := compressActions(actions)
-	if err != nil {
-		return &bytes.Buffer{}, errors.Wrap(err, "compressing actions")
-	}
-
-	payload := syncPayload{
-		Bookmark: bookmark,
-		Actions:  compressedActions,
-	}
-
-	b, err := json.Marshal(payload)
-	if err != nil {
-		return &bytes.Buffer{}, errors.Wrap(err, "marshalling paylaod into JSON")
-	}
-
-	ret := bytes.NewBuffer(b)
-	return ret, nil
-}
-
-func compressActions(actions []actions.Action) ([]byte, error) {
-	b, err := json.Marshal(&actions)
-	if err != nil {
-		return nil, errors.Wrap(err, "marshalling actions into JSON")
-	}
-
-	var buf bytes.Buffer
-	g := gzip.NewWriter(&buf)
+// getAcknowledgedActions returns the local actions acknowledged by the remote
+// in the current sync
+func getAcknowledgedActions(tx *sql.Tx, remoteName string) ([]actions.Action, error) {
+	ret := []actions.Action{}
 
-	_, err = g.Write(b)
+	rows, err := tx.Query(`SELECT uuid, schema, type, data, timestamp
+		FROM actions
+		WHERE uuid IN (SELECT action_uuid FROM sync_journal WHERE remote = ? AND acknowledged = ?)`, remoteName, true)
 	if err != nil {
-		return nil, errors.Wrap(err, "writing to gzip writer")
+		return ret, errors.Wrap(err, "querying actions")
 	}
+	defer rows.Close()
 
-	if err = g.Close(); err != nil {
-		return nil, errors.Wrap(err, "closing gzip writer")
-	}
+	for rows.Next() {
+		var action actions.Action
 
-	return buf.Bytes(), nil
-}
+		err = rows.Scan(&action.UUID, &action.Schema, &action.Type, &action.Data, &action.Timestamp)
+		if err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
 
-func postActions(ctx infra.DnoteCtx, APIKey string, payload io.Reader) (*http.Response, error) {
-	endpoint := fmt.Sprintf("%s/v1/sync", ctx.APIEndpoint)
-	req, err := http.NewRequest("POST", endpoint, payload)
-	if err != nil {
-		return &http.Response{}, errors.Wrap(err, "forming an HTTP request")
+		ret = append(ret, action)
 	}
 
-	req.Header.Set("Authorization", APIKey)
-	req.Header.Set("CLI-Version", ctx.Version)
-
-	client := http.Client{}
-	resp, err := client.Do(req)
+	err = rows.Err()
 	if err != nil {
-		return &http.Response{}, errors.Wrap(err, "making a request")
+		return ret, errors.Wrap(err, "scanning rows")
 	}
 
-	return resp, nil
+	return ret, nil
 }
 
-func getLocalActions(db *sql.DB) ([]actions.Action, error) {
+// getLocalActions returns the local actions for the remote that are not in the
+// journal
+func getLocalActions(tx *sql.Tx, remoteName string) ([]actions.Action, error) {
 	ret := []actions.Action{}
 
-	rows, err := db.Query("SELECT uuid, schema, type, data, timestamp FROM actions")
+	rows, err := tx.Query(`SELECT uuid, schema, type, data, timestamp
+		FROM actions
+		WHERE uuid IN (SELECT action_uuid FROM pending_actions WHERE remote = ?)
+			AND uuid NOT IN (SELECT action_uuid FROM sync_journal WHERE remote = ?)
+		ORDER BY rowid ASC`, remoteName, remoteName)
 	if err != nil {
 		return ret, errors.Wrap(err, "querying actions")
 	}
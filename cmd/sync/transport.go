@@ -0,0 +1,55 @@
+package sync
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+)
+
+// errLoginRequired is returned when the remote requires an API key which is not set
+var errLoginRequired = errors.New("login required")
+
+// transport exchanges actions with a remote
+type transport interface {
+	// send makes the remote durably store the local actions. Once it returns
+	// without an error, the actions are not sent again.
+	send(actionSlice []actions.Action, bookmark int) error
+	// receive returns the actions the remote has after the bookmark, including
+	// the ones just sent, and the new bookmark
+	receive(bookmark int) (responseData, error)
+}
+
+// newTransport returns the transport for the endpoint of the remote. An
+// endpoint is either
+//   - an HTTP URL of a server implementing the dnote sync protocol
+//   - a git URL prefixed with "git+", such as git+ssh://host/notes.git
+//   - a path to a directory, optionally prefixed with "file://"
+func newTransport(ctx infra.DnoteCtx, remote core.Remote) (transport, error) {
+	endpoint := remote.Endpoint
+
+	switch {
+	case endpoint == "":
+		return nil, errors.Errorf("no endpoint is configured for the remote '%s'", remote.Name)
+	case strings.HasPrefix(endpoint, "http://"), strings.HasPrefix(endpoint, "https://"):
+		if remote.APIKey == "" {
+			return nil, errLoginRequired
+		}
+
+		return &httpTransport{endpoint: endpoint, apiKey: remote.APIKey, version: ctx.Version}, nil
+	case strings.HasPrefix(endpoint, "git+"):
+		return &gitTransport{
+			url: strings.TrimPrefix(endpoint, "git+"),
+			dir: filepath.Join(ctx.DnoteDir, "remotes", remote.Name),
+		}, nil
+	case strings.HasPrefix(endpoint, "file://"):
+		return &dirTransport{path: strings.TrimPrefix(endpoint, "file://")}, nil
+	case filepath.IsAbs(endpoint):
+		return &dirTransport{path: endpoint}, nil
+	}
+
+	return nil, errors.Errorf("unsupported endpoint '%s'", endpoint)
+}
@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func newTestAction(t *testing.T, uuid, bookName string) actions.Action {
+	b, err := json.Marshal(actions.AddBookDataV1{BookName: bookName})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+
+	return actions.Action{
+		UUID:      uuid,
+		Schema:    1,
+		Type:      actions.ActionAddBook,
+		Data:      b,
+		Timestamp: 1517629805,
+	}
+}
+
+func getActionUUIDs(data responseData) []string {
+	ret := []string{}
+	for _, action := range data.Actions {
+		ret = append(ret, action.UUID)
+	}
+
+	return ret
+}
+
+// testTransports syncs two machines through the given transports
+func testTransports(t *testing.T, a, b transport) {
+	// Execute
+	if err := a.send([]actions.Action{newTestAction(t, "a-1", "js")}, 0); err != nil {
+		t.Fatal(errors.Wrap(err, "sending from a"))
+	}
+	if err := b.send([]actions.Action{newTestAction(t, "b-1", "linux"), newTestAction(t, "b-2", "css")}, 0); err != nil {
+		t.Fatal(errors.Wrap(err, "sending from b"))
+	}
+	if err := b.send([]actions.Action{}, 0); err != nil {
+		t.Fatal(errors.Wrap(err, "sending nothing from b"))
+	}
+
+	// Test
+	deltaA, err := a.receive(0)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "receiving on a"))
+	}
+	deltaB, err := b.receive(1)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "receiving on b"))
+	}
+	deltaNone, err := a.receive(2)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "receiving after the last segment"))
+	}
+
+	testutils.AssertDeepEqual(t, getActionUUIDs(deltaA), []string{"a-1", "b-1", "b-2"}, "delta of a mismatch")
+	testutils.AssertEqual(t, deltaA.Bookmark, 2, "bookmark of a mismatch")
+	testutils.AssertDeepEqual(t, getActionUUIDs(deltaB), []string{"b-1", "b-2"}, "delta of b mismatch")
+	testutils.AssertEqual(t, deltaB.Bookmark, 2, "bookmark of b mismatch")
+	testutils.AssertEqual(t, len(deltaNone.Actions), 0, "delta after the last segment mismatch")
+	testutils.AssertEqual(t, deltaNone.Bookmark, 2, "bookmark after the last segment mismatch")
+}
+
+func TestDirTransport(t *testing.T) {
+	// Setup
+	dir, err := ioutil.TempDir("", "dnote-sync")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "shared")
+
+	testTransports(t, &dirTransport{path: path}, &dirTransport{path: path})
+}
+
+func TestGitTransport(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Setup
+	dir, err := ioutil.TempDir("", "dnote-sync")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	repo := filepath.Join(dir, "notes.git")
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", repo).CombinedOutput(); err != nil {
+		t.Fatal(errors.Wrapf(err, "creating a bare repository: %s", out))
+	}
+
+	a := &gitTransport{url: repo, dir: filepath.Join(dir, "a")}
+	b := &gitTransport{url: repo, dir: filepath.Join(dir, "b")}
+
+	// Clone on both machines before either pushes so that b has to catch up
+	if err := a.update(); err != nil {
+		t.Fatal(errors.Wrap(err, "cloning on a"))
+	}
+	if err := b.update(); err != nil {
+		t.Fatal(errors.Wrap(err, "cloning on b"))
+	}
+
+	testTransports(t, a, b)
+
+	out, err := exec.Command("git", "--git-dir", repo, "rev-list", "--count", "HEAD").CombinedOutput()
+	if err != nil {
+		t.Fatal(errors.Wrapf(err, "counting commits: %s", out))
+	}
+	testutils.AssertEqual(t, string(out), "2\n", "commit count mismatch")
+}
+
+func TestNewTransport(t *testing.T) {
+	ctx := infra.DnoteCtx{DnoteDir: "/home/user/.dnote"}
+
+	testCases := []struct {
+		remote   core.Remote
+		expected transport
+	}{
+		{
+			remote:   core.Remote{Name: "default", Endpoint: "https://api.dnote.io", APIKey: "key"},
+			expected: &httpTransport{endpoint: "https://api.dnote.io", apiKey: "key"},
+		},
+		{
+			remote:   core.Remote{Name: "team", Endpoint: "git+ssh://git@example.com/notes.git"},
+			expected: &gitTransport{url: "ssh://git@example.com/notes.git", dir: "/home/user/.dnote/remotes/team"},
+		},
+		{
+			remote:   core.Remote{Name: "drive", Endpoint: "file:///mnt/drive/notes"},
+			expected: &dirTransport{path: "/mnt/drive/notes"},
+		},
+		{
+			remote:   core.Remote{Name: "drive", Endpoint: "/mnt/drive/notes"},
+			expected: &dirTransport{path: "/mnt/drive/notes"},
+		},
+	}
+
+	for _, tc := range testCases {
+		got, err := newTransport(ctx, tc.remote)
+		if err != nil {
+			t.Fatal(errors.Wrapf(err, "getting the transport for %s", tc.remote.Endpoint))
+		}
+
+		testutils.AssertDeepEqual(t, got, tc.expected, "transport mismatch for "+tc.remote.Endpoint)
+	}
+
+	_, err := newTransport(ctx, core.Remote{Name: "default", Endpoint: "https://api.dnote.io"})
+	testutils.AssertEqual(t, err, errLoginRequired, "error mismatch for a missing API key")
+}
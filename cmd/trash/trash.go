@@ -0,0 +1,225 @@
+package trash
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dnote/cli/cmd/ls"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var restoreBookName string
+var olderThan string
+
+var example = `
+  * List the notes and books in the trash
+  dnote trash list
+
+  * Restore a note by its index in the trash
+  dnote trash restore 2
+
+  * Restore a book and its notes
+  dnote trash restore -b js
+
+  * Permanently delete everything in the trash
+  dnote trash empty
+
+  * Permanently delete what was moved to the trash more than 30 days ago
+  dnote trash empty --older-than 30d`
+
+// NewCmd returns a new trash command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "trash",
+		Short:   "Manage the removed notes and books",
+		Example: example,
+	}
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Short:   "List the notes and books in the trash",
+		Aliases: []string{"ls"},
+		RunE:    newListRun(ctx),
+	}
+
+	restoreCmd := &cobra.Command{
+		Use:     "restore <note index>",
+		Short:   "Restore a note or a book from the trash",
+		PreRunE: restorePreRun,
+		RunE:    newRestoreRun(ctx),
+	}
+	restoreCmd.Flags().StringVarP(&restoreBookName, "book", "b", "", "The book name to restore")
+
+	emptyCmd := &cobra.Command{
+		Use:   "empty",
+		Short: "Permanently delete the notes and books in the trash",
+		RunE:  newEmptyRun(ctx),
+	}
+	emptyCmd.Flags().StringVarP(&olderThan, "older-than", "", "", "Only delete what was moved to the trash before this duration (e.g. 30d, 2w, 12h)")
+
+	cmd.AddCommand(listCmd)
+	cmd.AddCommand(restoreCmd)
+	cmd.AddCommand(emptyCmd)
+
+	return cmd
+}
+
+func formatTime(ts int64) string {
+	return time.Unix(ts, 0).Format("Jan 2, 2006 3:04pm (MST)")
+}
+
+func newListRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		books, err := core.GetTrashedBooks(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "getting trashed books")
+		}
+		notes, err := core.GetTrashedNotes(ctx.DB)
+		if err != nil {
+			return errors.Wrap(err, "getting trashed notes")
+		}
+
+		if len(books) == 0 && len(notes) == 0 {
+			log.Infof("the trash is empty\n")
+			return nil
+		}
+
+		if len(books) > 0 {
+			log.Infof("books\n")
+			for _, book := range books {
+				log.Plainf("%s %s %s\n", log.SprintfBlue(book.Label), log.SprintfYellow("(%d notes)", book.NoteCount), formatTime(book.TrashedOn))
+			}
+		}
+
+		if len(notes) > 0 {
+			log.Infof("notes\n")
+			for _, note := range notes {
+				excerpt, _ := ls.FormatContent(note.Content)
+				log.Plainf("%s %s %s %s\n", log.SprintfYellow("(%d)", note.ID), log.SprintfBlue(note.BookLabel), excerpt, formatTime(note.TrashedOn))
+			}
+		}
+
+		return nil
+	}
+}
+
+func restorePreRun(cmd *cobra.Command, args []string) error {
+	if restoreBookName == "" && len(args) != 1 {
+		return errors.New("Incorrect number of arguments")
+	}
+	if restoreBookName != "" && len(args) != 0 {
+		return errors.New("Cannot restore a note and a book at the same time")
+	}
+
+	return nil
+}
+
+func newRestoreRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+
+		if restoreBookName != "" {
+			if err := core.RestoreBook(tx, restoreBookName); err != nil {
+				tx.Rollback()
+				return errors.Wrap(err, "restoring the book")
+			}
+
+			tx.Commit()
+			log.Successf("restored book %s\n", restoreBookName)
+			return nil
+		}
+
+		trashID, err := strconv.Atoi(args[0])
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "invalid note index '%s'", args[0])
+		}
+
+		if err := core.RestoreNote(tx, trashID); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "restoring the note")
+		}
+
+		tx.Commit()
+		log.Success("restored the note\n")
+
+		return nil
+	}
+}
+
+var durationRe = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// parseDuration parses the given duration. In addition to the units supported by
+// time.ParseDuration, 'd' for days and 'w' for weeks are supported.
+func parseDuration(s string) (time.Duration, error) {
+	match := durationRe.FindStringSubmatch(s)
+	if match == nil {
+		return time.ParseDuration(s)
+	}
+
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, errors.Wrap(err, "parsing the number")
+	}
+
+	day := 24 * time.Hour
+	if match[2] == "w" {
+		return time.Duration(n) * 7 * day, nil
+	}
+
+	return time.Duration(n) * day, nil
+}
+
+func newEmptyRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		before := now.Unix() + 1
+		question := "permanently delete everything in the trash?"
+
+		if olderThan != "" {
+			d, err := parseDuration(olderThan)
+			if err != nil {
+				return errors.Wrapf(err, "invalid duration '%s'", olderThan)
+			}
+
+			before = now.Add(-d).Unix()
+			question = fmt.Sprintf("permanently delete what was moved to the trash more than %s ago?", olderThan)
+		}
+
+		ok, err := utils.AskConfirmation(question, false)
+		if err != nil {
+			return errors.Wrap(err, "getting confirmation")
+		}
+		if !ok {
+			log.Warnf("aborted by user\n")
+			return nil
+		}
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+
+		noteCount, bookCount, err := core.EmptyTrash(tx, before)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "emptying the trash")
+		}
+
+		tx.Commit()
+
+		log.Successf("deleted %d notes and %d books\n", noteCount, bookCount)
+
+		return nil
+	}
+}
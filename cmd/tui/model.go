@@ -0,0 +1,308 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/dnote/cli/output"
+	"github.com/dnote/cli/term"
+)
+
+// pane is a list on the screen that can be focused
+type pane int
+
+const (
+	bookPane pane = iota
+	notePane
+)
+
+// mode decides what the keys do
+type mode int
+
+const (
+	normalMode mode = iota
+	// filterMode reads the filter of the focused pane
+	filterMode
+	// addMode reads the book to add a note to
+	addMode
+	// moveMode reads the book to move the note to
+	moveMode
+	// deleteMode asks to confirm deleting the note
+	deleteMode
+)
+
+// command is a change requested by the keys, to be performed by the caller
+type command int
+
+const (
+	noCommand command = iota
+	quitCommand
+	addCommand
+	editCommand
+	moveCommand
+	deleteCommand
+)
+
+// model is the state of the screen
+type model struct {
+	books      []output.Book
+	notes      []output.Note
+	focus      pane
+	bookCursor int
+	noteCursor int
+	bookFilter string
+	noteFilter string
+	mode       mode
+	// input is the text typed in the prompt
+	input string
+	// target is the book to add a note to, or to move the note to
+	target string
+	// message is shown in the status line until the next key
+	message string
+}
+
+// matchFilter returns true if the text contains every word of the filter,
+// ignoring the case
+func matchFilter(text, filter string) bool {
+	text = strings.ToLower(text)
+	for _, word := range strings.Fields(strings.ToLower(filter)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filteredBooks returns the books matching the book filter
+func (m *model) filteredBooks() []output.Book {
+	ret := []output.Book{}
+	for _, b := range m.books {
+		if matchFilter(b.Label, m.bookFilter) {
+			ret = append(ret, b)
+		}
+	}
+
+	return ret
+}
+
+// filteredNotes returns the notes matching the note filter
+func (m *model) filteredNotes() []output.Note {
+	ret := []output.Note{}
+	for _, n := range m.notes {
+		if matchFilter(n.Content, m.noteFilter) {
+			ret = append(ret, n)
+		}
+	}
+
+	return ret
+}
+
+// selectedBook returns the book under the cursor
+func (m *model) selectedBook() (output.Book, bool) {
+	books := m.filteredBooks()
+	if m.bookCursor < 0 || m.bookCursor >= len(books) {
+		return output.Book{}, false
+	}
+
+	return books[m.bookCursor], true
+}
+
+// selectedNote returns the note under the cursor
+func (m *model) selectedNote() (output.Note, bool) {
+	notes := m.filteredNotes()
+	if m.noteCursor < 0 || m.noteCursor >= len(notes) {
+		return output.Note{}, false
+	}
+
+	return notes[m.noteCursor], true
+}
+
+// setBooks replaces the books, keeping the cursor on the same book if it is
+// still there
+func (m *model) setBooks(books []output.Book) {
+	selected, ok := m.selectedBook()
+
+	m.books = books
+	m.bookCursor = 0
+	if !ok {
+		return
+	}
+
+	for i, b := range m.filteredBooks() {
+		if b.Label == selected.Label {
+			m.bookCursor = i
+		}
+	}
+}
+
+// setNotes replaces the notes, keeping the cursor on the same note if it is
+// still there
+func (m *model) setNotes(notes []output.Note) {
+	selected, ok := m.selectedNote()
+
+	m.notes = notes
+	m.noteCursor = 0
+	if !ok {
+		return
+	}
+
+	for i, n := range m.filteredNotes() {
+		if n.UUID == selected.UUID {
+			m.noteCursor = i
+		}
+	}
+}
+
+// moveCursor moves the cursor of the focused pane by the delta within the list
+func (m *model) moveCursor(delta int) {
+	cursor, count := &m.bookCursor, len(m.filteredBooks())
+	if m.focus == notePane {
+		cursor, count = &m.noteCursor, len(m.filteredNotes())
+	}
+
+	*cursor += delta
+	if *cursor >= count {
+		*cursor = count - 1
+	}
+	if *cursor < 0 {
+		*cursor = 0
+	}
+}
+
+// setFilter sets the filter of the focused pane
+func (m *model) setFilter(filter string) {
+	if m.focus == bookPane {
+		m.bookFilter = filter
+		m.bookCursor = 0
+		return
+	}
+
+	m.noteFilter = filter
+	m.noteCursor = 0
+}
+
+// handleKey updates the model for the key and returns the command requested by it
+func (m *model) handleKey(k string) command {
+	m.message = ""
+
+	if k == term.KeyCtrlC {
+		return quitCommand
+	}
+
+	switch m.mode {
+	case filterMode:
+		return m.handlePromptKey(k, func() command {
+			return noCommand
+		})
+	case addMode:
+		return m.handlePromptKey(k, func() command {
+			m.target = strings.TrimSpace(m.input)
+			if m.target == "" {
+				return noCommand
+			}
+
+			return addCommand
+		})
+	case moveMode:
+		return m.handlePromptKey(k, func() command {
+			m.target = strings.TrimSpace(m.input)
+			if m.target == "" {
+				return noCommand
+			}
+
+			return moveCommand
+		})
+	case deleteMode:
+		m.mode = normalMode
+		if k == "y" || k == "Y" {
+			return deleteCommand
+		}
+
+		return noCommand
+	}
+
+	return m.handleNormalKey(k)
+}
+
+// handlePromptKey edits the input of the prompt. The submit function is called
+// when the input is entered.
+func (m *model) handlePromptKey(k string, submit func() command) command {
+	switch k {
+	case term.KeyEnter:
+		m.mode = normalMode
+		return submit()
+	case term.KeyEsc:
+		if m.mode == filterMode {
+			m.setFilter("")
+		}
+		m.mode = normalMode
+	case term.KeyBackspace:
+		if r := []rune(m.input); len(r) > 0 {
+			m.input = string(r[:len(r)-1])
+		}
+	default:
+		if len([]rune(k)) != 1 {
+			return noCommand
+		}
+
+		m.input += k
+	}
+
+	if m.mode == filterMode {
+		m.setFilter(m.input)
+	}
+
+	return noCommand
+}
+
+func (m *model) handleNormalKey(k string) command {
+	switch k {
+	case "q":
+		return quitCommand
+	case "j", term.KeyDown:
+		m.moveCursor(1)
+	case "k", term.KeyUp:
+		m.moveCursor(-1)
+	case "g":
+		m.moveCursor(-len(m.notes) - len(m.books))
+	case "G":
+		m.moveCursor(len(m.notes) + len(m.books))
+	case term.KeyTab:
+		if m.focus == bookPane {
+			m.focus = notePane
+		} else {
+			m.focus = bookPane
+		}
+	case "l", term.KeyRight, term.KeyEnter:
+		m.focus = notePane
+	case "h", term.KeyLeft:
+		m.focus = bookPane
+	case "/":
+		m.mode = filterMode
+		m.input = m.bookFilter
+		if m.focus == notePane {
+			m.input = m.noteFilter
+		}
+	case "a":
+		m.mode = addMode
+		m.input = ""
+		if b, ok := m.selectedBook(); ok {
+			m.input = b.Label
+		}
+	case "e":
+		if _, ok := m.selectedNote(); ok {
+			return editCommand
+		}
+	case "m":
+		if _, ok := m.selectedNote(); ok {
+			m.mode = moveMode
+			m.input = ""
+		}
+	case "d":
+		if _, ok := m.selectedNote(); ok {
+			m.mode = deleteMode
+		}
+	}
+
+	return noCommand
+}
@@ -0,0 +1,185 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dnote/cli/cmd/ls"
+	"github.com/dnote/cli/core"
+)
+
+const (
+	minWidth     = 20
+	minHeight    = 3
+	reverseVideo = "\x1b[7m"
+	bold         = "\x1b[1m"
+	resetStyle   = "\x1b[0m"
+	separator    = "│"
+)
+
+var helpText = "j/k move  tab switch  / filter  a add  e edit  m move  d delete  q quit"
+
+// fit truncates or pads the text with spaces to the width
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+
+	return s + strings.Repeat(" ", width-len(r))
+}
+
+// wrap breaks the text into lines no wider than the width
+func wrap(s string, width int) []string {
+	ret := []string{}
+	if width <= 0 {
+		return ret
+	}
+
+	for _, line := range strings.Split(strings.Replace(s, "\t", "    ", -1), "\n") {
+		r := []rune(strings.TrimRight(line, "\r"))
+		for len(r) > width {
+			ret = append(ret, string(r[:width]))
+			r = r[width:]
+		}
+		ret = append(ret, string(r))
+	}
+
+	return ret
+}
+
+// scrollOffset returns the index of the first item to be shown so that the cursor
+// is within the height
+func scrollOffset(cursor, height int) int {
+	if cursor < height {
+		return 0
+	}
+
+	return cursor - height + 1
+}
+
+// renderList returns the lines of a list with the cursor highlighted
+func renderList(items []string, cursor, width, height int, focused bool) []string {
+	ret := []string{}
+
+	offset := scrollOffset(cursor, height)
+	for i := offset; i < len(items) && len(ret) < height; i++ {
+		line := fit(" "+items[i], width)
+		if i == cursor {
+			if focused {
+				line = reverseVideo + line + resetStyle
+			} else {
+				line = bold + line + resetStyle
+			}
+		}
+
+		ret = append(ret, line)
+	}
+
+	for len(ret) < height {
+		ret = append(ret, fit("", width))
+	}
+
+	return ret
+}
+
+// renderPreview returns the lines showing the selected note
+func renderPreview(m *model, width, height int) []string {
+	ret := []string{}
+
+	note, ok := m.selectedNote()
+	if ok {
+		ret = append(ret, fmt.Sprintf("%s in %s", core.ShortUUID(note.UUID), note.Book))
+		ret = append(ret, time.Unix(note.AddedOn, 0).Format("Jan 2, 2006"))
+		ret = append(ret, "")
+		ret = append(ret, wrap(note.Content, width-1)...)
+	}
+
+	for i := range ret {
+		ret[i] = fit(" "+ret[i], width)
+	}
+	if len(ret) > height {
+		ret = ret[:height]
+	}
+	for len(ret) < height {
+		ret = append(ret, fit("", width))
+	}
+
+	return ret
+}
+
+// renderStatus returns the status line
+func renderStatus(m *model) string {
+	switch m.mode {
+	case filterMode:
+		return "/" + m.input
+	case addMode:
+		return "add to book: " + m.input
+	case moveMode:
+		return "move to book: " + m.input
+	case deleteMode:
+		return "delete this note? (y/N)"
+	}
+
+	if m.message != "" {
+		return m.message
+	}
+
+	return helpText
+}
+
+// render returns the screen for the model. The lines are separated by "\r\n" as
+// the terminal is in raw mode.
+func render(m *model, width, height int) string {
+	if width < minWidth {
+		width = minWidth
+	}
+	if height < minHeight {
+		height = minHeight
+	}
+
+	bookWidth := width / 4
+	noteWidth := (width - bookWidth) / 2
+	previewWidth := width - bookWidth - noteWidth - 2
+	bodyHeight := height - 2
+
+	bookTitle := "books"
+	if m.bookFilter != "" {
+		bookTitle = fmt.Sprintf("books /%s", m.bookFilter)
+	}
+	noteTitle := "notes"
+	if m.noteFilter != "" {
+		noteTitle = fmt.Sprintf("notes /%s", m.noteFilter)
+	}
+
+	books := []string{}
+	for _, b := range m.filteredBooks() {
+		books = append(books, fmt.Sprintf("%s (%d)", b.Label, b.NoteCount))
+	}
+	notes := []string{}
+	for _, n := range m.filteredNotes() {
+		content, _ := ls.FormatContent(n.Content)
+		notes = append(notes, fmt.Sprintf("%s %s", core.ShortUUID(n.UUID), content))
+	}
+
+	bookLines := renderList(books, m.bookCursor, bookWidth, bodyHeight, m.focus == bookPane)
+	noteLines := renderList(notes, m.noteCursor, noteWidth, bodyHeight, m.focus == notePane)
+	previewLines := renderPreview(m, previewWidth, bodyHeight)
+
+	var buf bytes.Buffer
+	buf.WriteString(bold + fit(" "+bookTitle, bookWidth) + separator + fit(" "+noteTitle, noteWidth) + separator + fit(" preview", previewWidth) + resetStyle)
+	for i := 0; i < bodyHeight; i++ {
+		buf.WriteString("\r\n")
+		buf.WriteString(bookLines[i] + separator + noteLines[i] + separator + previewLines[i])
+	}
+	buf.WriteString("\r\n")
+	buf.WriteString(fit(renderStatus(m), width))
+
+	return buf.String()
+}
@@ -0,0 +1,219 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dnote/cli/cmd/add"
+	"github.com/dnote/cli/cmd/edit"
+	"github.com/dnote/cli/cmd/ls"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/output"
+	"github.com/dnote/cli/term"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	exitAltScreen  = "\x1b[?25h\x1b[?1049l"
+	cursorHome     = "\x1b[H"
+)
+
+var example = `
+ * Browse the notes
+ dnote tui`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new tui command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "tui",
+		Short:   "Browse and edit the notes in an interactive terminal UI",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    newRun(ctx),
+	}
+
+	return cmd
+}
+
+func newRun(ctx infra.DnoteCtx) core.RunEFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		m := &model{}
+		if err := load(ctx, m); err != nil {
+			return errors.Wrap(err, "loading the notes")
+		}
+
+		t, err := term.Open()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stdout, enterAltScreen)
+
+		err = loop(ctx, t, m)
+		if rerr := exitScreen(t); rerr != nil && err == nil {
+			err = rerr
+		}
+
+		return err
+	}
+}
+
+// load reads the books and the notes in the selected book into the model
+func load(ctx infra.DnoteCtx, m *model) error {
+	books, err := ls.GetBooks(ctx.DB)
+	if err != nil {
+		return errors.Wrap(err, "getting books")
+	}
+	m.setBooks(books)
+
+	notes := []output.Note{}
+	if book, ok := m.selectedBook(); ok {
+		notes, err = ls.GetNotes(ctx.DB, book.Label)
+		if err != nil {
+			return errors.Wrap(err, "getting notes")
+		}
+	}
+	m.setNotes(notes)
+
+	return nil
+}
+
+// loop draws the screen and performs the commands until the user quits
+func loop(ctx infra.DnoteCtx, t *term.Terminal, m *model) error {
+	for {
+		width, height, err := t.Size()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stdout, cursorHome+render(m, width, height))
+
+		keys, err := t.ReadKeys()
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			selected, _ := m.selectedBook()
+
+			c := m.handleKey(k)
+			if c == quitCommand {
+				return nil
+			}
+			if c != noCommand {
+				if err := perform(ctx, t, m, c); err != nil {
+					m.message = err.Error()
+				}
+			}
+
+			if book, _ := m.selectedBook(); c != noCommand || book.Label != selected.Label {
+				if err := load(ctx, m); err != nil {
+					return errors.Wrap(err, "loading the notes")
+				}
+			}
+		}
+	}
+}
+
+// perform carries out the command on the selected note
+func perform(ctx infra.DnoteCtx, t *term.Terminal, m *model, c command) error {
+	note, _ := m.selectedNote()
+	ts := time.Now().Unix()
+
+	switch c {
+	case addCommand:
+		content, err := runEditor(ctx, t, "")
+		if err != nil {
+			return err
+		}
+		if content == "" {
+			return errors.New("Empty content")
+		}
+
+		if _, err := add.WriteNote(ctx, m.target, content, nil, false, ts); err != nil {
+			return errors.Wrap(err, "adding the note")
+		}
+
+		m.message = "added to " + m.target
+	case editCommand:
+		content, err := runEditor(ctx, t, note.Content)
+		if err != nil {
+			return err
+		}
+
+		ref := core.NoteRef{UUID: note.UUID, ID: note.ID, BookLabel: note.Book, Content: note.Content}
+		if _, err := edit.WriteNote(ctx, ref, content, nil, nil); err != nil {
+			return err
+		}
+
+		m.message = "edited the note"
+	case moveCommand:
+		if m.target == note.Book {
+			return errors.New("Nothing changed")
+		}
+
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+		if err := core.MoveNote(tx, note.UUID, note.Book, m.target, ts); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "moving the note")
+		}
+		tx.Commit()
+
+		m.message = "moved the note to " + m.target
+	case deleteCommand:
+		tx, err := ctx.DB.Begin()
+		if err != nil {
+			return errors.Wrap(err, "beginning a transaction")
+		}
+
+		// The remove_note action is logged when the trash is emptied
+		if err := core.TrashNote(tx, note.UUID, ts); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "moving the note to the trash")
+		}
+		tx.Commit()
+
+		m.message = "moved the note to the trash"
+	}
+
+	return nil
+}
+
+// exitScreen switches back to the main screen and restores the terminal
+func exitScreen(t *term.Terminal) error {
+	fmt.Fprint(os.Stdout, exitAltScreen)
+
+	return t.Restore()
+}
+
+// runEditor leaves the terminal UI while the editor is open
+func runEditor(ctx infra.DnoteCtx, t *term.Terminal, content string) (string, error) {
+	if err := exitScreen(t); err != nil {
+		return "", err
+	}
+
+	ret, editErr := edit.EditContent(ctx, content)
+
+	if err := t.Raw(); err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stdout, enterAltScreen)
+	if editErr != nil {
+		return "", errors.Wrap(editErr, "editing the content")
+	}
+
+	return ret, nil
+}
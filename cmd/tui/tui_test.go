@@ -0,0 +1,172 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dnote/cli/output"
+	"github.com/dnote/cli/term"
+	"github.com/dnote/cli/testutils"
+)
+
+func newTestModel() *model {
+	return &model{
+		books: []output.Book{
+			{Label: "css", NoteCount: 1},
+			{Label: "golang", NoteCount: 2},
+			{Label: "js", NoteCount: 3},
+		},
+		notes: []output.Note{
+			{UUID: "0c5fe3c1-6f8e-4b51-9b4e-1b7fc7ab3a4e", Book: "js", Content: "array destructuring"},
+			{UUID: "a9d4c1b2-2b3c-4d5e-8f90-1a2b3c4d5e6f", Book: "js", Content: "Promise.all\nresolves all"},
+			{UUID: "f3a1e2d4-5b6c-4d7e-9f80-0a1b2c3d4e5f", Book: "js", Content: "arrow functions"},
+		},
+	}
+}
+
+func pressKeys(m *model, keys ...string) command {
+	var ret command
+	for _, k := range keys {
+		ret = m.handleKey(k)
+	}
+
+	return ret
+}
+
+func TestHandleKey_Navigation(t *testing.T) {
+	m := newTestModel()
+
+	pressKeys(m, "j", term.KeyDown, term.KeyDown)
+	testutils.AssertEqual(t, m.bookCursor, 2, "book cursor should stop at the last book")
+
+	pressKeys(m, "k")
+	testutils.AssertEqual(t, m.bookCursor, 1, "book cursor mismatch")
+
+	pressKeys(m, term.KeyTab, "j")
+	testutils.AssertEqual(t, m.focus, notePane, "focus mismatch")
+	testutils.AssertEqual(t, m.noteCursor, 1, "note cursor mismatch")
+	testutils.AssertEqual(t, m.bookCursor, 1, "book cursor should not move")
+
+	pressKeys(m, "h", "G")
+	testutils.AssertEqual(t, m.focus, bookPane, "focus mismatch")
+	testutils.AssertEqual(t, m.bookCursor, 2, "book cursor mismatch")
+
+	pressKeys(m, "g")
+	testutils.AssertEqual(t, m.bookCursor, 0, "book cursor mismatch")
+
+	testutils.AssertEqual(t, pressKeys(m, "q"), quitCommand, "command mismatch")
+	testutils.AssertEqual(t, pressKeys(m, term.KeyCtrlC), quitCommand, "command mismatch")
+}
+
+func TestHandleKey_Filter(t *testing.T) {
+	m := newTestModel()
+	pressKeys(m, term.KeyTab, "/", "a", "r")
+
+	testutils.AssertEqual(t, m.mode, filterMode, "mode mismatch")
+	testutils.AssertEqual(t, len(m.filteredNotes()), 2, "filtered notes count mismatch")
+
+	pressKeys(m, "r", "o", "w", term.KeyBackspace, "w")
+	note, ok := m.selectedNote()
+	testutils.AssertEqual(t, ok, true, "a note should be selected")
+	testutils.AssertEqual(t, note.Content, "arrow functions", "selected note mismatch")
+
+	pressKeys(m, term.KeyEnter)
+	testutils.AssertEqual(t, m.mode, normalMode, "mode mismatch")
+	testutils.AssertEqual(t, m.noteFilter, "arrow", "filter should be kept")
+	testutils.AssertEqual(t, m.bookFilter, "", "book filter should not be set")
+
+	pressKeys(m, "/", term.KeyEsc)
+	testutils.AssertEqual(t, m.noteFilter, "", "filter should be cleared")
+	testutils.AssertEqual(t, len(m.filteredNotes()), 3, "filtered notes count mismatch")
+
+	pressKeys(m, "h", "/", "G", "O")
+	book, ok := m.selectedBook()
+	testutils.AssertEqual(t, ok, true, "a book should be selected")
+	testutils.AssertEqual(t, book.Label, "golang", "filter should ignore the case")
+}
+
+func TestHandleKey_Commands(t *testing.T) {
+	t.Run("add", func(t *testing.T) {
+		m := newTestModel()
+		pressKeys(m, "j", "a")
+		testutils.AssertEqual(t, m.input, "golang", "input should be the selected book")
+
+		c := pressKeys(m, term.KeyBackspace, term.KeyBackspace, term.KeyBackspace, term.KeyBackspace, term.KeyBackspace, "o", term.KeyEnter)
+		testutils.AssertEqual(t, c, addCommand, "command mismatch")
+		testutils.AssertEqual(t, m.target, "go", "target mismatch")
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		m := newTestModel()
+		testutils.AssertEqual(t, pressKeys(m, "e"), editCommand, "command mismatch")
+
+		m.notes = []output.Note{}
+		testutils.AssertEqual(t, pressKeys(m, "e"), noCommand, "no note to edit")
+	})
+
+	t.Run("move", func(t *testing.T) {
+		m := newTestModel()
+		pressKeys(m, "m", "c", "s", "s")
+		testutils.AssertEqual(t, m.mode, moveMode, "mode mismatch")
+		testutils.AssertEqual(t, pressKeys(m, term.KeyEnter), moveCommand, "command mismatch")
+		testutils.AssertEqual(t, m.target, "css", "target mismatch")
+
+		pressKeys(m, "m", "x", term.KeyEsc)
+		testutils.AssertEqual(t, m.mode, normalMode, "mode mismatch")
+		testutils.AssertEqual(t, pressKeys(m, "m", term.KeyEnter), noCommand, "empty target should be ignored")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		m := newTestModel()
+		testutils.AssertEqual(t, pressKeys(m, "d", "n"), noCommand, "delete should be cancelled")
+		testutils.AssertEqual(t, pressKeys(m, "d", "y"), deleteCommand, "command mismatch")
+		testutils.AssertEqual(t, m.mode, normalMode, "mode mismatch")
+	})
+}
+
+func TestSetNotes(t *testing.T) {
+	m := newTestModel()
+	pressKeys(m, term.KeyTab, "j")
+
+	m.setNotes([]output.Note{m.notes[2], m.notes[1]})
+	note, _ := m.selectedNote()
+	testutils.AssertEqual(t, m.noteCursor, 1, "cursor should follow the note")
+	testutils.AssertEqual(t, note.Content, "Promise.all\nresolves all", "selected note mismatch")
+
+	m.setNotes([]output.Note{m.notes[0]})
+	testutils.AssertEqual(t, m.noteCursor, 0, "cursor should be reset")
+}
+
+// visibleWidth returns the number of characters in the line leaving out the
+// escape sequences
+func visibleWidth(line string) int {
+	for _, seq := range []string{reverseVideo, bold, resetStyle} {
+		line = strings.Replace(line, seq, "", -1)
+	}
+
+	return utf8.RuneCountInString(line)
+}
+
+func TestRender(t *testing.T) {
+	m := newTestModel()
+	pressKeys(m, "G", term.KeyTab, "j")
+
+	screen := render(m, 80, 10)
+	lines := strings.Split(screen, "\r\n")
+
+	testutils.AssertEqual(t, len(lines), 10, "line count mismatch")
+	for i, line := range lines {
+		testutils.AssertEqual(t, visibleWidth(line), 80, fmt.Sprintf("width of line %d mismatch", i))
+	}
+
+	testutils.AssertEqual(t, strings.Contains(lines[3], "js (3)"), true, "selected book should be listed")
+	testutils.AssertEqual(t, strings.Contains(lines[2], reverseVideo+" a9d4c1b2 Promise.all"), true, "selected note should be highlighted")
+	testutils.AssertEqual(t, strings.Contains(lines[5], " resolves all"), true, "preview should show the content")
+	testutils.AssertEqual(t, strings.HasPrefix(lines[9], helpText[:10]), true, "status line should show the help")
+
+	pressKeys(m, "d")
+	lines = strings.Split(render(m, 80, 10), "\r\n")
+	testutils.AssertEqual(t, strings.HasPrefix(lines[9], "delete this note?"), true, "status line should ask to confirm")
+}
@@ -0,0 +1,36 @@
+package unpublish
+
+import (
+	"github.com/dnote/cli/cmd/publish"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var example = `
+ * Unpublish a note by its index in a book
+ dnote unpublish js 3
+
+ * Unpublish a note by the id shown by "dnote view"
+ dnote unpublish 4f2a`
+
+func preRun(cmd *cobra.Command, args []string) error {
+	if len(args) > 2 {
+		return errors.New("Incorrect number of argument")
+	}
+
+	return nil
+}
+
+// NewCmd returns a new unpublish command
+func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "unpublish <book name?> <note index?>",
+		Short:   "Remove a note from the site built by 'dnote site build'",
+		Example: example,
+		PreRunE: preRun,
+		RunE:    publish.NewRun(ctx, false),
+	}
+
+	return cmd
+}
@@ -3,6 +3,8 @@ package view
 import (
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/picker"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
@@ -10,8 +12,10 @@ import (
 	"github.com/dnote/cli/cmd/ls"
 )
 
+var tag string
+
 var example = `
- * View all books
+ * Pick a book or a note, or view all books if not run in a terminal
  dnote view
 
  * List notes in a book
@@ -19,12 +23,24 @@ var example = `
 
  * View a particular note in a book
  dnote view javascript 0
+
+ * View a note by the id shown when listing the notes
+ dnote view 4f2a
+
+ * List notes with a tag
+ dnote view --tag es6
+
+ * List notes with a tag in a book
+ dnote view javascript --tag es6
  `
 
 func preRun(cmd *cobra.Command, args []string) error {
 	if len(args) > 2 {
 		return errors.New("Incorrect number of argument")
 	}
+	if tag != "" && len(args) > 1 {
+		return errors.New("Cannot view a note by a tag")
+	}
 
 	return nil
 }
@@ -39,6 +55,9 @@ func NewCmd(ctx infra.DnoteCtx) *cobra.Command {
 		PreRunE: preRun,
 	}
 
+	f := cmd.Flags()
+	f.StringVarP(&tag, "tag", "t", "", "The tag of the notes to list")
+
 	return cmd
 }
 
@@ -46,8 +65,44 @@ func newRun(ctx infra.DnoteCtx) core.RunEFunc {
 	return func(cmd *cobra.Command, args []string) error {
 		var run core.RunEFunc
 
-		if len(args) <= 1 {
+		if tag != "" {
+			var bookLabel string
+			if len(args) == 1 {
+				bookLabel = args[0]
+			}
+
+			return ls.PrintTaggedNotes(ctx, tag, bookLabel)
+		}
+
+		if len(args) == 0 && picker.IsAvailable() {
+			bookLabel, note, err := picker.PickBookOrNote(ctx)
+			if errors.Cause(err) == picker.ErrCancelled {
+				log.Warnf("aborted by user\n")
+				return nil
+			} else if err != nil {
+				return errors.Wrap(err, "picking a book or a note")
+			}
+
+			if note.UUID != "" {
+				return cat.NewRun(ctx)(cmd, []string{note.UUID})
+			}
+
+			return ls.NewRun(ctx)(cmd, []string{bookLabel})
+		}
+
+		if len(args) == 0 {
 			run = ls.NewRun(ctx)
+		} else if len(args) == 1 {
+			isNote, err := core.IsNoteID(ctx, args[0])
+			if err != nil {
+				return errors.Wrap(err, "checking the argument")
+			}
+
+			if isNote {
+				run = cat.NewRun(ctx)
+			} else {
+				run = ls.NewRun(ctx)
+			}
 		} else if len(args) == 2 {
 			run = cat.NewRun(ctx)
 		} else {
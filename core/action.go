@@ -9,14 +9,46 @@ import (
 	"github.com/pkg/errors"
 )
 
+var (
+	// ActionSetNoteTags identifies a type of action for setting the tags of a note
+	ActionSetNoteTags = "set_note_tags"
+	// ActionRenameBook identifies a type of action for renaming a book
+	ActionRenameBook = "rename_book"
+	// ActionReviewNote identifies a type of action for recording the review of a
+	// note
+	ActionReviewNote = "review_note"
+)
+
+// SetNoteTagsDataV1 is a data for setting the tags of a note (v1)
+type SetNoteTagsDataV1 struct {
+	NoteUUID string   `json:"note_uuid"`
+	Tags     []string `json:"tags"`
+}
+
+// RenameBookDataV1 is a data for renaming a book (v1)
+type RenameBookDataV1 struct {
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name"`
+}
+
+// ReviewNoteDataV1 is a data for recording the review of a note (v1). It holds
+// the schedule of the note after the review.
+type ReviewNoteDataV1 struct {
+	NoteUUID    string  `json:"note_uuid"`
+	Ease        float64 `json:"ease"`
+	Interval    int     `json:"interval"`
+	Repetitions int     `json:"repetitions"`
+	DueOn       int64   `json:"due_on"`
+	ReviewedOn  int64   `json:"reviewed_on"`
+}
+
 // LogActionAddNote logs an action for adding a note
-func LogActionAddNote(tx *sql.Tx, noteUUID, bookName, content string, timestamp int64) error {
+func LogActionAddNote(tx *sql.Tx, noteUUID, bookName, content string, public bool, timestamp int64) error {
 	b, err := json.Marshal(actions.AddNoteDataV2{
 		NoteUUID: noteUUID,
 		BookName: bookName,
 		Content:  content,
-		// TODO: support adding a public note
-		Public: false,
+		Public:   public,
 	})
 	if err != nil {
 		return errors.Wrap(err, "marshalling data into JSON")
@@ -65,6 +97,42 @@ func LogActionEditNote(tx *sql.Tx, noteUUID, bookName, content string, ts int64)
 	return nil
 }
 
+// LogActionEditNotePublic logs an action for changing whether a note is public
+func LogActionEditNotePublic(tx *sql.Tx, noteUUID, bookName string, public bool, ts int64) error {
+	b, err := json.Marshal(actions.EditNoteDataV2{
+		NoteUUID: noteUUID,
+		FromBook: bookName,
+		Public:   &public,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling data into JSON")
+	}
+
+	if err := LogAction(tx, 2, actions.ActionEditNote, string(b), ts); err != nil {
+		return errors.Wrapf(err, "logging action")
+	}
+
+	return nil
+}
+
+// LogActionMoveNote logs an action for moving a note to another book
+func LogActionMoveNote(tx *sql.Tx, noteUUID, fromBook, toBook string, ts int64) error {
+	b, err := json.Marshal(actions.EditNoteDataV2{
+		NoteUUID: noteUUID,
+		FromBook: fromBook,
+		ToBook:   &toBook,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling data into JSON")
+	}
+
+	if err := LogAction(tx, 2, actions.ActionEditNote, string(b), ts); err != nil {
+		return errors.Wrapf(err, "logging action")
+	}
+
+	return nil
+}
+
 // LogActionAddBook logs an action for adding a book
 func LogActionAddBook(tx *sql.Tx, name string) error {
 	b, err := json.Marshal(actions.AddBookDataV1{
@@ -96,3 +164,58 @@ func LogActionRemoveBook(tx *sql.Tx, name string) error {
 
 	return nil
 }
+
+// LogActionSetNoteTags logs an action for setting the tags of a note
+func LogActionSetNoteTags(tx *sql.Tx, noteUUID string, tags []string, ts int64) error {
+	b, err := json.Marshal(SetNoteTagsDataV1{
+		NoteUUID: noteUUID,
+		Tags:     tags,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling data into JSON")
+	}
+
+	if err := LogAction(tx, 1, ActionSetNoteTags, string(b), ts); err != nil {
+		return errors.Wrapf(err, "logging action")
+	}
+
+	return nil
+}
+
+// LogActionRenameBook logs an action for renaming a book
+func LogActionRenameBook(tx *sql.Tx, oldName, newName string, ts int64) error {
+	b, err := json.Marshal(RenameBookDataV1{
+		OldName: oldName,
+		NewName: newName,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling data into JSON")
+	}
+
+	if err := LogAction(tx, 1, ActionRenameBook, string(b), ts); err != nil {
+		return errors.Wrapf(err, "logging action")
+	}
+
+	return nil
+}
+
+// LogActionReviewNote logs an action for recording the review of a note
+func LogActionReviewNote(tx *sql.Tx, review Review) error {
+	b, err := json.Marshal(ReviewNoteDataV1{
+		NoteUUID:    review.NoteUUID,
+		Ease:        review.Ease,
+		Interval:    review.Interval,
+		Repetitions: review.Repetitions,
+		DueOn:       review.DueOn,
+		ReviewedOn:  review.ReviewedOn,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling data into JSON")
+	}
+
+	if err := LogAction(tx, 1, ActionReviewNote, string(b), review.ReviewedOn); err != nil {
+		return errors.Wrapf(err, "logging action")
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"database/sql"
+
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// GetOrCreateBook returns the uuid of the book with the given label. If the book
+// does not exist, it creates the book and logs an action for adding it.
+func GetOrCreateBook(tx *sql.Tx, label string) (string, error) {
+	var ret string
+	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ?", label).Scan(&ret)
+	if err == nil {
+		return ret, nil
+	} else if err != sql.ErrNoRows {
+		return "", errors.Wrap(err, "finding the book")
+	}
+
+	ret = utils.GenerateUUID()
+	if _, err := tx.Exec("INSERT INTO books (uuid, label) VALUES (?, ?)", ret, label); err != nil {
+		return "", errors.Wrap(err, "creating the book")
+	}
+	if _, err := tx.Exec("DELETE FROM book_aliases WHERE label = ?", label); err != nil {
+		return "", errors.Wrap(err, "removing the alias")
+	}
+
+	if err := LogActionAddBook(tx, label); err != nil {
+		return "", errors.Wrap(err, "logging an action")
+	}
+
+	return ret, nil
+}
+
+// MoveNote moves the note to the book with the given label, creating the book if
+// necessary, and logs an action for editing the note. A note cannot be moved to a
+// book synced with another remote, which would not have the note.
+func MoveNote(tx *sql.Tx, noteUUID, fromBook, toBook string, ts int64) error {
+	var fromUUID, toUUID string
+	if err := tx.QueryRow("SELECT book_uuid FROM notes WHERE uuid = ?", noteUUID).Scan(&fromUUID); err != nil {
+		return errors.Wrap(err, "finding the note")
+	}
+	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ?", toBook).Scan(&toUUID)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "finding the destination book")
+	}
+
+	fromRemote, err := getBookRemoteName(tx, fromUUID)
+	if err != nil {
+		return errors.Wrap(err, "getting the remote of the book")
+	}
+	toRemote, err := getBookRemoteName(tx, toUUID)
+	if err != nil {
+		return errors.Wrap(err, "getting the remote of the destination book")
+	}
+	if fromRemote != toRemote {
+		return errors.Errorf("cannot move the note because '%s' is synced with remote '%s' and '%s' is synced with remote '%s'", fromBook, fromRemote, toBook, toRemote)
+	}
+
+	bookUUID, err := GetOrCreateBook(tx, toBook)
+	if err != nil {
+		return errors.Wrap(err, "getting the destination book")
+	}
+
+	_, err = tx.Exec(`UPDATE notes
+		SET book_uuid = ?, edited_on = ?
+		WHERE uuid = ?`, bookUUID, ts, noteUUID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	if err := LogActionMoveNote(tx, noteUUID, fromBook, toBook, ts); err != nil {
+		return errors.Wrap(err, "logging an action")
+	}
+
+	return nil
+}
+
+// setBookAlias makes the label refer to the book, which has been renamed from it
+func setBookAlias(tx *sql.Tx, label, bookUUID string) error {
+	if _, err := tx.Exec("DELETE FROM book_aliases WHERE label = ?", label); err != nil {
+		return errors.Wrap(err, "removing the alias")
+	}
+	if _, err := tx.Exec("INSERT INTO book_aliases (label, book_uuid) VALUES (?, ?)", label, bookUUID); err != nil {
+		return errors.Wrap(err, "inserting the alias")
+	}
+
+	return nil
+}
+
+// getAliasedBookUUID returns the uuid of the book renamed from the label and
+// whether the book is in the trash. The uuid is empty if no book has been renamed
+// from the label.
+func getAliasedBookUUID(tx *sql.Tx, label string) (string, bool, error) {
+	var ret string
+	var trashed bool
+	err := tx.QueryRow(`SELECT book_aliases.book_uuid, books.uuid IS NULL
+		FROM book_aliases
+		LEFT JOIN books ON books.uuid = book_aliases.book_uuid
+		LEFT JOIN trash_books ON trash_books.uuid = book_aliases.book_uuid
+		WHERE book_aliases.label = ? AND (books.uuid IS NOT NULL OR trash_books.uuid IS NOT NULL)`, label).Scan(&ret, &trashed)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, errors.Wrap(err, "querying the alias")
+	}
+
+	return ret, trashed, nil
+}
+
+// findBookUUID returns the uuid of the book with the given label and whether the
+// book is in the trash, or an empty uuid if the book is not found. Trashed books
+// are looked up so that the actions on them can still be reduced until the trash
+// is emptied, and so are the books renamed from the label.
+func findBookUUID(tx *sql.Tx, label string) (string, bool, error) {
+	var ret string
+	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ?", label).Scan(&ret)
+	if err == nil {
+		return ret, false, nil
+	} else if err != sql.ErrNoRows {
+		return ret, false, errors.Wrap(err, "querying the book")
+	}
+
+	ret, err = getTrashedBookUUID(tx, label)
+	if err != nil {
+		return ret, false, errors.Wrap(err, "querying the trashed book")
+	}
+	if ret != "" {
+		return ret, true, nil
+	}
+
+	ret, trashed, err := getAliasedBookUUID(tx, label)
+	if err != nil {
+		return ret, false, errors.Wrap(err, "querying the renamed book")
+	}
+
+	return ret, trashed, nil
+}
+
+// RenameBook changes the label of the book and logs an action for renaming it
+func RenameBook(tx *sql.Tx, oldLabel, newLabel string, ts int64) error {
+	var count, trashedCount int
+	err := tx.QueryRow(`SELECT
+		(SELECT count(*) FROM books WHERE label = ?),
+		(SELECT count(*) FROM trash_books WHERE label = ?)`, newLabel, newLabel).Scan(&count, &trashedCount)
+	if err != nil {
+		return errors.Wrap(err, "counting books")
+	}
+	if count > 0 {
+		return errors.Errorf("book '%s' already exists", newLabel)
+	}
+	if trashedCount > 0 {
+		return errors.Errorf("book '%s' is in the trash. empty the trash or choose another name", newLabel)
+	}
+
+	var bookUUID string
+	err = tx.QueryRow("SELECT uuid FROM books WHERE label = ?", oldLabel).Scan(&bookUUID)
+	if err == sql.ErrNoRows {
+		return errors.Errorf("book '%s' not found", oldLabel)
+	} else if err != nil {
+		return errors.Wrap(err, "querying the book")
+	}
+
+	if _, err := tx.Exec("UPDATE books SET label = ? WHERE uuid = ?", newLabel, bookUUID); err != nil {
+		return errors.Wrap(err, "updating the book")
+	}
+	if _, err := tx.Exec("DELETE FROM book_aliases WHERE label = ?", newLabel); err != nil {
+		return errors.Wrap(err, "removing the alias")
+	}
+	// Other machines may still use the old label until they receive the rename
+	if err := setBookAlias(tx, oldLabel, bookUUID); err != nil {
+		return errors.Wrap(err, "setting the alias")
+	}
+
+	if err := LogActionRenameBook(tx, oldLabel, newLabel, ts); err != nil {
+		return errors.Wrap(err, "logging an action")
+	}
+
+	return nil
+}
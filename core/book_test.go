@@ -0,0 +1,69 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestRenameBook(t *testing.T) {
+	testCases := []struct {
+		newLabel      string
+		trashedLabel  string
+		expectedError bool
+	}{
+		{
+			newLabel:      "javascript",
+			expectedError: false,
+		},
+		{
+			newLabel:      "linux",
+			expectedError: true,
+		},
+		{
+			newLabel:      "javascript",
+			trashedLabel:  "javascript",
+			expectedError: true,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			db := ctx.DB
+			if tc.trashedLabel != "" {
+				testutils.MustExec(t, "setting up trashed book", db, "INSERT INTO trash_books (uuid, label, trashed_on) VALUES (?, ?, ?)", "trashed-book-uuid", tc.trashedLabel, 1515199960)
+			}
+
+			// Execute
+			tx, err := db.Begin()
+			if err != nil {
+				panic(errors.Wrap(err, "beginning a transaction"))
+			}
+			err = RenameBook(tx, "js", tc.newLabel, 1517629805)
+			tx.Commit()
+
+			// Test
+			testutils.AssertEqual(t, err != nil, tc.expectedError, fmt.Sprintf("error mismatch: %v", err))
+
+			var label string
+			var aliasCount int
+			testutils.MustScan(t, "getting the book", db.QueryRow("SELECT label FROM books WHERE uuid = ?", "js-book-uuid"), &label)
+			testutils.MustScan(t, "counting aliases", db.QueryRow("SELECT count(*) FROM book_aliases WHERE label = ? AND book_uuid = ?", "js", "js-book-uuid"), &aliasCount)
+
+			if tc.expectedError {
+				testutils.AssertEqual(t, label, "js", "label mismatch")
+				testutils.AssertEqual(t, aliasCount, 0, "alias count mismatch")
+			} else {
+				testutils.AssertEqual(t, label, tc.newLabel, "label mismatch")
+				testutils.AssertEqual(t, aliasCount, 1, "alias count mismatch")
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+)
+
+// Conflict markers delimit the local and the incoming versions of the lines that
+// differ in a merged content
+var (
+	ConflictMarkerOurs   = "<<<<<<< ours"
+	ConflictMarkerSep    = "======="
+	ConflictMarkerTheirs = ">>>>>>> theirs"
+)
+
+// Conflict is a note edited on another machine while it was being edited locally
+type Conflict struct {
+	ID        int
+	NoteUUID  string
+	NoteID    int
+	BookLabel string
+	Ours      string
+	Theirs    string
+	CreatedOn int64
+}
+
+// ReduceAllWithConflicts reduces the actions returned by the server like
+// ReduceAll. If an incoming action edits the content of a note that the given
+// local actions also edited, the local content is kept and the incoming content
+// is saved as a conflict to be resolved by the user. It returns the number of
+// new conflicts.
+func ReduceAllWithConflicts(ctx infra.DnoteCtx, tx *sql.Tx, actionSlice []actions.Action, localActions []actions.Action) (int, error) {
+	own := map[string]bool{}
+	edited := map[string]bool{}
+	for _, action := range localActions {
+		own[action.UUID] = true
+
+		if action.Type != actions.ActionEditNote {
+			continue
+		}
+
+		var data actions.EditNoteDataV2
+		if err := json.Unmarshal(action.Data, &data); err != nil {
+			return 0, errors.Wrap(err, "parsing the local action data")
+		}
+		if data.Content != nil {
+			edited[data.NoteUUID] = true
+		}
+	}
+
+	var ret int
+	for _, action := range actionSlice {
+		if action.Type == actions.ActionEditNote && !own[action.UUID] {
+			decoded, ok, err := decodeAction(action)
+			if err != nil {
+				return ret, errors.Wrap(err, "decoding the action")
+			}
+
+			// The unsupported schemas are left to Reduce to be quarantined
+			if data, isEdit := decoded.(actions.EditNoteDataV2); ok && isEdit && data.Content != nil && edited[data.NoteUUID] {
+				theirs, err := decryptContent(ctx, *data.Content)
+				if err != nil {
+					return ret, errors.Wrap(err, "decrypting the content")
+				}
+
+				saved, err := saveConflict(tx, data.NoteUUID, theirs, action.Timestamp)
+				if err != nil {
+					return ret, errors.Wrap(err, "saving the conflict")
+				}
+				if saved {
+					ret++
+				}
+
+				// Apply the rest of the edit, such as moving the note, without the content
+				data.Content = nil
+				b, err := json.Marshal(data)
+				if err != nil {
+					return ret, errors.Wrap(err, "marshalling the action data")
+				}
+
+				action.Schema = 2
+				action.Data = b
+			}
+		}
+
+		if err := Reduce(ctx, tx, action); err != nil {
+			return ret, errors.Wrap(err, "reducing action")
+		}
+	}
+
+	return ret, nil
+}
+
+// saveConflict saves the incoming content of the note as a conflict with the
+// local content. It returns false if there is no conflict because the note does
+// not exist or the contents are the same.
+func saveConflict(tx *sql.Tx, noteUUID, theirs string, ts int64) (bool, error) {
+	var ours string
+	err := tx.QueryRow("SELECT content FROM notes WHERE uuid = ?", noteUUID).Scan(&ours)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "querying the note")
+	}
+
+	if ours == theirs {
+		return false, nil
+	}
+
+	if err := RemoveConflict(tx, noteUUID); err != nil {
+		return false, errors.Wrap(err, "removing the previous conflict")
+	}
+
+	_, err = tx.Exec("INSERT INTO conflicts (note_uuid, ours, theirs, created_on) VALUES (?, ?, ?, ?)", noteUUID, ours, theirs, ts)
+	if err != nil {
+		return false, errors.Wrap(err, "inserting the conflict")
+	}
+
+	return true, nil
+}
+
+// RemoveConflict removes the conflict of the note with the given uuid
+func RemoveConflict(tx *sql.Tx, noteUUID string) error {
+	if _, err := tx.Exec("DELETE FROM conflicts WHERE note_uuid = ?", noteUUID); err != nil {
+		return errors.Wrap(err, "deleting the conflict")
+	}
+
+	return nil
+}
+
+const conflictQuery = `SELECT conflicts.id, conflicts.note_uuid, notes.id, books.label, conflicts.ours, conflicts.theirs, conflicts.created_on
+	FROM conflicts
+	INNER JOIN notes ON notes.uuid = conflicts.note_uuid
+	INNER JOIN books ON books.uuid = notes.book_uuid`
+
+// GetConflicts returns the unresolved conflicts
+func GetConflicts(db *sql.DB) ([]Conflict, error) {
+	ret := []Conflict{}
+
+	rows, err := db.Query(conflictQuery + " ORDER BY books.label ASC, notes.id ASC")
+	if err != nil {
+		return ret, errors.Wrap(err, "querying conflicts")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Conflict
+		if err := rows.Scan(&c.ID, &c.NoteUUID, &c.NoteID, &c.BookLabel, &c.Ours, &c.Theirs, &c.CreatedOn); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, c)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// GetConflict returns the unresolved conflict of the note with the given uuid
+func GetConflict(db *sql.DB, noteUUID string) (Conflict, error) {
+	var ret Conflict
+
+	err := db.QueryRow(conflictQuery+" WHERE conflicts.note_uuid = ?", noteUUID).
+		Scan(&ret.ID, &ret.NoteUUID, &ret.NoteID, &ret.BookLabel, &ret.Ours, &ret.Theirs, &ret.CreatedOn)
+	if err == sql.ErrNoRows {
+		return ret, errors.New("the note has no conflict")
+	} else if err != nil {
+		return ret, errors.Wrap(err, "querying the conflict")
+	}
+
+	return ret, nil
+}
+
+// diffLines returns the longest common subsequence table of the given lines
+func diffLines(a, b []string) [][]int {
+	ret := make([][]int, len(a)+1)
+	for i := range ret {
+		ret[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				ret[i][j] = ret[i+1][j+1] + 1
+			} else if ret[i+1][j] >= ret[i][j+1] {
+				ret[i][j] = ret[i+1][j]
+			} else {
+				ret[i][j] = ret[i][j+1]
+			}
+		}
+	}
+
+	return ret
+}
+
+// MergeConflict merges the local and the incoming contents line by line. The
+// lines that differ are surrounded by conflict markers.
+func MergeConflict(ours, theirs string) string {
+	a := strings.Split(ours, "\n")
+	b := strings.Split(theirs, "\n")
+	lcs := diffLines(a, b)
+
+	ret := []string{}
+	var oursHunk, theirsHunk []string
+	flush := func() {
+		if len(oursHunk) == 0 && len(theirsHunk) == 0 {
+			return
+		}
+
+		ret = append(ret, ConflictMarkerOurs)
+		ret = append(ret, oursHunk...)
+		ret = append(ret, ConflictMarkerSep)
+		ret = append(ret, theirsHunk...)
+		ret = append(ret, ConflictMarkerTheirs)
+
+		oursHunk = nil
+		theirsHunk = nil
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			ret = append(ret, a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			oursHunk = append(oursHunk, a[i])
+			i++
+		default:
+			theirsHunk = append(theirsHunk, b[j])
+			j++
+		}
+	}
+	flush()
+
+	return strings.Join(ret, "\n")
+}
+
+// HasConflictMarkers returns true if the content has a line consisting of a
+// conflict marker
+func HasConflictMarkers(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		switch line {
+		case ConflictMarkerOurs, ConflictMarkerSep, ConflictMarkerTheirs:
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestMergeConflict(t *testing.T) {
+	testCases := []struct {
+		ours     string
+		theirs   string
+		expected string
+	}{
+		{
+			ours:     "a\nb\nc",
+			theirs:   "a\nb\nc",
+			expected: "a\nb\nc",
+		},
+		{
+			ours:     "a\nb\nc",
+			theirs:   "a\nx\nc",
+			expected: "a\n<<<<<<< ours\nb\n=======\nx\n>>>>>>> theirs\nc",
+		},
+		{
+			ours:     "a\nb",
+			theirs:   "a\nb\nc",
+			expected: "a\nb\n<<<<<<< ours\n=======\nc\n>>>>>>> theirs",
+		},
+		{
+			ours:     "foo",
+			theirs:   "bar",
+			expected: "<<<<<<< ours\nfoo\n=======\nbar\n>>>>>>> theirs",
+		},
+	}
+
+	for idx, tc := range testCases {
+		got := MergeConflict(tc.ours, tc.theirs)
+
+		testutils.AssertEqualf(t, got, tc.expected, fmt.Sprintf("result mismatch for test case %d", idx))
+		testutils.AssertEqualf(t, HasConflictMarkers(got), tc.ours != tc.theirs, fmt.Sprintf("markers mismatch for test case %d", idx))
+	}
+}
+
+func mustMarshalEditNote(t *testing.T, noteUUID, content string) json.RawMessage {
+	b, err := json.Marshal(actions.EditNoteDataV2{
+		NoteUUID: noteUUID,
+		FromBook: "js",
+		Content:  &content,
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+
+	return b
+}
+
+func TestReduceAllWithConflicts(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup4(t, ctx)
+
+	db := ctx.DB
+	testutils.MustExec(t, "editing note 2 locally", db, "UPDATE notes SET content = ? WHERE uuid = ?", "local edit", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+
+	localEdit := actions.Action{
+		UUID:      "local-action-uuid",
+		Schema:    2,
+		Type:      actions.ActionEditNote,
+		Data:      mustMarshalEditNote(t, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "local edit"),
+		Timestamp: 1517629810,
+	}
+	delta := []actions.Action{
+		{
+			UUID:      "remote-action-uuid-1",
+			Schema:    2,
+			Type:      actions.ActionEditNote,
+			Data:      mustMarshalEditNote(t, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "remote edit"),
+			Timestamp: 1517629805,
+		},
+		{
+			UUID:      "remote-action-uuid-2",
+			Schema:    2,
+			Type:      actions.ActionEditNote,
+			Data:      mustMarshalEditNote(t, "43827b9a-c2b0-4c06-a290-97991c896653", "remote edit of note 1"),
+			Timestamp: 1517629805,
+		},
+		localEdit,
+	}
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	count, err := ReduceAllWithConflicts(ctx, tx, delta, []actions.Action{localEdit})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "reducing"))
+	}
+	tx.Commit()
+
+	// Test
+	var n1Content, n2Content string
+	testutils.MustScan(t, "scanning note 1", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "43827b9a-c2b0-4c06-a290-97991c896653"), &n1Content)
+	testutils.MustScan(t, "scanning note 2", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &n2Content)
+
+	conflicts, err := GetConflicts(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting conflicts"))
+	}
+
+	testutils.AssertEqual(t, count, 1, "conflict count mismatch")
+	testutils.AssertEqual(t, n1Content, "remote edit of note 1", "note 1 content mismatch")
+	testutils.AssertEqual(t, n2Content, "local edit", "note 2 content mismatch")
+	testutils.AssertEqual(t, len(conflicts), 1, "saved conflict count mismatch")
+	testutils.AssertEqual(t, conflicts[0].NoteID, 2, "conflict note id mismatch")
+	testutils.AssertEqual(t, conflicts[0].BookLabel, "js", "conflict book label mismatch")
+	testutils.AssertEqual(t, conflicts[0].Ours, "local edit", "conflict ours mismatch")
+	testutils.AssertEqual(t, conflicts[0].Theirs, "remote edit", "conflict theirs mismatch")
+}
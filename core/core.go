@@ -142,13 +142,14 @@ func WriteConfig(ctx infra.DnoteCtx, config infra.Config) error {
 
 	err = ioutil.WriteFile(configPath, d, 0644)
 	if err != nil {
-		errors.Wrap(err, "writing the config file")
+		return errors.Wrap(err, "writing the config file")
 	}
 
 	return nil
 }
 
-// LogAction logs action and updates the last_action
+// LogAction logs action for the remotes of the books it concerns and updates the
+// last_action
 func LogAction(tx *sql.Tx, schema int, actionType, data string, timestamp int64) error {
 	uuid := uuid.NewV4().String()
 
@@ -157,6 +158,9 @@ func LogAction(tx *sql.Tx, schema int, actionType, data string, timestamp int64)
 	if err != nil {
 		return errors.Wrap(err, "inserting an action")
 	}
+	if err := recordPendingAction(tx, uuid, data); err != nil {
+		return errors.Wrap(err, "recording the remotes to receive the action")
+	}
 
 	_, err = tx.Exec("UPDATE system SET value = ? WHERE key = ?", timestamp, "last_action")
 	if err != nil {
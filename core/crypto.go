@@ -0,0 +1,273 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+)
+
+// encryptedContentPrefix marks an encrypted content. It is followed by the salt
+// of the key and the sealed content, separated by a colon.
+const encryptedContentPrefix = "dnote:enc:v1:"
+
+// KeyError is returned when an encrypted content cannot be decrypted because
+// this machine does not have the key, or has a key derived from a wrong passphrase
+type KeyError struct {
+	// Salt identifies the key
+	Salt  string
+	Wrong bool
+}
+
+func (e *KeyError) Error() string {
+	if e.Wrong {
+		return "the passphrase for the encryption key is wrong"
+	}
+
+	return "the content is encrypted with a key this machine does not have"
+}
+
+// NewEncryptionKey derives a key from the passphrase and the base64 encoded salt
+func NewEncryptionKey(passphrase, salt string) (infra.EncryptionKey, error) {
+	s, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return infra.EncryptionKey{}, errors.Wrap(err, "decoding the salt")
+	}
+
+	key := infra.DeriveKey(passphrase, s)
+
+	return infra.EncryptionKey{
+		Salt: salt,
+		Key:  base64.StdEncoding.EncodeToString(key),
+	}, nil
+}
+
+// GenerateEncryptionKey derives a key from the passphrase and a random salt
+func GenerateEncryptionKey(passphrase string) (infra.EncryptionKey, error) {
+	salt := make([]byte, infra.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return infra.EncryptionKey{}, errors.Wrap(err, "generating a salt")
+	}
+
+	return NewEncryptionKey(passphrase, base64.StdEncoding.EncodeToString(salt))
+}
+
+func newGCM(key infra.EncryptionKey) (cipher.AEAD, error) {
+	k, err := base64.StdEncoding.DecodeString(key.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding the key")
+	}
+
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing the cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted returns true if the content is encrypted
+func IsEncrypted(content string) bool {
+	return strings.HasPrefix(content, encryptedContentPrefix)
+}
+
+// EncryptContent encrypts the content with the key
+func EncryptContent(key infra.EncryptionKey, content string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", errors.Wrap(err, "initializing the cipher")
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "generating a nonce")
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(content), nil)
+
+	return fmt.Sprintf("%s%s:%s", encryptedContentPrefix, key.Salt, base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// DecryptContent decrypts the content with the key identified by the salt in
+// the content. A content that is not encrypted is returned as it is.
+func DecryptContent(keys []infra.EncryptionKey, content string) (string, error) {
+	if !IsEncrypted(content) {
+		return content, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(content, encryptedContentPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", errors.New("malformed encrypted content")
+	}
+	salt := parts[0]
+
+	var key *infra.EncryptionKey
+	for i := range keys {
+		if keys[i].Salt == salt {
+			key = &keys[i]
+		}
+	}
+	if key == nil {
+		return "", &KeyError{Salt: salt}
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.Wrap(err, "decoding the encrypted content")
+	}
+
+	gcm, err := newGCM(*key)
+	if err != nil {
+		return "", errors.Wrap(err, "initializing the cipher")
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted content")
+	}
+
+	b, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", &KeyError{Salt: salt, Wrong: true}
+	}
+
+	return string(b), nil
+}
+
+// decryptContent decrypts the content with the keys in the config
+func decryptContent(ctx infra.DnoteCtx, content string) (string, error) {
+	if !IsEncrypted(content) || ctx.KeepEncrypted {
+		return content, nil
+	}
+
+	config, err := ReadConfig(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "reading the config")
+	}
+
+	return DecryptContent(config.EncryptionKeys, content)
+}
+
+// encryptValue encrypts the value if it is a plaintext string
+func encryptValue(key infra.EncryptionKey, value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || IsEncrypted(s) {
+		return value, nil
+	}
+
+	return EncryptContent(key, s)
+}
+
+// EncryptActions returns the actions with the contents and the tags of the notes
+// encrypted with the current key. If encryption is not enabled, the actions are
+// returned as they are.
+func EncryptActions(ctx infra.DnoteCtx, actionSlice []actions.Action) ([]actions.Action, error) {
+	config, err := ReadConfig(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading the config")
+	}
+	if len(config.EncryptionKeys) == 0 {
+		return actionSlice, nil
+	}
+	key := config.EncryptionKeys[len(config.EncryptionKeys)-1]
+
+	ret := []actions.Action{}
+	for _, action := range actionSlice {
+		if action.Type != actions.ActionAddNote && action.Type != actions.ActionEditNote && action.Type != ActionSetNoteTags {
+			ret = append(ret, action)
+			continue
+		}
+
+		// Keep the other fields as they are regardless of the schema
+		var data map[string]interface{}
+		if err := json.Unmarshal(action.Data, &data); err != nil {
+			return nil, errors.Wrap(err, "parsing the action data")
+		}
+
+		if action.Type == ActionSetNoteTags {
+			tags, _ := data["tags"].([]interface{})
+			for i, tag := range tags {
+				if tags[i], err = encryptValue(key, tag); err != nil {
+					return nil, errors.Wrap(err, "encrypting a tag")
+				}
+			}
+		} else if content, ok := data["content"]; ok {
+			if data["content"], err = encryptValue(key, content); err != nil {
+				return nil, errors.Wrap(err, "encrypting the content")
+			}
+		}
+
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshalling the action data")
+		}
+		action.Data = b
+
+		ret = append(ret, action)
+	}
+
+	return ret, nil
+}
+
+// GetMissingKeySalt returns the salt of the key that was missing or wrong when
+// decrypting the contents from another machine, if any
+func GetMissingKeySalt(db *sql.DB) (string, error) {
+	salt, _, err := getSystemValue(db, "missing_key_salt")
+	if err != nil {
+		return "", errors.Wrap(err, "getting the salt")
+	}
+
+	return salt, nil
+}
+
+// SetMissingKeySalt saves the salt of the key that was missing or wrong when
+// decrypting the contents from another machine. An empty salt clears it.
+func SetMissingKeySalt(db *sql.DB, salt string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if salt == "" {
+		_, err = tx.Exec("DELETE FROM system WHERE key = ?", "missing_key_salt")
+	} else {
+		err = setSystemValue(tx, "missing_key_salt", salt)
+	}
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving the salt")
+	}
+
+	tx.Commit()
+
+	return nil
+}
+
+// AddEncryptionKey adds the key to the config as the current key, replacing
+// the key with the same salt if any
+func AddEncryptionKey(ctx infra.DnoteCtx, key infra.EncryptionKey) error {
+	config, err := ReadConfig(ctx)
+	if err != nil {
+		return errors.Wrap(err, "reading the config")
+	}
+
+	keys := []infra.EncryptionKey{}
+	for _, k := range config.EncryptionKeys {
+		if k.Salt != key.Salt {
+			keys = append(keys, k)
+		}
+	}
+	config.EncryptionKeys = append(keys, key)
+
+	if err := WriteConfig(ctx, config); err != nil {
+		return errors.Wrap(err, "writing the config")
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestEncryptContent(t *testing.T) {
+	key, err := GenerateEncryptionKey("correct horse")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating a key"))
+	}
+	sameKey, err := NewEncryptionKey("correct horse", key.Salt)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "deriving the key"))
+	}
+	wrongKey, err := NewEncryptionKey("battery staple", key.Salt)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "deriving a wrong key"))
+	}
+	otherKey, err := GenerateEncryptionKey("correct horse")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating another key"))
+	}
+
+	encrypted, err := EncryptContent(key, "secret note")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting"))
+	}
+
+	testutils.AssertEqual(t, IsEncrypted(encrypted), true, "encrypted mismatch")
+	testutils.AssertEqual(t, strings.Contains(encrypted, "secret note"), false, "plaintext in the encrypted content")
+
+	t.Run("same passphrase", func(t *testing.T) {
+		got, err := DecryptContent([]infra.EncryptionKey{otherKey, sameKey}, encrypted)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "decrypting"))
+		}
+
+		testutils.AssertEqual(t, got, "secret note", "decrypted content mismatch")
+	})
+
+	t.Run("plaintext", func(t *testing.T) {
+		got, err := DecryptContent([]infra.EncryptionKey{}, "plain note")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "decrypting"))
+		}
+
+		testutils.AssertEqual(t, got, "plain note", "content mismatch")
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := DecryptContent([]infra.EncryptionKey{otherKey}, encrypted)
+
+		keyErr, ok := err.(*KeyError)
+		testutils.AssertEqual(t, ok, true, "error type mismatch")
+		testutils.AssertEqual(t, keyErr.Salt, key.Salt, "salt mismatch")
+		testutils.AssertEqual(t, keyErr.Wrong, false, "wrong mismatch")
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		_, err := DecryptContent([]infra.EncryptionKey{wrongKey}, encrypted)
+
+		keyErr, ok := err.(*KeyError)
+		testutils.AssertEqual(t, ok, true, "error type mismatch")
+		testutils.AssertEqual(t, keyErr.Wrong, true, "wrong mismatch")
+	})
+}
+
+func TestEncryptActions(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	key, err := GenerateEncryptionKey("correct horse")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "generating a key"))
+	}
+	if err := WriteConfig(ctx, infra.Config{EncryptionKeys: []infra.EncryptionKey{key}}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	content := "edited"
+	b1, err := json.Marshal(actions.AddNoteDataV2{NoteUUID: "note-uuid", BookName: "js", Content: "added", Public: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+	b2, err := json.Marshal(actions.EditNoteDataV2{NoteUUID: "note-uuid", FromBook: "js", Content: &content})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+	b3, err := json.Marshal(actions.AddBookDataV1{BookName: "js"})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+	b4, err := json.Marshal(SetNoteTagsDataV1{NoteUUID: "note-uuid", Tags: []string{"idea", "todo"}})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+	actionSlice := []actions.Action{
+		{UUID: "1", Schema: 2, Type: actions.ActionAddNote, Data: b1, Timestamp: 1517629805},
+		{UUID: "2", Schema: 2, Type: actions.ActionEditNote, Data: b2, Timestamp: 1517629806},
+		{UUID: "3", Schema: 1, Type: actions.ActionAddBook, Data: b3, Timestamp: 1517629807},
+		{UUID: "4", Schema: 1, Type: ActionSetNoteTags, Data: b4, Timestamp: 1517629808},
+	}
+
+	// Execute
+	got, err := EncryptActions(ctx, actionSlice)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting actions"))
+	}
+
+	// Test
+	var addData actions.AddNoteDataV2
+	if err := json.Unmarshal(got[0].Data, &addData); err != nil {
+		t.Fatal(errors.Wrap(err, "unmarshalling"))
+	}
+	var editData actions.EditNoteDataV2
+	if err := json.Unmarshal(got[1].Data, &editData); err != nil {
+		t.Fatal(errors.Wrap(err, "unmarshalling"))
+	}
+
+	var tagsData SetNoteTagsDataV1
+	if err := json.Unmarshal(got[3].Data, &tagsData); err != nil {
+		t.Fatal(errors.Wrap(err, "unmarshalling"))
+	}
+
+	testutils.AssertEqual(t, len(got), 4, "action count mismatch")
+	testutils.AssertEqual(t, IsEncrypted(addData.Content), true, "add_note content not encrypted")
+	testutils.AssertEqual(t, addData.Public, true, "add_note public mismatch")
+	testutils.AssertEqual(t, addData.BookName, "js", "add_note book name mismatch")
+	testutils.AssertEqual(t, IsEncrypted(*editData.Content), true, "edit_note content not encrypted")
+	testutils.AssertEqual(t, string(got[2].Data), string(b3), "add_book data mismatch")
+	testutils.AssertEqual(t, tagsData.NoteUUID, "note-uuid", "set_note_tags note uuid mismatch")
+	testutils.AssertEqual(t, len(tagsData.Tags), 2, "set_note_tags tag count mismatch")
+	testutils.AssertEqual(t, IsEncrypted(tagsData.Tags[0]), true, "first tag not encrypted")
+	testutils.AssertEqual(t, IsEncrypted(tagsData.Tags[1]), true, "second tag not encrypted")
+
+	// Execute
+	again, err := EncryptActions(ctx, got)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting the encrypted actions"))
+	}
+
+	// Test
+	testutils.AssertEqual(t, string(again[0].Data), string(got[0].Data), "add_note encrypted twice")
+	testutils.AssertEqual(t, string(again[3].Data), string(got[3].Data), "set_note_tags encrypted twice")
+
+	// Execute
+	testutils.Setup1(t, ctx)
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := ReduceAll(ctx, tx, []actions.Action{got[0], got[1], got[3]}); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "reducing"))
+	}
+	tx.Commit()
+
+	// Test
+	var noteContent string
+	testutils.MustScan(t, "getting the note", ctx.DB.QueryRow("SELECT content FROM notes WHERE uuid = ?", "note-uuid"), &noteContent)
+	testutils.AssertEqual(t, noteContent, "edited", "reduced content mismatch")
+
+	var tagLabels string
+	testutils.MustScan(t, "getting the tags", ctx.DB.QueryRow(`SELECT group_concat(label, ',') FROM (SELECT tags.label FROM note_tags
+		INNER JOIN tags ON tags.uuid = note_tags.tag_uuid
+		WHERE note_tags.note_uuid = ? ORDER BY tags.label ASC)`, "note-uuid"), &tagLabels)
+	testutils.AssertEqual(t, tagLabels, "idea,todo", "reduced tags mismatch")
+}
@@ -0,0 +1,191 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+)
+
+// ShortUUIDLength is the length of the uuid prefix shown to identify a note.
+// Unlike the index of a note, the prefix is the same on every machine.
+const ShortUUIDLength = 8
+
+// MinUUIDPrefixLength is the minimum length of a uuid prefix identifying a note
+const MinUUIDPrefixLength = 4
+
+var uuidPrefixRegex = regexp.MustCompile(`^[0-9a-fA-F-]+$`)
+var indexRegex = regexp.MustCompile(`^[0-9]+$`)
+
+// NoteRef is a note found by a reference given by the user
+type NoteRef struct {
+	UUID      string
+	ID        int
+	BookLabel string
+	Content   string
+}
+
+// AmbiguousNoteError is returned when a uuid prefix matches several notes
+type AmbiguousNoteError struct {
+	Prefix     string
+	Candidates []NoteRef
+}
+
+func (e *AmbiguousNoteError) Error() string {
+	lines := []string{fmt.Sprintf("'%s' matches %d notes. use a longer prefix of one of:", e.Prefix, len(e.Candidates))}
+	for _, c := range e.Candidates {
+		lines = append(lines, fmt.Sprintf("  %s in %s: %s", ShortUUID(c.UUID), c.BookLabel, Excerpt(c.Content)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Excerpt returns the first line of the content
+func Excerpt(content string) string {
+	if idx := strings.Index(content, "\n"); idx > -1 {
+		return fmt.Sprintf("%s...", strings.TrimRight(content[:idx], "\r"))
+	}
+
+	return content
+}
+
+// ShortUUID returns the prefix of the uuid shown to identify a note
+func ShortUUID(uuid string) string {
+	if len(uuid) < ShortUUIDLength {
+		return uuid
+	}
+
+	return uuid[:ShortUUIDLength]
+}
+
+// IsUUIDPrefix returns true if the string can be a uuid prefix identifying a note
+func IsUUIDPrefix(s string) bool {
+	return len(s) >= MinUUIDPrefixLength && uuidPrefixRegex.MatchString(s)
+}
+
+// IsNoteID returns true if the argument is a note id rather than a book name.
+// A book takes precedence over a note id with the same name.
+func IsNoteID(ctx infra.DnoteCtx, arg string) (bool, error) {
+	if !IsUUIDPrefix(arg) {
+		return false, nil
+	}
+
+	var count int
+	if err := ctx.DB.QueryRow("SELECT count(*) FROM books WHERE label = ?", arg).Scan(&count); err != nil {
+		return false, errors.Wrap(err, "counting books")
+	}
+
+	return count == 0, nil
+}
+
+// FindNote returns the note referred to by the reference, which is either the
+// index of the note in the book or a prefix of its uuid. If the book label is
+// empty, the note is looked up by the uuid prefix in all books.
+func FindNote(ctx infra.DnoteCtx, bookLabel, ref string) (NoteRef, error) {
+	db := ctx.DB
+
+	if bookLabel == "" {
+		if !IsUUIDPrefix(ref) {
+			return NoteRef{}, errors.Errorf("'%s' is not a note id. give at least %d characters of the id, or a book and the index of a note", ref, MinUUIDPrefixLength)
+		}
+
+		return findNoteByPrefix(db, ref, "")
+	}
+
+	bookUUID, err := GetBookUUID(ctx, bookLabel)
+	if err != nil {
+		return NoteRef{}, errors.Wrap(err, "finding book uuid")
+	}
+
+	if indexRegex.MatchString(ref) {
+		ret := NoteRef{BookLabel: bookLabel}
+		err := db.QueryRow("SELECT uuid, id, content FROM notes WHERE id = ? AND book_uuid = ?", ref, bookUUID).
+			Scan(&ret.UUID, &ret.ID, &ret.Content)
+		if err == nil {
+			return ret, nil
+		} else if err != sql.ErrNoRows {
+			return NoteRef{}, errors.Wrap(err, "querying the note")
+		}
+	}
+
+	if !IsUUIDPrefix(ref) {
+		return NoteRef{}, errors.Errorf("note %s not found in the book '%s'", ref, bookLabel)
+	}
+
+	return findNoteByPrefix(db, ref, bookUUID)
+}
+
+// FindNoteByArgs returns the note referred to by the arguments of a command,
+// which are either a book and a reference to a note in it, or a note id
+func FindNoteByArgs(ctx infra.DnoteCtx, args []string) (NoteRef, error) {
+	switch len(args) {
+	case 1:
+		return FindNote(ctx, "", args[0])
+	case 2:
+		return FindNote(ctx, args[0], args[1])
+	}
+
+	return NoteRef{}, errors.New("Incorrect number of arguments")
+}
+
+// findNoteByPrefix returns the note whose uuid starts with the prefix. If the
+// book uuid is not empty, only the notes in the book are looked up.
+func findNoteByPrefix(db *sql.DB, prefix, bookUUID string) (NoteRef, error) {
+	query := `SELECT notes.uuid, notes.id, books.label, notes.content
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.uuid LIKE ?`
+	args := []interface{}{strings.ToLower(prefix) + "%"}
+	if bookUUID != "" {
+		query = fmt.Sprintf("%s AND notes.book_uuid = ?", query)
+		args = append(args, bookUUID)
+	}
+
+	rows, err := db.Query(query+" ORDER BY notes.uuid ASC", args...)
+	if err != nil {
+		return NoteRef{}, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	candidates := []NoteRef{}
+	for rows.Next() {
+		var ref NoteRef
+		if err := rows.Scan(&ref.UUID, &ref.ID, &ref.BookLabel, &ref.Content); err != nil {
+			return NoteRef{}, errors.Wrap(err, "scanning a row")
+		}
+
+		candidates = append(candidates, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return NoteRef{}, errors.Wrap(err, "scanning rows")
+	}
+
+	switch len(candidates) {
+	case 0:
+		return NoteRef{}, errors.Errorf("note %s not found", prefix)
+	case 1:
+		return candidates[0], nil
+	}
+
+	return NoteRef{}, &AmbiguousNoteError{Prefix: prefix, Candidates: candidates}
+}
+
+// SetNotePublic changes whether the note is public and logs an action for editing
+// the note
+func SetNotePublic(tx *sql.Tx, noteUUID, bookLabel string, public bool, ts int64) error {
+	_, err := tx.Exec(`UPDATE notes
+		SET public = ?, edited_on = ?
+		WHERE uuid = ?`, public, ts, noteUUID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	if err := LogActionEditNotePublic(tx, noteUUID, bookLabel, public, ts); err != nil {
+		return errors.Wrap(err, "logging an action")
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+)
+
+func TestFindNote(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.MustExec(t, "setting up note 4", ctx.DB, "INSERT INTO notes (id, uuid, book_uuid, content, added_on) VALUES (?, ?, ?, ?, ?)", 4, "f0d0aaaa-0000-4000-8000-000000000000", "linux-book-uuid", "grep -r\nrecursively", 1515199971)
+
+	testCases := []struct {
+		name      string
+		bookLabel string
+		ref       string
+		expected  string
+		ambiguous int
+	}{
+		{
+			name:      "index",
+			bookLabel: "js",
+			ref:       "2",
+			expected:  "43827b9a-c2b0-4c06-a290-97991c896653",
+		},
+		{
+			name:      "prefix in a book",
+			bookLabel: "linux",
+			ref:       "f0d0",
+			expected:  "f0d0aaaa-0000-4000-8000-000000000000",
+		},
+		{
+			name:     "prefix",
+			ref:      "3E065D",
+			expected: "3e065d55-6d47-42f2-a6bf-f5844130b2d2",
+		},
+		{
+			name:     "longer prefix",
+			ref:      "f0d0f",
+			expected: "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+		},
+		{
+			name:      "ambiguous prefix",
+			ref:       "f0d0",
+			ambiguous: 2,
+		},
+		{
+			name: "short prefix",
+			ref:  "f0d",
+		},
+		{
+			name: "index without a book",
+			ref:  "2",
+		},
+		{
+			name:      "index not in the book",
+			bookLabel: "js",
+			ref:       "3",
+		},
+		{
+			name: "unknown prefix",
+			ref:  "abcd",
+		},
+		{
+			name:      "unknown book",
+			bookLabel: "go",
+			ref:       "1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FindNote(ctx, tc.bookLabel, tc.ref)
+
+			if tc.expected != "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+
+				testutils.AssertEqual(t, got.UUID, tc.expected, "uuid mismatch")
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected an error. got %s", got.UUID)
+			}
+
+			ambiguousErr, ok := err.(*AmbiguousNoteError)
+			testutils.AssertEqual(t, ok, tc.ambiguous > 0, "error type mismatch")
+			if ok {
+				testutils.AssertEqual(t, len(ambiguousErr.Candidates), tc.ambiguous, "candidate count mismatch")
+				testutils.AssertEqual(t, ambiguousErr.Error(), "'f0d0' matches 2 notes. use a longer prefix of one of:\n  f0d0aaaa in linux: grep -r...\n  f0d0fbb7 in js: Date object implements mathematical comparisons", "error message mismatch")
+			}
+		})
+	}
+}
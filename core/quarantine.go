@@ -0,0 +1,152 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/pkg/errors"
+)
+
+// quarantineAction keeps the action that cannot be reduced so that it can be
+// reduced by a version supporting it
+func quarantineAction(tx *sql.Tx, action actions.Action) error {
+	_, err := tx.Exec(`INSERT INTO quarantined_actions (uuid, schema, type, data, timestamp, quarantined_on)
+		VALUES (?, ?, ?, ?, ?, ?)`, action.UUID, action.Schema, action.Type, string(action.Data), action.Timestamp, time.Now().Unix())
+	if err != nil {
+		return errors.Wrap(err, "inserting the action")
+	}
+
+	return nil
+}
+
+// quarantinedAction is an action in the quarantine
+type quarantinedAction struct {
+	id     int
+	action actions.Action
+}
+
+// getQuarantinedActions returns the quarantined actions in the order they were
+// received
+func getQuarantinedActions(tx *sql.Tx) ([]quarantinedAction, error) {
+	rows, err := tx.Query("SELECT id, uuid, schema, type, data, timestamp FROM quarantined_actions ORDER BY id ASC")
+	if err != nil {
+		return nil, errors.Wrap(err, "querying quarantined actions")
+	}
+	defer rows.Close()
+
+	ret := []quarantinedAction{}
+	for rows.Next() {
+		var q quarantinedAction
+		var data string
+		if err := rows.Scan(&q.id, &q.action.UUID, &q.action.Schema, &q.action.Type, &data, &q.action.Timestamp); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		q.action.Data = json.RawMessage(data)
+		ret = append(ret, q)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// tryHandle reduces the decoded action and undoes its partial changes if it
+// fails. The error reducing the action is returned apart from the error undoing
+// it.
+func tryHandle(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) (error, error) {
+	if _, err := tx.Exec("SAVEPOINT reduce_action"); err != nil {
+		return nil, errors.Wrap(err, "creating a savepoint")
+	}
+
+	reduceErr := reducers[action.Type].handle(ctx, tx, action, data)
+	if reduceErr != nil {
+		if _, err := tx.Exec("ROLLBACK TO reduce_action"); err != nil {
+			return nil, errors.Wrap(err, "rolling back to the savepoint")
+		}
+	}
+
+	if _, err := tx.Exec("RELEASE reduce_action"); err != nil {
+		return nil, errors.Wrap(err, "releasing the savepoint")
+	}
+
+	return reduceErr, nil
+}
+
+// ReduceQuarantined reduces the quarantined actions that are now supported and
+// removes them from the quarantine. An action that still cannot be reduced is
+// kept. It returns the number of reduced actions.
+func ReduceQuarantined(ctx infra.DnoteCtx, tx *sql.Tx) (int, error) {
+	quarantined, err := getQuarantinedActions(tx)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting quarantined actions")
+	}
+
+	var ret int
+	for _, q := range quarantined {
+		action := q.action
+
+		data, ok, err := decodeAction(action)
+		if err != nil {
+			log.Warnf("skipped a malformed quarantined action %s: %s\n", action.UUID, err.Error())
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		reduceErr, err := tryHandle(ctx, tx, action, data)
+		if err != nil {
+			return ret, errors.Wrapf(err, "reducing %s", action.Type)
+		}
+		if reduceErr != nil {
+			log.Warnf("kept the quarantined action %s: %s\n", action.UUID, reduceErr.Error())
+			continue
+		}
+
+		if _, err := tx.Exec("DELETE FROM quarantined_actions WHERE id = ?", q.id); err != nil {
+			return ret, errors.Wrap(err, "removing the action from the quarantine")
+		}
+
+		ret++
+	}
+
+	return ret, nil
+}
+
+// ReduceOrQuarantine reduces the action. An action that cannot be reduced, such
+// as a note added to a book that does not exist yet, is quarantined instead of
+// failing so that ReduceQuarantined retries it. It returns whether the action
+// was reduced.
+func ReduceOrQuarantine(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) (bool, error) {
+	data, ok, err := decodeAction(action)
+	if err == nil && ok {
+		var reduceErr error
+		reduceErr, err = tryHandle(ctx, tx, action, data)
+		if err != nil {
+			return false, errors.Wrapf(err, "reducing %s", action.Type)
+		}
+		if reduceErr == nil {
+			return true, nil
+		}
+
+		err = reduceErr
+	}
+
+	if err := quarantineAction(tx, action); err != nil {
+		return false, errors.Wrapf(err, "quarantining %s", action.Type)
+	}
+
+	if err != nil {
+		log.Warnf("quarantined the action %s: %s\n", action.UUID, err.Error())
+	} else {
+		log.Warnf("skipped an unsupported action %s (schema %d)\n", action.Type, action.Schema)
+	}
+
+	return false, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"reflect"
 
 	"github.com/dnote/actions"
 	"github.com/dnote/cli/infra"
@@ -23,60 +24,211 @@ func ReduceAll(ctx infra.DnoteCtx, tx *sql.Tx, actionSlice []actions.Action) err
 	return nil
 }
 
+// actionKey identifies the format of the data of an action
+type actionKey struct {
+	actionType string
+	schema     int
+}
+
+// decoder parses the data of an action
+type decoder func(data json.RawMessage) (interface{}, error)
+
+// upcaster converts the data of an action into the next schema
+type upcaster func(data interface{}) interface{}
+
+// handler applies an action whose data is in the latest schema of its type
+type handler func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error
+
+// reducer reduces the actions of a type
+type reducer struct {
+	// schema is the latest schema of the type. The data in older schemas are
+	// upcast to it before being handled.
+	schema int
+	handle handler
+}
+
+// reducers holds the reducer of each action type
+var reducers = map[string]reducer{
+	actions.ActionAddNote: {schema: 2, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleAddNote(ctx, tx, action, data.(actions.AddNoteDataV2))
+	}},
+	actions.ActionRemoveNote: {schema: 1, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleRemoveNote(ctx, tx, action, data.(actions.RemoveNoteDataV1))
+	}},
+	actions.ActionEditNote: {schema: 2, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleEditNote(ctx, tx, action, data.(actions.EditNoteDataV2))
+	}},
+	actions.ActionAddBook: {schema: 1, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleAddBook(ctx, tx, action, data.(actions.AddBookDataV1))
+	}},
+	actions.ActionRemoveBook: {schema: 1, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleRemoveBook(ctx, tx, action, data.(actions.RemoveBookDataV1))
+	}},
+	ActionSetNoteTags: {schema: 1, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleSetNoteTags(ctx, tx, action, data.(SetNoteTagsDataV1))
+	}},
+	ActionRenameBook: {schema: 1, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleRenameBook(ctx, tx, action, data.(RenameBookDataV1))
+	}},
+	ActionReviewNote: {schema: 1, handle: func(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data interface{}) error {
+		return handleReviewNote(ctx, tx, action, data.(ReviewNoteDataV1))
+	}},
+}
+
+// decoders holds the decoder of each supported schema of each action type
+var decoders = map[actionKey]decoder{
+	{actions.ActionAddNote, 1}:    jsonDecoder(actions.AddNoteDataV1{}),
+	{actions.ActionAddNote, 2}:    jsonDecoder(actions.AddNoteDataV2{}),
+	{actions.ActionRemoveNote, 1}: jsonDecoder(actions.RemoveNoteDataV1{}),
+	{actions.ActionEditNote, 1}:   jsonDecoder(actions.EditNoteDataV1{}),
+	{actions.ActionEditNote, 2}:   jsonDecoder(actions.EditNoteDataV2{}),
+	{actions.ActionAddBook, 1}:    jsonDecoder(actions.AddBookDataV1{}),
+	{actions.ActionRemoveBook, 1}: jsonDecoder(actions.RemoveBookDataV1{}),
+	{ActionSetNoteTags, 1}:        jsonDecoder(SetNoteTagsDataV1{}),
+	{ActionRenameBook, 1}:         jsonDecoder(RenameBookDataV1{}),
+	{ActionReviewNote, 1}:         jsonDecoder(ReviewNoteDataV1{}),
+}
+
+// upcasters holds the upcaster of each schema that is not the latest, keyed by
+// the schema it converts from
+var upcasters = map[actionKey]upcaster{
+	{actions.ActionAddNote, 1}:  upcastAddNoteV1,
+	{actions.ActionEditNote, 1}: upcastEditNoteV1,
+}
+
+// jsonDecoder returns a decoder parsing JSON into a value of the type of v
+func jsonDecoder(v interface{}) decoder {
+	t := reflect.TypeOf(v)
+
+	return func(data json.RawMessage) (interface{}, error) {
+		ptr := reflect.New(t)
+		if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+			return nil, err
+		}
+
+		return ptr.Elem().Interface(), nil
+	}
+}
+
+func upcastAddNoteV1(data interface{}) interface{} {
+	d := data.(actions.AddNoteDataV1)
+
+	return actions.AddNoteDataV2{
+		NoteUUID: d.NoteUUID,
+		BookName: d.BookName,
+		Content:  d.Content,
+		Public:   false,
+	}
+}
+
+// upcastEditNoteV1 converts an edit in schema 1, which always carries the
+// content and the destination book, into one changing only what is given
+func upcastEditNoteV1(data interface{}) interface{} {
+	d := data.(actions.EditNoteDataV1)
+
+	ret := actions.EditNoteDataV2{
+		NoteUUID: d.NoteUUID,
+		FromBook: d.FromBook,
+	}
+	if d.Content != "" {
+		content := d.Content
+		ret.Content = &content
+	}
+	if d.ToBook != "" && d.ToBook != d.FromBook {
+		toBook := d.ToBook
+		ret.ToBook = &toBook
+	}
+
+	return ret
+}
+
+// decodeAction parses the data of the action and upcasts it to the latest
+// schema of the type. It returns false if the type or the schema is not
+// supported.
+func decodeAction(action actions.Action) (interface{}, bool, error) {
+	r, ok := reducers[action.Type]
+	if !ok || action.Schema > r.schema {
+		return nil, false, nil
+	}
+	decode, ok := decoders[actionKey{action.Type, action.Schema}]
+	if !ok {
+		return nil, false, nil
+	}
+
+	data, err := decode(action.Data)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "parsing the action data")
+	}
+
+	for schema := action.Schema; schema < r.schema; schema++ {
+		upcast, ok := upcasters[actionKey{action.Type, schema}]
+		if !ok {
+			return nil, false, errors.Errorf("no upcaster from schema %d", schema)
+		}
+
+		data = upcast(data)
+	}
+
+	return data, true, nil
+}
+
 // Reduce transitions the local dnote state by consuming the action returned
-// from the server
+// from the server. The actions of an unsupported type or schema, such as those
+// written by a newer version, are quarantined instead so that they can be
+// reduced after upgrading.
 func Reduce(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error {
-	var err error
+	data, ok, err := decodeAction(action)
+	if err != nil {
+		return errors.Wrapf(err, "decoding %s", action.Type)
+	}
+	if !ok {
+		if err := quarantineAction(tx, action); err != nil {
+			return errors.Wrapf(err, "quarantining %s", action.Type)
+		}
 
-	switch action.Type {
-	case actions.ActionAddNote:
-		err = handleAddNote(ctx, tx, action)
-	case actions.ActionRemoveNote:
-		err = handleRemoveNote(ctx, tx, action)
-	case actions.ActionEditNote:
-		err = handleEditNote(ctx, tx, action)
-	case actions.ActionAddBook:
-		err = handleAddBook(ctx, tx, action)
-	case actions.ActionRemoveBook:
-		err = handleRemoveBook(ctx, tx, action)
-	default:
-		return errors.Errorf("Unsupported action %s", action.Type)
+		log.Warnf("skipped an unsupported action %s (schema %d)\n", action.Type, action.Schema)
+		return nil
 	}
 
-	if err != nil {
+	if err := reducers[action.Type].handle(ctx, tx, action, data); err != nil {
 		return errors.Wrapf(err, "reducing %s", action.Type)
 	}
 
 	return nil
 }
 
-func getBookUUIDWithTx(tx *sql.Tx, bookLabel string) (string, error) {
-	var ret string
-	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ?", bookLabel).Scan(&ret)
-	if err == sql.ErrNoRows {
-		return ret, errors.Errorf("book '%s' not found", bookLabel)
-	} else if err != nil {
-		return ret, errors.Wrap(err, "querying the book")
+// getBookUUIDWithTx returns the uuid of the book with the given label and whether
+// the book is in the trash. It returns an error if the book is not found.
+func getBookUUIDWithTx(tx *sql.Tx, bookLabel string) (string, bool, error) {
+	ret, trashed, err := findBookUUID(tx, bookLabel)
+	if err != nil {
+		return ret, false, errors.Wrap(err, "finding the book")
+	}
+	if ret == "" {
+		return ret, false, errors.Errorf("book '%s' not found", bookLabel)
 	}
 
-	return ret, nil
+	return ret, trashed, nil
 }
 
-func handleAddNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error {
-	var data actions.AddNoteDataV1
-	if err := json.Unmarshal(action.Data, &data); err != nil {
-		return errors.Wrap(err, "parsing the action data")
-	}
-
+func handleAddNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data actions.AddNoteDataV2) error {
 	log.Debug("reducing add_note. action: %+v. data: %+v\n", action, data)
 
-	bookUUID, err := getBookUUIDWithTx(tx, data.BookName)
+	content, err := decryptContent(ctx, data.Content)
+	if err != nil {
+		return errors.Wrap(err, "decrypting the content")
+	}
+	data.Content = content
+
+	bookUUID, bookTrashed, err := getBookUUIDWithTx(tx, data.BookName)
 	if err != nil {
 		return errors.Wrap(err, "getting book uuid")
 	}
 
 	var noteCount int
-	err = tx.QueryRow("SELECT count(uuid) FROM notes WHERE uuid = ? AND book_uuid = ?", data.NoteUUID, bookUUID).Scan(&noteCount)
+	err = tx.QueryRow(`SELECT
+		(SELECT count(uuid) FROM notes WHERE uuid = ? AND book_uuid = ?) +
+		(SELECT count(uuid) FROM trash_notes WHERE uuid = ?)`, data.NoteUUID, bookUUID, data.NoteUUID).Scan(&noteCount)
 	if err != nil {
 		return errors.Wrap(err, "counting note")
 	}
@@ -89,9 +241,24 @@ func handleAddNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error
 		return nil
 	}
 
+	if bookTrashed {
+		// The note belongs to a book in the trash. Put it in the trash along with the book so
+		// that it is restored or deleted together with the book.
+		_, err = tx.Exec(`INSERT INTO trash_notes
+		(note_id, uuid, book_uuid, content, added_on, edited_on, public, trashed_on, with_book)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, 0, data.NoteUUID, bookUUID, data.Content, action.Timestamp, 0, data.Public, action.Timestamp, true)
+		if err != nil {
+			return errors.Wrap(err, "inserting a trashed note")
+		}
+
+		return nil
+	}
+
+	// The note is added the way it was on the machine that added it, which is
+	// when the action took place. It has not been edited since.
 	_, err = tx.Exec(`INSERT INTO notes
-	(uuid, book_uuid, content, added_on, public)
-	VALUES (?, ?, ?, ?, ?)`, data.NoteUUID, bookUUID, data.Content, action.Timestamp, false)
+	(uuid, book_uuid, content, added_on, edited_on, public)
+	VALUES (?, ?, ?, ?, ?, ?)`, data.NoteUUID, bookUUID, data.Content, action.Timestamp, 0, data.Public)
 	if err != nil {
 		return errors.Wrap(err, "inserting a note")
 	}
@@ -99,23 +266,37 @@ func handleAddNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error
 	return nil
 }
 
-func handleRemoveNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error {
-	var data actions.RemoveNoteDataV1
-	if err := json.Unmarshal(action.Data, &data); err != nil {
-		return errors.Wrap(err, "parsing the action data")
-	}
-
+func handleRemoveNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data actions.RemoveNoteDataV1) error {
 	log.Debug("reducing remove_note. action: %+v. data: %+v\n", action, data)
 
 	_, err := tx.Exec("DELETE FROM notes WHERE uuid = ?", data.NoteUUID)
 	if err != nil {
 		return errors.Wrap(err, "removing a note")
 	}
+	_, err = tx.Exec("DELETE FROM trash_notes WHERE uuid = ?", data.NoteUUID)
+	if err != nil {
+		return errors.Wrap(err, "removing a trashed note")
+	}
+	_, err = tx.Exec("DELETE FROM note_tags WHERE note_uuid = ?", data.NoteUUID)
+	if err != nil {
+		return errors.Wrap(err, "removing tags of the note")
+	}
+	_, err = tx.Exec("DELETE FROM note_revisions WHERE note_uuid = ?", data.NoteUUID)
+	if err != nil {
+		return errors.Wrap(err, "removing revisions of the note")
+	}
+	_, err = tx.Exec("DELETE FROM reviews WHERE note_uuid = ?", data.NoteUUID)
+	if err != nil {
+		return errors.Wrap(err, "removing the review of the note")
+	}
+	if err := RemoveConflict(tx, data.NoteUUID); err != nil {
+		return errors.Wrap(err, "removing the conflict of the note")
+	}
 
 	return nil
 }
 
-func buildEditNoteQuery(ctx infra.DnoteCtx, tx *sql.Tx, noteUUID, bookUUID string, ts int64, data actions.EditNoteDataV2) (string, []interface{}, error) {
+func buildEditNoteQuery(ctx infra.DnoteCtx, tx *sql.Tx, table, noteUUID, bookUUID string, ts int64, data actions.EditNoteDataV2) (string, []interface{}, error) {
 	setTmpl := "edited_on = ?"
 	queryArgs := []interface{}{ts}
 
@@ -128,7 +309,7 @@ func buildEditNoteQuery(ctx infra.DnoteCtx, tx *sql.Tx, noteUUID, bookUUID strin
 		queryArgs = append(queryArgs, *data.Public)
 	}
 	if data.ToBook != nil {
-		bookUUID, err := getBookUUIDWithTx(tx, *data.ToBook)
+		bookUUID, _, err := getBookUUIDWithTx(tx, *data.ToBook)
 		if err != nil {
 			return "", []interface{}{}, errors.Wrap(err, "getting destination book uuid")
 		}
@@ -137,55 +318,81 @@ func buildEditNoteQuery(ctx infra.DnoteCtx, tx *sql.Tx, noteUUID, bookUUID strin
 		queryArgs = append(queryArgs, bookUUID)
 	}
 
-	queryTmpl := fmt.Sprintf("UPDATE notes SET %s WHERE uuid = ? AND book_uuid = ?", setTmpl)
+	queryTmpl := fmt.Sprintf("UPDATE %s SET %s WHERE uuid = ? AND book_uuid = ?", table, setTmpl)
 	queryArgs = append(queryArgs, noteUUID, bookUUID)
 
 	return queryTmpl, queryArgs, nil
 }
 
-func handleEditNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error {
-	var data actions.EditNoteDataV2
-	err := json.Unmarshal(action.Data, &data)
-	if err != nil {
-		return errors.Wrap(err, "parsing the action data")
-	}
-
+func handleEditNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data actions.EditNoteDataV2) error {
 	log.Debug("reducing edit_note v2. action: %+v. data: %+v\n", action, data)
 
-	bookUUID, err := getBookUUIDWithTx(tx, data.FromBook)
+	if data.Content != nil {
+		content, err := decryptContent(ctx, *data.Content)
+		if err != nil {
+			return errors.Wrap(err, "decrypting the content")
+		}
+		data.Content = &content
+	}
+
+	bookUUID, _, err := getBookUUIDWithTx(tx, data.FromBook)
 	if err != nil {
 		return errors.Wrap(err, "getting book uuid")
 	}
 
-	queryTmpl, queryArgs, err := buildEditNoteQuery(ctx, tx, data.NoteUUID, bookUUID, action.Timestamp, data)
-	if err != nil {
-		return errors.Wrap(err, "building edit note query")
+	if data.Content != nil {
+		if err := SaveNoteRevision(tx, data.NoteUUID, *data.Content); err != nil {
+			return errors.Wrap(err, "saving the revision")
+		}
 	}
-	_, err = tx.Exec(queryTmpl, queryArgs...)
-	if err != nil {
-		return errors.Wrap(err, "updating a note")
+
+	// Edit the note in the trash as well so that it is up-to-date when restored
+	for _, table := range []string{"notes", "trash_notes"} {
+		queryTmpl, queryArgs, err := buildEditNoteQuery(ctx, tx, table, data.NoteUUID, bookUUID, action.Timestamp, data)
+		if err != nil {
+			return errors.Wrap(err, "building edit note query")
+		}
+		_, err = tx.Exec(queryTmpl, queryArgs...)
+		if err != nil {
+			return errors.Wrapf(err, "updating a note in %s", table)
+		}
 	}
 
-	return nil
-}
+	if data.ToBook != nil {
+		_, toBookTrashed, err := getBookUUIDWithTx(tx, *data.ToBook)
+		if err != nil {
+			return errors.Wrap(err, "getting destination book uuid")
+		}
 
-func handleAddBook(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error {
-	var data actions.AddBookDataV1
-	err := json.Unmarshal(action.Data, &data)
-	if err != nil {
-		return errors.Wrap(err, "parsing the action data")
+		// A note moved to a book in the trash goes to the trash along with the book
+		if toBookTrashed {
+			if err := TrashNote(tx, data.NoteUUID, action.Timestamp); err != nil {
+				return errors.Wrap(err, "moving the note to the trash")
+			}
+			if _, err := tx.Exec("UPDATE trash_notes SET with_book = ? WHERE uuid = ?", true, data.NoteUUID); err != nil {
+				return errors.Wrap(err, "marking the note as trashed with the book")
+			}
+		}
 	}
 
+	return nil
+}
+
+func handleAddBook(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data actions.AddBookDataV1) error {
 	log.Debug("reducing add_book. action: %+v. data: %+v\n", action, data)
 
 	var bookCount int
-	err = tx.QueryRow("SELECT count(uuid) FROM books WHERE label = ?", data.BookName).Scan(&bookCount)
+	err := tx.QueryRow(`SELECT
+		(SELECT count(uuid) FROM books WHERE label = ?) +
+		(SELECT count(uuid) FROM trash_books WHERE label = ?)`, data.BookName, data.BookName).Scan(&bookCount)
 	if err != nil {
 		return errors.Wrap(err, "counting books")
 	}
 
 	if bookCount > 0 {
 		// If book already exists, another machine added a book with the same name.
+		// If it is in the trash, the book is not added again so that the label can be
+		// restored.
 		// noop
 		return nil
 	}
@@ -194,36 +401,203 @@ func handleAddBook(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error
 	if err != nil {
 		return errors.Wrap(err, "inserting a book")
 	}
+	// The label no longer refers to a book renamed from it
+	_, err = tx.Exec("DELETE FROM book_aliases WHERE label = ?", data.BookName)
+	if err != nil {
+		return errors.Wrap(err, "removing the alias")
+	}
 
 	return nil
 }
 
-func handleRemoveBook(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action) error {
-	var data actions.RemoveBookDataV1
-	if err := json.Unmarshal(action.Data, &data); err != nil {
-		return errors.Wrap(err, "parsing the action data")
+func handleRemoveBook(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data actions.RemoveBookDataV1) error {
+	log.Debug("reducing remove_book. action: %+v. data: %+v\n", action, data)
+
+	rows, err := tx.Query(`SELECT uuid FROM books WHERE label = ?
+		UNION SELECT uuid FROM trash_books WHERE label = ?`, data.BookName, data.BookName)
+	if err != nil {
+		return errors.Wrap(err, "querying the book")
 	}
+	bookUUIDs := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "scanning a row")
+		}
+		bookUUIDs = append(bookUUIDs, uuid)
+	}
+	rows.Close()
 
-	log.Debug("reducing remove_book. action: %+v. data: %+v\n", action, data)
+	// If book does not exist, another client added and removed the book, making the add_book action
+	// obsolete. noop.
+	for _, bookUUID := range bookUUIDs {
+		_, err = tx.Exec("DELETE FROM note_tags WHERE note_uuid IN (SELECT uuid FROM notes WHERE book_uuid = ?)", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "removing tags of notes")
+		}
+		_, err = tx.Exec("DELETE FROM note_revisions WHERE note_uuid IN (SELECT uuid FROM notes WHERE book_uuid = ?)", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "removing revisions of notes")
+		}
+		_, err = tx.Exec("DELETE FROM reviews WHERE note_uuid IN (SELECT uuid FROM notes WHERE book_uuid = ?)", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "removing reviews of notes")
+		}
+
+		_, err = tx.Exec("DELETE FROM notes WHERE book_uuid = ?", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "removing notes")
+		}
+
+		if err := purgeTrashedNotes(tx, "book_uuid = ?", bookUUID); err != nil {
+			return errors.Wrap(err, "removing trashed notes")
+		}
+
+		_, err = tx.Exec("DELETE FROM books WHERE uuid = ?", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "removing a book")
+		}
+		_, err = tx.Exec("DELETE FROM trash_books WHERE uuid = ?", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "removing a trashed book")
+		}
+		_, err = tx.Exec("DELETE FROM book_aliases WHERE book_uuid = ?", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "removing the aliases of a book")
+		}
+		_, err = tx.Exec("DELETE FROM remote_books WHERE book_uuid = ?", bookUUID)
+		if err != nil {
+			return errors.Wrap(err, "unassigning a book")
+		}
+	}
+
+	return nil
+}
+
+func handleSetNoteTags(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data SetNoteTagsDataV1) error {
+	log.Debug("reducing set_note_tags. action: %+v. data: %+v\n", action, data)
+
+	var noteCount int
+	if err := tx.QueryRow("SELECT count(uuid) FROM notes WHERE uuid = ?", data.NoteUUID).Scan(&noteCount); err != nil {
+		return errors.Wrap(err, "counting note")
+	}
+
+	if noteCount == 0 {
+		// If note does not exist, another client removed the note after tagging it. noop.
+		return nil
+	}
 
-	var bookUUID string
-	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ?", data.BookName).Scan(&bookUUID)
+	tags := []string{}
+	for _, tag := range data.Tags {
+		t, err := decryptContent(ctx, tag)
+		if err != nil {
+			return errors.Wrap(err, "decrypting a tag")
+		}
+
+		tags = append(tags, t)
+	}
+
+	if err := SetNoteTags(tx, data.NoteUUID, tags); err != nil {
+		return errors.Wrap(err, "setting tags")
+	}
+
+	return nil
+}
+
+func handleRenameBook(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data RenameBookDataV1) error {
+	log.Debug("reducing rename_book. action: %+v. data: %+v\n", action, data)
+
+	// Keep the label of the trashed book up-to-date so that it is restored with the new name
+	if _, err := tx.Exec("UPDATE trash_books SET label = ? WHERE label = ?", data.NewName, data.OldName); err != nil {
+		return errors.Wrap(err, "renaming the trashed book")
+	}
+
+	var oldUUID string
+	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ?", data.OldName).Scan(&oldUUID)
 	if err == sql.ErrNoRows {
-		// If book does not exist, another client added and removed the book, making the add_book action
-		// obsolete. noop.
+		// If book does not exist, another client removed the book after renaming it. noop.
 		return nil
 	} else if err != nil {
 		return errors.Wrap(err, "querying the book")
 	}
 
-	_, err = tx.Exec("DELETE FROM notes WHERE book_uuid = ?", bookUUID)
-	if err != nil {
-		return errors.Wrap(err, "removing notes")
+	var newUUID string
+	err = tx.QueryRow("SELECT uuid FROM books WHERE label = ?", data.NewName).Scan(&newUUID)
+	if err == sql.ErrNoRows {
+		if _, err := tx.Exec("UPDATE books SET label = ? WHERE uuid = ?", data.NewName, oldUUID); err != nil {
+			return errors.Wrap(err, "renaming the book")
+		}
+		if _, err := tx.Exec("DELETE FROM book_aliases WHERE label = ?", data.NewName); err != nil {
+			return errors.Wrap(err, "removing the alias")
+		}
+		if err := setBookAlias(tx, data.OldName, oldUUID); err != nil {
+			return errors.Wrap(err, "setting the alias")
+		}
+
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "querying the destination book")
+	}
+
+	// If a book with the new name already exists, another machine added a book with
+	// the same name. Merge the books so that the notes are not lost.
+	for _, table := range []string{"notes", "trash_notes", "book_aliases"} {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET book_uuid = ? WHERE book_uuid = ?", table), newUUID, oldUUID); err != nil {
+			return errors.Wrapf(err, "moving %s", table)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM books WHERE uuid = ?", oldUUID); err != nil {
+		return errors.Wrap(err, "removing the book")
+	}
+	if _, err := tx.Exec("DELETE FROM remote_books WHERE book_uuid = ?", oldUUID); err != nil {
+		return errors.Wrap(err, "unassigning the book")
+	}
+	if err := setBookAlias(tx, data.OldName, newUUID); err != nil {
+		return errors.Wrap(err, "setting the alias")
+	}
+
+	return nil
+}
+
+func handleReviewNote(ctx infra.DnoteCtx, tx *sql.Tx, action actions.Action, data ReviewNoteDataV1) error {
+	log.Debug("reducing review_note. action: %+v. data: %+v\n", action, data)
+
+	var noteCount int
+	if err := tx.QueryRow("SELECT count(uuid) FROM notes WHERE uuid = ?", data.NoteUUID).Scan(&noteCount); err != nil {
+		return errors.Wrap(err, "counting note")
 	}
 
-	_, err = tx.Exec("DELETE FROM books WHERE uuid = ?", bookUUID)
+	if noteCount == 0 {
+		// If note does not exist, another client removed the note after reviewing it. noop.
+		return nil
+	}
+
+	current, ok, err := GetReview(tx, data.NoteUUID)
 	if err != nil {
-		return errors.Wrap(err, "removing a book")
+		return errors.Wrap(err, "getting the review")
+	}
+
+	// The most recent review wins if the note was also reviewed on this machine
+	if ok && current.ReviewedOn > data.ReviewedOn {
+		return nil
+	}
+
+	review := Review{
+		NoteUUID:    data.NoteUUID,
+		Ease:        data.Ease,
+		Interval:    data.Interval,
+		Repetitions: data.Repetitions,
+		DueOn:       data.DueOn,
+		ReviewedOn:  data.ReviewedOn,
+		CreatedOn:   data.ReviewedOn,
+	}
+	if ok {
+		review.CreatedOn = current.CreatedOn
+	}
+
+	if err := SaveReview(tx, review); err != nil {
+		return errors.Wrap(err, "saving the review")
 	}
 
 	return nil
@@ -2,6 +2,8 @@ package core
 
 import (
 	"encoding/json"
+	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/dnote/actions"
@@ -25,6 +27,7 @@ func TestReduceAddNote(t *testing.T) {
 	})
 	action := actions.Action{
 		Type:      actions.ActionAddNote,
+		Schema:    1,
 		Data:      b,
 		Timestamp: 1517629805,
 	}
@@ -58,6 +61,10 @@ func TestReduceAddNote(t *testing.T) {
 	testutils.AssertEqual(t, newNote.UUID, "06896551-8a06-4996-89cc-0d866308b0f6", "new note uuid mismatch")
 	testutils.AssertEqual(t, newNote.Content, "new content", "new note content mismatch")
 	testutils.AssertEqual(t, newNote.AddedOn, int64(1517629805), "new note added_on mismatch")
+
+	var searchCount int
+	testutils.MustScan(t, "searching the new note", db.QueryRow("SELECT count(*) FROM note_fts WHERE note_fts MATCH ?", "content"), &searchCount)
+	testutils.AssertEqual(t, searchCount, 1, "search result count mismatch")
 }
 
 func TestReduceRemoveNote(t *testing.T) {
@@ -66,6 +73,8 @@ func TestReduceRemoveNote(t *testing.T) {
 	defer testutils.TeardownEnv(ctx)
 
 	testutils.Setup2(t, ctx)
+	testutils.MustExec(t, "setting up tag", ctx.DB, "INSERT INTO tags (uuid, label) VALUES (?, ?)", "es5-tag-uuid", "es5")
+	testutils.MustExec(t, "setting up note tag", ctx.DB, "INSERT INTO note_tags (note_uuid, tag_uuid) VALUES (?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "es5-tag-uuid")
 
 	// Execute
 	b, err := json.Marshal(&actions.RemoveNoteDataV1{
@@ -74,6 +83,7 @@ func TestReduceRemoveNote(t *testing.T) {
 	})
 	action := actions.Action{
 		Type:      actions.ActionRemoveNote,
+		Schema:    1,
 		Data:      b,
 		Timestamp: 1517629805,
 	}
@@ -100,6 +110,10 @@ func TestReduceRemoveNote(t *testing.T) {
 	testutils.MustScan(t, "scanning note 1", db.QueryRow("SELECT uuid, content FROM notes WHERE uuid = ?", "43827b9a-c2b0-4c06-a290-97991c896653"), &n1.UUID, &n1.Content)
 	testutils.MustScan(t, "scanning note 2", db.QueryRow("SELECT uuid, content FROM notes WHERE uuid = ?", "3e065d55-6d47-42f2-a6bf-f5844130b2d2"), &n2.UUID, &n2.Content)
 
+	var noteTagCount int
+	testutils.MustScan(t, "counting note tags", db.QueryRow("SELECT count(*) FROM note_tags"), &noteTagCount)
+	testutils.AssertEqual(t, noteTagCount, 0, "note tag count mismatch")
+
 	testutils.AssertEqual(t, bookCount, 2, "number of books mismatch")
 	testutils.AssertEqual(t, jsNoteCount, 1, "target book notes length mismatch")
 	testutils.AssertEqual(t, linuxNoteCount, 1, "other book notes length mismatch")
@@ -120,6 +134,7 @@ func TestReduceEditNote(t *testing.T) {
 		expectedNotePublic     bool
 		expectedJsNoteCount    int
 		expectedLinuxNoteCount int
+		expectedRevisionCount  int
 	}{
 		{
 			data:                   `{"note_uuid": "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "from_book": "js", "content": "updated content"}`,
@@ -131,6 +146,7 @@ func TestReduceEditNote(t *testing.T) {
 			expectedNotePublic:     false,
 			expectedJsNoteCount:    2,
 			expectedLinuxNoteCount: 1,
+			expectedRevisionCount:  1,
 		},
 		{
 			data:                   `{"note_uuid": "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "from_book": "js", "public": true}`,
@@ -153,6 +169,7 @@ func TestReduceEditNote(t *testing.T) {
 			expectedNotePublic:     false,
 			expectedJsNoteCount:    1,
 			expectedLinuxNoteCount: 2,
+			expectedRevisionCount:  1,
 		}}
 
 	for _, tc := range testCases {
@@ -210,6 +227,16 @@ func TestReduceEditNote(t *testing.T) {
 			testutils.AssertEqual(t, n3.AddedOn, tc.expectedNoteAddedOn, "edited note added_on mismatch")
 			testutils.AssertEqual(t, n3.EditedOn, tc.expectedNoteEditedOn, "edited note edited_on mismatch")
 			testutils.AssertEqual(t, n3.Public, tc.expectedNotePublic, "edited note public mismatch")
+
+			revs, err := GetNoteRevisions(db, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting revisions"))
+			}
+			testutils.AssertEqual(t, len(revs), tc.expectedRevisionCount, "revision count mismatch")
+			if tc.expectedRevisionCount > 0 {
+				testutils.AssertEqual(t, revs[0].Content, "Date object implements mathematical comparisons", "revision content mismatch")
+				testutils.AssertEqual(t, revs[0].CreatedOn, int64(1515199951), "revision created_on mismatch")
+			}
 		}()
 	}
 }
@@ -225,6 +252,7 @@ func TestReduceAddBook(t *testing.T) {
 	b, err := json.Marshal(&actions.AddBookDataV1{BookName: "new_book"})
 	action := actions.Action{
 		Type:      actions.ActionAddBook,
+		Schema:    1,
 		Data:      b,
 		Timestamp: 1517629805,
 	}
@@ -259,6 +287,7 @@ func TestReduceRemoveBook(t *testing.T) {
 	b, err := json.Marshal(&actions.RemoveBookDataV1{BookName: "linux"})
 	action := actions.Action{
 		Type:      actions.ActionRemoveBook,
+		Schema:    1,
 		Data:      b,
 		Timestamp: 1517629805,
 	}
@@ -298,3 +327,861 @@ func TestReduceRemoveBook(t *testing.T) {
 	testutils.AssertEqual(t, n2.UUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "edited note uuid mismatch")
 	testutils.AssertEqual(t, n2.Content, "Date object implements mathematical comparisons", "edited note content mismatch")
 }
+
+func TestReduceSetNoteTags(t *testing.T) {
+	testCases := []struct {
+		data         string
+		expectedTags []string
+	}{
+		{
+			data:         `{"note_uuid": "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "tags": ["es6", "date"]}`,
+			expectedTags: []string{"date", "es6"},
+		},
+		{
+			data:         `{"note_uuid": "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "tags": []}`,
+			expectedTags: []string{},
+		},
+		{
+			data:         `{"note_uuid": "nonexistent-note-uuid", "tags": ["es6"]}`,
+			expectedTags: []string{"es5"},
+		},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			db := ctx.DB
+			testutils.MustExec(t, "setting up tag", db, "INSERT INTO tags (uuid, label) VALUES (?, ?)", "es5-tag-uuid", "es5")
+			testutils.MustExec(t, "setting up note tag", db, "INSERT INTO note_tags (note_uuid, tag_uuid) VALUES (?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "es5-tag-uuid")
+
+			// Execute
+			action := actions.Action{
+				Type:      ActionSetNoteTags,
+				Data:      json.RawMessage(tc.data),
+				Schema:    1,
+				Timestamp: 1517629805,
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				panic(errors.Wrap(err, "beginning a transaction"))
+			}
+			if err = Reduce(ctx, tx, action); err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "processing action"))
+			}
+			tx.Commit()
+
+			// Test
+			tags, err := GetNoteTags(db, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting tags"))
+			}
+			testutils.AssertDeepEqual(t, tags, tc.expectedTags, "note tags mismatch")
+
+			var noteTagCount int
+			testutils.MustScan(t, "counting note tags", db.QueryRow("SELECT count(*) FROM note_tags"), &noteTagCount)
+			testutils.AssertEqual(t, noteTagCount, len(tc.expectedTags), "note tag count mismatch")
+		}()
+	}
+}
+
+func TestReduceAddNote_TrashedBook(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup1(t, ctx)
+
+	db := ctx.DB
+	testutils.MustExec(t, "trashing the book", db, "INSERT INTO trash_books (uuid, label, trashed_on) SELECT uuid, label, ? FROM books WHERE label = ?", 1517629800, "js")
+	testutils.MustExec(t, "removing the book", db, "DELETE FROM books WHERE label = ?", "js")
+
+	// Execute
+	b, err := json.Marshal(&actions.AddNoteDataV1{
+		Content:  "new content",
+		BookName: "js",
+		NoteUUID: "06896551-8a06-4996-89cc-0d866308b0f6",
+	})
+	action := actions.Action{
+		Type:      actions.ActionAddNote,
+		Schema:    1,
+		Data:      b,
+		Timestamp: 1517629805,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err = Reduce(ctx, tx, action); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "processing action"))
+	}
+	tx.Commit()
+
+	// Test
+	var noteCount, trashNoteCount int
+	testutils.MustScan(t, "counting note", db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", "06896551-8a06-4996-89cc-0d866308b0f6"), &noteCount)
+	testutils.MustScan(t, "counting trashed note", db.QueryRow("SELECT count(*) FROM trash_notes WHERE uuid = ? AND book_uuid = ? AND with_book = ?", "06896551-8a06-4996-89cc-0d866308b0f6", "js-book-uuid", true), &trashNoteCount)
+
+	testutils.AssertEqual(t, noteCount, 0, "note count mismatch")
+	testutils.AssertEqual(t, trashNoteCount, 1, "trashed note count mismatch")
+}
+
+func TestReduceEditNote_TrashedNote(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	db := ctx.DB
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := TrashNote(tx, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", 1517629800); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the note"))
+	}
+	tx.Commit()
+
+	// Execute
+	content := "updated content"
+	b, err := json.Marshal(&actions.EditNoteDataV2{
+		NoteUUID: "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+		FromBook: "js",
+		Content:  &content,
+	})
+	action := actions.Action{
+		Type:      actions.ActionEditNote,
+		Data:      b,
+		Schema:    2,
+		Timestamp: 1517629805,
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err = Reduce(ctx, tx, action); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "processing action"))
+	}
+	tx.Commit()
+
+	// Test
+	var trashed infra.Note
+	testutils.MustScan(t, "scanning the trashed note", db.QueryRow("SELECT content, edited_on FROM trash_notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &trashed.Content, &trashed.EditedOn)
+
+	testutils.AssertEqual(t, trashed.Content, "updated content", "trashed note content mismatch")
+	testutils.AssertEqual(t, trashed.EditedOn, int64(1517629805), "trashed note edited_on mismatch")
+}
+
+func TestReduceRemoveBook_Trashed(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	db := ctx.DB
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := TrashBook(tx, "linux-book-uuid", 1517629800); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the book"))
+	}
+	tx.Commit()
+
+	// Execute
+	b, err := json.Marshal(&actions.RemoveBookDataV1{BookName: "linux"})
+	action := actions.Action{
+		Type:      actions.ActionRemoveBook,
+		Schema:    1,
+		Data:      b,
+		Timestamp: 1517629805,
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err = Reduce(ctx, tx, action); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "processing action"))
+	}
+	tx.Commit()
+
+	// Test
+	var bookCount, trashBookCount, trashNoteCount int
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "counting trashed books", db.QueryRow("SELECT count(*) FROM trash_books"), &trashBookCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+
+	testutils.AssertEqual(t, bookCount, 1, "book count mismatch")
+	testutils.AssertEqual(t, trashBookCount, 0, "trashed book count mismatch")
+	testutils.AssertEqual(t, trashNoteCount, 0, "trashed note count mismatch")
+}
+
+func TestReduceRenameBook(t *testing.T) {
+	testCases := []struct {
+		oldName               string
+		newName               string
+		existingBook          bool
+		expectedBookCount     int
+		expectedJSLabel       string
+		expectedJSNoteCount   int
+		expectedDestNoteCount int
+	}{
+		{
+			oldName:               "js",
+			newName:               "javascript",
+			expectedBookCount:     2,
+			expectedJSLabel:       "javascript",
+			expectedJSNoteCount:   2,
+			expectedDestNoteCount: 2,
+		},
+		{
+			oldName:               "js",
+			newName:               "javascript",
+			existingBook:          true,
+			expectedBookCount:     1,
+			expectedJSLabel:       "",
+			expectedJSNoteCount:   0,
+			expectedDestNoteCount: 2,
+		},
+		{
+			oldName:               "nonexistent",
+			newName:               "javascript",
+			expectedBookCount:     2,
+			expectedJSLabel:       "js",
+			expectedJSNoteCount:   2,
+			expectedDestNoteCount: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			db := ctx.DB
+			testutils.MustExec(t, "removing linux book", db, "DELETE FROM books WHERE uuid = ?", "linux-book-uuid")
+			if tc.existingBook {
+				testutils.MustExec(t, "setting up book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "javascript-book-uuid", "javascript")
+			} else {
+				testutils.MustExec(t, "setting up book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "linux-book-uuid", "linux")
+			}
+
+			// Execute
+			b, err := json.Marshal(&RenameBookDataV1{OldName: tc.oldName, NewName: tc.newName})
+			action := actions.Action{
+				Type:      ActionRenameBook,
+				Data:      b,
+				Schema:    1,
+				Timestamp: 1517629805,
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				panic(errors.Wrap(err, "beginning a transaction"))
+			}
+			if err = Reduce(ctx, tx, action); err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "processing action"))
+			}
+			tx.Commit()
+
+			// Test
+			var bookCount, jsNoteCount, destNoteCount int
+			var jsLabel string
+			testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+			testutils.MustScan(t, "counting js notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &jsNoteCount)
+			testutils.MustScan(t, "counting destination notes", db.QueryRow("SELECT count(*) FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ?", tc.newName), &destNoteCount)
+			testutils.MustScan(t, "scanning js book", db.QueryRow("SELECT coalesce((SELECT label FROM books WHERE uuid = ?), '')", "js-book-uuid"), &jsLabel)
+
+			testutils.AssertEqual(t, bookCount, tc.expectedBookCount, "book count mismatch")
+			testutils.AssertEqual(t, jsNoteCount, tc.expectedJSNoteCount, "js note count mismatch")
+			testutils.AssertEqual(t, destNoteCount, tc.expectedDestNoteCount, "destination note count mismatch")
+			testutils.AssertEqual(t, jsLabel, tc.expectedJSLabel, "js book label mismatch")
+		}()
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+
+	return b
+}
+
+func TestReduceRenameBook_OldLabel(t *testing.T) {
+	testCases := []struct {
+		existingBook bool
+	}{
+		{
+			existingBook: false,
+		},
+		{
+			existingBook: true,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			db := ctx.DB
+			if tc.existingBook {
+				testutils.MustExec(t, "setting up book", db, "INSERT INTO books (uuid, label) VALUES (?, ?)", "javascript-book-uuid", "javascript")
+			}
+			testutils.MustExec(t, "setting up trashed note", db, `INSERT INTO trash_notes (note_id, uuid, book_uuid, content, added_on, edited_on, public, trashed_on, with_book)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, 3, "trashed-note-uuid", "js-book-uuid", "trashed", 1515199951, 0, false, 1515199960, false)
+
+			content := "edited"
+			// Another machine adds and edits notes in the book before receiving the rename
+			actionSlice := []actions.Action{
+				{Type: ActionRenameBook, Schema: 1, Data: mustMarshal(t, RenameBookDataV1{OldName: "js", NewName: "javascript"}), Timestamp: 1517629805},
+				{Type: actions.ActionAddNote, Schema: 2, Data: mustMarshal(t, actions.AddNoteDataV2{NoteUUID: "new-note-uuid", BookName: "js", Content: "new"}), Timestamp: 1517629807},
+				{Type: actions.ActionEditNote, Schema: 2, Data: mustMarshal(t, actions.EditNoteDataV2{NoteUUID: "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", FromBook: "js", Content: &content}), Timestamp: 1517629808},
+			}
+
+			// Execute
+			tx, err := db.Begin()
+			if err != nil {
+				panic(errors.Wrap(err, "beginning a transaction"))
+			}
+			if err := ReduceAll(ctx, tx, actionSlice); err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "reducing actions"))
+			}
+			tx.Commit()
+
+			// Test
+			var bookUUID string
+			testutils.MustScan(t, "getting the book", db.QueryRow("SELECT uuid FROM books WHERE label = ?", "javascript"), &bookUUID)
+
+			var jsCount, noteCount, trashedNoteCount int
+			var editedContent string
+			testutils.MustScan(t, "counting js books", db.QueryRow("SELECT count(*) FROM books WHERE label = ?", "js"), &jsCount)
+			testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", bookUUID), &noteCount)
+			testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes WHERE book_uuid = ?", bookUUID), &trashedNoteCount)
+			testutils.MustScan(t, "getting the edited note", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &editedContent)
+
+			testutils.AssertEqual(t, jsCount, 0, "js book count mismatch")
+			testutils.AssertEqual(t, noteCount, 3, "note count mismatch")
+			testutils.AssertEqual(t, trashedNoteCount, 1, "trashed note count mismatch")
+			testutils.AssertEqual(t, editedContent, "edited", "edited content mismatch")
+		})
+	}
+}
+
+func TestReduceReviewNote(t *testing.T) {
+	testCases := []struct {
+		noteUUID            string
+		existingReviewedOn  int64
+		reviewedOn          int64
+		expectedReviewCount int
+		expectedInterval    int
+	}{
+		{
+			noteUUID:            "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+			reviewedOn:          1517629805,
+			expectedReviewCount: 1,
+			expectedInterval:    6,
+		},
+		{
+			noteUUID:            "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+			existingReviewedOn:  1517629800,
+			reviewedOn:          1517629805,
+			expectedReviewCount: 1,
+			expectedInterval:    6,
+		},
+		{
+			noteUUID:            "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+			existingReviewedOn:  1517629810,
+			reviewedOn:          1517629805,
+			expectedReviewCount: 1,
+			expectedInterval:    1,
+		},
+		{
+			noteUUID:            "nonexistent-note-uuid",
+			reviewedOn:          1517629805,
+			expectedReviewCount: 0,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			db := ctx.DB
+			if tc.existingReviewedOn != 0 {
+				testutils.MustExec(t, "setting up review", db, `INSERT INTO reviews (note_uuid, ease, interval, repetitions, due_on, reviewed_on, created_on)
+					VALUES (?, ?, ?, ?, ?, ?, ?)`, tc.noteUUID, 2.5, 1, 1, tc.existingReviewedOn+86400, tc.existingReviewedOn, tc.existingReviewedOn)
+			}
+
+			// Execute
+			b, err := json.Marshal(&ReviewNoteDataV1{
+				NoteUUID:    tc.noteUUID,
+				Ease:        2.6,
+				Interval:    6,
+				Repetitions: 2,
+				DueOn:       tc.reviewedOn + 6*86400,
+				ReviewedOn:  tc.reviewedOn,
+			})
+			action := actions.Action{
+				Type:      ActionReviewNote,
+				Data:      b,
+				Schema:    1,
+				Timestamp: tc.reviewedOn,
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				panic(errors.Wrap(err, "beginning a transaction"))
+			}
+			if err = Reduce(ctx, tx, action); err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "processing action"))
+			}
+			tx.Commit()
+
+			// Test
+			var reviewCount int
+			testutils.MustScan(t, "counting reviews", db.QueryRow("SELECT count(*) FROM reviews"), &reviewCount)
+			testutils.AssertEqual(t, reviewCount, tc.expectedReviewCount, "review count mismatch")
+
+			if tc.expectedReviewCount > 0 {
+				var interval int
+				testutils.MustScan(t, "scanning the review", db.QueryRow("SELECT interval FROM reviews WHERE note_uuid = ?", tc.noteUUID), &interval)
+				testutils.AssertEqual(t, interval, tc.expectedInterval, "interval mismatch")
+			}
+		})
+	}
+}
+
+func TestDecodeAction(t *testing.T) {
+	content := "new content"
+	toBook := "linux"
+	public := true
+
+	testCases := []struct {
+		actionType string
+		schema     int
+		data       string
+		expected   interface{}
+		expectedOK bool
+	}{
+		{
+			actionType: actions.ActionAddNote,
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid", "book_name": "js", "content": "new content"}`,
+			expected:   actions.AddNoteDataV2{NoteUUID: "note-uuid", BookName: "js", Content: "new content", Public: false},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionAddNote,
+			schema:     2,
+			data:       `{"note_uuid": "note-uuid", "book_name": "js", "content": "new content", "public": true}`,
+			expected:   actions.AddNoteDataV2{NoteUUID: "note-uuid", BookName: "js", Content: "new content", Public: true},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionRemoveNote,
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid", "book_name": "js"}`,
+			expected:   actions.RemoveNoteDataV1{NoteUUID: "note-uuid", BookName: "js"},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionEditNote,
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid", "from_book": "js", "to_book": "linux", "content": "new content"}`,
+			expected:   actions.EditNoteDataV2{NoteUUID: "note-uuid", FromBook: "js", ToBook: &toBook, Content: &content},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionEditNote,
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid", "from_book": "js", "to_book": "js", "content": "new content"}`,
+			expected:   actions.EditNoteDataV2{NoteUUID: "note-uuid", FromBook: "js", Content: &content},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionEditNote,
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid", "from_book": "js", "to_book": "linux", "content": ""}`,
+			expected:   actions.EditNoteDataV2{NoteUUID: "note-uuid", FromBook: "js", ToBook: &toBook},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionEditNote,
+			schema:     2,
+			data:       `{"note_uuid": "note-uuid", "from_book": "js", "public": true}`,
+			expected:   actions.EditNoteDataV2{NoteUUID: "note-uuid", FromBook: "js", Public: &public},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionAddBook,
+			schema:     1,
+			data:       `{"book_name": "js"}`,
+			expected:   actions.AddBookDataV1{BookName: "js"},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionRemoveBook,
+			schema:     1,
+			data:       `{"book_name": "js"}`,
+			expected:   actions.RemoveBookDataV1{BookName: "js"},
+			expectedOK: true,
+		},
+		{
+			actionType: ActionSetNoteTags,
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid", "tags": ["a", "b"]}`,
+			expected:   SetNoteTagsDataV1{NoteUUID: "note-uuid", Tags: []string{"a", "b"}},
+			expectedOK: true,
+		},
+		{
+			actionType: ActionRenameBook,
+			schema:     1,
+			data:       `{"old_name": "js", "new_name": "javascript"}`,
+			expected:   RenameBookDataV1{OldName: "js", NewName: "javascript"},
+			expectedOK: true,
+		},
+		{
+			actionType: ActionReviewNote,
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid", "ease": 2.6, "interval": 6, "repetitions": 2, "due_on": 1518148205, "reviewed_on": 1517629805}`,
+			expected:   ReviewNoteDataV1{NoteUUID: "note-uuid", Ease: 2.6, Interval: 6, Repetitions: 2, DueOn: 1518148205, ReviewedOn: 1517629805},
+			expectedOK: true,
+		},
+		{
+			actionType: actions.ActionAddNote,
+			schema:     3,
+			data:       `{"note_uuid": "note-uuid"}`,
+			expectedOK: false,
+		},
+		{
+			actionType: actions.ActionAddNote,
+			schema:     0,
+			data:       `{"note_uuid": "note-uuid"}`,
+			expectedOK: false,
+		},
+		{
+			actionType: ActionRenameBook,
+			schema:     2,
+			data:       `{"old_name": "js"}`,
+			expectedOK: false,
+		},
+		{
+			actionType: "archive_note",
+			schema:     1,
+			data:       `{"note_uuid": "note-uuid"}`,
+			expectedOK: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s v%d", tc.actionType, tc.schema), func(t *testing.T) {
+			action := actions.Action{
+				Type:   tc.actionType,
+				Schema: tc.schema,
+				Data:   json.RawMessage(tc.data),
+			}
+
+			got, ok, err := decodeAction(action)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "decoding the action"))
+			}
+
+			testutils.AssertEqual(t, ok, tc.expectedOK, "ok mismatch")
+			testutils.AssertDeepEqual(t, got, tc.expected, "data mismatch")
+		})
+	}
+}
+
+func TestDecodeAction_Registry(t *testing.T) {
+	// Every supported schema must be decoded and upcast to the latest schema
+	for key := range decoders {
+		t.Run(fmt.Sprintf("%s v%d", key.actionType, key.schema), func(t *testing.T) {
+			action := actions.Action{Type: key.actionType, Schema: key.schema, Data: json.RawMessage("{}")}
+
+			got, ok, err := decodeAction(action)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "decoding the action"))
+			}
+			testutils.AssertEqual(t, ok, true, "ok mismatch")
+
+			latest, _, err := decodeAction(actions.Action{Type: key.actionType, Schema: reducers[key.actionType].schema, Data: json.RawMessage("{}")})
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "decoding the latest schema"))
+			}
+			testutils.AssertEqual(t, reflect.TypeOf(got), reflect.TypeOf(latest), "upcast type mismatch")
+		})
+	}
+
+	for actionType := range reducers {
+		if _, ok := decoders[actionKey{actionType, reducers[actionType].schema}]; !ok {
+			t.Errorf("no decoder for the latest schema of %s", actionType)
+		}
+	}
+}
+
+func TestReduce_Quarantine(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	db := ctx.DB
+
+	actionSlice := []actions.Action{
+		{
+			UUID:      "unknown-type-uuid",
+			Type:      "archive_note",
+			Schema:    1,
+			Data:      json.RawMessage(`{"note_uuid": "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"}`),
+			Timestamp: 1517629805,
+		},
+		{
+			UUID:      "newer-schema-uuid",
+			Type:      actions.ActionAddBook,
+			Schema:    2,
+			Data:      json.RawMessage(`{"book_name": "go", "color": "blue"}`),
+			Timestamp: 1517629806,
+		},
+		{
+			UUID:      "add-book-uuid",
+			Type:      actions.ActionAddBook,
+			Schema:    1,
+			Data:      json.RawMessage(`{"book_name": "css"}`),
+			Timestamp: 1517629807,
+		},
+	}
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := ReduceAll(ctx, tx, actionSlice); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "reducing actions"))
+	}
+	tx.Commit()
+
+	// Test
+	var bookCount, quarantineCount int
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "counting quarantined actions", db.QueryRow("SELECT count(*) FROM quarantined_actions"), &quarantineCount)
+	testutils.AssertEqual(t, bookCount, 3, "book count mismatch")
+	testutils.AssertEqual(t, quarantineCount, 2, "quarantined action count mismatch")
+
+	var uuid, actionType, data string
+	var schema int
+	var ts int64
+	testutils.MustScan(t, "scanning the quarantined action", db.QueryRow("SELECT uuid, schema, type, data, timestamp FROM quarantined_actions WHERE uuid = ?", "newer-schema-uuid"), &uuid, &schema, &actionType, &data, &ts)
+	testutils.AssertEqual(t, schema, 2, "schema mismatch")
+	testutils.AssertEqual(t, actionType, actions.ActionAddBook, "type mismatch")
+	testutils.AssertEqual(t, data, `{"book_name": "go", "color": "blue"}`, "data mismatch")
+	testutils.AssertEqual(t, ts, int64(1517629806), "timestamp mismatch")
+}
+
+func TestReduceQuarantined(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	db := ctx.DB
+	testutils.MustExec(t, "quarantining a supported action", db, `INSERT INTO quarantined_actions (uuid, schema, type, data, timestamp, quarantined_on)
+		VALUES (?, ?, ?, ?, ?, ?)`, "add-book-uuid", 1, actions.ActionAddBook, `{"book_name": "css"}`, 1517629805, 1517629810)
+	testutils.MustExec(t, "quarantining an unsupported action", db, `INSERT INTO quarantined_actions (uuid, schema, type, data, timestamp, quarantined_on)
+		VALUES (?, ?, ?, ?, ?, ?)`, "unknown-type-uuid", 1, "archive_note", `{}`, 1517629806, 1517629810)
+	testutils.MustExec(t, "quarantining an unreducible action", db, `INSERT INTO quarantined_actions (uuid, schema, type, data, timestamp, quarantined_on)
+		VALUES (?, ?, ?, ?, ?, ?)`, "orphan-note-uuid", 1, actions.ActionAddNote, `{"note_uuid": "note-uuid", "book_name": "nonexistent", "content": "foo"}`, 1517629807, 1517629810)
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	count, err := ReduceQuarantined(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "reducing quarantined actions"))
+	}
+	tx.Commit()
+
+	// Test
+	var bookCount int
+	var remaining string
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books WHERE label = ?", "css"), &bookCount)
+	testutils.MustScan(t, "scanning the remaining action", db.QueryRow("SELECT group_concat(uuid) FROM quarantined_actions"), &remaining)
+	testutils.AssertEqual(t, count, 1, "reduced count mismatch")
+	testutils.AssertEqual(t, bookCount, 1, "book count mismatch")
+	testutils.AssertEqual(t, remaining, "unknown-type-uuid,orphan-note-uuid", "remaining actions mismatch")
+}
+
+func TestReduceOrQuarantine(t *testing.T) {
+	testCases := []struct {
+		name                string
+		action              actions.Action
+		expectedReduced     bool
+		expectedNotes       int
+		expectedQuarantined int
+	}{
+		{
+			name: "reducible",
+			action: actions.Action{
+				UUID:      "action-uuid",
+				Schema:    1,
+				Type:      actions.ActionAddNote,
+				Data:      json.RawMessage(`{"note_uuid": "06896551-8a06-4996-89cc-0d866308b0f6", "book_name": "js", "content": "foo"}`),
+				Timestamp: 1517629805,
+			},
+			expectedReduced:     true,
+			expectedNotes:       4,
+			expectedQuarantined: 0,
+		},
+		{
+			name: "missing book",
+			action: actions.Action{
+				UUID:      "action-uuid",
+				Schema:    1,
+				Type:      actions.ActionAddNote,
+				Data:      json.RawMessage(`{"note_uuid": "06896551-8a06-4996-89cc-0d866308b0f6", "book_name": "nonexistent", "content": "foo"}`),
+				Timestamp: 1517629805,
+			},
+			expectedReduced:     false,
+			expectedNotes:       3,
+			expectedQuarantined: 1,
+		},
+		{
+			name: "malformed",
+			action: actions.Action{
+				UUID:      "action-uuid",
+				Schema:    1,
+				Type:      actions.ActionAddNote,
+				Data:      json.RawMessage(`{"note_uuid": 1}`),
+				Timestamp: 1517629805,
+			},
+			expectedReduced:     false,
+			expectedNotes:       3,
+			expectedQuarantined: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			db := ctx.DB
+
+			// Execute
+			tx, err := db.Begin()
+			if err != nil {
+				panic(errors.Wrap(err, "beginning a transaction"))
+			}
+			reduced, err := ReduceOrQuarantine(ctx, tx, tc.action)
+			if err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "reducing"))
+			}
+			tx.Commit()
+
+			// Test
+			var noteCount, quarantineCount int
+			testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+			testutils.MustScan(t, "counting quarantined actions", db.QueryRow("SELECT count(*) FROM quarantined_actions"), &quarantineCount)
+			testutils.AssertEqual(t, reduced, tc.expectedReduced, "reduced mismatch")
+			testutils.AssertEqual(t, noteCount, tc.expectedNotes, "note count mismatch")
+			testutils.AssertEqual(t, quarantineCount, tc.expectedQuarantined, "quarantined action count mismatch")
+		})
+	}
+}
+
+func TestReduceAddNote_Schemas(t *testing.T) {
+	testCases := []struct {
+		schema         int
+		data           string
+		expectedPublic bool
+	}{
+		{
+			schema:         1,
+			data:           `{"note_uuid": "06896551-8a06-4996-89cc-0d866308b0f6", "book_name": "js", "content": "new content"}`,
+			expectedPublic: false,
+		},
+		{
+			schema:         2,
+			data:           `{"note_uuid": "06896551-8a06-4996-89cc-0d866308b0f6", "book_name": "js", "content": "new content", "public": false}`,
+			expectedPublic: false,
+		},
+		{
+			schema:         2,
+			data:           `{"note_uuid": "06896551-8a06-4996-89cc-0d866308b0f6", "book_name": "js", "content": "new content", "public": true}`,
+			expectedPublic: true,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup1(t, ctx)
+			db := ctx.DB
+
+			// Execute
+			action := actions.Action{
+				Type:      actions.ActionAddNote,
+				Schema:    tc.schema,
+				Data:      json.RawMessage(tc.data),
+				Timestamp: 1517629805,
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				panic(errors.Wrap(err, "beginning a transaction"))
+			}
+			if err = Reduce(ctx, tx, action); err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "processing action"))
+			}
+			tx.Commit()
+
+			// Test
+			var note infra.Note
+			testutils.MustScan(t, "scanning the new note", db.QueryRow("SELECT content, added_on, edited_on, public FROM notes WHERE uuid = ?", "06896551-8a06-4996-89cc-0d866308b0f6"), &note.Content, &note.AddedOn, &note.EditedOn, &note.Public)
+
+			testutils.AssertEqual(t, note.Content, "new content", "content mismatch")
+			testutils.AssertEqual(t, note.AddedOn, int64(1517629805), "added_on mismatch")
+			testutils.AssertEqual(t, note.EditedOn, int64(0), "edited_on mismatch")
+			testutils.AssertEqual(t, note.Public, tc.expectedPublic, "public mismatch")
+		})
+	}
+}
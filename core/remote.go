@@ -0,0 +1,564 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// DefaultRemote is the name of the remote configured in the config file
+const DefaultRemote = "default"
+
+// Remote is a server to sync with. A machine can sync with several remotes,
+// each of which has its own API key and bookmark.
+type Remote struct {
+	Name     string
+	Endpoint string
+	APIKey   string
+	Bookmark int
+}
+
+// remoteKey returns the key in the system table holding the field of the remote
+func remoteKey(name, field string) string {
+	if name == DefaultRemote && field == "bookmark" {
+		return "bookmark"
+	}
+
+	return fmt.Sprintf("remote.%s.%s", name, field)
+}
+
+func getSystemValue(db *sql.DB, key string) (string, bool, error) {
+	var ret string
+	err := db.QueryRow("SELECT value FROM system WHERE key = ?", key).Scan(&ret)
+	if err == sql.ErrNoRows {
+		return ret, false, nil
+	} else if err != nil {
+		return ret, false, errors.Wrapf(err, "querying %s", key)
+	}
+
+	return ret, true, nil
+}
+
+func setSystemValue(tx *sql.Tx, key, value string) error {
+	res, err := tx.Exec("UPDATE system SET value = ? WHERE key = ?", value, key)
+	if err != nil {
+		return errors.Wrapf(err, "updating %s", key)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting updated rows")
+	}
+	if n > 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec("INSERT INTO system (key, value) VALUES (?, ?)", key, value); err != nil {
+		return errors.Wrapf(err, "inserting %s", key)
+	}
+
+	return nil
+}
+
+// getDefaultEndpoint returns the endpoint of the default remote. The
+// DNOTE_API_ENDPOINT environment variable takes precedence over the config,
+// which takes precedence over the endpoint the binary was built with.
+func getDefaultEndpoint(ctx infra.DnoteCtx, config infra.Config) string {
+	if endpoint := os.Getenv("DNOTE_API_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if config.Endpoint != "" {
+		return config.Endpoint
+	}
+
+	return ctx.APIEndpoint
+}
+
+// GetCurrentRemoteName returns the name of the remote to sync with by default
+func GetCurrentRemoteName(db *sql.DB) (string, error) {
+	name, ok, err := getSystemValue(db, "remote")
+	if err != nil {
+		return "", errors.Wrap(err, "getting the current remote")
+	}
+	if !ok {
+		return DefaultRemote, nil
+	}
+
+	return name, nil
+}
+
+// isEndpoint returns true if the name of a remote is an endpoint
+func isEndpoint(name string) bool {
+	for _, prefix := range []string{"http://", "https://", "git+", "file://"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return filepath.IsAbs(name)
+}
+
+// GetRemote returns the remote with the given name. If the name is empty, the
+// current remote is returned. If the name is an endpoint, the current remote is
+// returned with the endpoint overridden.
+func GetRemote(ctx infra.DnoteCtx, name string) (Remote, error) {
+	db := ctx.DB
+
+	var endpoint string
+	if isEndpoint(name) {
+		endpoint, name = name, ""
+	}
+
+	if name == "" {
+		var err error
+		if name, err = GetCurrentRemoteName(db); err != nil {
+			return Remote{}, errors.Wrap(err, "getting the current remote name")
+		}
+	}
+
+	ret := Remote{Name: name}
+
+	if name == DefaultRemote {
+		config, err := ReadConfig(ctx)
+		if err != nil {
+			return ret, errors.Wrap(err, "reading the config")
+		}
+
+		ret.Endpoint = getDefaultEndpoint(ctx, config)
+		ret.APIKey = config.APIKey
+	} else {
+		endpoint, ok, err := getSystemValue(db, remoteKey(name, "endpoint"))
+		if err != nil {
+			return ret, errors.Wrap(err, "getting the endpoint")
+		}
+		if !ok {
+			return ret, errors.Errorf("remote '%s' not found", name)
+		}
+		apiKey, _, err := getSystemValue(db, remoteKey(name, "api_key"))
+		if err != nil {
+			return ret, errors.Wrap(err, "getting the API key")
+		}
+
+		ret.Endpoint = endpoint
+		ret.APIKey = apiKey
+	}
+
+	bookmark, ok, err := getSystemValue(db, remoteKey(name, "bookmark"))
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the bookmark")
+	}
+	if ok {
+		if ret.Bookmark, err = strconv.Atoi(bookmark); err != nil {
+			return ret, errors.Wrap(err, "parsing the bookmark")
+		}
+	}
+
+	if endpoint != "" {
+		ret.Endpoint = endpoint
+	}
+
+	return ret, nil
+}
+
+// queryer is either a database or a transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// getRemoteNames returns the name of the default remote followed by the names
+// of the added remotes
+func getRemoteNames(q queryer) ([]string, error) {
+	ret := []string{DefaultRemote}
+
+	rows, err := q.Query("SELECT key FROM system WHERE key LIKE 'remote.%.endpoint' ORDER BY key ASC")
+	if err != nil {
+		return ret, errors.Wrap(err, "querying remotes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, key[len("remote."):len(key)-len(".endpoint")])
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// GetRemotes returns the default remote followed by the added remotes
+func GetRemotes(ctx infra.DnoteCtx) ([]Remote, error) {
+	names, err := getRemoteNames(ctx.DB)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the remote names")
+	}
+
+	ret := []Remote{}
+	for _, name := range names {
+		remote, err := GetRemote(ctx, name)
+		if err != nil {
+			return ret, errors.Wrapf(err, "getting remote '%s'", name)
+		}
+
+		ret = append(ret, remote)
+	}
+
+	return ret, nil
+}
+
+// AddRemote adds a remote with the given name. The remote receives the actions
+// only for the books assigned to it by AssignBook.
+func AddRemote(tx *sql.Tx, name, endpoint, apiKey string) error {
+	if name == DefaultRemote {
+		return errors.Errorf("'%s' is reserved for the remote in the config", DefaultRemote)
+	}
+	if isEndpoint(name) {
+		return errors.New("the name of a remote cannot be an endpoint")
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT count(*) FROM system WHERE key = ?", remoteKey(name, "endpoint")).Scan(&count); err != nil {
+		return errors.Wrap(err, "counting remotes")
+	}
+	if count > 0 {
+		return errors.Errorf("remote '%s' already exists", name)
+	}
+
+	if err := setSystemValue(tx, remoteKey(name, "endpoint"), endpoint); err != nil {
+		return errors.Wrap(err, "saving the endpoint")
+	}
+	if err := setSystemValue(tx, remoteKey(name, "api_key"), apiKey); err != nil {
+		return errors.Wrap(err, "saving the API key")
+	}
+	if err := setSystemValue(tx, remoteKey(name, "bookmark"), "0"); err != nil {
+		return errors.Wrap(err, "saving the bookmark")
+	}
+
+	return nil
+}
+
+// RemoveRemote removes the remote with the given name. If it is the current
+// remote, the default remote becomes current. The books assigned to the remote
+// are synced with the default remote from then on, which receives the actions
+// recreating them.
+func RemoveRemote(tx *sql.Tx, name string) error {
+	if name == DefaultRemote {
+		return errors.Errorf("cannot remove the '%s' remote", DefaultRemote)
+	}
+
+	res, err := tx.Exec("DELETE FROM system WHERE key IN (?, ?, ?)", remoteKey(name, "endpoint"), remoteKey(name, "api_key"), remoteKey(name, "bookmark"))
+	if err != nil {
+		return errors.Wrap(err, "deleting the remote")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "counting deleted rows")
+	}
+	if n == 0 {
+		return errors.Errorf("remote '%s' not found", name)
+	}
+
+	if _, err := tx.Exec("DELETE FROM system WHERE key = ? AND value = ?", "remote", name); err != nil {
+		return errors.Wrap(err, "resetting the current remote")
+	}
+	if _, err := tx.Exec("DELETE FROM sync_journal WHERE remote = ?", name); err != nil {
+		return errors.Wrap(err, "clearing the journal")
+	}
+	if _, err := tx.Exec("DELETE FROM pending_actions WHERE remote = ?", name); err != nil {
+		return errors.Wrap(err, "clearing the pending actions")
+	}
+	if _, err := tx.Exec("DELETE FROM actions WHERE uuid NOT IN (SELECT action_uuid FROM pending_actions)"); err != nil {
+		return errors.Wrap(err, "deleting the actions no remote is to receive")
+	}
+
+	books, err := getRemoteBooks(tx, name)
+	if err != nil {
+		return errors.Wrap(err, "getting the books of the remote")
+	}
+	if _, err := tx.Exec("DELETE FROM remote_books WHERE remote = ?", name); err != nil {
+		return errors.Wrap(err, "unassigning the books")
+	}
+	for _, b := range books {
+		if err := logBookSnapshot(tx, b.uuid, b.label); err != nil {
+			return errors.Wrapf(err, "logging the notes of the book '%s'", b.label)
+		}
+	}
+
+	return nil
+}
+
+// UseRemote makes the remote with the given name the one to sync with by default
+func UseRemote(tx *sql.Tx, name string) error {
+	if name != DefaultRemote {
+		var count int
+		if err := tx.QueryRow("SELECT count(*) FROM system WHERE key = ?", remoteKey(name, "endpoint")).Scan(&count); err != nil {
+			return errors.Wrap(err, "counting remotes")
+		}
+		if count == 0 {
+			return errors.Errorf("remote '%s' not found", name)
+		}
+	}
+
+	if err := setSystemValue(tx, "remote", name); err != nil {
+		return errors.Wrap(err, "saving the current remote")
+	}
+
+	return nil
+}
+
+// SetRemoteAPIKey saves the API key of the remote with the given name. The API
+// key of the default remote is saved in the config.
+func SetRemoteAPIKey(ctx infra.DnoteCtx, name, apiKey string) error {
+	if isEndpoint(name) {
+		return errors.New("the name of a remote cannot be an endpoint")
+	}
+
+	if name == DefaultRemote {
+		config, err := ReadConfig(ctx)
+		if err != nil {
+			return errors.Wrap(err, "reading the config")
+		}
+
+		config.APIKey = apiKey
+		if err := WriteConfig(ctx, config); err != nil {
+			return errors.Wrap(err, "writing the config")
+		}
+
+		return nil
+	}
+
+	if _, err := GetRemote(ctx, name); err != nil {
+		return errors.Wrap(err, "getting the remote")
+	}
+
+	tx, err := ctx.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+	if err := setSystemValue(tx, remoteKey(name, "api_key"), apiKey); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "saving the API key")
+	}
+	tx.Commit()
+
+	return nil
+}
+
+// UpdateRemoteBookmark saves the bookmark of the remote with the given name
+func UpdateRemoteBookmark(tx *sql.Tx, name string, bookmark int) error {
+	if err := setSystemValue(tx, remoteKey(name, "bookmark"), strconv.Itoa(bookmark)); err != nil {
+		return errors.Wrap(err, "saving the bookmark")
+	}
+
+	return nil
+}
+
+// getBookRemoteName returns the name of the remote the book with the given uuid
+// is synced with
+func getBookRemoteName(tx *sql.Tx, bookUUID string) (string, error) {
+	var ret string
+	err := tx.QueryRow("SELECT remote FROM remote_books WHERE book_uuid = ?", bookUUID).Scan(&ret)
+	if err == sql.ErrNoRows {
+		return DefaultRemote, nil
+	} else if err != nil {
+		return ret, errors.Wrap(err, "querying the remote of the book")
+	}
+
+	return ret, nil
+}
+
+// getActionRemoteNames returns the names of the remotes to receive the action
+// with the given data, which are the remotes of the books it concerns. The book
+// of a note is found by the uuid of the note rather than by the label in the
+// data, which another book might have taken.
+func getActionRemoteNames(tx *sql.Tx, data string) ([]string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling the data")
+	}
+
+	bookUUIDs := []string{}
+	if noteUUID, ok := fields["note_uuid"].(string); ok {
+		var bookUUID string
+		err := tx.QueryRow(`SELECT book_uuid FROM notes WHERE uuid = ?
+			UNION ALL
+			SELECT book_uuid FROM trash_notes WHERE uuid = ?`, noteUUID, noteUUID).Scan(&bookUUID)
+		if err == nil {
+			bookUUIDs = append(bookUUIDs, bookUUID)
+		} else if err != sql.ErrNoRows {
+			return nil, errors.Wrap(err, "finding the book of the note")
+		}
+	}
+	if len(bookUUIDs) == 0 {
+		for _, key := range []string{"book_name", "from_book", "to_book", "old_name", "new_name"} {
+			label, ok := fields[key].(string)
+			if !ok {
+				continue
+			}
+
+			bookUUID, _, err := findBookUUID(tx, label)
+			if err != nil {
+				return nil, errors.Wrapf(err, "finding the book '%s'", label)
+			}
+			if bookUUID != "" {
+				bookUUIDs = append(bookUUIDs, bookUUID)
+			}
+		}
+	}
+
+	ret := []string{}
+	seen := map[string]bool{}
+	for _, bookUUID := range bookUUIDs {
+		name, err := getBookRemoteName(tx, bookUUID)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting the remote of the book")
+		}
+
+		if !seen[name] {
+			ret = append(ret, name)
+			seen[name] = true
+		}
+	}
+	if len(ret) == 0 {
+		ret = append(ret, DefaultRemote)
+	}
+
+	return ret, nil
+}
+
+type remoteBook struct {
+	uuid  string
+	label string
+}
+
+// getRemoteBooks returns the books assigned to the remote with the given name
+func getRemoteBooks(q queryer, name string) ([]remoteBook, error) {
+	ret := []remoteBook{}
+
+	rows, err := q.Query(`SELECT books.uuid, books.label
+		FROM remote_books
+		INNER JOIN books ON books.uuid = remote_books.book_uuid
+		WHERE remote_books.remote = ?
+		ORDER BY books.label ASC`, name)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b remoteBook
+		if err := rows.Scan(&b.uuid, &b.label); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, b)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// GetRemoteBookLabels returns the labels of the books assigned to the remote
+// with the given name
+func GetRemoteBookLabels(db *sql.DB, name string) ([]string, error) {
+	books, err := getRemoteBooks(db, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting books")
+	}
+
+	ret := []string{}
+	for _, b := range books {
+		ret = append(ret, b.label)
+	}
+
+	return ret, nil
+}
+
+// AssignBook makes the book with the given label sync with the remote with the
+// given name instead of the default remote, creating the book if it does not
+// exist. The actions recreating the notes already in the book are logged for the
+// remote, which has not received them.
+func AssignBook(tx *sql.Tx, remoteName, label string) error {
+	if remoteName == DefaultRemote {
+		return errors.Errorf("the books not assigned to another remote are synced with the '%s' remote", DefaultRemote)
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT count(*) FROM system WHERE key = ?", remoteKey(remoteName, "endpoint")).Scan(&count); err != nil {
+		return errors.Wrap(err, "counting remotes")
+	}
+	if count == 0 {
+		return errors.Errorf("remote '%s' not found", remoteName)
+	}
+
+	var bookUUID string
+	err := tx.QueryRow("SELECT uuid FROM books WHERE label = ?", label).Scan(&bookUUID)
+	if err == sql.ErrNoRows {
+		bookUUID = utils.GenerateUUID()
+		if _, err := tx.Exec("INSERT INTO books (uuid, label) VALUES (?, ?)", bookUUID, label); err != nil {
+			return errors.Wrap(err, "creating the book")
+		}
+		if _, err := tx.Exec("DELETE FROM book_aliases WHERE label = ?", label); err != nil {
+			return errors.Wrap(err, "removing the alias")
+		}
+		if _, err := tx.Exec("INSERT INTO remote_books (remote, book_uuid) VALUES (?, ?)", remoteName, bookUUID); err != nil {
+			return errors.Wrap(err, "assigning the book")
+		}
+
+		if err := LogActionAddBook(tx, label); err != nil {
+			return errors.Wrap(err, "logging an action")
+		}
+
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "finding the book")
+	}
+
+	current, err := getBookRemoteName(tx, bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "getting the remote of the book")
+	}
+	if current != DefaultRemote {
+		return errors.Errorf("book '%s' is already synced with remote '%s'", label, current)
+	}
+
+	if _, err := tx.Exec("INSERT INTO remote_books (remote, book_uuid) VALUES (?, ?)", remoteName, bookUUID); err != nil {
+		return errors.Wrap(err, "assigning the book")
+	}
+	if err := logBookSnapshot(tx, bookUUID, label); err != nil {
+		return errors.Wrap(err, "logging the notes of the book")
+	}
+
+	return nil
+}
+
+// recordPendingAction records that the remotes of the books the action concerns
+// are to receive it
+func recordPendingAction(tx *sql.Tx, actionUUID, data string) error {
+	names, err := getActionRemoteNames(tx, data)
+	if err != nil {
+		return errors.Wrap(err, "getting the remotes to receive the action")
+	}
+
+	for _, name := range names {
+		if _, err := tx.Exec("INSERT INTO pending_actions (remote, action_uuid) VALUES (?, ?)", name, actionUUID); err != nil {
+			return errors.Wrapf(err, "recording the action for '%s'", name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestGetRemote_Default(t *testing.T) {
+	testCases := []struct {
+		env            string
+		configEndpoint string
+		expected       string
+	}{
+		{
+			env:            "",
+			configEndpoint: "",
+			expected:       "http://built-in",
+		},
+		{
+			env:            "",
+			configEndpoint: "http://config",
+			expected:       "http://config",
+		},
+		{
+			env:            "http://env",
+			configEndpoint: "http://config",
+			expected:       "http://env",
+		},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			ctx.APIEndpoint = "http://built-in"
+			if err := WriteConfig(ctx, infra.Config{APIKey: "key", Endpoint: tc.configEndpoint}); err != nil {
+				t.Fatal(errors.Wrap(err, "writing the config"))
+			}
+			os.Setenv("DNOTE_API_ENDPOINT", tc.env)
+			defer os.Unsetenv("DNOTE_API_ENDPOINT")
+
+			// Execute
+			remote, err := GetRemote(ctx, "")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting the remote"))
+			}
+
+			// Test
+			testutils.AssertEqual(t, remote.Name, DefaultRemote, "name mismatch")
+			testutils.AssertEqual(t, remote.Endpoint, tc.expected, "endpoint mismatch")
+			testutils.AssertEqual(t, remote.APIKey, "key", "API key mismatch")
+		}()
+	}
+}
+
+func TestRemotes(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	db := ctx.DB
+	testutils.MustExec(t, "setting up the bookmark", db, "INSERT INTO system (key, value) VALUES (?, ?)", "bookmark", 7)
+	if err := WriteConfig(ctx, infra.Config{APIKey: "key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := AddRemote(tx, "team", "http://team", "team-key"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "adding a remote"))
+	}
+	if err := UseRemote(tx, "team"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "using the remote"))
+	}
+	if err := UpdateRemoteBookmark(tx, "team", 3); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "updating the bookmark"))
+	}
+	tx.Commit()
+
+	// Test
+	current, err := GetRemote(ctx, "")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the current remote"))
+	}
+	remotes, err := GetRemotes(ctx)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting remotes"))
+	}
+
+	testutils.AssertEqual(t, current.Name, "team", "current remote mismatch")
+	testutils.AssertEqual(t, current.Endpoint, "http://team", "endpoint mismatch")
+	testutils.AssertEqual(t, current.APIKey, "team-key", "API key mismatch")
+	testutils.AssertEqual(t, current.Bookmark, 3, "bookmark mismatch")
+	testutils.AssertEqual(t, len(remotes), 2, "remote count mismatch")
+	testutils.AssertEqual(t, remotes[0].Name, DefaultRemote, "remote 0 name mismatch")
+	testutils.AssertEqual(t, remotes[0].Bookmark, 7, "remote 0 bookmark mismatch")
+	testutils.AssertEqual(t, remotes[1].Name, "team", "remote 1 name mismatch")
+
+	// Execute
+	tx, err = db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := RemoveRemote(tx, "team"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "removing the remote"))
+	}
+	tx.Commit()
+
+	// Test
+	current, err = GetRemote(ctx, "")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the current remote"))
+	}
+	var remoteKeyCount int
+	testutils.MustScan(t, "counting remote keys", db.QueryRow("SELECT count(*) FROM system WHERE key LIKE 'remote%'"), &remoteKeyCount)
+
+	testutils.AssertEqual(t, current.Name, DefaultRemote, "current remote mismatch after removal")
+	testutils.AssertEqual(t, remoteKeyCount, 0, "remote key count mismatch")
+}
+
+func TestGetRemote_Endpoint(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	db := ctx.DB
+	if err := WriteConfig(ctx, infra.Config{APIKey: "key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := AddRemote(tx, "team", "http://team", "team-key"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "adding a remote"))
+	}
+	if err := UseRemote(tx, "team"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "using the remote"))
+	}
+	tx.Commit()
+
+	// Execute
+	remote, err := GetRemote(ctx, "https://other")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the remote"))
+	}
+
+	// Test
+	testutils.AssertEqual(t, remote.Name, "team", "name mismatch")
+	testutils.AssertEqual(t, remote.Endpoint, "https://other", "endpoint mismatch")
+	testutils.AssertEqual(t, remote.APIKey, "team-key", "API key mismatch")
+}
+
+func TestAssignBook(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	db := ctx.DB
+	testutils.Setup2(t, ctx)
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := AddRemote(tx, "team", "http://team", "team-key"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "adding a remote"))
+	}
+
+	// Execute
+	if err := AssignBook(tx, "team", "js"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "assigning an existing book"))
+	}
+	if err := AssignBook(tx, "team", "ops"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "assigning a new book"))
+	}
+	if err := LogActionEditNote(tx, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "js", "edited", 1517629810); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "editing a note of the assigned book"))
+	}
+	if err := LogActionEditNote(tx, "3e065d55-6d47-42f2-a6bf-f5844130b2d2", "linux", "edited", 1517629810); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "editing a note of another book"))
+	}
+	defaultErr := AssignBook(tx, DefaultRemote, "linux")
+	againErr := AssignBook(tx, "team", "js")
+	tx.Commit()
+
+	// Test
+	var teamPending, defaultPending, opsCount int
+	pendingQuery := "SELECT count(*) FROM pending_actions WHERE remote = ?"
+	testutils.MustScan(t, "counting actions for team", db.QueryRow(pendingQuery, "team"), &teamPending)
+	testutils.MustScan(t, "counting actions for default", db.QueryRow(pendingQuery, DefaultRemote), &defaultPending)
+	testutils.MustScan(t, "counting the new book", db.QueryRow("SELECT count(*) FROM books WHERE label = ?", "ops"), &opsCount)
+
+	labels, err := GetRemoteBookLabels(db, "team")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting the books of the remote"))
+	}
+
+	// The team remote receives the js book with its 2 notes, the ops book and the edit
+	testutils.AssertEqual(t, teamPending, 5, "team pending action count mismatch")
+	testutils.AssertEqual(t, defaultPending, 1, "default pending action count mismatch")
+	testutils.AssertEqual(t, opsCount, 1, "new book count mismatch")
+	testutils.AssertDeepEqual(t, labels, []string{"js", "ops"}, "books mismatch")
+	testutils.AssertEqual(t, defaultErr != nil, true, "assigning to the default remote should fail")
+	testutils.AssertEqual(t, againErr != nil, true, "assigning an assigned book should fail")
+}
+
+func TestRemoveRemote_Books(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	db := ctx.DB
+	testutils.Setup2(t, ctx)
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := AddRemote(tx, "team", "http://team", "team-key"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "adding a remote"))
+	}
+	if err := AssignBook(tx, "team", "js"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "assigning a book"))
+	}
+
+	// Execute
+	if err := RemoveRemote(tx, "team"); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "removing the remote"))
+	}
+	tx.Commit()
+
+	// Test
+	var teamPending, defaultPending, assignedCount int
+	pendingQuery := "SELECT count(*) FROM pending_actions WHERE remote = ?"
+	testutils.MustScan(t, "counting actions for team", db.QueryRow(pendingQuery, "team"), &teamPending)
+	testutils.MustScan(t, "counting actions for default", db.QueryRow(pendingQuery, DefaultRemote), &defaultPending)
+	testutils.MustScan(t, "counting assigned books", db.QueryRow("SELECT count(*) FROM remote_books"), &assignedCount)
+
+	// The default remote receives the js book with its 2 notes
+	testutils.AssertEqual(t, teamPending, 0, "team pending action count mismatch")
+	testutils.AssertEqual(t, defaultPending, 3, "default pending action count mismatch")
+	testutils.AssertEqual(t, assignedCount, 0, "assigned book count mismatch")
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// initialEase is the ease of a note reviewed for the first time
+	initialEase = 2.5
+	// minEase is the lowest ease a note can have so that the interval keeps
+	// growing for the hard notes
+	minEase = 1.3
+	// secondsPerDay is the unit of the review intervals
+	secondsPerDay = 24 * 60 * 60
+
+	// MinGrade is the grade for a note the user could not recall at all
+	MinGrade = 0
+	// PassingGrade is the lowest grade for a note the user recalled
+	PassingGrade = 3
+	// MaxGrade is the grade for a note the user recalled perfectly
+	MaxGrade = 5
+)
+
+// Review is the spaced repetition schedule of a note
+type Review struct {
+	NoteUUID string
+	// Ease is the factor by which the interval grows after a successful recall
+	Ease float64
+	// Interval is the number of days until the next review
+	Interval    int
+	Repetitions int
+	DueOn       int64
+	ReviewedOn  int64
+	CreatedOn   int64
+}
+
+// NewReview returns the schedule of a note that has never been reviewed
+func NewReview(noteUUID string) Review {
+	return Review{
+		NoteUUID: noteUUID,
+		Ease:     initialEase,
+	}
+}
+
+// Schedule returns the review rescheduled after the user recalled the note with
+// the given grade at the given time, using the SM-2 algorithm. The grade ranges
+// from MinGrade to MaxGrade.
+func Schedule(r Review, grade int, ts int64) Review {
+	ret := r
+
+	if grade < PassingGrade {
+		ret.Repetitions = 0
+		ret.Interval = 1
+	} else {
+		switch ret.Repetitions {
+		case 0:
+			ret.Interval = 1
+		case 1:
+			ret.Interval = 6
+		default:
+			ret.Interval = int(math.Ceil(float64(r.Interval) * r.Ease))
+		}
+
+		ret.Repetitions++
+	}
+
+	q := float64(MaxGrade - grade)
+	ret.Ease = r.Ease + 0.1 - q*(0.08+q*0.02)
+	if ret.Ease < minEase {
+		ret.Ease = minEase
+	}
+
+	ret.DueOn = ts + int64(ret.Interval)*secondsPerDay
+	ret.ReviewedOn = ts
+	if ret.CreatedOn == 0 {
+		ret.CreatedOn = ts
+	}
+
+	return ret
+}
+
+// GetReview returns the review of the note and a boolean indicating if the note
+// has been reviewed
+func GetReview(tx *sql.Tx, noteUUID string) (Review, bool, error) {
+	ret := Review{NoteUUID: noteUUID}
+
+	err := tx.QueryRow(`SELECT ease, interval, repetitions, due_on, reviewed_on, created_on
+		FROM reviews WHERE note_uuid = ?`, noteUUID).
+		Scan(&ret.Ease, &ret.Interval, &ret.Repetitions, &ret.DueOn, &ret.ReviewedOn, &ret.CreatedOn)
+	if err == sql.ErrNoRows {
+		return NewReview(noteUUID), false, nil
+	} else if err != nil {
+		return ret, false, errors.Wrap(err, "querying the review")
+	}
+
+	return ret, true, nil
+}
+
+// SaveReview creates or updates the review of a note
+func SaveReview(tx *sql.Tx, r Review) error {
+	_, err := tx.Exec(`INSERT OR REPLACE INTO reviews (note_uuid, ease, interval, repetitions, due_on, reviewed_on, created_on)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, r.NoteUUID, r.Ease, r.Interval, r.Repetitions, r.DueOn, r.ReviewedOn, r.CreatedOn)
+	if err != nil {
+		return errors.Wrap(err, "saving the review")
+	}
+
+	return nil
+}
+
+// StartOfDay returns the unix timestamp of the local midnight of the given time
+func StartOfDay(t time.Time) int64 {
+	y, m, d := t.Date()
+
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Unix()
+}
+
+// CountReviews returns the number of the notes reviewed since the given time
+// and the number of those reviewed for the first time
+func CountReviews(db *sql.DB, since int64) (int, int, error) {
+	var reviewed, added int
+
+	err := db.QueryRow(`SELECT count(*), count(CASE WHEN created_on >= ? THEN 1 END)
+		FROM reviews WHERE reviewed_on >= ?`, since, since).Scan(&reviewed, &added)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "counting reviews")
+	}
+
+	return reviewed, added, nil
+}
+
+// GetDueNotes returns the uuids of the notes due for a review at the given
+// time, followed by the notes never reviewed in the order they were added. At
+// most newLimit new notes and limit notes in total are returned. If bookUUID is
+// not empty, only the notes in the book are returned.
+func GetDueNotes(db *sql.DB, bookUUID string, now int64, limit, newLimit int) ([]string, error) {
+	ret := []string{}
+	if limit <= 0 {
+		return ret, nil
+	}
+	if newLimit < 0 {
+		newLimit = 0
+	}
+
+	cond := ""
+	args := []interface{}{now}
+	if bookUUID != "" {
+		cond = " AND notes.book_uuid = ?"
+		args = append(args, bookUUID)
+	}
+
+	dueQuery := `SELECT notes.uuid FROM notes
+		INNER JOIN reviews ON reviews.note_uuid = notes.uuid
+		WHERE reviews.due_on <= ?` + cond + `
+		ORDER BY reviews.due_on ASC, notes.id ASC LIMIT ?`
+	dueUUIDs, err := queryUUIDs(db, dueQuery, append(args, limit)...)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying due notes")
+	}
+	ret = append(ret, dueUUIDs...)
+
+	if rest := limit - len(ret); rest < newLimit {
+		newLimit = rest
+	}
+
+	newQuery := `SELECT notes.uuid FROM notes
+		LEFT JOIN reviews ON reviews.note_uuid = notes.uuid
+		WHERE reviews.note_uuid IS NULL AND notes.added_on <= ?` + cond + `
+		ORDER BY notes.added_on ASC, notes.id ASC LIMIT ?`
+	newUUIDs, err := queryUUIDs(db, newQuery, append(args, newLimit)...)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying new notes")
+	}
+	ret = append(ret, newUUIDs...)
+
+	return ret, nil
+}
+
+// GetNextDue returns the time the next review is due, or 0 if no note is under
+// review. If bookUUID is not empty, only the notes in the book are considered.
+func GetNextDue(db *sql.DB, bookUUID string) (int64, error) {
+	query := `SELECT coalesce(min(reviews.due_on), 0) FROM reviews
+		INNER JOIN notes ON notes.uuid = reviews.note_uuid`
+	args := []interface{}{}
+	if bookUUID != "" {
+		query += " WHERE notes.book_uuid = ?"
+		args = append(args, bookUUID)
+	}
+
+	var ret int64
+	if err := db.QueryRow(query, args...).Scan(&ret); err != nil {
+		return 0, errors.Wrap(err, "querying the next review")
+	}
+
+	return ret, nil
+}
+
+func queryUUIDs(db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying")
+	}
+	defer rows.Close()
+
+	ret := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			return nil, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, uuid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestSchedule(t *testing.T) {
+	ts := int64(1517629805)
+
+	testCases := []struct {
+		review              Review
+		grade               int
+		expectedEase        string
+		expectedInterval    int
+		expectedRepetitions int
+	}{
+		{
+			review:              NewReview("note-uuid"),
+			grade:               4,
+			expectedEase:        "2.50",
+			expectedInterval:    1,
+			expectedRepetitions: 1,
+		},
+		{
+			review:              Review{Ease: 2.5, Interval: 1, Repetitions: 1},
+			grade:               5,
+			expectedEase:        "2.60",
+			expectedInterval:    6,
+			expectedRepetitions: 2,
+		},
+		{
+			review:              Review{Ease: 2.5, Interval: 6, Repetitions: 2},
+			grade:               3,
+			expectedEase:        "2.36",
+			expectedInterval:    15,
+			expectedRepetitions: 3,
+		},
+		{
+			review:              Review{Ease: 2.5, Interval: 15, Repetitions: 3},
+			grade:               1,
+			expectedEase:        "1.96",
+			expectedInterval:    1,
+			expectedRepetitions: 0,
+		},
+		{
+			review:              Review{Ease: 1.4, Interval: 6, Repetitions: 2},
+			grade:               0,
+			expectedEase:        "1.30",
+			expectedInterval:    1,
+			expectedRepetitions: 0,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			got := Schedule(tc.review, tc.grade, ts)
+
+			testutils.AssertEqual(t, fmt.Sprintf("%.2f", got.Ease), tc.expectedEase, "ease mismatch")
+			testutils.AssertEqual(t, got.Interval, tc.expectedInterval, "interval mismatch")
+			testutils.AssertEqual(t, got.Repetitions, tc.expectedRepetitions, "repetitions mismatch")
+			testutils.AssertEqual(t, got.DueOn, ts+int64(tc.expectedInterval)*secondsPerDay, "due_on mismatch")
+			testutils.AssertEqual(t, got.ReviewedOn, ts, "reviewed_on mismatch")
+			testutils.AssertEqual(t, got.CreatedOn, ts, "created_on mismatch")
+		})
+	}
+}
+
+func TestGetDueNotes(t *testing.T) {
+	now := int64(1517629805)
+	id1 := "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"
+	id2 := "43827b9a-c2b0-4c06-a290-97991c896653"
+	id3 := "3e065d55-6d47-42f2-a6bf-f5844130b2d2"
+
+	testCases := []struct {
+		bookUUID string
+		limit    int
+		newLimit int
+		expected []string
+	}{
+		{
+			limit:    20,
+			newLimit: 10,
+			expected: []string{id3, id2},
+		},
+		{
+			limit:    1,
+			newLimit: 10,
+			expected: []string{id3},
+		},
+		{
+			limit:    20,
+			newLimit: 0,
+			expected: []string{id3},
+		},
+		{
+			bookUUID: "js-book-uuid",
+			limit:    20,
+			newLimit: 10,
+			expected: []string{id2},
+		},
+		{
+			limit:    0,
+			newLimit: 10,
+			expected: []string{},
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			// Setup
+			ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			db := ctx.DB
+			testutils.MustExec(t, "setting up a review not due", db, `INSERT INTO reviews (note_uuid, ease, interval, repetitions, due_on, reviewed_on, created_on)
+				VALUES (?, ?, ?, ?, ?, ?, ?)`, id1, 2.5, 6, 2, now+1, now-6*secondsPerDay, now-7*secondsPerDay)
+			testutils.MustExec(t, "setting up a due review", db, `INSERT INTO reviews (note_uuid, ease, interval, repetitions, due_on, reviewed_on, created_on)
+				VALUES (?, ?, ?, ?, ?, ?, ?)`, id3, 2.5, 1, 1, now, now-secondsPerDay, now-secondsPerDay)
+
+			// Execute
+			got, err := GetDueNotes(db, tc.bookUUID, now, tc.limit, tc.newLimit)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "getting due notes"))
+			}
+
+			// Test
+			testutils.AssertDeepEqual(t, got, tc.expected, "due notes mismatch")
+		})
+	}
+}
+
+func TestCountReviews(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	now := time.Date(2018, 2, 3, 15, 30, 0, 0, time.Local)
+	today := StartOfDay(now)
+
+	testutils.Setup2(t, ctx)
+	db := ctx.DB
+	testutils.MustExec(t, "setting up a review of a new note", db, `INSERT INTO reviews (note_uuid, ease, interval, repetitions, due_on, reviewed_on, created_on)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", 2.5, 1, 1, today+secondsPerDay, today+60, today+60)
+	testutils.MustExec(t, "setting up a review", db, `INSERT INTO reviews (note_uuid, ease, interval, repetitions, due_on, reviewed_on, created_on)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, "43827b9a-c2b0-4c06-a290-97991c896653", 2.5, 6, 2, today+6*secondsPerDay, today+120, today-secondsPerDay)
+	testutils.MustExec(t, "setting up a review of yesterday", db, `INSERT INTO reviews (note_uuid, ease, interval, repetitions, due_on, reviewed_on, created_on)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, "3e065d55-6d47-42f2-a6bf-f5844130b2d2", 2.5, 1, 1, today, today-60, today-60)
+
+	// Execute
+	reviewed, added, err := CountReviews(db, today)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "counting reviews"))
+	}
+
+	// Test
+	testutils.AssertEqual(t, reviewed, 2, "reviewed count mismatch")
+	testutils.AssertEqual(t, added, 1, "new count mismatch")
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// NoteRevision is a previous version of a note
+type NoteRevision struct {
+	// Number is the 1-based position of the revision in the history of the note
+	Number    int
+	Content   string
+	CreatedOn int64
+}
+
+// SaveNoteRevision keeps the current content of the note as a revision if it is
+// about to be replaced by a different content
+func SaveNoteRevision(tx *sql.Tx, noteUUID, newContent string) error {
+	_, err := tx.Exec(`INSERT INTO note_revisions (note_uuid, content, created_on)
+		SELECT uuid, content, CASE WHEN edited_on > 0 THEN edited_on ELSE added_on END
+		FROM notes
+		WHERE uuid = ? AND content != ?`, noteUUID, newContent)
+	if err != nil {
+		return errors.Wrap(err, "inserting a revision")
+	}
+
+	return nil
+}
+
+// GetNoteRevisions returns the revisions of the note with the given uuid from
+// the oldest to the newest
+func GetNoteRevisions(db *sql.DB, noteUUID string) ([]NoteRevision, error) {
+	ret := []NoteRevision{}
+
+	rows, err := db.Query(`SELECT content, created_on
+		FROM note_revisions
+		WHERE note_uuid = ?
+		ORDER BY id ASC`, noteUUID)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying revisions")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rev := NoteRevision{Number: len(ret) + 1}
+		if err := rows.Scan(&rev.Content, &rev.CreatedOn); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// UpdateNoteContent replaces the content of the note, keeping the previous
+// content as a revision, and logs an action for editing the note
+func UpdateNoteContent(tx *sql.Tx, noteUUID, bookLabel, content string, ts int64) error {
+	if err := SaveNoteRevision(tx, noteUUID, content); err != nil {
+		return errors.Wrap(err, "saving the revision")
+	}
+
+	_, err := tx.Exec(`UPDATE notes
+		SET content = ?, edited_on = ?
+		WHERE uuid = ?`, content, ts, noteUUID)
+	if err != nil {
+		return errors.Wrap(err, "updating the note")
+	}
+
+	if err := LogActionEditNote(tx, noteUUID, bookLabel, content, ts); err != nil {
+		return errors.Wrap(err, "logging an action")
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type snapshotNote struct {
+	uuid     string
+	content  string
+	public   bool
+	addedOn  int64
+	editedOn int64
+}
+
+// getSnapshotNotes returns the notes in the book with the given uuid
+func getSnapshotNotes(tx *sql.Tx, bookUUID string) ([]snapshotNote, error) {
+	ret := []snapshotNote{}
+
+	rows, err := tx.Query(`SELECT uuid, content, public, added_on, edited_on
+		FROM notes
+		WHERE book_uuid = ?
+		ORDER BY added_on ASC`, bookUUID)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n snapshotNote
+		if err := rows.Scan(&n.uuid, &n.content, &n.public, &n.addedOn, &n.editedOn); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, n)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// getSnapshotTags returns the tags of the notes in the book with the given uuid
+// keyed by the note uuid
+func getSnapshotTags(tx *sql.Tx, bookUUID string) (map[string][]string, error) {
+	ret := map[string][]string{}
+
+	rows, err := tx.Query(`SELECT note_tags.note_uuid, tags.label
+		FROM note_tags
+		INNER JOIN tags ON tags.uuid = note_tags.tag_uuid
+		INNER JOIN notes ON notes.uuid = note_tags.note_uuid
+		WHERE notes.book_uuid = ?
+		ORDER BY tags.label ASC`, bookUUID)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying tags")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteUUID, label string
+		if err := rows.Scan(&noteUUID, &label); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret[noteUUID] = append(ret[noteUUID], label)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// logBookSnapshot logs the actions recreating the book with the given uuid and
+// its notes and tags. The actions go to the remote of the book like any other.
+func logBookSnapshot(tx *sql.Tx, bookUUID, label string) error {
+	notes, err := getSnapshotNotes(tx, bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "getting notes")
+	}
+	tags, err := getSnapshotTags(tx, bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "getting tags")
+	}
+
+	if err := LogActionAddBook(tx, label); err != nil {
+		return errors.Wrapf(err, "logging the book '%s'", label)
+	}
+
+	ts := time.Now().Unix()
+	for _, n := range notes {
+		if err := LogActionAddNote(tx, n.uuid, label, n.content, n.public, n.addedOn); err != nil {
+			return errors.Wrapf(err, "logging the note %s", n.uuid)
+		}
+		// add_note cannot carry the time the note was last edited
+		if n.editedOn != 0 {
+			if err := LogActionEditNotePublic(tx, n.uuid, label, n.public, n.editedOn); err != nil {
+				return errors.Wrapf(err, "logging the edit of the note %s", n.uuid)
+			}
+		}
+
+		if len(tags[n.uuid]) > 0 {
+			if err := LogActionSetNoteTags(tx, n.uuid, tags[n.uuid], ts); err != nil {
+				return errors.Wrapf(err, "logging the tags of the note %s", n.uuid)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"database/sql"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// hashtagRe matches a hashtag in the note content. A hashtag must start with a
+// letter so that references such as '#123' or markdown headings are not mistaken
+// for tags.
+var hashtagRe = regexp.MustCompile(`(?:^|[\s(])#(\p{L}[\p{L}\p{N}_-]*)`)
+
+// NormalizeTag returns the canonical form of the given tag label
+func NormalizeTag(label string) string {
+	ret := strings.TrimSpace(label)
+	ret = strings.TrimPrefix(ret, "#")
+
+	return strings.ToLower(ret)
+}
+
+// ExtractHashtags returns the normalized labels of the hashtags found in the
+// given content
+func ExtractHashtags(content string) []string {
+	ret := []string{}
+
+	for _, match := range hashtagRe.FindAllStringSubmatch(content, -1) {
+		ret = append(ret, match[1])
+	}
+
+	return MergeTags(ret)
+}
+
+// MergeTags returns a sorted union of the given lists of tags after normalizing
+// them
+func MergeTags(lists ...[]string) []string {
+	seen := map[string]bool{}
+	ret := []string{}
+
+	for _, list := range lists {
+		for _, label := range list {
+			t := NormalizeTag(label)
+			if t == "" || seen[t] {
+				continue
+			}
+
+			seen[t] = true
+			ret = append(ret, t)
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
+
+// SubtractTags returns the tags in the given list that are not in the excluded
+// list
+func SubtractTags(list, excluded []string) []string {
+	ex := map[string]bool{}
+	for _, label := range excluded {
+		ex[NormalizeTag(label)] = true
+	}
+
+	ret := []string{}
+	for _, label := range MergeTags(list) {
+		if !ex[label] {
+			ret = append(ret, label)
+		}
+	}
+
+	return ret
+}
+
+// GetNoteTags returns the sorted labels of the tags of the note with the given uuid
+func GetNoteTags(db *sql.DB, noteUUID string) ([]string, error) {
+	ret := []string{}
+
+	rows, err := db.Query(`SELECT tags.label
+		FROM note_tags
+		INNER JOIN tags ON tags.uuid = note_tags.tag_uuid
+		WHERE note_tags.note_uuid = ?
+		ORDER BY tags.label ASC`, noteUUID)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying tags")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, label)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+func getOrCreateTag(tx *sql.Tx, label string) (string, error) {
+	var ret string
+	err := tx.QueryRow("SELECT uuid FROM tags WHERE label = ?", label).Scan(&ret)
+	if err == sql.ErrNoRows {
+		ret = utils.GenerateUUID()
+		if _, err := tx.Exec("INSERT INTO tags (uuid, label) VALUES (?, ?)", ret, label); err != nil {
+			return "", errors.Wrap(err, "inserting a tag")
+		}
+	} else if err != nil {
+		return "", errors.Wrap(err, "querying the tag")
+	}
+
+	return ret, nil
+}
+
+// SetNoteTags replaces the tags of the note with the given uuid
+func SetNoteTags(tx *sql.Tx, noteUUID string, labels []string) error {
+	if _, err := tx.Exec("DELETE FROM note_tags WHERE note_uuid = ?", noteUUID); err != nil {
+		return errors.Wrap(err, "removing existing tags")
+	}
+
+	for _, label := range MergeTags(labels) {
+		tagUUID, err := getOrCreateTag(tx, label)
+		if err != nil {
+			return errors.Wrapf(err, "getting tag '%s'", label)
+		}
+
+		if _, err := tx.Exec("INSERT INTO note_tags (note_uuid, tag_uuid) VALUES (?, ?)", noteUUID, tagUUID); err != nil {
+			return errors.Wrapf(err, "tagging the note with '%s'", label)
+		}
+	}
+
+	return nil
+}
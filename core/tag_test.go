@@ -0,0 +1,85 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected []string
+	}{
+		{
+			content:  "no tags here",
+			expected: []string{},
+		},
+		{
+			content:  "#linux find - recursively walk the #Directory",
+			expected: []string{"directory", "linux"},
+		},
+		{
+			content:  "# heading\nfixed in #123 and (#net-working)",
+			expected: []string{"net-working"},
+		},
+		{
+			content:  "a#b is not a tag but #go_lang is. #go_lang",
+			expected: []string{"go_lang"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.content, func(t *testing.T) {
+			testutils.AssertDeepEqual(t, ExtractHashtags(tc.content), tc.expected, "tags mismatch")
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	got := MergeTags([]string{"Linux", " networking "}, []string{"#linux", ""}, []string{"bash"})
+
+	testutils.AssertDeepEqual(t, got, []string{"bash", "linux", "networking"}, "tags mismatch")
+}
+
+func TestSubtractTags(t *testing.T) {
+	got := SubtractTags([]string{"bash", "linux", "networking"}, []string{"Linux"})
+
+	testutils.AssertDeepEqual(t, got, []string{"bash", "networking"}, "tags mismatch")
+}
+
+func TestSetNoteTags(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	db := ctx.DB
+	testutils.MustExec(t, "setting up tag", db, "INSERT INTO tags (uuid, label) VALUES (?, ?)", "es5-tag-uuid", "es5")
+	testutils.MustExec(t, "setting up note tag", db, "INSERT INTO note_tags (note_uuid, tag_uuid) VALUES (?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "es5-tag-uuid")
+
+	// Execute
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := SetNoteTags(tx, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", []string{"ES6", "date"}); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "setting tags"))
+	}
+	tx.Commit()
+
+	// Test
+	var tagCount, noteTagCount int
+	testutils.MustScan(t, "counting tags", db.QueryRow("SELECT count(*) FROM tags"), &tagCount)
+	testutils.MustScan(t, "counting note tags", db.QueryRow("SELECT count(*) FROM note_tags"), &noteTagCount)
+	testutils.AssertEqual(t, tagCount, 3, "tag count mismatch")
+	testutils.AssertEqual(t, noteTagCount, 2, "note tag count mismatch")
+
+	tags, err := GetNoteTags(db, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting tags"))
+	}
+	testutils.AssertDeepEqual(t, tags, []string{"date", "es6"}, "note tags mismatch")
+}
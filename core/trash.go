@@ -0,0 +1,362 @@
+package core
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// TrashedNote is a note in the trash
+type TrashedNote struct {
+	ID        int
+	UUID      string
+	BookLabel string
+	Content   string
+	TrashedOn int64
+}
+
+// TrashedBook is a book in the trash
+type TrashedBook struct {
+	UUID      string
+	Label     string
+	NoteCount int
+	TrashedOn int64
+}
+
+// TrashNote moves the note with the given uuid to the trash
+func TrashNote(tx *sql.Tx, noteUUID string, ts int64) error {
+	_, err := tx.Exec(`INSERT INTO trash_notes (note_id, uuid, book_uuid, content, added_on, edited_on, public, trashed_on, with_book)
+		SELECT id, uuid, book_uuid, content, added_on, edited_on, public, ?, ?
+		FROM notes
+		WHERE uuid = ?`, ts, false, noteUUID)
+	if err != nil {
+		return errors.Wrap(err, "copying the note to the trash")
+	}
+
+	if _, err := tx.Exec("DELETE FROM notes WHERE uuid = ?", noteUUID); err != nil {
+		return errors.Wrap(err, "removing the note")
+	}
+
+	return nil
+}
+
+// TrashBook moves the book with the given uuid and all its notes to the trash
+func TrashBook(tx *sql.Tx, bookUUID string, ts int64) error {
+	_, err := tx.Exec(`INSERT INTO trash_books (uuid, label, trashed_on)
+		SELECT uuid, label, ?
+		FROM books
+		WHERE uuid = ?`, ts, bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "copying the book to the trash")
+	}
+
+	_, err = tx.Exec(`INSERT INTO trash_notes (note_id, uuid, book_uuid, content, added_on, edited_on, public, trashed_on, with_book)
+		SELECT id, uuid, book_uuid, content, added_on, edited_on, public, ?, ?
+		FROM notes
+		WHERE book_uuid = ?`, ts, true, bookUUID)
+	if err != nil {
+		return errors.Wrap(err, "copying the notes to the trash")
+	}
+
+	if _, err := tx.Exec("DELETE FROM notes WHERE book_uuid = ?", bookUUID); err != nil {
+		return errors.Wrap(err, "removing notes in the book")
+	}
+	if _, err := tx.Exec("DELETE FROM books WHERE uuid = ?", bookUUID); err != nil {
+		return errors.Wrap(err, "removing the book")
+	}
+
+	return nil
+}
+
+// getTrashedBookUUID returns the uuid of the most recently trashed book with the given label
+func getTrashedBookUUID(tx *sql.Tx, label string) (string, error) {
+	var ret string
+	err := tx.QueryRow("SELECT uuid FROM trash_books WHERE label = ? ORDER BY trashed_on DESC LIMIT 1", label).Scan(&ret)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrap(err, "querying the trashed book")
+	}
+
+	return ret, nil
+}
+
+// RestoreNote moves the note with the given trash id from the trash back to its book
+func RestoreNote(tx *sql.Tx, trashID int) error {
+	var bookUUID string
+	err := tx.QueryRow("SELECT book_uuid FROM trash_notes WHERE id = ?", trashID).Scan(&bookUUID)
+	if err == sql.ErrNoRows {
+		return errors.Errorf("note %d not found in the trash", trashID)
+	} else if err != nil {
+		return errors.Wrap(err, "querying the trashed note")
+	}
+
+	var bookCount int
+	if err := tx.QueryRow("SELECT count(*) FROM books WHERE uuid = ?", bookUUID).Scan(&bookCount); err != nil {
+		return errors.Wrap(err, "counting the book")
+	}
+	if bookCount == 0 {
+		var bookLabel string
+		err := tx.QueryRow("SELECT label FROM trash_books WHERE uuid = ?", bookUUID).Scan(&bookLabel)
+		if err == sql.ErrNoRows {
+			return errors.New("the book of the note no longer exists")
+		} else if err != nil {
+			return errors.Wrap(err, "querying the trashed book")
+		}
+
+		return errors.Errorf("book '%s' is in the trash. restore the book first", bookLabel)
+	}
+
+	_, err = tx.Exec(`INSERT INTO notes (id, uuid, book_uuid, content, added_on, edited_on, public)
+		SELECT nullif(note_id, 0), uuid, book_uuid, content, added_on, edited_on, public
+		FROM trash_notes
+		WHERE id = ?`, trashID)
+	if err != nil {
+		return errors.Wrap(err, "restoring the note")
+	}
+
+	if _, err := tx.Exec("DELETE FROM trash_notes WHERE id = ?", trashID); err != nil {
+		return errors.Wrap(err, "removing the note from the trash")
+	}
+
+	return nil
+}
+
+// RestoreBook moves the most recently trashed book with the given label and the
+// notes that were trashed along with it back from the trash
+func RestoreBook(tx *sql.Tx, label string) error {
+	bookUUID, err := getTrashedBookUUID(tx, label)
+	if err != nil {
+		return errors.Wrap(err, "finding the trashed book")
+	}
+	if bookUUID == "" {
+		return errors.Errorf("book '%s' not found in the trash", label)
+	}
+
+	var bookCount int
+	if err := tx.QueryRow("SELECT count(*) FROM books WHERE label = ?", label).Scan(&bookCount); err != nil {
+		return errors.Wrap(err, "counting books")
+	}
+	if bookCount > 0 {
+		return errors.Errorf("book '%s' already exists", label)
+	}
+
+	if _, err := tx.Exec("INSERT INTO books (uuid, label) SELECT uuid, label FROM trash_books WHERE uuid = ?", bookUUID); err != nil {
+		return errors.Wrap(err, "restoring the book")
+	}
+
+	_, err = tx.Exec(`INSERT INTO notes (id, uuid, book_uuid, content, added_on, edited_on, public)
+		SELECT nullif(note_id, 0), uuid, book_uuid, content, added_on, edited_on, public
+		FROM trash_notes
+		WHERE book_uuid = ? AND with_book = ?`, bookUUID, true)
+	if err != nil {
+		return errors.Wrap(err, "restoring notes")
+	}
+
+	if _, err := tx.Exec("DELETE FROM trash_notes WHERE book_uuid = ? AND with_book = ?", bookUUID, true); err != nil {
+		return errors.Wrap(err, "removing notes from the trash")
+	}
+	if _, err := tx.Exec("DELETE FROM trash_books WHERE uuid = ?", bookUUID); err != nil {
+		return errors.Wrap(err, "removing the book from the trash")
+	}
+
+	return nil
+}
+
+// GetTrashedNotes returns the notes that were moved to the trash individually
+func GetTrashedNotes(db *sql.DB) ([]TrashedNote, error) {
+	ret := []TrashedNote{}
+
+	rows, err := db.Query(`SELECT trash_notes.id, trash_notes.uuid, coalesce(books.label, trash_books.label, ''), trash_notes.content, trash_notes.trashed_on
+		FROM trash_notes
+		LEFT JOIN books ON books.uuid = trash_notes.book_uuid
+		LEFT JOIN trash_books ON trash_books.uuid = trash_notes.book_uuid
+		WHERE trash_notes.with_book = ?
+		ORDER BY trash_notes.trashed_on ASC, trash_notes.id ASC`, false)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying trashed notes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n TrashedNote
+		if err := rows.Scan(&n.ID, &n.UUID, &n.BookLabel, &n.Content, &n.TrashedOn); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, n)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// GetTrashedBooks returns the books in the trash
+func GetTrashedBooks(db *sql.DB) ([]TrashedBook, error) {
+	ret := []TrashedBook{}
+
+	rows, err := db.Query(`SELECT trash_books.uuid, trash_books.label, trash_books.trashed_on,
+			(SELECT count(*) FROM trash_notes WHERE trash_notes.book_uuid = trash_books.uuid AND trash_notes.with_book = ?)
+		FROM trash_books
+		ORDER BY trash_books.trashed_on ASC`, true)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying trashed books")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b TrashedBook
+		if err := rows.Scan(&b.UUID, &b.Label, &b.TrashedOn, &b.NoteCount); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, b)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+// purgeTrashedNotes permanently deletes the trashed notes matching the given
+// condition along with their tags, revisions and reviews
+func purgeTrashedNotes(tx *sql.Tx, cond string, args ...interface{}) error {
+	if _, err := tx.Exec("DELETE FROM note_tags WHERE note_uuid IN (SELECT uuid FROM trash_notes WHERE "+cond+")", args...); err != nil {
+		return errors.Wrap(err, "removing tags")
+	}
+	if _, err := tx.Exec("DELETE FROM note_revisions WHERE note_uuid IN (SELECT uuid FROM trash_notes WHERE "+cond+")", args...); err != nil {
+		return errors.Wrap(err, "removing revisions")
+	}
+	if _, err := tx.Exec("DELETE FROM reviews WHERE note_uuid IN (SELECT uuid FROM trash_notes WHERE "+cond+")", args...); err != nil {
+		return errors.Wrap(err, "removing reviews")
+	}
+	if _, err := tx.Exec("DELETE FROM trash_notes WHERE "+cond, args...); err != nil {
+		return errors.Wrap(err, "removing notes")
+	}
+
+	return nil
+}
+
+// emptyTrashedBook permanently deletes the trashed book with the notes trashed
+// along with it, logging a remove_note for each note because a remove_book for
+// the label may not reach a book that was renamed on other machines.
+func emptyTrashedBook(tx *sql.Tx, book TrashedBook) error {
+	rows, err := tx.Query("SELECT uuid FROM trash_notes WHERE book_uuid = ? AND with_book = ?", book.UUID, true)
+	if err != nil {
+		return errors.Wrap(err, "querying notes")
+	}
+	noteUUIDs := []string{}
+	for rows.Next() {
+		var uuid string
+		if err := rows.Scan(&uuid); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "scanning a row")
+		}
+		noteUUIDs = append(noteUUIDs, uuid)
+	}
+	rows.Close()
+
+	for _, uuid := range noteUUIDs {
+		if err := LogActionRemoveNote(tx, uuid, book.Label); err != nil {
+			return errors.Wrap(err, "logging the remove_note action")
+		}
+	}
+
+	var liveCount int
+	if err := tx.QueryRow("SELECT count(*) FROM books WHERE label = ?", book.Label).Scan(&liveCount); err != nil {
+		return errors.Wrap(err, "counting books")
+	}
+	if liveCount == 0 {
+		if err := LogActionRemoveBook(tx, book.Label); err != nil {
+			return errors.Wrap(err, "logging the remove_book action")
+		}
+	}
+
+	if err := purgeTrashedNotes(tx, "book_uuid = ? AND with_book = ?", book.UUID, true); err != nil {
+		return errors.Wrap(err, "deleting notes")
+	}
+	if _, err := tx.Exec("DELETE FROM trash_books WHERE uuid = ?", book.UUID); err != nil {
+		return errors.Wrap(err, "deleting the book")
+	}
+	if _, err := tx.Exec("DELETE FROM book_aliases WHERE book_uuid = ?", book.UUID); err != nil {
+		return errors.Wrap(err, "deleting the aliases of the book")
+	}
+	if _, err := tx.Exec("DELETE FROM remote_books WHERE book_uuid = ?", book.UUID); err != nil {
+		return errors.Wrap(err, "unassigning the book")
+	}
+
+	return nil
+}
+
+// EmptyTrash permanently deletes the notes and books that were moved to the
+// trash before the given timestamp and logs the actions to remove them on other
+// machines. It returns the number of deleted notes and books.
+func EmptyTrash(tx *sql.Tx, before int64) (int, int, error) {
+	var noteCount, bookCount int
+
+	rows, err := tx.Query(`SELECT trash_notes.uuid, coalesce(books.label, trash_books.label, '')
+		FROM trash_notes
+		LEFT JOIN books ON books.uuid = trash_notes.book_uuid
+		LEFT JOIN trash_books ON trash_books.uuid = trash_notes.book_uuid
+		WHERE trash_notes.trashed_on < ? AND trash_notes.with_book = ?`, before, false)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "querying trashed notes")
+	}
+	notes := []TrashedNote{}
+	for rows.Next() {
+		var n TrashedNote
+		if err := rows.Scan(&n.UUID, &n.BookLabel); err != nil {
+			rows.Close()
+			return 0, 0, errors.Wrap(err, "scanning a row")
+		}
+		notes = append(notes, n)
+	}
+	rows.Close()
+
+	for _, note := range notes {
+		// If the book no longer exists, it has been removed along with the note.
+		// The notes are emptied before the books so that the label is still known.
+		if note.BookLabel != "" {
+			if err := LogActionRemoveNote(tx, note.UUID, note.BookLabel); err != nil {
+				return 0, 0, errors.Wrap(err, "logging the remove_note action")
+			}
+		}
+
+		if err := purgeTrashedNotes(tx, "uuid = ?", note.UUID); err != nil {
+			return 0, 0, errors.Wrap(err, "deleting the note")
+		}
+
+		noteCount++
+	}
+
+	rows, err = tx.Query(`SELECT uuid, label, (SELECT count(*) FROM trash_notes WHERE trash_notes.book_uuid = trash_books.uuid AND trash_notes.with_book = ?)
+		FROM trash_books
+		WHERE trashed_on < ?`, true, before)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "querying trashed books")
+	}
+	books := []TrashedBook{}
+	for rows.Next() {
+		var b TrashedBook
+		if err := rows.Scan(&b.UUID, &b.Label, &b.NoteCount); err != nil {
+			rows.Close()
+			return 0, 0, errors.Wrap(err, "scanning a row")
+		}
+		books = append(books, b)
+	}
+	rows.Close()
+
+	for _, book := range books {
+		if err := emptyTrashedBook(tx, book); err != nil {
+			return 0, 0, errors.Wrapf(err, "emptying book '%s'", book.Label)
+		}
+
+		bookCount++
+		noteCount += book.NoteCount
+	}
+
+	return noteCount, bookCount, nil
+}
@@ -0,0 +1,196 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestRestoreNote(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	db := ctx.DB
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := TrashNote(tx, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", 1517629800); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the note"))
+	}
+	tx.Commit()
+
+	notes, err := GetTrashedNotes(db)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting trashed notes"))
+	}
+	testutils.AssertEqual(t, len(notes), 1, "trashed note count mismatch")
+	testutils.AssertEqual(t, notes[0].BookLabel, "js", "trashed note book label mismatch")
+
+	// Execute
+	tx, err = db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := RestoreNote(tx, notes[0].ID); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "restoring the note"))
+	}
+	tx.Commit()
+
+	// Test
+	var noteID, trashNoteCount int
+	testutils.MustScan(t, "scanning the note", db.QueryRow("SELECT id FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &noteID)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+
+	testutils.AssertEqual(t, noteID, 1, "restored note id mismatch")
+	testutils.AssertEqual(t, trashNoteCount, 0, "trashed note count mismatch")
+}
+
+func TestRestoreNote_TrashedBook(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	db := ctx.DB
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := TrashNote(tx, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", 1517629800); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the note"))
+	}
+	if err := TrashBook(tx, "js-book-uuid", 1517629805); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the book"))
+	}
+	tx.Commit()
+
+	var trashID int
+	testutils.MustScan(t, "scanning the trash id", db.QueryRow("SELECT id FROM trash_notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &trashID)
+
+	// Execute
+	tx, err = db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	err = RestoreNote(tx, trashID)
+	tx.Rollback()
+
+	// Test
+	if err == nil {
+		t.Fatal("expected an error restoring a note of a trashed book")
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	db := ctx.DB
+	testutils.MustExec(t, "setting up revision", db, "INSERT INTO note_revisions (note_uuid, content, created_on) VALUES (?, ?, ?)", "3e065d55-6d47-42f2-a6bf-f5844130b2d2", "wc to count", 1515199950)
+
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := TrashNote(tx, "3e065d55-6d47-42f2-a6bf-f5844130b2d2", 1517629800); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the note"))
+	}
+	if err := TrashBook(tx, "js-book-uuid", 1517629900); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the book"))
+	}
+	tx.Commit()
+
+	// Execute
+	tx, err = db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	noteCount, bookCount, err := EmptyTrash(tx, 1517629850)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "emptying the trash"))
+	}
+	tx.Commit()
+
+	// Test
+	testutils.AssertEqual(t, noteCount, 1, "deleted note count mismatch")
+	testutils.AssertEqual(t, bookCount, 0, "deleted book count mismatch")
+
+	var trashNoteCount, trashBookCount, revisionCount, actionCount int
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+	testutils.MustScan(t, "counting trashed books", db.QueryRow("SELECT count(*) FROM trash_books"), &trashBookCount)
+	testutils.MustScan(t, "counting revisions", db.QueryRow("SELECT count(*) FROM note_revisions"), &revisionCount)
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+
+	testutils.AssertEqual(t, trashNoteCount, 2, "trashed note count mismatch")
+	testutils.AssertEqual(t, trashBookCount, 1, "trashed book count mismatch")
+	testutils.AssertEqual(t, revisionCount, 0, "revision count mismatch")
+	testutils.AssertEqual(t, actionCount, 1, "action count mismatch")
+
+	var actionType string
+	testutils.MustScan(t, "scanning the action", db.QueryRow("SELECT type FROM actions"), &actionType)
+	testutils.AssertEqual(t, actionType, actions.ActionRemoveNote, "action type mismatch")
+}
+
+func TestEmptyTrash_BookWithTrashedNote(t *testing.T) {
+	// Setup
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	db := ctx.DB
+	tx, err := db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	if err := TrashNote(tx, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", 1517629900); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the note"))
+	}
+	if err := TrashBook(tx, "js-book-uuid", 1517629800); err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "trashing the book"))
+	}
+	tx.Commit()
+
+	// Execute
+	tx, err = db.Begin()
+	if err != nil {
+		panic(errors.Wrap(err, "beginning a transaction"))
+	}
+	noteCount, bookCount, err := EmptyTrash(tx, 1517629850)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(errors.Wrap(err, "emptying the trash"))
+	}
+	tx.Commit()
+
+	// Test that the note trashed on its own after the cutoff is kept
+	testutils.AssertEqual(t, noteCount, 1, "deleted note count mismatch")
+	testutils.AssertEqual(t, bookCount, 1, "deleted book count mismatch")
+
+	var trashNoteUUID string
+	var trashNoteCount int
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+	testutils.MustScan(t, "getting the trashed note", db.QueryRow("SELECT uuid FROM trash_notes"), &trashNoteUUID)
+
+	testutils.AssertEqual(t, trashNoteCount, 1, "trashed note count mismatch")
+	testutils.AssertEqual(t, trashNoteUUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "trashed note mismatch")
+}
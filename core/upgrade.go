@@ -2,7 +2,6 @@ package core
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/dnote/cli/infra"
@@ -81,7 +80,7 @@ func CheckUpdate(ctx infra.DnoteCtx) error {
 		return errors.Wrap(err, "updating the last upgrade timestamp")
 	}
 
-	fmt.Printf("\n")
+	log.Raw("\n")
 	willCheck, err := utils.AskConfirmation("check for upgrade?", true)
 	if err != nil {
 		return errors.Wrap(err, "getting user confirmation")
@@ -0,0 +1,55 @@
+package infra
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	// KeyLength is the length of the keys derived from passphrases
+	KeyLength = 32
+	// SaltLength is the length of the salts for deriving keys
+	SaltLength = 16
+
+	kdfIterations = 100000
+)
+
+// pbkdf2 derives a key from the password and the salt using PBKDF2 with
+// HMAC-SHA256 as defined in RFC 8018
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	ret := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:4])
+		t := prf.Sum(nil)
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+
+		ret = append(ret, t...)
+	}
+
+	return ret[:keyLen]
+}
+
+// DeriveKey derives a key from the passphrase and the salt
+func DeriveKey(passphrase string, salt []byte) []byte {
+	return pbkdf2([]byte(passphrase), salt, kdfIterations, KeyLength)
+}
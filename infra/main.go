@@ -11,6 +11,8 @@ import (
 	// use sqlite
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/dnote/cli/term"
+	"github.com/dnote/cli/utils"
 	"github.com/pkg/errors"
 )
 
@@ -26,12 +28,35 @@ type DnoteCtx struct {
 	APIEndpoint string
 	Version     string
 	DB          *sql.DB
+	// KeepEncrypted makes the reducer keep encrypted contents as they are. The
+	// sync server does not have the keys to decrypt them.
+	KeepEncrypted bool
+	// Store is the database encrypted at rest, if the database is encrypted
+	Store *Store
 }
 
 // Config holds dnote configuration
 type Config struct {
-	Editor string
-	APIKey string
+	Editor   string
+	APIKey   string
+	Endpoint string
+	// Picker is the command picking a line from the candidates in stdin, such
+	// as fzf. The built-in picker is used if it is empty.
+	Picker string `yaml:"picker,omitempty"`
+	// SyncReviews makes 'dnote review' log the reviews as actions so that the
+	// review schedule is synced across the machines
+	SyncReviews bool `yaml:"sync_reviews,omitempty"`
+	// EncryptionKeys are the keys derived from the passphrases for encrypting
+	// the synced contents. The last one is the current key.
+	EncryptionKeys []EncryptionKey `yaml:"encryption_keys,omitempty"`
+}
+
+// EncryptionKey is a key derived from a passphrase and a salt
+type EncryptionKey struct {
+	// Salt identifies the key. It is base64 encoded.
+	Salt string `yaml:"salt"`
+	// Key is base64 encoded
+	Key string `yaml:"key"`
 }
 
 // Dnote holds the whole dnote data
@@ -69,10 +94,23 @@ func NewCtx(apiEndpoint, versionTag string) (DnoteCtx, error) {
 	}
 	dnoteDir := getDnoteDir(homeDir)
 
-	dnoteDBPath := fmt.Sprintf("%s/dnote.db", dnoteDir)
-	db, err := sql.Open("sqlite3", dnoteDBPath)
-	if err != nil {
-		return DnoteCtx{}, errors.Wrap(err, "conntecting to db")
+	var db *sql.DB
+	var store *Store
+	if encPath := GetEncryptedDBPath(dnoteDir); utils.FileExists(encPath) {
+		passphrase, err := getPassphrase()
+		if err != nil {
+			return DnoteCtx{}, errors.Wrap(err, "getting the passphrase")
+		}
+
+		db, store, err = openStore(encPath, passphrase)
+		if err != nil {
+			return DnoteCtx{}, errors.Wrap(err, "unlocking the database")
+		}
+	} else {
+		db, err = sql.Open("sqlite3", GetDBPath(dnoteDir))
+		if err != nil {
+			return DnoteCtx{}, errors.Wrap(err, "conntecting to db")
+		}
 	}
 
 	ret := DnoteCtx{
@@ -81,11 +119,38 @@ func NewCtx(apiEndpoint, versionTag string) (DnoteCtx, error) {
 		APIEndpoint: apiEndpoint,
 		Version:     versionTag,
 		DB:          db,
+		Store:       store,
 	}
 
 	return ret, nil
 }
 
+// promptPassphrase is false if the passphrase must not be asked for
+var promptPassphrase = true
+
+// DisablePassphrasePrompt makes NewCtx return ErrLocked instead of asking for the
+// passphrase of the encrypted database if it is not in the environment
+func DisablePassphrasePrompt() {
+	promptPassphrase = false
+}
+
+// getPassphrase returns the passphrase unlocking the encrypted database from
+// the environment, or asks for it on the terminal
+func getPassphrase() (string, error) {
+	if passphrase := os.Getenv("DNOTE_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if !promptPassphrase {
+		return "", ErrLocked
+	}
+	// The input piped to the command must not be taken for the passphrase
+	if !utils.IsStdinTerminal() {
+		return "", ErrNoTerminal
+	}
+
+	return term.AskPassphrase("passphrase for the database", false)
+}
+
 func getDnoteDir(homeDir string) string {
 	var ret string
 
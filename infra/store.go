@@ -0,0 +1,666 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+)
+
+// encryptedDBHeader marks a database encrypted at rest. It is followed by the
+// salt of the key, the nonce and the sealed dump of the database.
+var encryptedDBHeader = []byte("DNOTEDB1")
+
+// memoryDriver is the driver for the decrypted copies of encrypted databases.
+// The copy is shared by the connections in the pool so that a connection can
+// read a table written by another in an ongoing transaction, as it can with a
+// database in a file.
+const memoryDriver = "sqlite3_dnote_memory"
+
+func init() {
+	sql.Register(memoryDriver, &storeDriver{
+		SQLiteDriver: sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				_, err := conn.Exec("PRAGMA read_uncommitted = true", nil)
+				return err
+			},
+		},
+	})
+}
+
+var (
+	// stores are the open stores keyed by the data source name of their copy
+	stores     = map[string]*Store{}
+	storesLock sync.Mutex
+)
+
+// getStore returns the store of the copy with the data source name, if any
+func getStore(dsn string) (*Store, bool) {
+	storesLock.Lock()
+	defer storesLock.Unlock()
+
+	store, ok := stores[dsn]
+	return store, ok
+}
+
+// persist saves the store of the copy with the data source name, if any
+func persist(dsn string) error {
+	store, ok := getStore(dsn)
+	if !ok {
+		return nil
+	}
+
+	store.markDirty()
+	if err := store.save(store.db); err != nil {
+		return errors.Wrap(err, "saving the encrypted database")
+	}
+
+	return nil
+}
+
+// storeDriver opens the copies of encrypted databases. A copy is saved to its
+// file after every committed transaction so that a crash does not lose what was
+// committed. A write outside of a transaction is saved along with the next
+// transaction or when the store is closed, so that a command writing row by row
+// does not encrypt the whole database after each row.
+type storeDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *storeDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storeConn{SQLiteConn: conn.(*sqlite3.SQLiteConn), dsn: dsn}, nil
+}
+
+type storeConn struct {
+	*sqlite3.SQLiteConn
+	dsn string
+}
+
+func (c *storeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.AutoCommit() {
+		if store, ok := getStore(c.dsn); ok {
+			store.markDirty()
+		}
+	}
+
+	return res, nil
+}
+
+func (c *storeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.SQLiteConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storeTx{Tx: tx, dsn: c.dsn}, nil
+}
+
+type storeTx struct {
+	driver.Tx
+	dsn string
+}
+
+func (tx *storeTx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		return err
+	}
+
+	return persist(tx.dsn)
+}
+
+// ErrWrongPassphrase is returned when an encrypted database cannot be decrypted
+// with the given passphrase
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// ErrLocked is returned when the database is encrypted and the passphrase cannot
+// be asked for
+var ErrLocked = errors.New("the database is encrypted")
+
+// ErrNoTerminal is returned when the database is encrypted, the passphrase is
+// not in the environment and the input is not a terminal to ask for it on
+var ErrNoTerminal = errors.New("the input is not a terminal")
+
+// Store is a database encrypted at rest. It is decrypted into memory when dnote
+// starts and encrypted back to the file whenever a change is committed. The
+// file is locked while it is open so that dnote processes do not overwrite the
+// changes of one another.
+type Store struct {
+	Path string
+	salt []byte
+	key  []byte
+	dsn  string
+	db   *sql.DB
+	// dump is the content of the database when it was last saved
+	dump string
+	// conn keeps the database in memory alive while the pool has no connection
+	conn      *sql.Conn
+	discarded bool
+	// dirty is true if the database has been written since it was last saved
+	dirty bool
+	// lock serializes the saves
+	lock sync.Mutex
+}
+
+// GetDBPath returns the path to the database
+func GetDBPath(dnoteDir string) string {
+	return fmt.Sprintf("%s/dnote.db", dnoteDir)
+}
+
+// GetEncryptedDBPath returns the path to the database encrypted at rest
+func GetEncryptedDBPath(dnoteDir string) string {
+	return fmt.Sprintf("%s/dnote.db.enc", dnoteDir)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing the cipher")
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// getLockPath returns the path to the file locking the database encrypted at
+// rest
+func getLockPath(path string) string {
+	return fmt.Sprintf("%s.lock", path)
+}
+
+// processExists returns true if a process with the pid is running
+func processExists(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Finding a process on windows fails if it is not running
+	if runtime.GOOS == "windows" {
+		return true
+	}
+
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// lockStore creates the lock file of the database at the path. The lock file
+// holds the pid so that a lock left by a process that was killed is taken over.
+func lockStore(path string) error {
+	lockPath := getLockPath(path)
+
+	// The lock file is linked with its content at once so that another process
+	// never reads it empty
+	tmpPath := fmt.Sprintf("%s.%d", lockPath, os.Getpid())
+	if err := ioutil.WriteFile(tmpPath, []byte(strconv.Itoa(os.Getpid())), 0600); err != nil {
+		return errors.Wrap(err, "writing the lock file")
+	}
+	defer os.Remove(tmpPath)
+
+	for i := 0; i < 2; i++ {
+		err := os.Link(tmpPath, lockPath)
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) {
+			return errors.Wrap(err, "creating the lock file")
+		}
+
+		b, err := ioutil.ReadFile(lockPath)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "reading the lock file")
+		}
+		if pid, err := strconv.Atoi(string(b)); err == nil && pid != os.Getpid() && processExists(pid) {
+			return errors.Errorf("the database is in use by another dnote process (pid %d). if it is not running, remove %s", pid, lockPath)
+		}
+
+		if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "removing the stale lock file")
+		}
+	}
+
+	return errors.New("the database is in use by another dnote process")
+}
+
+// writeEncrypted encrypts the dump with the key and writes it to the path. The
+// file is replaced at once so that it is never left half written.
+func writeEncrypted(path string, salt, key []byte, dump string) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return errors.Wrap(err, "initializing the cipher")
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "generating a nonce")
+	}
+
+	var b bytes.Buffer
+	b.Write(encryptedDBHeader)
+	b.Write(salt)
+	b.Write(gcm.Seal(nonce, nonce, []byte(dump), encryptedDBHeader))
+
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "opening the file")
+	}
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing the file")
+	}
+	// The content must be on the disk before the file replaces the old one
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrap(err, "syncing the file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "closing the file")
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "replacing the file")
+	}
+
+	return nil
+}
+
+// readEncrypted decrypts the file at the path and returns the dump with the salt
+// and the key derived from the passphrase
+func readEncrypted(path, passphrase string) (string, []byte, []byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, nil, errors.Wrap(err, "reading the file")
+	}
+
+	if !bytes.HasPrefix(b, encryptedDBHeader) || len(b) < len(encryptedDBHeader)+SaltLength {
+		return "", nil, nil, errors.New("not an encrypted database")
+	}
+	b = b[len(encryptedDBHeader):]
+	salt, sealed := b[:SaltLength], b[SaltLength:]
+
+	key := DeriveKey(passphrase, salt)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", nil, nil, errors.Wrap(err, "initializing the cipher")
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", nil, nil, errors.New("the encrypted database is truncated")
+	}
+
+	nonce := sealed[:gcm.NonceSize()]
+	dump, err := gcm.Open(nil, nonce, sealed[gcm.NonceSize():], encryptedDBHeader)
+	if err != nil {
+		return "", nil, nil, ErrWrongPassphrase
+	}
+
+	return string(dump), salt, key, nil
+}
+
+// EncryptDB writes the database encrypted with a key derived from the
+// passphrase to the path
+func EncryptDB(db *sql.DB, path, passphrase string) error {
+	dump, err := dumpDB(db)
+	if err != nil {
+		return errors.Wrap(err, "dumping the database")
+	}
+
+	salt := make([]byte, SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return errors.Wrap(err, "generating a salt")
+	}
+
+	if err := writeEncrypted(path, salt, DeriveKey(passphrase, salt), dump); err != nil {
+		return errors.Wrap(err, "writing the encrypted database")
+	}
+
+	return nil
+}
+
+// WriteDB writes the database to a new file at the path
+func WriteDB(db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return errors.Errorf("%s already exists", path)
+	}
+
+	dump, err := dumpDB(db)
+	if err != nil {
+		return errors.Wrap(err, "dumping the database")
+	}
+
+	tmpPath := fmt.Sprintf("%s.tmp", path)
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return errors.Wrap(err, "removing the leftover file")
+	}
+
+	dest, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "opening the file")
+	}
+	if _, err := dest.Exec(dump); err != nil {
+		dest.Close()
+		return errors.Wrap(err, "restoring the dump")
+	}
+	if err := dest.Close(); err != nil {
+		return errors.Wrap(err, "closing the file")
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return errors.Wrap(err, "moving the file")
+	}
+
+	return nil
+}
+
+// openStore locks the database at the path and decrypts it into memory
+func openStore(path, passphrase string) (*sql.DB, *Store, error) {
+	if err := lockStore(path); err != nil {
+		return nil, nil, err
+	}
+
+	db, store, err := restoreStore(path, passphrase)
+	if err != nil {
+		os.Remove(getLockPath(path))
+		return nil, nil, err
+	}
+
+	storesLock.Lock()
+	stores[store.dsn] = store
+	storesLock.Unlock()
+
+	return db, store, nil
+}
+
+// restoreStore decrypts the database at the path into memory
+func restoreStore(path, passphrase string) (*sql.DB, *Store, error) {
+	dump, salt, key, err := readEncrypted(path, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := make([]byte, 8)
+	if _, err := rand.Read(name); err != nil {
+		return nil, nil, errors.Wrap(err, "generating a name")
+	}
+
+	dsn := fmt.Sprintf("file:dnote-%s?mode=memory&cache=shared", hex.EncodeToString(name))
+	db, err := sql.Open(memoryDriver, dsn)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "opening the database in memory")
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, nil, errors.Wrap(err, "connecting to the database in memory")
+	}
+	if _, err := conn.ExecContext(context.Background(), dump); err != nil {
+		conn.Close()
+		db.Close()
+		return nil, nil, errors.Wrap(err, "restoring the dump")
+	}
+
+	// Dump the restored database again to compare with when saving, because the
+	// schema can be listed in a different order from the original
+	restored, err := dumpDB(db)
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, nil, errors.Wrap(err, "dumping the restored database")
+	}
+
+	store := &Store{
+		Path: path,
+		salt: salt,
+		key:  key,
+		dsn:  dsn,
+		db:   db,
+		dump: restored,
+		conn: conn,
+	}
+
+	return db, store, nil
+}
+
+// Discard makes the store leave the file as it is from now on
+func (s *Store) Discard() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.discarded = true
+}
+
+// markDirty records that the database has been written
+func (s *Store) markDirty() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.dirty = true
+}
+
+// save encrypts the database back to the file if it has been written
+func (s *Store) save(db *sql.DB) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.discarded || !s.dirty {
+		return nil
+	}
+
+	dump, err := dumpDB(db)
+	if err != nil {
+		return errors.Wrap(err, "dumping the database")
+	}
+	if dump == s.dump {
+		s.dirty = false
+		return nil
+	}
+
+	if err := writeEncrypted(s.Path, s.salt, s.key, dump); err != nil {
+		return errors.Wrap(err, "writing the encrypted database")
+	}
+	s.dump = dump
+	s.dirty = false
+
+	return nil
+}
+
+// CloseCtx releases the context. A database encrypted at rest is saved and
+// unlocked.
+func CloseCtx(ctx DnoteCtx) error {
+	if ctx.Store != nil {
+		storesLock.Lock()
+		delete(stores, ctx.Store.dsn)
+		storesLock.Unlock()
+
+		if err := ctx.Store.save(ctx.DB); err != nil {
+			return errors.Wrap(err, "saving the encrypted database")
+		}
+
+		ctx.Store.conn.Close()
+		if err := os.Remove(getLockPath(ctx.Store.Path)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "removing the lock file")
+		}
+	}
+
+	return ctx.DB.Close()
+}
+
+// quoteIdent quotes an SQL identifier
+func quoteIdent(s string) string {
+	return fmt.Sprintf(`"%s"`, strings.Replace(s, `"`, `""`, -1))
+}
+
+type schemaEntry struct {
+	kind string
+	name string
+	sql  string
+}
+
+// dumpDB returns the SQL statements recreating the database. The tables are
+// created and filled before the indices and the triggers so that the triggers
+// do not fire while restoring the rows. The full-text search indices are then
+// rebuilt from the restored tables instead of being dumped.
+func dumpDB(db *sql.DB) (string, error) {
+	rows, err := db.Query("SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY rowid")
+	if err != nil {
+		return "", errors.Wrap(err, "querying the schema")
+	}
+
+	entries := []schemaEntry{}
+	for rows.Next() {
+		var e schemaEntry
+		if err := rows.Scan(&e.kind, &e.name, &e.sql); err != nil {
+			rows.Close()
+			return "", errors.Wrap(err, "scanning a row")
+		}
+
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", errors.Wrap(err, "scanning rows")
+	}
+
+	var tables, virtualTables, rest []schemaEntry
+	for _, e := range entries {
+		if e.kind != "table" {
+			rest = append(rest, e)
+			continue
+		}
+
+		if strings.HasPrefix(strings.ToUpper(e.sql), "CREATE VIRTUAL TABLE") {
+			virtualTables = append(virtualTables, e)
+			continue
+		}
+
+		// The shadow tables of a virtual table are created along with it
+		var shadow bool
+		for _, vt := range virtualTables {
+			if strings.HasPrefix(e.name, vt.name+"_") {
+				shadow = true
+			}
+		}
+		if !shadow {
+			tables = append(tables, e)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("BEGIN;\n")
+
+	for _, e := range tables {
+		if e.name == "sqlite_sequence" {
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s;\n", e.sql)
+	}
+	for _, e := range virtualTables {
+		fmt.Fprintf(&b, "%s;\n", e.sql)
+	}
+
+	var hasSequence bool
+	for _, e := range tables {
+		if e.name == "sqlite_sequence" {
+			hasSequence = true
+			continue
+		}
+
+		if err := dumpRows(db, &b, e.name); err != nil {
+			return "", errors.Wrapf(err, "dumping %s", e.name)
+		}
+	}
+
+	// Restoring the rows advances the sequences of the autoincrement columns
+	// only as far as the largest restored values
+	if hasSequence {
+		b.WriteString("DELETE FROM sqlite_sequence;\n")
+		if err := dumpRows(db, &b, "sqlite_sequence"); err != nil {
+			return "", errors.Wrap(err, "dumping sqlite_sequence")
+		}
+	}
+
+	for _, e := range rest {
+		fmt.Fprintf(&b, "%s;\n", e.sql)
+	}
+	for _, e := range virtualTables {
+		fmt.Fprintf(&b, "INSERT INTO %s(%s) VALUES ('rebuild');\n", quoteIdent(e.name), quoteIdent(e.name))
+	}
+
+	b.WriteString("COMMIT;\n")
+
+	return b.String(), nil
+}
+
+// dumpRows writes the statements inserting the rows of the table
+func dumpRows(db *sql.DB, b *bytes.Buffer, table string) error {
+	colRows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", quoteIdent(table)))
+	if err != nil {
+		return errors.Wrap(err, "querying the columns")
+	}
+
+	var cols, quoted []string
+	for colRows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := colRows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			colRows.Close()
+			return errors.Wrap(err, "scanning a column")
+		}
+
+		cols = append(cols, quoteIdent(name))
+		quoted = append(quoted, fmt.Sprintf("quote(%s)", quoteIdent(name)))
+	}
+	colRows.Close()
+	if err := colRows.Err(); err != nil {
+		return errors.Wrap(err, "scanning columns")
+	}
+
+	// quote() returns each value as an SQL literal
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), quoteIdent(table)))
+	if err != nil {
+		return errors.Wrap(err, "querying the rows")
+	}
+	defer rows.Close()
+
+	values := make([]string, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return errors.Wrap(err, "scanning a row")
+		}
+
+		fmt.Fprintf(b, "INSERT INTO %s (%s) VALUES (%s);\n", quoteIdent(table), strings.Join(cols, ", "), strings.Join(values, ", "))
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "scanning rows")
+	}
+
+	return nil
+}
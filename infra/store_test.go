@@ -0,0 +1,214 @@
+package infra
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func setupStoreTest(t *testing.T) (string, *sql.DB) {
+	dir, err := ioutil.TempDir("", "dnote-store")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+
+	db, err := sql.Open("sqlite3", GetDBPath(dir))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the database"))
+	}
+
+	_, err = db.Exec(`CREATE TABLE notes (id integer PRIMARY KEY AUTOINCREMENT, content text NOT NULL, public bool DEFAULT false);
+		CREATE VIRTUAL TABLE note_fts USING fts5(content, content=notes, content_rowid=id);
+		CREATE TRIGGER notes_after_insert AFTER INSERT ON notes BEGIN
+			INSERT INTO note_fts(rowid, content) VALUES (new.id, new.content);
+		END;
+		CREATE INDEX idx_notes_public ON notes(public);
+		INSERT INTO notes (content, public) VALUES ('it''s a note', true);
+		INSERT INTO notes (content) VALUES ('merge sort');
+		INSERT INTO notes (content) VALUES ('removed');
+		DELETE FROM notes WHERE id = 3;`)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "setting up the database"))
+	}
+
+	return dir, db
+}
+
+func TestStore(t *testing.T) {
+	dir, plainDB := setupStoreTest(t)
+	defer os.RemoveAll(dir)
+	defer plainDB.Close()
+
+	path := GetEncryptedDBPath(dir)
+	if err := EncryptDB(plainDB, path, "secret"); err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting"))
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the file"))
+	}
+	for _, s := range []string{"merge sort", "CREATE TABLE"} {
+		if bytes.Contains(b, []byte(s)) {
+			t.Errorf("%s is in the encrypted file", s)
+		}
+	}
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		_, _, err := openStore(path, "wrong")
+		if err != ErrWrongPassphrase {
+			t.Errorf("error mismatch. got %v", err)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		db, store, err := openStore(path, "secret")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "opening the store"))
+		}
+
+		// Use several connections as a command would
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "beginning a transaction"))
+		}
+		if _, err := tx.Exec("INSERT INTO notes (content) VALUES (?)", "quick sort"); err != nil {
+			t.Fatal(errors.Wrap(err, "inserting a note"))
+		}
+		var count int
+		if err := db.QueryRow("SELECT count(*) FROM notes").Scan(&count); err != nil {
+			t.Fatal(errors.Wrap(err, "counting notes"))
+		}
+		tx.Commit()
+
+		// The committed change is saved before dnote exits
+		dump, _, _, err := readEncrypted(path, "secret")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the saved database"))
+		}
+		if !strings.Contains(dump, "quick sort") {
+			t.Error("the committed note is not saved")
+		}
+
+		// A write outside of a transaction waits for the store to be closed
+		if _, err := db.Exec("INSERT INTO notes (content) VALUES (?)", "heap sort"); err != nil {
+			t.Fatal(errors.Wrap(err, "inserting a note outside of a transaction"))
+		}
+		dump, _, _, err = readEncrypted(path, "secret")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "reading the saved database"))
+		}
+		if strings.Contains(dump, "heap sort") {
+			t.Error("the database is saved after a write outside of a transaction")
+		}
+
+		if err := CloseCtx(DnoteCtx{DB: db, Store: store}); err != nil {
+			t.Fatal(errors.Wrap(err, "closing"))
+		}
+
+		db, store, err = openStore(path, "secret")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "opening the store again"))
+		}
+		defer CloseCtx(DnoteCtx{DB: db, Store: store})
+
+		var id int
+		var content string
+		var public bool
+		if err := db.QueryRow("SELECT id, content, public FROM notes WHERE id = 1").Scan(&id, &content, &public); err != nil {
+			t.Fatal(errors.Wrap(err, "getting a note"))
+		}
+		if content != "it's a note" || !public {
+			t.Errorf("note mismatch. got %s %t", content, public)
+		}
+
+		if err := db.QueryRow("SELECT id FROM notes WHERE content = ?", "quick sort").Scan(&id); err != nil {
+			t.Fatal(errors.Wrap(err, "getting the new note"))
+		}
+		if id != 4 {
+			t.Errorf("id mismatch. got %d, expected 4", id)
+		}
+		if err := db.QueryRow("SELECT id FROM notes WHERE content = ?", "heap sort").Scan(&id); err != nil {
+			t.Fatal(errors.Wrap(err, "getting the note inserted outside of a transaction"))
+		}
+
+		if err := db.QueryRow("SELECT rowid FROM note_fts WHERE note_fts MATCH ?", "merge").Scan(&id); err != nil {
+			t.Fatal(errors.Wrap(err, "searching notes"))
+		}
+		if id != 2 {
+			t.Errorf("search result mismatch. got %d, expected 2", id)
+		}
+
+		t.Run("write", func(t *testing.T) {
+			outPath := filepath.Join(dir, "decrypted.db")
+			if err := WriteDB(db, outPath); err != nil {
+				t.Fatal(errors.Wrap(err, "writing the database"))
+			}
+
+			out, err := sql.Open("sqlite3", outPath)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "opening the written database"))
+			}
+			defer out.Close()
+
+			if err := out.QueryRow("SELECT count(*) FROM notes").Scan(&count); err != nil {
+				t.Fatal(errors.Wrap(err, "counting notes"))
+			}
+			if count != 4 {
+				t.Errorf("note count mismatch. got %d, expected 4", count)
+			}
+		})
+	})
+}
+
+func TestStore_Lock(t *testing.T) {
+	dir, plainDB := setupStoreTest(t)
+	defer os.RemoveAll(dir)
+	defer plainDB.Close()
+
+	path := GetEncryptedDBPath(dir)
+	if err := EncryptDB(plainDB, path, "secret"); err != nil {
+		t.Fatal(errors.Wrap(err, "encrypting"))
+	}
+
+	t.Run("held by a running process", func(t *testing.T) {
+		if err := ioutil.WriteFile(getLockPath(path), []byte(strconv.Itoa(os.Getppid())), 0600); err != nil {
+			t.Fatal(errors.Wrap(err, "writing the lock file"))
+		}
+		defer os.Remove(getLockPath(path))
+
+		if _, _, err := openStore(path, "secret"); err == nil {
+			t.Error("expected the store to be locked")
+		}
+	})
+
+	t.Run("left by an exited process", func(t *testing.T) {
+		cmd := exec.Command("true")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(errors.Wrap(err, "running a process"))
+		}
+		if err := ioutil.WriteFile(getLockPath(path), []byte(strconv.Itoa(cmd.Process.Pid)), 0600); err != nil {
+			t.Fatal(errors.Wrap(err, "writing the lock file"))
+		}
+
+		db, store, err := openStore(path, "secret")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "opening the store"))
+		}
+		if err := CloseCtx(DnoteCtx{DB: db, Store: store}); err != nil {
+			t.Fatal(errors.Wrap(err, "closing"))
+		}
+
+		if _, err := os.Stat(getLockPath(path)); !os.IsNotExist(err) {
+			t.Error("the lock file is not removed")
+		}
+	})
+}
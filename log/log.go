@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/fatih/color"
@@ -17,49 +18,78 @@ var (
 
 var indent = "  "
 
+// out is where the messages are printed
+var out io.Writer = color.Output
+
+// plain is true if the messages are printed without colors, bullets and indentation
+var plain bool
+
+// SetPlain prints the messages to stderr without colors, bullets and
+// indentation, leaving stdout to a structured output read by other programs
+func SetPlain() {
+	plain = true
+	indent = ""
+	color.NoColor = true
+	out = os.Stderr
+}
+
+// bullet returns the bullet to prefix a message with
+func bullet(s string) string {
+	if plain {
+		return ""
+	}
+
+	return fmt.Sprintf("%s ", s)
+}
+
 func Info(msg string) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfBlue("•"), msg)
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfBlue("•")), msg)
 }
 
 func Infof(msg string, v ...interface{}) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfBlue("•"), fmt.Sprintf(msg, v...))
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfBlue("•")), fmt.Sprintf(msg, v...))
 }
 
 func Success(msg string) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfGreen("✔"), msg)
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfGreen("✔")), msg)
 }
 
 func Successf(msg string, v ...interface{}) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfGreen("✔"), fmt.Sprintf(msg, v...))
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfGreen("✔")), fmt.Sprintf(msg, v...))
 }
 
 func Plain(msg string) {
-	fmt.Printf("%s%s", indent, msg)
+	fmt.Fprintf(out, "%s%s", indent, msg)
+}
+
+// Raw prints the message without indentation, such as to finish a line
+func Raw(msg string) {
+	fmt.Fprint(out, msg)
 }
 
 func Plainf(msg string, v ...interface{}) {
-	fmt.Fprintf(color.Output, "%s%s", indent, fmt.Sprintf(msg, v...))
+	fmt.Fprintf(out, "%s%s", indent, fmt.Sprintf(msg, v...))
 }
 
 func Warnf(msg string, v ...interface{}) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfRed("•"), fmt.Sprintf(msg, v...))
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfRed("•")), fmt.Sprintf(msg, v...))
 }
 
 func Error(msg string) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfRed("⨯"), msg)
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfRed("⨯")), msg)
 }
 
 func Errorf(msg string, v ...interface{}) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfRed("⨯"), fmt.Sprintf(msg, v...))
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfRed("⨯")), fmt.Sprintf(msg, v...))
 }
 
 func Printf(msg string, v ...interface{}) {
-	fmt.Fprintf(color.Output, "%s%s %s", indent, SprintfGray("•"), fmt.Sprintf(msg, v...))
+	fmt.Fprintf(out, "%s%s%s", indent, bullet(SprintfGray("•")), fmt.Sprintf(msg, v...))
 }
 
 // Debug prints to the console if DNOTE_DEBUG is set
 func Debug(msg string, v ...interface{}) {
 	if os.Getenv("DNOTE_DEBUG") == "1" {
-		fmt.Fprintf(color.Output, "%s %s", SprintfGray("DEBUG:"), fmt.Sprintf(msg, v...))
+		fmt.Fprintf(out, "%s %s", SprintfGray("DEBUG:"), fmt.Sprintf(msg, v...))
 	}
 }
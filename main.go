@@ -6,18 +6,39 @@ import (
 	"github.com/dnote/cli/cmd/root"
 	"github.com/dnote/cli/infra"
 	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/migrate"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
 
 	// commands
 	"github.com/dnote/cli/cmd/add"
 	"github.com/dnote/cli/cmd/cat"
+	"github.com/dnote/cli/cmd/completion"
+	"github.com/dnote/cli/cmd/conflicts"
+	"github.com/dnote/cli/cmd/decrypt"
 	"github.com/dnote/cli/cmd/edit"
+	"github.com/dnote/cli/cmd/encrypt"
+	"github.com/dnote/cli/cmd/export"
+	"github.com/dnote/cli/cmd/find"
+	"github.com/dnote/cli/cmd/history"
+	"github.com/dnote/cli/cmd/importer"
+	"github.com/dnote/cli/cmd/keys"
 	"github.com/dnote/cli/cmd/login"
 	"github.com/dnote/cli/cmd/ls"
+	"github.com/dnote/cli/cmd/mv"
+	"github.com/dnote/cli/cmd/publish"
 
+	"github.com/dnote/cli/cmd/remote"
 	"github.com/dnote/cli/cmd/remove"
+	"github.com/dnote/cli/cmd/resolve"
+	"github.com/dnote/cli/cmd/restore"
+	"github.com/dnote/cli/cmd/review"
+	"github.com/dnote/cli/cmd/serve"
+	"github.com/dnote/cli/cmd/site"
 	"github.com/dnote/cli/cmd/sync"
+	"github.com/dnote/cli/cmd/trash"
+	"github.com/dnote/cli/cmd/tui"
+	"github.com/dnote/cli/cmd/unpublish"
 	"github.com/dnote/cli/cmd/version"
 	"github.com/dnote/cli/cmd/view"
 )
@@ -27,13 +48,28 @@ var apiEndpoint string
 var versionTag = "master"
 
 func main() {
+	// The completion runs on every key press and must not wait for a passphrase
+	if completion.IsCompleting(os.Args) {
+		infra.DisablePassphrasePrompt()
+	}
+
 	ctx, err := infra.NewCtx(apiEndpoint, versionTag)
-	if err != nil {
+	if errors.Cause(err) == infra.ErrLocked {
+		os.Exit(0)
+	} else if errors.Cause(err) == infra.ErrWrongPassphrase {
+		log.Error("wrong passphrase for the database\n")
+		os.Exit(1)
+	} else if errors.Cause(err) == infra.ErrNoTerminal {
+		log.Error("the database is encrypted. to unlock it when the input is not a terminal, set DNOTE_PASSPHRASE\n")
+		os.Exit(1)
+	} else if err != nil {
 		panic(errors.Wrap(err, "initializing context"))
 	}
-	defer ctx.DB.Close()
 
-	if err := root.Prepare(ctx); err != nil {
+	if err := root.Prepare(ctx); errors.Cause(err) == migrate.ErrNoFTS5 {
+		log.Error("dnote was built without the full-text search extension of SQLite. build it with `go build --tags \"fts5\"`\n")
+		os.Exit(1)
+	} else if err != nil {
 		panic(errors.Wrap(err, "preparing dnote run"))
 	}
 
@@ -46,9 +82,37 @@ func main() {
 	root.Register(version.NewCmd(ctx))
 	root.Register(cat.NewCmd(ctx))
 	root.Register(view.NewCmd(ctx))
+	root.Register(find.NewCmd(ctx))
+	root.Register(history.NewCmd(ctx))
+	root.Register(restore.NewCmd(ctx))
+	root.Register(trash.NewCmd(ctx))
+	root.Register(mv.NewCmd(ctx))
+	root.Register(export.NewCmd(ctx))
+	root.Register(importer.NewCmd(ctx))
+	root.Register(conflicts.NewCmd(ctx))
+	root.Register(resolve.NewCmd(ctx))
+	root.Register(serve.NewCmd(ctx))
+	root.Register(remote.NewCmd(ctx))
+	root.Register(keys.NewCmd(ctx))
+	root.Register(encrypt.NewCmd(ctx))
+	root.Register(decrypt.NewCmd(ctx))
+	root.Register(tui.NewCmd(ctx))
+	root.Register(publish.NewCmd(ctx))
+	root.Register(unpublish.NewCmd(ctx))
+	root.Register(site.NewCmd(ctx))
+	root.Register(review.NewCmd(ctx))
+	root.Register(completion.NewCmd(ctx))
+	root.Register(completion.NewCompleteCmd(ctx))
 
-	if err := root.Execute(); err != nil {
-		log.Errorf("%s\n", err.Error())
+	// The context is closed before exiting so that the database encrypted at
+	// rest is unlocked even if the command fails
+	runErr := root.Execute()
+	if err := infra.CloseCtx(ctx); err != nil {
+		log.Errorf("%s\n", errors.Wrap(err, "closing the context").Error())
+		os.Exit(1)
+	}
+	if runErr != nil {
+		log.Errorf("%s\n", runErr.Error())
 		os.Exit(1)
 	}
 }
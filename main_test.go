@@ -1,31 +1,78 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/pkg/errors"
 
 	"github.com/dnote/actions"
+	"github.com/dnote/cli/cmd/export"
 	"github.com/dnote/cli/core"
 	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/output"
+	"github.com/dnote/cli/server"
 	"github.com/dnote/cli/testutils"
 	"github.com/dnote/cli/utils"
+	"gopkg.in/yaml.v2"
 )
 
 var binaryName = "test-dnote"
 
+// syncServer is a fake dnote server the test binary syncs with. Tests set
+// syncHandler to control its behavior.
+var syncServer *httptest.Server
+var syncHandler http.HandlerFunc
+var syncHandlerLock sync.Mutex
+
+func setSyncHandler(h http.HandlerFunc) {
+	syncHandlerLock.Lock()
+	defer syncHandlerLock.Unlock()
+
+	syncHandler = h
+}
+
 func TestMain(m *testing.M) {
-	if err := exec.Command("go", "build", "-o", binaryName).Run(); err != nil {
+	syncServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		syncHandlerLock.Lock()
+		h := syncHandler
+		syncHandlerLock.Unlock()
+
+		if h == nil {
+			http.Error(w, "no handler", http.StatusInternalServerError)
+			return
+		}
+
+		h(w, r)
+	}))
+	defer syncServer.Close()
+
+	ldflags := fmt.Sprintf("-X main.apiEndpoint=%s", syncServer.URL)
+	if err := exec.Command("go", "build", "--tags", "fts5", "-ldflags", ldflags, "-o", binaryName).Run(); err != nil {
 		log.Print(errors.Wrap(err, "building a binary").Error())
 		os.Exit(1)
 	}
 
-	os.Exit(m.Run())
+	code := m.Run()
+	syncServer.Close()
+	os.Exit(code)
 }
 
 func TestInit(t *testing.T) {
@@ -211,6 +258,316 @@ func TestEditNote_ContentFlag(t *testing.T) {
 	testutils.AssertEqual(t, n2.UUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "Note should have UUID")
 	testutils.AssertEqual(t, n2.Content, "foo bar", "Note content mismatch")
 	testutils.AssertNotEqual(t, n2.EditedOn, 0, "Note edited_on mismatch")
+
+	revs, err := core.GetNoteRevisions(db, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting revisions"))
+	}
+	testutils.AssertEqualf(t, len(revs), 1, "revision count mismatch")
+	testutils.AssertEqual(t, revs[0].Content, "Date object implements mathematical comparisons", "revision content mismatch")
+	testutils.AssertEqual(t, revs[0].CreatedOn, int64(1515199951), "revision created_on mismatch")
+}
+
+func TestEditBook_Name(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "edit", "--book", "js", "--name", "javascript")
+
+	// Test
+	db := ctx.DB
+
+	var actionCount, bookCount, jsNoteCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "counting js notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &jsNoteCount)
+
+	testutils.AssertEqualf(t, actionCount, 1, "action count mismatch")
+	testutils.AssertEqualf(t, bookCount, 2, "book count mismatch")
+	testutils.AssertEqualf(t, jsNoteCount, 2, "js note count mismatch")
+
+	var label string
+	testutils.MustScan(t, "getting the book", db.QueryRow("SELECT label FROM books WHERE uuid = ?", "js-book-uuid"), &label)
+	testutils.AssertEqual(t, label, "javascript", "book label mismatch")
+
+	var action actions.Action
+	testutils.MustScan(t, "getting an action",
+		db.QueryRow("SELECT type, schema, data, timestamp FROM actions"), &action.Type, &action.Schema, &action.Data, &action.Timestamp)
+
+	var actionData core.RenameBookDataV1
+	if err := json.Unmarshal(action.Data, &actionData); err != nil {
+		log.Fatalf("unmarshalling the action data: %s", err)
+	}
+
+	testutils.AssertEqual(t, action.Type, core.ActionRenameBook, "action type mismatch")
+	testutils.AssertEqual(t, action.Schema, 1, "action schema mismatch")
+	testutils.AssertEqual(t, actionData.OldName, "js", "action data old_name mismatch")
+	testutils.AssertEqual(t, actionData.NewName, "javascript", "action data new_name mismatch")
+	testutils.AssertNotEqual(t, action.Timestamp, 0, "action timestamp mismatch")
+}
+
+func TestMoveNote(t *testing.T) {
+	testCases := []struct {
+		destBook           string
+		expectedBookCount  int
+		expectedActionType []string
+	}{
+		{
+			destBook:           "linux",
+			expectedBookCount:  2,
+			expectedActionType: []string{actions.ActionEditNote},
+		},
+		{
+			destBook:           "javascript",
+			expectedBookCount:  3,
+			expectedActionType: []string{actions.ActionAddBook, actions.ActionEditNote},
+		},
+	}
+
+	for _, tc := range testCases {
+		func() {
+			// Set up
+			ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+
+			// Execute
+			testutils.RunDnoteCmd(t, ctx, binaryName, "mv", "js", "1", tc.destBook)
+
+			// Test
+			db := ctx.DB
+
+			var bookCount, jsNoteCount int
+			testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+			testutils.MustScan(t, "counting js notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &jsNoteCount)
+
+			testutils.AssertEqualf(t, bookCount, tc.expectedBookCount, "book count mismatch")
+			testutils.AssertEqualf(t, jsNoteCount, 1, "js note count mismatch")
+
+			var destLabel string
+			var editedOn int64
+			testutils.MustScan(t, "getting the note",
+				db.QueryRow("SELECT books.label, notes.edited_on FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE notes.uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"),
+				&destLabel, &editedOn)
+			testutils.AssertEqual(t, destLabel, tc.destBook, "destination book mismatch")
+			testutils.AssertNotEqual(t, editedOn, 0, "note edited_on mismatch")
+
+			rows, err := db.Query("SELECT type, data FROM actions ORDER BY rowid ASC")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "querying actions"))
+			}
+			defer rows.Close()
+
+			actionTypes := []string{}
+			for rows.Next() {
+				var action actions.Action
+				if err := rows.Scan(&action.Type, &action.Data); err != nil {
+					t.Fatal(errors.Wrap(err, "scanning an action"))
+				}
+				actionTypes = append(actionTypes, action.Type)
+
+				if action.Type != actions.ActionEditNote {
+					continue
+				}
+
+				var actionData actions.EditNoteDataV2
+				if err := json.Unmarshal(action.Data, &actionData); err != nil {
+					t.Fatal(errors.Wrap(err, "unmarshalling the action data"))
+				}
+
+				testutils.AssertEqual(t, actionData.NoteUUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "action data note_uuid mismatch")
+				testutils.AssertEqual(t, actionData.FromBook, "js", "action data from_book mismatch")
+				testutils.AssertEqual(t, *actionData.ToBook, tc.destBook, "action data to_book mismatch")
+				if actionData.Content != nil {
+					t.Errorf("action data content mismatch. Expected %+v. Got %+v", nil, actionData.Content)
+				}
+			}
+
+			testutils.AssertDeepEqual(t, actionTypes, tc.expectedActionType, "action types mismatch")
+		}()
+	}
+}
+
+func TestMoveNote_ID(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "mv", "f0d0fbb7", "linux")
+
+	// Test
+	db := ctx.DB
+
+	var destLabel string
+	testutils.MustScan(t, "getting the note",
+		db.QueryRow("SELECT books.label FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE notes.uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &destLabel)
+	testutils.AssertEqual(t, destLabel, "linux", "destination book mismatch")
+
+	var actionType string
+	testutils.MustScan(t, "getting the action", db.QueryRow("SELECT type FROM actions"), &actionType)
+	testutils.AssertEqual(t, actionType, actions.ActionEditNote, "action type mismatch")
+}
+
+func TestExport_JSON(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	outPath := fmt.Sprintf("%s/dnote.json", ctx.DnoteDir)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "export", "--format", "json", "--book", "js", "--out", outPath)
+
+	// Test
+	b, err := ioutil.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the export"))
+	}
+
+	var archive export.Archive
+	if err := json.Unmarshal(b, &archive); err != nil {
+		t.Fatal(errors.Wrap(err, "unmarshalling the export"))
+	}
+
+	testutils.AssertEqual(t, len(archive.Books), 1, "book count mismatch")
+	testutils.AssertEqual(t, archive.Books[0].Label, "js", "book label mismatch")
+	testutils.AssertEqual(t, archive.Books[0].UUID, "js-book-uuid", "book uuid mismatch")
+	testutils.AssertEqual(t, len(archive.Books[0].Notes), 2, "note count mismatch")
+	testutils.AssertEqual(t, archive.Books[0].Notes[0].UUID, "43827b9a-c2b0-4c06-a290-97991c896653", "note uuid mismatch")
+	testutils.AssertEqual(t, archive.Books[0].Notes[0].AddedOn, int64(1515199943), "note added_on mismatch")
+}
+
+func TestExport_Markdown(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	outDir := fmt.Sprintf("%s/export", ctx.DnoteDir)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "export", "--out", outDir)
+
+	// Test
+	files, err := ioutil.ReadDir(outDir)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the export directory"))
+	}
+
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	testutils.AssertDeepEqual(t, names, []string{"js.md", "linux.md"}, "exported files mismatch")
+}
+
+func TestExport_Anki(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "linux", "-t", "shell", "-c", "{{pwd}} prints the working directory")
+
+	path := fmt.Sprintf("%s/dnote.txt", ctx.DnoteDir)
+	clozePath := fmt.Sprintf("%s/cloze.txt", ctx.DnoteDir)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "export", "--format", "anki", "--out", path)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "export", "--format", "anki", "--cloze", "--out", clozePath)
+	runDnoteCmdWithError(t, ctx, "export", "--format", "json", "--cloze")
+
+	// Test
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the deck"))
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	testutils.AssertEqual(t, len(lines), 10, "line count mismatch")
+	testutils.AssertEqual(t, lines[6], "43827b9a-c2b0-4c06-a290-97991c896653\tBooleans have toString()\t\tjs\t", "first card mismatch")
+
+	b, err = ioutil.ReadFile(clozePath)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the cloze deck"))
+	}
+	lines = strings.Split(strings.TrimSpace(string(b)), "\n")
+	testutils.AssertEqual(t, len(lines), 7, "cloze line count mismatch")
+	if !strings.HasSuffix(lines[6], "\t{{c1::pwd}} prints the working directory\t\tlinux\tshell") {
+		t.Errorf("cloze card mismatch: %s", lines[6])
+	}
+}
+
+func TestImport_DryRun(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup1(t, ctx)
+
+	path := fmt.Sprintf("%s/golang.md", ctx.DnoteDir)
+	if err := ioutil.WriteFile(path, []byte("# defer\ndeferred calls run in LIFO order\n"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the file"))
+	}
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "import", path, "--dry-run")
+
+	// Test
+	db := ctx.DB
+
+	var actionCount, noteCount, bookCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+
+	testutils.AssertEqualf(t, actionCount, 0, "action count mismatch")
+	testutils.AssertEqualf(t, bookCount, 2, "book count mismatch")
+	testutils.AssertEqualf(t, noteCount, 1, "note count mismatch")
+}
+
+func TestImport_Export(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	path := fmt.Sprintf("%s/dnote.json", ctx.DnoteDir)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "export", "--format", "json", "--out", path)
+
+	db := ctx.DB
+	testutils.MustExec(t, "removing notes", db, "DELETE FROM notes WHERE book_uuid = ?", "linux-book-uuid")
+	testutils.MustExec(t, "removing book", db, "DELETE FROM books WHERE uuid = ?", "linux-book-uuid")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "import", path)
+
+	// Test
+	var actionCount, noteCount, bookCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+
+	testutils.AssertEqualf(t, actionCount, 2, "action count mismatch")
+	testutils.AssertEqualf(t, bookCount, 2, "book count mismatch")
+	testutils.AssertEqualf(t, noteCount, 3, "note count mismatch")
+
+	var n infra.Note
+	testutils.MustScan(t, "getting the imported note",
+		db.QueryRow("SELECT uuid, content, added_on FROM notes WHERE uuid = ?", "3e065d55-6d47-42f2-a6bf-f5844130b2d2"), &n.UUID, &n.Content, &n.AddedOn)
+	testutils.AssertEqual(t, n.Content, "wc -l to count words", "imported note content mismatch")
+	testutils.AssertEqual(t, n.AddedOn, int64(1515199961), "imported note added_on mismatch")
 }
 
 func TestRemoveNote(t *testing.T) {
@@ -226,49 +583,37 @@ func TestRemoveNote(t *testing.T) {
 	// Test
 	db := ctx.DB
 
-	var actionCount, noteCount, bookCount, jsNoteCount, linuxNoteCount int
+	var actionCount, noteCount, bookCount, jsNoteCount, linuxNoteCount, trashNoteCount int
 	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
 	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
 	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
 	testutils.MustScan(t, "counting js notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &jsNoteCount)
 	testutils.MustScan(t, "counting linux notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "linux-book-uuid"), &linuxNoteCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
 
-	testutils.AssertEqualf(t, actionCount, 1, "action count mismatch")
+	testutils.AssertEqualf(t, actionCount, 0, "action count mismatch")
 	testutils.AssertEqualf(t, bookCount, 2, "book count mismatch")
 	testutils.AssertEqualf(t, noteCount, 2, "note count mismatch")
 	testutils.AssertEqual(t, jsNoteCount, 1, "Book should have one note")
 	testutils.AssertEqual(t, linuxNoteCount, 1, "Other book should have one note")
+	testutils.AssertEqual(t, trashNoteCount, 1, "trashed note count mismatch")
 
-	var b1, b2 infra.Book
 	var n1 infra.Note
-	testutils.MustScan(t, "getting b1",
-		db.QueryRow("SELECT label FROM books WHERE uuid = ?", "js-book-uuid"),
-		&b1.Name)
-	testutils.MustScan(t, "getting b2",
-		db.QueryRow("SELECT label FROM books WHERE uuid = ?", "linux-book-uuid"),
-		&b2.Name)
 	testutils.MustScan(t, "getting n1",
 		db.QueryRow("SELECT uuid, content, added_on FROM notes WHERE book_uuid = ? AND id = ?", "js-book-uuid", 2),
 		&n1.UUID, &n1.Content, &n1.AddedOn)
 
-	var noteAction actions.Action
-	testutils.MustScan(t, "getting note action",
-		db.QueryRow("SELECT type, schema, data FROM actions WHERE type = ?", actions.ActionRemoveNote), &noteAction.Type, &noteAction.Schema, &noteAction.Data)
-
-	var actionData actions.RemoveNoteDataV1
-	if err := json.Unmarshal(noteAction.Data, &actionData); err != nil {
-		log.Fatalf("unmarshalling the action data: %s", err)
-	}
+	var trashed infra.Note
+	var withBook bool
+	testutils.MustScan(t, "getting trashed note",
+		db.QueryRow("SELECT uuid, content, with_book FROM trash_notes WHERE book_uuid = ?", "js-book-uuid"),
+		&trashed.UUID, &trashed.Content, &withBook)
 
-	testutils.AssertEqual(t, b1.Name, "js", "b1 label mismatch")
-	testutils.AssertEqual(t, b2.Name, "linux", "b2 label mismatch")
-	testutils.AssertEqual(t, noteAction.Schema, 1, "action schema mismatch")
-	testutils.AssertEqual(t, noteAction.Type, actions.ActionRemoveNote, "action type mismatch")
-	testutils.AssertEqual(t, actionData.NoteUUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "action data note_uuid mismatch")
-	testutils.AssertEqual(t, actionData.BookName, "js", "action data book_name mismatch")
-	testutils.AssertNotEqual(t, noteAction.Timestamp, 0, "action timestamp mismatch")
 	testutils.AssertEqual(t, n1.UUID, "43827b9a-c2b0-4c06-a290-97991c896653", "Note should have UUID")
 	testutils.AssertEqual(t, n1.Content, "Booleans have toString()", "Note content mismatch")
+	testutils.AssertEqual(t, trashed.UUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "trashed note uuid mismatch")
+	testutils.AssertEqual(t, trashed.Content, "Date object implements mathematical comparisons", "trashed note content mismatch")
+	testutils.AssertEqual(t, withBook, false, "trashed note with_book mismatch")
 }
 
 func TestRemoveBook(t *testing.T) {
@@ -284,27 +629,98 @@ func TestRemoveBook(t *testing.T) {
 	// Test
 	db := ctx.DB
 
-	var actionCount, noteCount, bookCount, jsNoteCount, linuxNoteCount int
+	var actionCount, noteCount, bookCount, jsNoteCount, linuxNoteCount, trashNoteCount, trashBookCount int
 	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
 	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
 	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
 	testutils.MustScan(t, "counting js notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &jsNoteCount)
 	testutils.MustScan(t, "counting linux notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "linux-book-uuid"), &linuxNoteCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes WHERE with_book = ?", true), &trashNoteCount)
+	testutils.MustScan(t, "counting trashed books", db.QueryRow("SELECT count(*) FROM trash_books WHERE label = ?", "js"), &trashBookCount)
 
-	testutils.AssertEqualf(t, actionCount, 1, "action count mismatch")
+	testutils.AssertEqualf(t, actionCount, 0, "action count mismatch")
 	testutils.AssertEqualf(t, bookCount, 1, "book count mismatch")
 	testutils.AssertEqualf(t, noteCount, 1, "note count mismatch")
 	testutils.AssertEqual(t, jsNoteCount, 0, "some notes in book were not deleted")
 	testutils.AssertEqual(t, linuxNoteCount, 1, "Other book should have one note")
+	testutils.AssertEqual(t, trashNoteCount, 2, "trashed note count mismatch")
+	testutils.AssertEqual(t, trashBookCount, 1, "trashed book count mismatch")
 
 	var b1 infra.Book
 	testutils.MustScan(t, "getting b1",
 		db.QueryRow("SELECT label FROM books WHERE uuid = ?", "linux-book-uuid"),
 		&b1.Name)
 
+	testutils.AssertEqual(t, b1.Name, "linux", "Remaining book name mismatch")
+}
+
+func TestTrashEmpty_Note(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "js", "1")
+
+	// Execute
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "trash", "empty")
+
+	// Test
+	db := ctx.DB
+
+	var actionCount, noteCount, trashNoteCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+
+	testutils.AssertEqualf(t, actionCount, 1, "action count mismatch")
+	testutils.AssertEqualf(t, noteCount, 2, "note count mismatch")
+	testutils.AssertEqualf(t, trashNoteCount, 0, "trashed note count mismatch")
+
+	var noteAction actions.Action
+	testutils.MustScan(t, "getting note action",
+		db.QueryRow("SELECT type, schema, data, timestamp FROM actions WHERE type = ?", actions.ActionRemoveNote), &noteAction.Type, &noteAction.Schema, &noteAction.Data, &noteAction.Timestamp)
+
+	var actionData actions.RemoveNoteDataV1
+	if err := json.Unmarshal(noteAction.Data, &actionData); err != nil {
+		log.Fatalf("unmarshalling the action data: %s", err)
+	}
+
+	testutils.AssertEqual(t, noteAction.Schema, 1, "action schema mismatch")
+	testutils.AssertEqual(t, noteAction.Type, actions.ActionRemoveNote, "action type mismatch")
+	testutils.AssertEqual(t, actionData.NoteUUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "action data note_uuid mismatch")
+	testutils.AssertEqual(t, actionData.BookName, "js", "action data book_name mismatch")
+	testutils.AssertNotEqual(t, noteAction.Timestamp, 0, "action timestamp mismatch")
+}
+
+func TestTrashEmpty_Book(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "-b", "js")
+
+	// Execute
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "trash", "empty")
+
+	// Test
+	db := ctx.DB
+
+	var actionCount, removeNoteCount, trashNoteCount, trashBookCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting remove_note actions", db.QueryRow("SELECT count(*) FROM actions WHERE type = ?", actions.ActionRemoveNote), &removeNoteCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+	testutils.MustScan(t, "counting trashed books", db.QueryRow("SELECT count(*) FROM trash_books"), &trashBookCount)
+
+	testutils.AssertEqualf(t, actionCount, 3, "action count mismatch")
+	testutils.AssertEqualf(t, removeNoteCount, 2, "remove_note action count mismatch")
+	testutils.AssertEqualf(t, trashNoteCount, 0, "trashed note count mismatch")
+	testutils.AssertEqualf(t, trashBookCount, 0, "trashed book count mismatch")
+
 	var action actions.Action
 	testutils.MustScan(t, "getting an action",
-		db.QueryRow("SELECT type, schema, data FROM actions WHERE type = ?", actions.ActionRemoveBook), &action.Type, &action.Schema, &action.Data)
+		db.QueryRow("SELECT type, schema, data, timestamp FROM actions WHERE type = ?", actions.ActionRemoveBook), &action.Type, &action.Schema, &action.Data, &action.Timestamp)
 
 	var actionData actions.RemoveBookDataV1
 	if err := json.Unmarshal(action.Data, &actionData); err != nil {
@@ -314,5 +730,1634 @@ func TestRemoveBook(t *testing.T) {
 	testutils.AssertEqual(t, action.Type, actions.ActionRemoveBook, "action type mismatch")
 	testutils.AssertEqual(t, actionData.BookName, "js", "action data name mismatch")
 	testutils.AssertNotEqual(t, action.Timestamp, 0, "action timestamp mismatch")
-	testutils.AssertEqual(t, b1.Name, "linux", "Remaining book name mismatch")
+}
+
+func TestTrashEmpty_RenamedBook(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "-b", "js")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "new note")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "edit", "--book", "js", "--name", "javascript")
+
+	// Execute
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "trash", "empty")
+
+	// Test
+	db := ctx.DB
+
+	// Other machines have the trashed notes in the renamed book
+	rows, err := db.Query("SELECT data FROM actions WHERE type = ? ORDER BY rowid ASC", actions.ActionRemoveNote)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "querying actions"))
+	}
+	removedNotes := []string{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			t.Fatal(errors.Wrap(err, "scanning an action"))
+		}
+
+		var actionData actions.RemoveNoteDataV1
+		if err := json.Unmarshal([]byte(data), &actionData); err != nil {
+			t.Fatal(errors.Wrap(err, "unmarshalling the action data"))
+		}
+		removedNotes = append(removedNotes, actionData.NoteUUID)
+	}
+	rows.Close()
+	sort.Strings(removedNotes)
+
+	testutils.AssertDeepEqual(t, removedNotes, []string{"43827b9a-c2b0-4c06-a290-97991c896653", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"}, "removed notes mismatch")
+
+	var noteCount int
+	testutils.MustScan(t, "counting notes in the renamed book", db.QueryRow(`SELECT count(*) FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE books.label = ?`, "javascript"), &noteCount)
+	testutils.AssertEqual(t, noteCount, 1, "note count mismatch")
+}
+
+func TestTrashEmpty_OlderThan(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "js", "1")
+
+	// Execute
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "trash", "empty", "--older-than", "30d")
+
+	// Test
+	db := ctx.DB
+
+	var actionCount, trashNoteCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+
+	testutils.AssertEqualf(t, actionCount, 0, "action count mismatch")
+	testutils.AssertEqualf(t, trashNoteCount, 1, "trashed note count mismatch")
+}
+
+func TestTrashRestore_Note(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "js", "1")
+
+	db := ctx.DB
+	var trashID int
+	testutils.MustScan(t, "getting trash id", db.QueryRow("SELECT id FROM trash_notes"), &trashID)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "trash", "restore", strconv.Itoa(trashID))
+
+	// Test
+	var actionCount, jsNoteCount, trashNoteCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting js notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &jsNoteCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+
+	testutils.AssertEqualf(t, actionCount, 0, "action count mismatch")
+	testutils.AssertEqualf(t, jsNoteCount, 2, "js note count mismatch")
+	testutils.AssertEqualf(t, trashNoteCount, 0, "trashed note count mismatch")
+
+	var n1 infra.Note
+	testutils.MustScan(t, "getting n1",
+		db.QueryRow("SELECT uuid, content FROM notes WHERE book_uuid = ? AND id = ?", "js-book-uuid", 1),
+		&n1.UUID, &n1.Content)
+
+	testutils.AssertEqual(t, n1.UUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "restored note uuid mismatch")
+	testutils.AssertEqual(t, n1.Content, "Date object implements mathematical comparisons", "restored note content mismatch")
+}
+
+func TestTrashRestore_Book(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "-b", "js")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "trash", "restore", "-b", "js")
+
+	// Test
+	db := ctx.DB
+
+	var actionCount, bookCount, jsNoteCount, trashNoteCount, trashBookCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "counting js notes", db.QueryRow("SELECT count(*) FROM notes WHERE book_uuid = ?", "js-book-uuid"), &jsNoteCount)
+	testutils.MustScan(t, "counting trashed notes", db.QueryRow("SELECT count(*) FROM trash_notes"), &trashNoteCount)
+	testutils.MustScan(t, "counting trashed books", db.QueryRow("SELECT count(*) FROM trash_books"), &trashBookCount)
+
+	testutils.AssertEqualf(t, actionCount, 0, "action count mismatch")
+	testutils.AssertEqualf(t, bookCount, 2, "book count mismatch")
+	testutils.AssertEqualf(t, jsNoteCount, 2, "js note count mismatch")
+	testutils.AssertEqualf(t, trashNoteCount, 0, "trashed note count mismatch")
+	testutils.AssertEqualf(t, trashBookCount, 0, "trashed book count mismatch")
+}
+
+func TestAddNote_Tags(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup3(t, ctx)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-t", "ES6", "-c", "#arrow functions do not bind this")
+
+	// Test
+	db := ctx.DB
+
+	var actionCount, tagCount, noteTagCount int
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting tags", db.QueryRow("SELECT count(*) FROM tags"), &tagCount)
+	testutils.MustScan(t, "counting note tags", db.QueryRow("SELECT count(*) FROM note_tags"), &noteTagCount)
+
+	testutils.AssertEqualf(t, actionCount, 2, "action count mismatch")
+	testutils.AssertEqual(t, tagCount, 2, "tag count mismatch")
+	testutils.AssertEqual(t, noteTagCount, 2, "note tag count mismatch")
+
+	var noteUUID string
+	testutils.MustScan(t, "getting note", db.QueryRow("SELECT uuid FROM notes WHERE content = ?", "#arrow functions do not bind this"), &noteUUID)
+	tags, err := core.GetNoteTags(db, noteUUID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting tags"))
+	}
+
+	var tagAction actions.Action
+	testutils.MustScan(t, "getting tag action",
+		db.QueryRow("SELECT schema, data FROM actions WHERE type = ?", core.ActionSetNoteTags), &tagAction.Schema, &tagAction.Data)
+	var actionData core.SetNoteTagsDataV1
+	if err := json.Unmarshal(tagAction.Data, &actionData); err != nil {
+		log.Fatalf("unmarshalling the action data: %s", err)
+	}
+
+	testutils.AssertDeepEqual(t, tags, []string{"arrow", "es6"}, "note tags mismatch")
+	testutils.AssertEqual(t, tagAction.Schema, 1, "action schema mismatch")
+	testutils.AssertEqual(t, actionData.NoteUUID, noteUUID, "action data note_uuid mismatch")
+	testutils.AssertDeepEqual(t, actionData.Tags, []string{"arrow", "es6"}, "action data tags mismatch")
+}
+
+func TestEditNote_Tags(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup4(t, ctx)
+	db := ctx.DB
+	testutils.MustExec(t, "setting up tag", db, "INSERT INTO tags (uuid, label) VALUES (?, ?)", "es5-tag-uuid", "es5")
+	testutils.MustExec(t, "setting up note tag", db, "INSERT INTO note_tags (note_uuid, tag_uuid) VALUES (?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "es5-tag-uuid")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "edit", "js", "2", "-t", "date", "--untag", "es5")
+
+	// Test
+	var actionCount int
+	var content string
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "getting content", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &content)
+	tags, err := core.GetNoteTags(db, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting tags"))
+	}
+
+	var tagAction actions.Action
+	testutils.MustScan(t, "getting tag action",
+		db.QueryRow("SELECT data FROM actions WHERE type = ?", core.ActionSetNoteTags), &tagAction.Data)
+	var actionData core.SetNoteTagsDataV1
+	if err := json.Unmarshal(tagAction.Data, &actionData); err != nil {
+		log.Fatalf("unmarshalling the action data: %s", err)
+	}
+
+	testutils.AssertEqualf(t, actionCount, 1, "action count mismatch")
+	testutils.AssertEqual(t, content, "Date object implements mathematical comparisons", "content mismatch")
+	testutils.AssertDeepEqual(t, tags, []string{"date"}, "note tags mismatch")
+	testutils.AssertDeepEqual(t, actionData.Tags, []string{"date"}, "action data tags mismatch")
+}
+
+func TestRestoreNote(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup4(t, ctx)
+	db := ctx.DB
+	testutils.MustExec(t, "setting up revision 1", db, "INSERT INTO note_revisions (note_uuid, content, created_on) VALUES (?, ?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "Date objects", 1515199900)
+	testutils.MustExec(t, "setting up revision 2", db, "INSERT INTO note_revisions (note_uuid, content, created_on) VALUES (?, ?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "Date objects compare", 1515199920)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "restore", "js", "2", "--rev", "1")
+
+	// Test
+	var actionCount int
+	var note infra.Note
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "getting note",
+		db.QueryRow("SELECT content, edited_on FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &note.Content, &note.EditedOn)
+
+	var noteAction actions.Action
+	testutils.MustScan(t, "getting note action",
+		db.QueryRow("SELECT data, schema FROM actions WHERE type = ?", actions.ActionEditNote), &noteAction.Data, &noteAction.Schema)
+	var actionData actions.EditNoteDataV2
+	if err := json.Unmarshal(noteAction.Data, &actionData); err != nil {
+		log.Fatalf("unmarshalling the action data: %s", err)
+	}
+
+	revs, err := core.GetNoteRevisions(db, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting revisions"))
+	}
+
+	testutils.AssertEqualf(t, actionCount, 1, "action count mismatch")
+	testutils.AssertEqual(t, note.Content, "Date objects", "note content mismatch")
+	testutils.AssertNotEqual(t, note.EditedOn, int64(0), "note edited_on mismatch")
+	testutils.AssertEqual(t, noteAction.Schema, 2, "action schema mismatch")
+	testutils.AssertEqual(t, actionData.NoteUUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "action data note_uuid mismatch")
+	testutils.AssertEqual(t, *actionData.Content, "Date objects", "action data content mismatch")
+	testutils.AssertEqualf(t, len(revs), 3, "revision count mismatch")
+	testutils.AssertEqual(t, revs[2].Content, "Date object implements mathematical comparisons", "latest revision content mismatch")
+}
+
+func TestRestoreNote_ID(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup4(t, ctx)
+	db := ctx.DB
+	testutils.MustExec(t, "setting up revision 1", db, "INSERT INTO note_revisions (note_uuid, content, created_on) VALUES (?, ?, ?)", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "Date objects", 1515199900)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "restore", "f0d0fbb7", "--rev", "1")
+
+	// Test
+	var actionCount int
+	var content string
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "getting content", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &content)
+
+	testutils.AssertEqualf(t, actionCount, 1, "action count mismatch")
+	testutils.AssertEqual(t, content, "Date objects", "note content mismatch")
+}
+
+// fakeSyncServer records the actions it receives and returns a delta
+type fakeSyncServer struct {
+	received []actions.Action
+	delta    []actions.Action
+	bookmark int
+}
+
+func (s *fakeSyncServer) readActions(r *http.Request) error {
+	var payload struct {
+		Bookmark int    `json:"bookmark"`
+		Actions  []byte `json:"actions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return errors.Wrap(err, "decoding the payload")
+	}
+
+	g, err := gzip.NewReader(bytes.NewReader(payload.Actions))
+	if err != nil {
+		return errors.Wrap(err, "reading gzip")
+	}
+	defer g.Close()
+
+	var received []actions.Action
+	if err := json.NewDecoder(g).Decode(&received); err != nil {
+		return errors.Wrap(err, "decoding actions")
+	}
+
+	s.received = append(s.received, received...)
+
+	return nil
+}
+
+func (s *fakeSyncServer) handle(w http.ResponseWriter, r *http.Request) {
+	if err := s.readActions(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"actions":  s.delta,
+		"bookmark": s.bookmark,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(b)
+}
+
+// runDnoteCmdWithError runs a dnote command that is expected to fail
+func runDnoteCmdWithError(t *testing.T, ctx infra.DnoteCtx, arg ...string) {
+	t.Logf("running: %s %v", binaryName, arg)
+
+	cmd, _, stdout, err := testutils.NewDnoteCmd(ctx, binaryName, arg...)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	if err := cmd.Run(); err == nil {
+		t.Logf("\n%s", stdout)
+		t.Fatal("expected the command to fail")
+	}
+
+	t.Logf("\n%s", stdout)
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+
+	return b
+}
+
+func TestSync_Failures(t *testing.T) {
+	remoteNote := actions.Action{
+		UUID:      "remote-action-uuid",
+		Schema:    1,
+		Type:      actions.ActionAddNote,
+		Timestamp: 1517629805,
+		Data: mustMarshal(t, actions.AddNoteDataV1{
+			NoteUUID: "06896551-8a06-4996-89cc-0d866308b0f6",
+			BookName: "js",
+			Content:  "remote content",
+		}),
+	}
+	unreducible := actions.Action{
+		UUID:      "unreducible-action-uuid",
+		Schema:    1,
+		Type:      actions.ActionAddNote,
+		Timestamp: 1517629805,
+		Data: mustMarshal(t, actions.AddNoteDataV1{
+			NoteUUID: "9e5f7b7e-1ab4-4f0c-8b4f-6b5bc2a8b1c9",
+			BookName: "nonexistent-book",
+			Content:  "orphan",
+		}),
+	}
+
+	testCases := []struct {
+		name string
+		// handler fails the first sync
+		handler func(w http.ResponseWriter, r *http.Request, s *fakeSyncServer)
+		// expectedAcknowledged is whether the server received the actions in the failed sync
+		expectedAcknowledged bool
+	}{
+		{
+			name: "connection closed",
+			handler: func(w http.ResponseWriter, r *http.Request, s *fakeSyncServer) {
+				panic(http.ErrAbortHandler)
+			},
+			expectedAcknowledged: false,
+		},
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request, s *fakeSyncServer) {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+			},
+			expectedAcknowledged: false,
+		},
+		{
+			name: "malformed response",
+			handler: func(w http.ResponseWriter, r *http.Request, s *fakeSyncServer) {
+				if err := s.readActions(r); err != nil {
+					panic(err)
+				}
+				w.Write([]byte("{\"actions\": ["))
+			},
+			expectedAcknowledged: true,
+		},
+		{
+			name: "reducing failure",
+			handler: func(w http.ResponseWriter, r *http.Request, s *fakeSyncServer) {
+				failing := fakeSyncServer{delta: []actions.Action{remoteNote, unreducible}, bookmark: 3}
+				failing.handle(w, r)
+				s.received = append(s.received, failing.received...)
+			},
+			expectedAcknowledged: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Set up
+			ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "local content")
+			if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+				t.Fatal(errors.Wrap(err, "writing the config"))
+			}
+
+			db := ctx.DB
+			server := &fakeSyncServer{delta: []actions.Action{remoteNote}, bookmark: 2}
+
+			// Execute a failing sync
+			setSyncHandler(func(w http.ResponseWriter, r *http.Request) {
+				tc.handler(w, r, server)
+			})
+			runDnoteCmdWithError(t, ctx, "sync")
+
+			// Test that the failed sync did not change the state
+			var actionCount, noteCount, ackCount, bookmark int
+			testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+			testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+			testutils.MustScan(t, "counting acknowledged actions", db.QueryRow("SELECT count(*) FROM sync_journal WHERE acknowledged = ?", true), &ackCount)
+			testutils.MustScan(t, "getting the bookmark", db.QueryRow("SELECT value FROM system WHERE key = ?", "bookmark"), &bookmark)
+
+			expectedAckCount := 0
+			if tc.expectedAcknowledged {
+				expectedAckCount = 2
+			}
+
+			testutils.AssertEqualf(t, actionCount, 2, "action count mismatch after failure")
+			testutils.AssertEqualf(t, noteCount, 1, "note count mismatch after failure")
+			testutils.AssertEqualf(t, ackCount, expectedAckCount, "acknowledged action count mismatch after failure")
+			testutils.AssertEqualf(t, bookmark, 0, "bookmark mismatch after failure")
+
+			// Execute a successful sync
+			setSyncHandler(server.handle)
+			testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+
+			// Test that every local action reached the server exactly once and
+			// the delta was applied
+			testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+			testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+			testutils.MustScan(t, "getting the bookmark", db.QueryRow("SELECT value FROM system WHERE key = ?", "bookmark"), &bookmark)
+
+			var journalCount int
+			testutils.MustScan(t, "counting the journal", db.QueryRow("SELECT count(*) FROM sync_journal"), &journalCount)
+
+			testutils.AssertEqualf(t, len(server.received), 2, "received action count mismatch")
+			testutils.AssertEqualf(t, actionCount, 0, "action count mismatch")
+			testutils.AssertEqualf(t, journalCount, 0, "journal count mismatch")
+			testutils.AssertEqualf(t, noteCount, 2, "note count mismatch")
+			testutils.AssertEqualf(t, bookmark, 2, "bookmark mismatch")
+
+			var content string
+			testutils.MustScan(t, "getting the remote note", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "06896551-8a06-4996-89cc-0d866308b0f6"), &content)
+			testutils.AssertEqual(t, content, "remote content", "remote note content mismatch")
+		})
+	}
+}
+
+func TestSync_ActionsDuringSync(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "local content")
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	db := ctx.DB
+	server := &fakeSyncServer{delta: []actions.Action{}, bookmark: 2}
+
+	// Execute
+	setSyncHandler(func(w http.ResponseWriter, r *http.Request) {
+		// Another command logs an action while the server handles the request
+		testutils.MustExec(t, "logging an action", db, "INSERT INTO actions (uuid, schema, type, data, timestamp) VALUES (?, ?, ?, ?, ?)",
+			"concurrent-action-uuid", 1, actions.ActionAddBook, `{"book_name": "linux"}`, 1517629805)
+		testutils.MustExec(t, "recording the action for the remote", db, "INSERT INTO pending_actions (remote, action_uuid) VALUES (?, ?)",
+			core.DefaultRemote, "concurrent-action-uuid")
+
+		server.handle(w, r)
+	})
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+
+	// Test
+	var actionUUID string
+	testutils.MustScan(t, "getting the remaining action", db.QueryRow("SELECT uuid FROM actions"), &actionUUID)
+
+	testutils.AssertEqualf(t, len(server.received), 2, "received action count mismatch")
+	testutils.AssertEqual(t, actionUUID, "concurrent-action-uuid", "remaining action mismatch")
+}
+
+func TestSync_Conflict(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup4(t, ctx)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "edit", "js", "2", "-c", "local edit")
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	remoteContent := "remote edit"
+	server := &fakeSyncServer{
+		delta: []actions.Action{
+			{
+				UUID:      "remote-action-uuid",
+				Schema:    2,
+				Type:      actions.ActionEditNote,
+				Timestamp: 1517629805,
+				Data: mustMarshal(t, actions.EditNoteDataV2{
+					NoteUUID: "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f",
+					FromBook: "js",
+					Content:  &remoteContent,
+				}),
+			},
+		},
+		bookmark: 2,
+	}
+	setSyncHandler(server.handle)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "conflicts")
+
+	// Test
+	db := ctx.DB
+	var content, ours, theirs string
+	var bookmark int
+	testutils.MustScan(t, "getting the note", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &content)
+	testutils.MustScan(t, "getting the conflict", db.QueryRow("SELECT ours, theirs FROM conflicts WHERE note_uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &ours, &theirs)
+	testutils.MustScan(t, "getting the bookmark", db.QueryRow("SELECT value FROM system WHERE key = ?", "bookmark"), &bookmark)
+
+	testutils.AssertEqual(t, content, "local edit", "note content mismatch")
+	testutils.AssertEqual(t, ours, "local edit", "conflict ours mismatch")
+	testutils.AssertEqual(t, theirs, "remote edit", "conflict theirs mismatch")
+	testutils.AssertEqualf(t, bookmark, 2, "bookmark mismatch")
+}
+
+func TestResolve(t *testing.T) {
+	testCases := []struct {
+		flag              string
+		expectedContent   string
+		expectedActionCnt int
+	}{
+		{
+			flag:              "--ours",
+			expectedContent:   "local edit",
+			expectedActionCnt: 0,
+		},
+		{
+			flag:              "--theirs",
+			expectedContent:   "remote edit",
+			expectedActionCnt: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.flag, func(t *testing.T) {
+			// Set up
+			ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup4(t, ctx)
+			db := ctx.DB
+			testutils.MustExec(t, "editing the note", db, "UPDATE notes SET content = ? WHERE uuid = ?", "local edit", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f")
+			testutils.MustExec(t, "setting up a conflict", db, "INSERT INTO conflicts (note_uuid, ours, theirs, created_on) VALUES (?, ?, ?, ?)",
+				"f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "local edit", "remote edit", 1517629805)
+
+			// Execute
+			testutils.RunDnoteCmd(t, ctx, binaryName, "resolve", "js", "2", tc.flag)
+
+			// Test
+			var content string
+			var conflictCount, actionCount int
+			testutils.MustScan(t, "getting the note", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &content)
+			testutils.MustScan(t, "counting conflicts", db.QueryRow("SELECT count(*) FROM conflicts"), &conflictCount)
+			testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions WHERE type = ?", actions.ActionEditNote), &actionCount)
+
+			testutils.AssertEqual(t, content, tc.expectedContent, "note content mismatch")
+			testutils.AssertEqualf(t, conflictCount, 0, "conflict count mismatch")
+			testutils.AssertEqualf(t, actionCount, tc.expectedActionCnt, "action count mismatch")
+		})
+	}
+}
+
+func TestServe_Sync(t *testing.T) {
+	// Set up a server and a client with notes
+	dir, err := ioutil.TempDir("", "dnote-server")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	srv, err := server.Open(dir)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the server"))
+	}
+	defer srv.Close()
+
+	apiKey, err := srv.AddUser("alice")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "adding a user"))
+	}
+	setSyncHandler(srv.ServeHTTP)
+
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "linux", "-c", "bar")
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: apiKey}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+	testutils.TeardownEnv(ctx)
+
+	// Test that another client receives the notes
+	ctx = testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: apiKey}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+
+	db := ctx.DB
+	var noteCount, bookCount, bookmark int
+	var content string
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.MustScan(t, "counting books", db.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "getting the bookmark", db.QueryRow("SELECT value FROM system WHERE key = ?", "bookmark"), &bookmark)
+	testutils.MustScan(t, "getting the note", db.QueryRow("SELECT notes.content FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ?", "js"), &content)
+
+	testutils.AssertEqualf(t, noteCount, 2, "note count mismatch")
+	testutils.AssertEqualf(t, bookCount, 2, "book count mismatch")
+	testutils.AssertEqualf(t, bookmark, 4, "bookmark mismatch")
+	testutils.AssertEqual(t, content, "foo", "note content mismatch")
+
+	// Test that the server maintains the notes
+	users, err := srv.GetUsers()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting users"))
+	}
+	view, err := srv.OpenView(users[0].ID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the view"))
+	}
+	defer view.DB.Close()
+
+	testutils.MustScan(t, "counting notes in the view", view.DB.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.AssertEqualf(t, noteCount, 2, "view note count mismatch")
+}
+
+func TestSync_Remote(t *testing.T) {
+	// Set up a team server next to the default one
+	dir, err := ioutil.TempDir("", "dnote-server")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	srv, err := server.Open(dir)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the server"))
+	}
+	defer srv.Close()
+	teamServer := httptest.NewServer(srv)
+	defer teamServer.Close()
+
+	apiKey, err := srv.AddUser("alice")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "adding a user"))
+	}
+
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+	db := ctx.DB
+
+	// The default server returns a note added on another machine
+	defaultNote := actions.Action{
+		UUID:      "default-action-uuid",
+		Schema:    2,
+		Type:      actions.ActionAddNote,
+		Timestamp: 1517629805,
+		Data: mustMarshal(t, actions.AddNoteDataV2{
+			NoteUUID: "06896551-8a06-4996-89cc-0d866308b0f6",
+			BookName: "js",
+			Content:  "default note",
+		}),
+	}
+	defaultServer := &fakeSyncServer{delta: []actions.Action{defaultNote}, bookmark: 5}
+	setSyncHandler(defaultServer.handle)
+
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+	testutils.RunDnoteCmd(t, ctx, binaryName, "remote", "add", "team", teamServer.URL, "--api-key", apiKey, "--book", "work")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "personal note")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "work", "-c", "team note")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync", "--remote", "team")
+
+	// Test that the team server received only the team book
+	view, err := srv.OpenView(1)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the view"))
+	}
+	defer view.DB.Close()
+
+	var teamNoteCount, teamBookCount, actionCount int
+	var defaultBookmark, teamBookmark, teamContent string
+	testutils.MustScan(t, "counting notes on the team server", view.DB.QueryRow("SELECT count(*) FROM notes"), &teamNoteCount)
+	testutils.MustScan(t, "counting books on the team server", view.DB.QueryRow("SELECT count(*) FROM books"), &teamBookCount)
+	testutils.MustScan(t, "getting the note on the team server", view.DB.QueryRow("SELECT content FROM notes"), &teamContent)
+	testutils.MustScan(t, "getting the default bookmark", db.QueryRow("SELECT value FROM system WHERE key = ?", "bookmark"), &defaultBookmark)
+	testutils.MustScan(t, "getting the team bookmark", db.QueryRow("SELECT value FROM system WHERE key = ?", "remote.team.bookmark"), &teamBookmark)
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+
+	testutils.AssertEqualf(t, teamNoteCount, 1, "team server note count mismatch")
+	testutils.AssertEqualf(t, teamBookCount, 1, "team server book count mismatch")
+	testutils.AssertEqual(t, teamContent, "team note", "team server note mismatch")
+	testutils.AssertEqual(t, defaultBookmark, "0", "default bookmark mismatch")
+	testutils.AssertEqual(t, teamBookmark, "2", "team bookmark mismatch")
+	testutils.AssertEqualf(t, len(defaultServer.received), 0, "default server received action count mismatch")
+	testutils.AssertEqualf(t, actionCount, 2, "action count mismatch")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+	defaultServer.delta = []actions.Action{}
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync", "--remote", "team")
+
+	// Test that neither server received the notes of the other
+	testutils.MustScan(t, "counting notes on the team server", view.DB.QueryRow("SELECT count(*) FROM notes"), &teamNoteCount)
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+
+	testutils.AssertEqualf(t, len(defaultServer.received), 2, "default server received action count mismatch after syncing")
+	for _, action := range defaultServer.received {
+		testutils.AssertEqual(t, strings.Contains(string(action.Data), "work"), false, "team book sent to the default server")
+	}
+	testutils.AssertEqualf(t, teamNoteCount, 1, "team server note count mismatch after syncing")
+	testutils.AssertEqualf(t, actionCount, 0, "action count mismatch after syncing")
+
+	// Test that a note cannot leave the team book for a personal one
+	var teamNoteID int
+	testutils.MustScan(t, "getting the team note", db.QueryRow("SELECT id FROM notes WHERE content = ?", "team note"), &teamNoteID)
+	runDnoteCmdWithError(t, ctx, "mv", "work", strconv.Itoa(teamNoteID), "js")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "remote", "remove", "team")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+
+	// Test that the default server receives the team book once the remote is removed
+	testutils.AssertEqualf(t, len(defaultServer.received), 4, "default server received action count mismatch after removing the remote")
+	testutils.AssertEqual(t, defaultServer.received[2].Type, actions.ActionAddBook, "received action type mismatch after removing the remote")
+}
+
+func TestSync_InterruptedRemote(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+	db := ctx.DB
+
+	teamServer := &fakeSyncServer{delta: []actions.Action{}, bookmark: 1}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response is lost after the team server stored the actions
+		if err := teamServer.readActions(r); err != nil {
+			panic(err)
+		}
+		panic(http.ErrAbortHandler)
+	}))
+	defer s.Close()
+
+	defaultServer := &fakeSyncServer{delta: []actions.Action{}, bookmark: 1}
+	setSyncHandler(defaultServer.handle)
+
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+	testutils.RunDnoteCmd(t, ctx, binaryName, "remote", "add", "team", s.URL, "--api-key", "team-api-key", "--book", "work")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "work", "-c", "foo")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "bar")
+	runDnoteCmdWithError(t, ctx, "sync", "--remote", "team")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync")
+
+	// Test that the default remote neither resumed the sync with the team
+	// remote nor deleted the actions sent to it
+	var teamJournalCount, actionCount int
+	testutils.MustScan(t, "counting the team journal", db.QueryRow("SELECT count(*) FROM sync_journal WHERE remote = ?", "team"), &teamJournalCount)
+	testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+
+	testutils.AssertEqualf(t, len(teamServer.received), 2, "team server received action count mismatch")
+	testutils.AssertEqualf(t, len(defaultServer.received), 2, "default server received action count mismatch")
+	testutils.AssertEqualf(t, teamJournalCount, 2, "team journal count mismatch")
+	testutils.AssertEqualf(t, actionCount, 2, "action count mismatch")
+}
+
+func TestSync_EndpointFlag(t *testing.T) {
+	// Set up
+	flagServer := &fakeSyncServer{delta: []actions.Action{}, bookmark: 1}
+	s := httptest.NewServer(http.HandlerFunc(flagServer.handle))
+	defer s.Close()
+
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	defaultServer := &fakeSyncServer{delta: []actions.Action{}, bookmark: 1}
+	setSyncHandler(defaultServer.handle)
+
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync", "--remote", s.URL)
+
+	// Test
+	var bookmark string
+	testutils.MustScan(t, "getting the bookmark", ctx.DB.QueryRow("SELECT value FROM system WHERE key = ?", "bookmark"), &bookmark)
+
+	testutils.AssertEqualf(t, len(flagServer.received), 2, "flag server received action count mismatch")
+	testutils.AssertEqualf(t, len(defaultServer.received), 0, "default server received action count mismatch")
+	testutils.AssertEqual(t, bookmark, "1", "bookmark mismatch")
+}
+
+func TestSync_EndpointEnv(t *testing.T) {
+	// Set up
+	envServer := &fakeSyncServer{delta: []actions.Action{}, bookmark: 1}
+	s := httptest.NewServer(http.HandlerFunc(envServer.handle))
+	defer s.Close()
+
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	defaultServer := &fakeSyncServer{delta: []actions.Action{}, bookmark: 1}
+	setSyncHandler(defaultServer.handle)
+
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	// Execute
+	cmd, _, stdout, err := testutils.NewDnoteCmd(ctx, binaryName, "sync")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("DNOTE_API_ENDPOINT=%s", s.URL))
+	if err := cmd.Run(); err != nil {
+		t.Logf("\n%s", stdout)
+		t.Fatal(errors.Wrap(err, "running sync"))
+	}
+
+	// Test
+	testutils.AssertEqualf(t, len(envServer.received), 2, "env server received action count mismatch")
+	testutils.AssertEqualf(t, len(defaultServer.received), 0, "default server received action count mismatch")
+}
+
+func TestSync_Directory(t *testing.T) {
+	// Set up a machine with notes
+	dir, err := ioutil.TempDir("", "dnote-shared")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "remote", "add", "shared", dir, "--book", "js")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync", "--remote", "shared")
+	testutils.TeardownEnv(ctx)
+
+	// Test that another machine receives the notes
+	ctx = testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "remote", "add", "shared", fmt.Sprintf("file://%s", dir))
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync", "--remote", "shared")
+
+	db := ctx.DB
+	var content, bookmark string
+	testutils.MustScan(t, "getting the note", db.QueryRow("SELECT content FROM notes"), &content)
+	testutils.MustScan(t, "getting the bookmark", db.QueryRow("SELECT value FROM system WHERE key = ?", "remote.shared.bookmark"), &bookmark)
+
+	testutils.AssertEqual(t, content, "foo", "note content mismatch")
+	testutils.AssertEqual(t, bookmark, "1", "bookmark mismatch")
+
+	// Test that the book received from the remote is synced with it
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "bar")
+
+	var remote string
+	var pendingCount int
+	testutils.MustScan(t, "getting the remote of the book", db.QueryRow("SELECT remote FROM remote_books"), &remote)
+	testutils.MustScan(t, "counting pending actions", db.QueryRow("SELECT count(*) FROM pending_actions WHERE remote = ?", "shared"), &pendingCount)
+
+	testutils.AssertEqual(t, remote, "shared", "book remote mismatch")
+	testutils.AssertEqual(t, pendingCount, 1, "pending action count mismatch")
+}
+
+func TestSync_Encryption(t *testing.T) {
+	// Set up a machine with encryption enabled
+	dir, err := ioutil.TempDir("", "dnote-shared")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("secret", "secret"), binaryName, "keys", "init")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "remote", "add", "shared", dir, "--book", "js")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync", "--remote", "shared")
+
+	// Test that the contents leave the machine encrypted
+	var localContent string
+	testutils.MustScan(t, "getting the local note", ctx.DB.QueryRow("SELECT content FROM notes"), &localContent)
+	testutils.AssertEqual(t, localContent, "foo", "local content mismatch")
+	testutils.TeardownEnv(ctx)
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "0000000001.json"))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the segment"))
+	}
+	testutils.AssertEqual(t, strings.Contains(string(b), "dnote:enc:v1:"), true, "content not encrypted")
+
+	// Test that another machine needs the passphrase
+	ctx = testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "remote", "add", "shared", dir)
+
+	runDnoteCmdWithError(t, ctx, "sync", "--remote", "shared")
+
+	var noteCount int
+	testutils.MustScan(t, "counting notes", ctx.DB.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.AssertEqual(t, noteCount, 0, "note count mismatch")
+
+	runDnoteCmdWithError(t, ctx, "keys", "add")
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("wrong"), binaryName, "keys", "add")
+	runDnoteCmdWithError(t, ctx, "sync", "--remote", "shared")
+	testutils.MustScan(t, "counting notes", ctx.DB.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.AssertEqual(t, noteCount, 0, "note count mismatch after a wrong passphrase")
+
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("secret"), binaryName, "keys", "add")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "sync", "--remote", "shared")
+
+	var content string
+	testutils.MustScan(t, "getting the note", ctx.DB.QueryRow("SELECT content FROM notes"), &content)
+	testutils.AssertEqual(t, content, "foo", "note content mismatch")
+}
+
+func TestKeysRotate(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	runDnoteCmdWithError(t, ctx, "keys", "rotate")
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("secret", "secret"), binaryName, "keys", "init")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "bar #idea")
+
+	// Execute
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("new secret", "new secret"), binaryName, "keys", "rotate")
+
+	// Test
+	var editCount int
+	testutils.MustScan(t, "counting edit actions", ctx.DB.QueryRow("SELECT count(*) FROM actions WHERE type = ?", actions.ActionEditNote), &editCount)
+	var tagsCount int
+	testutils.MustScan(t, "counting tags actions", ctx.DB.QueryRow("SELECT count(*) FROM actions WHERE type = ?", "set_note_tags"), &tagsCount)
+	testutils.AssertEqual(t, editCount, 2, "edit action count mismatch")
+	// The tags were set when the note was added and once more for the new key
+	testutils.AssertEqual(t, tagsCount, 2, "tags action count mismatch")
+
+	config, err := core.ReadConfig(ctx)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "reading the config"))
+	}
+	testutils.AssertEqual(t, len(config.EncryptionKeys), 2, "key count mismatch")
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+
+	// Execute
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("secret", "secret"), binaryName, "encrypt")
+
+	// Test
+	dbPath := infra.GetDBPath(ctx.DnoteDir)
+	testutils.AssertEqual(t, utils.FileExists(dbPath), false, "plain database exists")
+	testutils.AssertEqual(t, utils.FileExists(infra.GetEncryptedDBPath(ctx.DnoteDir)), true, "encrypted database does not exist")
+
+	// Execute with the input piped, which is not taken for the passphrase
+	cmd, _, stdout, err := testutils.NewDnoteCmd(ctx, binaryName, "add", "js", "-c", "baz")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	cmd.Stdin = strings.NewReader("secret\n")
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the command to fail without the passphrase in the environment")
+	}
+	testutils.AssertEqual(t, strings.Contains(stdout.String(), "DNOTE_PASSPHRASE"), true, "the message does not mention DNOTE_PASSPHRASE")
+
+	cmd, _, stdout, err = testutils.NewDnoteCmd(ctx, binaryName, "add", "js", "-c", "bar")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	cmd.Env = append(cmd.Env, "DNOTE_PASSPHRASE=secret")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(errors.Wrap(err, "adding a note"))
+	}
+
+	cmd, _, stdout, err = testutils.NewDnoteCmd(ctx, binaryName, "view", "js")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	cmd.Env = append(cmd.Env, "DNOTE_PASSPHRASE=secret")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(errors.Wrap(err, "viewing notes"))
+	}
+	testutils.AssertEqual(t, strings.Contains(stdout.String(), "bar"), true, "added note is not listed")
+	testutils.AssertEqual(t, strings.Contains(stdout.String(), "baz"), false, "note is added with the piped input taken for the passphrase")
+
+	cmd, _, stdout, err = testutils.NewDnoteCmd(ctx, binaryName, "view", "js")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	cmd.Env = append(cmd.Env, "DNOTE_PASSPHRASE=wrong")
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the command to fail with a wrong passphrase")
+	}
+	testutils.AssertEqual(t, strings.Contains(stdout.String(), "bar"), false, "note is listed with a wrong passphrase")
+
+	// Execute
+	cmd, _, _, err = testutils.NewDnoteCmd(ctx, binaryName, "decrypt")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	cmd.Env = append(cmd.Env, "DNOTE_PASSPHRASE=secret")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(errors.Wrap(err, "decrypting"))
+	}
+
+	// Test
+	testutils.AssertEqual(t, utils.FileExists(infra.GetEncryptedDBPath(ctx.DnoteDir)), false, "encrypted database exists")
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the database"))
+	}
+	defer db.Close()
+
+	var noteCount int
+	var content string
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.MustScan(t, "getting the note", db.QueryRow("SELECT content FROM notes WHERE content = ?", "bar"), &content)
+	testutils.AssertEqual(t, noteCount, 2, "note count mismatch")
+	testutils.AssertEqual(t, content, "bar", "note content mismatch")
+}
+
+// runDnoteCmdOutput runs a dnote command and returns the stdout
+func runDnoteCmdOutput(t *testing.T, ctx infra.DnoteCtx, arg ...string) []byte {
+	t.Logf("running: %s %v", binaryName, arg)
+
+	cmd, stderr, stdout, err := testutils.NewDnoteCmd(ctx, binaryName, arg...)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting command"))
+	}
+	if err := cmd.Run(); err != nil {
+		t.Fatal(errors.Wrapf(err, "running command %s", stderr.String()))
+	}
+
+	return stdout.Bytes()
+}
+
+func TestOutput(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	// Execute
+	var added output.Note
+	if err := json.Unmarshal(runDnoteCmdOutput(t, ctx, "add", "js", "-c", "foo\nbar", "--output", "json"), &added); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the added note"))
+	}
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "baz")
+
+	var edited output.Note
+	if err := json.Unmarshal(runDnoteCmdOutput(t, ctx, "edit", "js", "2", "-c", "qux", "--output", "json"), &edited); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the edited note"))
+	}
+
+	var notes []output.Note
+	if err := json.Unmarshal(runDnoteCmdOutput(t, ctx, "view", "js", "--output", "json"), &notes); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the notes"))
+	}
+
+	var note output.Note
+	if err := yaml.Unmarshal(runDnoteCmdOutput(t, ctx, "view", "js", "1", "--output", "yaml"), &note); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the note"))
+	}
+
+	books := string(runDnoteCmdOutput(t, ctx, "view", "--output", "tsv"))
+
+	// Test
+	var noteUUID string
+	testutils.MustScan(t, "getting the note", ctx.DB.QueryRow("SELECT uuid FROM notes WHERE id = 1"), &noteUUID)
+
+	testutils.AssertEqual(t, added.UUID, noteUUID, "added note uuid mismatch")
+	testutils.AssertEqual(t, added.ID, 1, "added note id mismatch")
+	testutils.AssertEqual(t, added.Book, "js", "added note book mismatch")
+	testutils.AssertEqual(t, added.Content, "foo\nbar", "added note content mismatch")
+	testutils.AssertNotEqual(t, added.AddedOn, int64(0), "added note added_on mismatch")
+	testutils.AssertEqual(t, edited.ID, 2, "edited note id mismatch")
+	testutils.AssertEqual(t, edited.Content, "qux", "edited note content mismatch")
+	testutils.AssertNotEqual(t, edited.EditedOn, int64(0), "edited note edited_on mismatch")
+	testutils.AssertEqual(t, len(notes), 2, "note count mismatch")
+	testutils.AssertEqual(t, notes[0].UUID, noteUUID, "listed note uuid mismatch")
+	testutils.AssertEqual(t, notes[1].Content, "qux", "listed note content mismatch")
+	testutils.AssertEqual(t, note.UUID, noteUUID, "viewed note uuid mismatch")
+	testutils.AssertEqual(t, note.Content, "foo\nbar", "viewed note content mismatch")
+	testutils.AssertEqual(t, books, "label\tnote_count\njs\t2\n", "books mismatch")
+
+	runDnoteCmdWithError(t, ctx, "view", "--output", "xml")
+}
+
+func TestOutput_Sync(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+	if err := core.WriteConfig(ctx, infra.Config{APIKey: "test-api-key"}); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the config"))
+	}
+
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+
+	server := &fakeSyncServer{delta: []actions.Action{}, bookmark: 7}
+	setSyncHandler(server.handle)
+
+	// Execute
+	var result output.Sync
+	if err := json.Unmarshal(runDnoteCmdOutput(t, ctx, "sync", "--output", "json"), &result); err != nil {
+		t.Fatal(errors.Wrap(err, "decoding the result"))
+	}
+
+	// Test
+	testutils.AssertEqual(t, result.Remote, "default", "remote mismatch")
+	testutils.AssertEqual(t, result.Sent, len(server.received), "sent count mismatch")
+	testutils.AssertEqual(t, result.Received, 0, "received count mismatch")
+	testutils.AssertEqual(t, result.Bookmark, 7, "bookmark mismatch")
+}
+
+// pipeInput returns a function that writes the input to stdin and closes it
+func pipeInput(input string) func(io.WriteCloser) error {
+	return func(stdin io.WriteCloser) error {
+		if _, err := io.WriteString(stdin, input); err != nil {
+			return errors.Wrap(err, "writing to stdin")
+		}
+
+		return stdin.Close()
+	}
+}
+
+func TestAddNote_Stdin(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	// Execute
+	testutils.WaitDnoteCmd(t, ctx, pipeInput("commit 1a2b3c\n\n    fix the build\n"), binaryName, "add", "git")
+	testutils.WaitDnoteCmd(t, ctx, pipeInput("foo\n---\nbar #shell\n"), binaryName, "add", "linux", "-c", "-", "--split-on", "---")
+
+	// Test
+	db := ctx.DB
+
+	var gitContent string
+	var linuxCount, actionCount, tagCount int
+	testutils.MustScan(t, "getting the git note", db.QueryRow("SELECT notes.content FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ?", "git"), &gitContent)
+	testutils.MustScan(t, "counting linux notes", db.QueryRow("SELECT count(*) FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ?", "linux"), &linuxCount)
+	testutils.MustScan(t, "counting add_note actions", db.QueryRow("SELECT count(*) FROM actions WHERE type = ?", actions.ActionAddNote), &actionCount)
+	testutils.MustScan(t, "counting note tags", db.QueryRow("SELECT count(*) FROM note_tags"), &tagCount)
+
+	testutils.AssertEqual(t, gitContent, "commit 1a2b3c\n\n    fix the build", "git note content mismatch")
+	testutils.AssertEqual(t, linuxCount, 2, "linux note count mismatch")
+	testutils.AssertEqual(t, actionCount, 3, "add_note action count mismatch")
+	testutils.AssertEqual(t, tagCount, 1, "note tag count mismatch")
+}
+
+func TestAddNote_File(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	path := filepath.Join(ctx.DnoteDir, "notes.md")
+	if err := ioutil.WriteFile(path, []byte("# foo\n%%\n# bar\n"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "writing the file"))
+	}
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "--file", path)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "linux", "--file", path, "--split-on", "%%")
+	runDnoteCmdWithError(t, ctx, "add", "js", "--file", path, "-c", "foo")
+
+	// Test
+	db := ctx.DB
+
+	var jsContent string
+	testutils.MustScan(t, "getting the js note", db.QueryRow("SELECT notes.content FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ?", "js"), &jsContent)
+	rows, err := db.Query("SELECT notes.content FROM notes INNER JOIN books ON books.uuid = notes.book_uuid WHERE books.label = ? ORDER BY notes.id", "linux")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "querying linux notes"))
+	}
+	defer rows.Close()
+	linuxContents := []string{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			t.Fatal(errors.Wrap(err, "scanning a row"))
+		}
+		linuxContents = append(linuxContents, c)
+	}
+
+	testutils.AssertEqual(t, jsContent, "# foo\n%%\n# bar", "js note content mismatch")
+	testutils.AssertDeepEqual(t, linuxContents, []string{"# foo", "# bar"}, "linux note contents mismatch")
+}
+
+func TestEditNote_ShortID(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "edit", "3e065d55", "-c", "wc -w to count words")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "view", "3e06")
+	runDnoteCmdWithError(t, ctx, "edit", "3e0", "-c", "foo")
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "js", "43827b9a")
+
+	// Test
+	db := ctx.DB
+
+	var content string
+	var noteCount int
+	testutils.MustScan(t, "getting the note", db.QueryRow("SELECT content FROM notes WHERE uuid = ?", "3e065d55-6d47-42f2-a6bf-f5844130b2d2"), &content)
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes WHERE uuid = ?", "43827b9a-c2b0-4c06-a290-97991c896653"), &noteCount)
+
+	testutils.AssertEqual(t, content, "wc -w to count words", "note content mismatch")
+	testutils.AssertEqual(t, noteCount, 0, "removed note count mismatch")
+}
+
+func TestCompletion(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "linux", "-c", "wc -l\tcounts lines\nin a file")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "js", "-c", "foo")
+
+	// Execute
+	books := string(runDnoteCmdOutput(t, ctx, "__complete", "view", "li"))
+	notes := string(runDnoteCmdOutput(t, ctx, "__complete", "edit", "linux", ""))
+	script := string(runDnoteCmdOutput(t, ctx, "completion", "bash"))
+
+	// Test
+	testutils.AssertEqual(t, books, "linux\t1 note\n", "books mismatch")
+	testutils.AssertEqual(t, notes, "1\twc -l counts lines...\n", "notes mismatch")
+	testutils.AssertEqual(t, strings.Contains(script, "dnote __complete"), true, "script does not call the complete command")
+
+	// Execute with the database encrypted and no passphrase
+	testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("secret", "secret"), binaryName, "encrypt")
+	locked := string(runDnoteCmdOutput(t, ctx, "__complete", "view", ""))
+
+	// Test
+	testutils.AssertEqual(t, locked, "", "candidates are completed without the passphrase")
+}
+
+func TestPublish(t *testing.T) {
+	// Set up
+	ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	testutils.Setup2(t, ctx)
+	testutils.RunDnoteCmd(t, ctx, binaryName, "add", "go", "--public", "-c", "gofmt formats the code")
+
+	// Execute
+	testutils.RunDnoteCmd(t, ctx, binaryName, "publish", "js", "1")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "publish", "3e06")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "unpublish", "3e06")
+	runDnoteCmdWithError(t, ctx, "unpublish", "js", "2")
+
+	// Test
+	db := ctx.DB
+
+	var jsPublic, linuxPublic, goPublic bool
+	testutils.MustScan(t, "getting the js note", db.QueryRow("SELECT public FROM notes WHERE uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &jsPublic)
+	testutils.MustScan(t, "getting the linux note", db.QueryRow("SELECT public FROM notes WHERE uuid = ?", "3e065d55-6d47-42f2-a6bf-f5844130b2d2"), &linuxPublic)
+	testutils.MustScan(t, "getting the go note", db.QueryRow(`SELECT notes.public FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE books.label = ?`, "go"), &goPublic)
+
+	testutils.AssertEqual(t, jsPublic, true, "js note public mismatch")
+	testutils.AssertEqual(t, linuxPublic, false, "linux note public mismatch")
+	testutils.AssertEqual(t, goPublic, true, "go note public mismatch")
+
+	var addData actions.AddNoteDataV2
+	var addJSON string
+	testutils.MustScan(t, "getting the add action", db.QueryRow("SELECT data FROM actions WHERE type = ?", actions.ActionAddNote), &addJSON)
+	if err := json.Unmarshal([]byte(addJSON), &addData); err != nil {
+		t.Fatal(errors.Wrap(err, "unmarshalling the add action"))
+	}
+	testutils.AssertEqual(t, addData.Public, true, "add action public mismatch")
+
+	var editData actions.EditNoteDataV2
+	var editJSON string
+	var editSchema int
+	testutils.MustScan(t, "getting the edit action", db.QueryRow("SELECT schema, data FROM actions WHERE type = ? ORDER BY rowid ASC LIMIT 1", actions.ActionEditNote), &editSchema, &editJSON)
+	if err := json.Unmarshal([]byte(editJSON), &editData); err != nil {
+		t.Fatal(errors.Wrap(err, "unmarshalling the edit action"))
+	}
+	testutils.AssertEqual(t, editSchema, 2, "edit action schema mismatch")
+	testutils.AssertEqual(t, editData.NoteUUID, "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f", "edit action note uuid mismatch")
+	testutils.AssertEqual(t, editData.FromBook, "js", "edit action book mismatch")
+	testutils.AssertEqual(t, *editData.Public, true, "edit action public mismatch")
+	testutils.AssertEqual(t, editData.Content == nil, true, "edit action should not change the content")
+
+	// Execute
+	out := filepath.Join(ctx.DnoteDir, "site")
+	testutils.RunDnoteCmd(t, ctx, binaryName, "site", "build", "--out", out)
+
+	// Test
+	notePages, err := filepath.Glob(filepath.Join(out, "notes", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutils.AssertEqual(t, len(notePages), 2, "note pages count mismatch")
+	testutils.AssertEqual(t, utils.FileExists(filepath.Join(out, "notes", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f.html")), true, "js note page does not exist")
+	testutils.AssertEqual(t, utils.FileExists(filepath.Join(out, "books", "go.html")), true, "go book page does not exist")
+	testutils.AssertEqual(t, utils.FileExists(filepath.Join(out, "books", "linux.html")), false, "linux book page exists")
+
+	feed, err := ioutil.ReadFile(filepath.Join(out, "feed.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutils.AssertEqual(t, strings.Contains(string(feed), "urn:uuid:f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), true, "feed does not have the js note")
+	testutils.AssertEqual(t, strings.Contains(string(feed), "wc -l"), false, "feed has the unpublished note")
+}
+
+func TestReview(t *testing.T) {
+	testCases := []struct {
+		syncReviews         bool
+		expectedActionCount int
+	}{
+		{
+			syncReviews:         false,
+			expectedActionCount: 0,
+		},
+		{
+			syncReviews:         true,
+			expectedActionCount: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("sync reviews %t", tc.syncReviews), func(t *testing.T) {
+			// Set up
+			ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			testutils.Setup2(t, ctx)
+			if err := core.WriteConfig(ctx, infra.Config{SyncReviews: tc.syncReviews}); err != nil {
+				t.Fatal(errors.Wrap(err, "writing the config"))
+			}
+
+			// Execute
+			testutils.WaitDnoteCmd(t, ctx, testutils.UserInput("4", "x", "1", "q"), binaryName, "review")
+
+			// Test
+			db := ctx.DB
+
+			var reviewCount, actionCount int
+			testutils.MustScan(t, "counting reviews", db.QueryRow("SELECT count(*) FROM reviews"), &reviewCount)
+			testutils.MustScan(t, "counting actions", db.QueryRow("SELECT count(*) FROM actions WHERE type = ?", core.ActionReviewNote), &actionCount)
+			testutils.AssertEqual(t, reviewCount, 2, "review count mismatch")
+			testutils.AssertEqual(t, actionCount, tc.expectedActionCount, "action count mismatch")
+
+			var r1, r2 core.Review
+			testutils.MustScan(t, "scanning the review of note 1", db.QueryRow("SELECT ease, interval, repetitions FROM reviews WHERE note_uuid = ?", "43827b9a-c2b0-4c06-a290-97991c896653"), &r1.Ease, &r1.Interval, &r1.Repetitions)
+			testutils.MustScan(t, "scanning the review of note 2", db.QueryRow("SELECT ease, interval, repetitions FROM reviews WHERE note_uuid = ?", "f0d0fbb7-31ff-45ae-9f0f-4e429c0c797f"), &r2.Ease, &r2.Interval, &r2.Repetitions)
+			testutils.AssertEqual(t, r1.Interval, 1, "note 1 interval mismatch")
+			testutils.AssertEqual(t, r1.Repetitions, 1, "note 1 repetitions mismatch")
+			testutils.AssertEqual(t, r2.Interval, 1, "note 2 interval mismatch")
+			testutils.AssertEqual(t, r2.Repetitions, 0, "note 2 repetitions mismatch")
+			testutils.AssertEqual(t, r2.Ease < r1.Ease, true, "a forgotten note should become harder")
+
+			// Execute
+			out := runDnoteCmdOutput(t, ctx, "review", "--book", "js")
+
+			// Test
+			if !strings.Contains(string(out), "no notes to review") {
+				t.Fatalf("expected nothing to review, got %s", out)
+			}
+		})
+	}
+}
+
+// replayNote is a note as stored on a machine. The book is identified by its
+// label because the uuids of the books are generated by each machine.
+type replayNote struct {
+	UUID     string
+	Book     string
+	Content  string
+	AddedOn  int64
+	EditedOn int64
+	Public   bool
+}
+
+// getReplayState returns the labels of the books and the notes in the database
+func getReplayState(t *testing.T, db *sql.DB) ([]string, []replayNote) {
+	books := []string{}
+	rows, err := db.Query("SELECT label FROM books ORDER BY label ASC")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "querying books"))
+	}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			t.Fatal(errors.Wrap(err, "scanning a book"))
+		}
+		books = append(books, label)
+	}
+	rows.Close()
+
+	notes := []replayNote{}
+	rows, err = db.Query(`SELECT notes.uuid, books.label, notes.content, notes.added_on, notes.edited_on, notes.public
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		ORDER BY notes.uuid ASC`)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "querying notes"))
+	}
+	for rows.Next() {
+		var n replayNote
+		if err := rows.Scan(&n.UUID, &n.Book, &n.Content, &n.AddedOn, &n.EditedOn, &n.Public); err != nil {
+			t.Fatal(errors.Wrap(err, "scanning a note"))
+		}
+		notes = append(notes, n)
+	}
+	rows.Close()
+
+	return books, notes
+}
+
+// runRandomCommand runs a command changing the notes or the books, chosen by r
+func runRandomCommand(t *testing.T, ctx infra.DnoteCtx, r *rand.Rand, seq int) {
+	db := ctx.DB
+	labels := []string{"js", "linux", "go", "css"}
+
+	var noteCount int
+	testutils.MustScan(t, "counting notes", db.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	if noteCount == 0 {
+		testutils.RunDnoteCmd(t, ctx, binaryName, "add", labels[r.Intn(len(labels))], "-c", fmt.Sprintf("note %d", seq))
+		return
+	}
+
+	var noteID int
+	var noteUUID, bookLabel string
+	var public bool
+	testutils.MustScan(t, "picking a note", db.QueryRow(`SELECT notes.id, notes.uuid, books.label, notes.public
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		ORDER BY notes.id ASC LIMIT 1 OFFSET ?`, r.Intn(noteCount)), &noteID, &noteUUID, &bookLabel, &public)
+
+	switch r.Intn(8) {
+	case 0, 1:
+		args := []string{"add", labels[r.Intn(len(labels))], "-c", fmt.Sprintf("note %d", seq)}
+		if r.Intn(2) == 0 {
+			args = append(args, "--public")
+		}
+		testutils.RunDnoteCmd(t, ctx, binaryName, args...)
+	case 2:
+		testutils.RunDnoteCmd(t, ctx, binaryName, "edit", noteUUID, "-c", fmt.Sprintf("edited %d", seq))
+	case 3:
+		dest := labels[r.Intn(len(labels))]
+		if dest != bookLabel {
+			testutils.RunDnoteCmd(t, ctx, binaryName, "mv", bookLabel, strconv.Itoa(noteID), dest)
+		}
+	case 4:
+		if public {
+			testutils.RunDnoteCmd(t, ctx, binaryName, "unpublish", noteUUID)
+		} else {
+			testutils.RunDnoteCmd(t, ctx, binaryName, "publish", noteUUID)
+		}
+	case 5:
+		newLabel := fmt.Sprintf("%s-%d", bookLabel, seq)
+		testutils.RunDnoteCmd(t, ctx, binaryName, "edit", "--book", bookLabel, "--name", newLabel)
+		labels = append(labels, newLabel)
+	case 6:
+		testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", noteUUID)
+	case 7:
+		testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "remove", "-b", bookLabel)
+	}
+}
+
+// TestReplayActions checks that reducing the actions logged on a machine into an
+// empty database reproduces the notes and books of the machine
+func TestReplayActions(t *testing.T) {
+	for seed := int64(1); seed <= 4; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			// Set up
+			ctx := testutils.InitEnv("../tmp", "./testutils/fixtures/schema.sql")
+			defer testutils.TeardownEnv(ctx)
+
+			// The imported notes have been edited and published on another machine
+			archive := export.Archive{
+				Version: export.ArchiveVersion,
+				Books: []export.ArchiveBook{
+					{
+						Label: "imported",
+						Notes: []export.ArchiveNote{
+							{UUID: "a0c8e4a6-6f5b-4d0e-9f0e-6a3f3c2b1d01", Content: "private", AddedOn: 1515199943},
+							{UUID: "a0c8e4a6-6f5b-4d0e-9f0e-6a3f3c2b1d02", Content: "public", AddedOn: 1515199944, Public: true},
+							{UUID: "a0c8e4a6-6f5b-4d0e-9f0e-6a3f3c2b1d03", Content: "edited", AddedOn: 1515199945, EditedOn: 1515199999},
+							{UUID: "a0c8e4a6-6f5b-4d0e-9f0e-6a3f3c2b1d04", Content: "edited public", AddedOn: 1515199946, EditedOn: 1515199998, Public: true},
+						},
+					},
+				},
+			}
+			b, err := json.Marshal(archive)
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "marshalling the archive"))
+			}
+			archivePath := filepath.Join(ctx.DnoteDir, "archive.json")
+			if err := ioutil.WriteFile(archivePath, b, 0644); err != nil {
+				t.Fatal(errors.Wrap(err, "writing the archive"))
+			}
+
+			// Execute
+			testutils.RunDnoteCmd(t, ctx, binaryName, "import", archivePath)
+
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 20; i++ {
+				runRandomCommand(t, ctx, r, i)
+			}
+
+			// The removals are logged when the trash is emptied
+			testutils.WaitDnoteCmd(t, ctx, testutils.UserConfirm, binaryName, "trash", "empty")
+
+			db := ctx.DB
+			rows, err := db.Query("SELECT uuid, schema, type, data, timestamp FROM actions ORDER BY rowid ASC")
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "querying actions"))
+			}
+			actionSlice := []actions.Action{}
+			for rows.Next() {
+				var action actions.Action
+				var data string
+				if err := rows.Scan(&action.UUID, &action.Schema, &action.Type, &data, &action.Timestamp); err != nil {
+					t.Fatal(errors.Wrap(err, "scanning an action"))
+				}
+				action.Data = json.RawMessage(data)
+				actionSlice = append(actionSlice, action)
+			}
+			rows.Close()
+
+			replayDB, err := sql.Open("sqlite3", filepath.Join(ctx.DnoteDir, "replay.db"))
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "opening the replay database"))
+			}
+			defer replayDB.Close()
+			if _, err := replayDB.Exec(string(testutils.ReadFileAbs("./testutils/fixtures/schema.sql"))); err != nil {
+				t.Fatal(errors.Wrap(err, "setting up the replay database"))
+			}
+			replayCtx := infra.DnoteCtx{DnoteDir: ctx.DnoteDir, DB: replayDB}
+
+			tx, err := replayDB.Begin()
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "beginning a transaction"))
+			}
+			if err := core.ReduceAll(replayCtx, tx, actionSlice); err != nil {
+				tx.Rollback()
+				t.Fatal(errors.Wrap(err, "reducing actions"))
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(errors.Wrap(err, "committing the transaction"))
+			}
+
+			// Test
+			books, notes := getReplayState(t, db)
+			replayedBooks, replayedNotes := getReplayState(t, replayDB)
+
+			testutils.AssertDeepEqual(t, replayedBooks, books, "books mismatch")
+			testutils.AssertDeepEqual(t, replayedNotes, notes, "notes mismatch")
+
+			var quarantineCount int
+			testutils.MustScan(t, "counting quarantined actions", replayDB.QueryRow("SELECT count(*) FROM quarantined_actions"), &quarantineCount)
+			testutils.AssertEqual(t, quarantineCount, 0, "quarantined action count mismatch")
+		})
+	}
 }
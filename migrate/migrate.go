@@ -8,12 +8,29 @@ import (
 	"github.com/pkg/errors"
 )
 
+// ErrNoFTS5 is an error returned when SQLite was built without FTS5, which the
+// note search index and its triggers need. go-sqlite3 only includes it with
+// the fts5 build tag.
+var ErrNoFTS5 = errors.New("sqlite was built without fts5")
+
 type migration struct {
 	name string
 	sql  string
 }
 
-var migrations = []migration{}
+var migrations = []migration{
+	{name: "create-note-fts", sql: sqlCreateNoteFTS},
+	{name: "create-tags", sql: sqlCreateTags},
+	{name: "create-note-revisions", sql: sqlCreateNoteRevisions},
+	{name: "create-trash", sql: sqlCreateTrash},
+	{name: "create-sync-journal", sql: sqlCreateSyncJournal},
+	{name: "create-conflicts", sql: sqlCreateConflicts},
+	{name: "create-reviews", sql: sqlCreateReviews},
+	{name: "create-quarantined-actions", sql: sqlCreateQuarantinedActions},
+	{name: "key-sync-journal-by-remote", sql: sqlKeySyncJournalByRemote},
+	{name: "create-book-aliases", sql: sqlCreateBookAliases},
+	{name: "scope-remotes-by-book", sql: sqlScopeRemotesByBook},
+}
 
 func initSchema(db *sql.DB) (int, error) {
 	schemaVersion := 0
@@ -68,10 +85,27 @@ func execute(ctx infra.DnoteCtx, nextSchema int, m migration) error {
 	return nil
 }
 
+// checkFTS5 returns ErrNoFTS5 if SQLite was built without FTS5
+func checkFTS5(db *sql.DB) error {
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return errors.Wrap(err, "checking the sqlite compile options")
+	}
+	if !enabled {
+		return ErrNoFTS5
+	}
+
+	return nil
+}
+
 // Run performs unrun migrations
 func Run(ctx infra.DnoteCtx) error {
 	db := ctx.DB
 
+	if err := checkFTS5(db); err != nil {
+		return err
+	}
+
 	schema, err := getSchema(db)
 	if err != nil {
 		return errors.Wrap(err, "getting the current schema")
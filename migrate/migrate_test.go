@@ -2,8 +2,25 @@ package migrate
 
 import (
 	"testing"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
 )
 
 func TestExecute(t *testing.T) {
 
 }
+
+func TestCheckFTS5(t *testing.T) {
+	// set up
+	ctx := testutils.InitEnv("../tmp", "../testutils/fixtures/schema.sql")
+	defer testutils.TeardownEnv(ctx)
+
+	// execute
+	err := checkFTS5(ctx.DB)
+
+	// test
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "checking FTS5 in a build with the fts5 tag").Error())
+	}
+}
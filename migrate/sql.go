@@ -1 +1,192 @@
 package migrate
+
+// sqlCreateNoteFTS creates a full-text search index over the note content and
+// the triggers that keep it in sync with the notes table. Because the index is
+// maintained by triggers, every write to the notes table, whether it is made by
+// a command or by reducing actions from the server, is reflected in the index.
+var sqlCreateNoteFTS = `
+CREATE VIRTUAL TABLE IF NOT EXISTS note_fts USING fts5(content, content=notes, content_rowid=id, tokenize="porter unicode61");
+
+CREATE TRIGGER IF NOT EXISTS notes_after_insert AFTER INSERT ON notes BEGIN
+	INSERT INTO note_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS notes_after_delete AFTER DELETE ON notes BEGIN
+	INSERT INTO note_fts(note_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+CREATE TRIGGER IF NOT EXISTS notes_after_update AFTER UPDATE ON notes BEGIN
+	INSERT INTO note_fts(note_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	INSERT INTO note_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+INSERT INTO note_fts(note_fts) VALUES ('rebuild');`
+
+// sqlCreateTags creates the tables for tags and their association with notes
+var sqlCreateTags = `
+CREATE TABLE IF NOT EXISTS tags
+	(
+		uuid text PRIMARY KEY,
+		label text NOT NULL
+	);
+CREATE TABLE IF NOT EXISTS note_tags
+	(
+		note_uuid text NOT NULL,
+		tag_uuid text NOT NULL
+	);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_label ON tags(label);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_note_tags_note_uuid_tag_uuid ON note_tags(note_uuid, tag_uuid);
+CREATE INDEX IF NOT EXISTS idx_note_tags_tag_uuid ON note_tags(tag_uuid);`
+
+// sqlCreateNoteRevisions creates the table for the previous versions of notes
+var sqlCreateNoteRevisions = `
+CREATE TABLE IF NOT EXISTS note_revisions
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		note_uuid text NOT NULL,
+		content text NOT NULL,
+		created_on integer NOT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS idx_note_revisions_note_uuid ON note_revisions(note_uuid);`
+
+// sqlCreateTrash creates the tables for the notes and books that have been
+// removed but not yet deleted permanently
+var sqlCreateTrash = `
+CREATE TABLE IF NOT EXISTS trash_notes
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		note_id integer NOT NULL,
+		uuid text NOT NULL,
+		book_uuid text NOT NULL,
+		content text NOT NULL,
+		added_on integer NOT NULL,
+		edited_on integer DEFAULT 0,
+		public bool DEFAULT false,
+		trashed_on integer NOT NULL,
+		with_book bool DEFAULT false
+	);
+CREATE TABLE IF NOT EXISTS trash_books
+	(
+		uuid text PRIMARY KEY,
+		label text NOT NULL,
+		trashed_on integer NOT NULL
+	);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trash_notes_uuid ON trash_notes(uuid);
+CREATE INDEX IF NOT EXISTS idx_trash_notes_book_uuid ON trash_notes(book_uuid);`
+
+// sqlCreateSyncJournal creates the table recording the local actions sent to
+// the server during a sync, so that a sync interrupted after the server
+// acknowledged them neither loses nor resends them
+var sqlCreateSyncJournal = `
+CREATE TABLE IF NOT EXISTS sync_journal
+	(
+		action_uuid text PRIMARY KEY,
+		acknowledged bool NOT NULL DEFAULT false
+	);`
+
+// sqlCreateConflicts creates the table for the content of the notes edited on
+// another machine while they were being edited locally
+var sqlCreateConflicts = `
+CREATE TABLE IF NOT EXISTS conflicts
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		note_uuid text NOT NULL,
+		ours text NOT NULL,
+		theirs text NOT NULL,
+		created_on integer NOT NULL
+	);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conflicts_note_uuid ON conflicts(note_uuid);`
+
+// sqlCreateReviews creates the table for the spaced repetition schedule of the
+// notes under review
+var sqlCreateReviews = `
+CREATE TABLE IF NOT EXISTS reviews
+	(
+		note_uuid text PRIMARY KEY,
+		ease real NOT NULL,
+		interval integer NOT NULL,
+		repetitions integer NOT NULL,
+		due_on integer NOT NULL,
+		reviewed_on integer NOT NULL,
+		created_on integer NOT NULL
+	);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_due_on ON reviews(due_on);`
+
+// sqlCreateQuarantinedActions creates the table for the actions from the server
+// that this version cannot reduce, to be reduced after upgrading
+var sqlCreateQuarantinedActions = `
+CREATE TABLE IF NOT EXISTS quarantined_actions
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		uuid text NOT NULL,
+		schema integer NOT NULL,
+		type text NOT NULL,
+		data text NOT NULL,
+		timestamp integer NOT NULL,
+		quarantined_on integer NOT NULL
+	);`
+
+// sqlKeySyncJournalByRemote keys the sync journal by remote so that a sync
+// interrupted with one remote is not resumed with another, and creates the
+// table recording which remotes have received each local action. A local
+// action is deleted only after every remote has received it.
+var sqlKeySyncJournalByRemote = `
+ALTER TABLE sync_journal RENAME TO sync_journal_old;
+
+CREATE TABLE IF NOT EXISTS sync_journal
+	(
+		remote text NOT NULL,
+		action_uuid text NOT NULL,
+		acknowledged bool NOT NULL DEFAULT false,
+		PRIMARY KEY (remote, action_uuid)
+	);
+
+INSERT INTO sync_journal (remote, action_uuid, acknowledged)
+	SELECT coalesce((SELECT value FROM system WHERE key = 'remote'), 'default'), action_uuid, acknowledged
+	FROM sync_journal_old;
+
+DROP TABLE sync_journal_old;
+
+CREATE TABLE IF NOT EXISTS acknowledged_actions
+	(
+		remote text NOT NULL,
+		action_uuid text NOT NULL,
+		PRIMARY KEY (remote, action_uuid)
+	);`
+
+// sqlCreateBookAliases creates the table remembering the labels books had before
+// being renamed, so that the actions of other machines still using an old label
+// are applied to the renamed book
+var sqlCreateBookAliases = `CREATE TABLE IF NOT EXISTS book_aliases
+	(
+		label text PRIMARY KEY,
+		book_uuid text NOT NULL
+	);`
+
+// sqlScopeRemotesByBook creates the table assigning books to the added remotes
+// and replaces the acknowledgements with the deliveries still pending for each
+// remote. The books not assigned to an added remote are synced with the default
+// remote, which is where the existing local actions go.
+var sqlScopeRemotesByBook = `CREATE TABLE IF NOT EXISTS remote_books
+	(
+		remote text NOT NULL,
+		book_uuid text NOT NULL,
+		PRIMARY KEY (remote, book_uuid)
+	);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_remote_books_book_uuid ON remote_books(book_uuid);
+
+CREATE TABLE IF NOT EXISTS pending_actions
+	(
+		remote text NOT NULL,
+		action_uuid text NOT NULL,
+		PRIMARY KEY (remote, action_uuid)
+	);
+
+INSERT OR IGNORE INTO pending_actions (remote, action_uuid)
+	SELECT 'default', uuid FROM actions
+	WHERE uuid NOT IN (SELECT action_uuid FROM acknowledged_actions WHERE remote = 'default');
+
+DROP TABLE acknowledged_actions;`
@@ -0,0 +1,159 @@
+// Package output prints the results of commands in a structured format for
+// other programs to read
+package output
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is a format of the output
+type Format string
+
+const (
+	// Text is the human readable output printed by the log package
+	Text Format = "text"
+	// JSON prints a JSON object for a record and an array for records
+	JSON Format = "json"
+	// YAML prints a YAML mapping for a record and a sequence for records
+	YAML Format = "yaml"
+	// TSV prints a header line followed by a line per record
+	TSV Format = "tsv"
+)
+
+var format = Text
+
+// out is where the records are printed
+var out io.Writer = os.Stdout
+
+// SetFormat sets the format of the output
+func SetFormat(f string) error {
+	switch Format(f) {
+	case Text, JSON, YAML, TSV:
+		format = Format(f)
+	default:
+		return errors.Errorf("unknown output format '%s'. available formats are text, json, yaml and tsv", f)
+	}
+
+	return nil
+}
+
+// IsText returns true if the output is human readable text
+func IsText() bool {
+	return format == Text
+}
+
+// Note is the record of a note
+type Note struct {
+	UUID     string `json:"uuid" yaml:"uuid"`
+	ID       int    `json:"id" yaml:"id"`
+	Book     string `json:"book" yaml:"book"`
+	Content  string `json:"content" yaml:"content"`
+	AddedOn  int64  `json:"added_on" yaml:"added_on"`
+	EditedOn int64  `json:"edited_on" yaml:"edited_on"`
+	Public   bool   `json:"public" yaml:"public"`
+}
+
+// Book is the record of a book
+type Book struct {
+	Label     string `json:"label" yaml:"label"`
+	NoteCount int    `json:"note_count" yaml:"note_count"`
+}
+
+// Sync is the record of a sync
+type Sync struct {
+	Remote    string `json:"remote" yaml:"remote"`
+	Sent      int    `json:"sent" yaml:"sent"`
+	Received  int    `json:"received" yaml:"received"`
+	Conflicts int    `json:"conflicts" yaml:"conflicts"`
+	Bookmark  int    `json:"bookmark" yaml:"bookmark"`
+}
+
+// GetNote returns the record of the note with the given uuid
+func GetNote(db *sql.DB, noteUUID string) (Note, error) {
+	var ret Note
+
+	err := db.QueryRow(`SELECT notes.uuid, notes.id, books.label, notes.content, notes.added_on, notes.edited_on, notes.public
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid
+		WHERE notes.uuid = ?`, noteUUID).
+		Scan(&ret.UUID, &ret.ID, &ret.Book, &ret.Content, &ret.AddedOn, &ret.EditedOn, &ret.Public)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying the note")
+	}
+
+	return ret, nil
+}
+
+// Print prints a record, or a slice of records, in the current format. It
+// prints nothing in the text format.
+func Print(v interface{}) error {
+	switch format {
+	case JSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "marshalling into JSON")
+		}
+
+		fmt.Fprintf(out, "%s\n", b)
+	case YAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return errors.Wrap(err, "marshalling into YAML")
+		}
+
+		fmt.Fprintf(out, "%s", b)
+	case TSV:
+		if err := printTSV(v); err != nil {
+			return errors.Wrap(err, "printing TSV")
+		}
+	}
+
+	return nil
+}
+
+// escapeTSV escapes the characters that would break a TSV line
+var escapeTSV = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func printTSV(v interface{}) error {
+	val := reflect.ValueOf(v)
+
+	var records []reflect.Value
+	var typ reflect.Type
+	if val.Kind() == reflect.Slice {
+		typ = val.Type().Elem()
+		for i := 0; i < val.Len(); i++ {
+			records = append(records, val.Index(i))
+		}
+	} else {
+		typ = val.Type()
+		records = append(records, val)
+	}
+	if typ.Kind() != reflect.Struct {
+		return errors.Errorf("%s is not a record", typ)
+	}
+
+	header := []string{}
+	for i := 0; i < typ.NumField(); i++ {
+		header = append(header, typ.Field(i).Tag.Get("json"))
+	}
+	fmt.Fprintln(out, strings.Join(header, "\t"))
+
+	for _, r := range records {
+		fields := []string{}
+		for i := 0; i < r.NumField(); i++ {
+			fields = append(fields, escapeTSV.Replace(fmt.Sprint(r.Field(i).Interface())))
+		}
+		fmt.Fprintln(out, strings.Join(fields, "\t"))
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dnote/cli/testutils"
+	"github.com/pkg/errors"
+)
+
+func TestPrint(t *testing.T) {
+	notes := []Note{
+		{UUID: "note-1", ID: 1, Book: "js", Content: "line 1\n\tline 2", AddedOn: 1515199943, Public: true},
+		{UUID: "note-2", ID: 2, Book: "js", Content: `C:\dnote`, AddedOn: 1515199951, EditedOn: 1515199961},
+	}
+
+	testCases := []struct {
+		format   string
+		input    interface{}
+		expected string
+	}{
+		{
+			format: "tsv",
+			input:  notes,
+			expected: "uuid\tid\tbook\tcontent\tadded_on\tedited_on\tpublic\n" +
+				"note-1\t1\tjs\tline 1\\n\\tline 2\t1515199943\t0\ttrue\n" +
+				"note-2\t2\tjs\tC:\\\\dnote\t1515199951\t1515199961\tfalse\n",
+		},
+		{
+			format:   "tsv",
+			input:    Book{Label: "js", NoteCount: 2},
+			expected: "label\tnote_count\njs\t2\n",
+		},
+		{
+			format:   "json",
+			input:    []Book{{Label: "js", NoteCount: 2}},
+			expected: "[\n  {\n    \"label\": \"js\",\n    \"note_count\": 2\n  }\n]\n",
+		},
+		{
+			format:   "yaml",
+			input:    Book{Label: "js", NoteCount: 2},
+			expected: "label: js\nnote_count: 2\n",
+		},
+		{
+			format:   "text",
+			input:    notes,
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			out = &buf
+			if err := SetFormat(tc.format); err != nil {
+				t.Fatal(errors.Wrap(err, "setting the format"))
+			}
+
+			if err := Print(tc.input); err != nil {
+				t.Fatal(errors.Wrap(err, "printing"))
+			}
+
+			testutils.AssertEqual(t, buf.String(), tc.expected, "output mismatch")
+		})
+	}
+
+	if err := SetFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,179 @@
+package picker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dnote/cli/term"
+	"github.com/pkg/errors"
+)
+
+// maxResults is the number of candidates shown at once by the built-in picker
+const maxResults = 10
+
+const (
+	clearBelow = "\r\x1b[J"
+	boldStyle  = "\x1b[1m"
+	resetStyle = "\x1b[0m"
+)
+
+// inline is the state of the built-in picker
+type inline struct {
+	prompt     string
+	candidates []string
+	query      string
+	// matches are the indices of the candidates matching the query
+	matches []int
+	cursor  int
+	// selected is the index of the picked candidate, or -1 if cancelled
+	selected int
+}
+
+func newInline(prompt string, candidates []string) *inline {
+	ret := &inline{prompt: prompt, candidates: candidates, selected: -1}
+	ret.setQuery("")
+
+	return ret
+}
+
+func (p *inline) setQuery(query string) {
+	p.query = query
+	p.matches = filter(query, p.candidates)
+	p.cursor = 0
+}
+
+// handleKey updates the picker for the key and returns true when the user is done
+func (p *inline) handleKey(k string) bool {
+	switch k {
+	case term.KeyEnter:
+		if len(p.matches) == 0 {
+			return false
+		}
+
+		p.selected = p.matches[p.cursor]
+		return true
+	case term.KeyEsc, term.KeyCtrlC:
+		p.selected = -1
+		return true
+	case term.KeyUp:
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case term.KeyDown, term.KeyTab:
+		if p.cursor < len(p.matches)-1 {
+			p.cursor++
+		}
+	case term.KeyBackspace:
+		if r := []rune(p.query); len(r) > 0 {
+			p.setQuery(string(r[:len(r)-1]))
+		}
+	default:
+		if len([]rune(k)) == 1 {
+			p.setQuery(p.query + k)
+		}
+	}
+
+	return false
+}
+
+// truncate cuts the text to the width
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+
+	return s
+}
+
+// promptLine returns the line in which the query is typed
+func (p *inline) promptLine() string {
+	return fmt.Sprintf("%s: %s", p.prompt, p.query)
+}
+
+// render returns the lines of the picker
+func (p *inline) render(width, height int) []string {
+	ret := []string{truncate(p.promptLine(), width-1)}
+
+	offset := 0
+	if p.cursor >= height {
+		offset = p.cursor - height + 1
+	}
+
+	for i := offset; i < len(p.matches) && i < offset+height; i++ {
+		line := truncate("  "+p.candidates[p.matches[i]], width-1)
+		if i == p.cursor {
+			line = boldStyle + truncate("> "+p.candidates[p.matches[i]], width-1) + resetStyle
+		}
+
+		ret = append(ret, line)
+	}
+
+	if len(p.matches) == 0 {
+		ret = append(ret, "  no match")
+	}
+
+	return ret
+}
+
+// pickInline shows the candidates below the cursor and lets the user filter them
+// by typing and pick one with the arrow keys. The picker is drawn on stderr to
+// leave stdout to the output of the command.
+func pickInline(prompt string, candidates []string) (int, error) {
+	t, err := term.Open()
+	if err != nil {
+		return 0, err
+	}
+
+	p := newInline(prompt, candidates)
+	err = runInline(t, p)
+
+	fmt.Fprint(os.Stderr, clearBelow)
+	if rerr := t.Restore(); rerr != nil && err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return 0, err
+	}
+	if p.selected == -1 {
+		return 0, ErrCancelled
+	}
+
+	return p.selected, nil
+}
+
+func runInline(t *term.Terminal, p *inline) error {
+	for {
+		width, height, err := t.Size()
+		if err != nil {
+			return err
+		}
+		if height > maxResults+1 {
+			height = maxResults + 1
+		}
+
+		lines := p.render(width, height-1)
+		fmt.Fprint(os.Stderr, clearBelow+strings.Join(lines, "\r\n"))
+
+		// Put the cursor back at the end of the query
+		if len(lines) > 1 {
+			fmt.Fprintf(os.Stderr, "\x1b[%dA", len(lines)-1)
+		}
+		fmt.Fprint(os.Stderr, "\r")
+		if col := len([]rune(lines[0])); col > 0 {
+			fmt.Fprintf(os.Stderr, "\x1b[%dC", col)
+		}
+
+		keys, err := t.ReadKeys()
+		if err != nil {
+			return errors.Wrap(err, "reading the keys")
+		}
+
+		for _, k := range keys {
+			if p.handleKey(k) {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package picker
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Match returns true if the characters of the query appear in the text in the
+// same order, ignoring the case. The score is higher if the characters are
+// consecutive or at the start of words.
+func Match(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+
+	var score, qi int
+	prev := -2
+	for i, r := range t {
+		if qi == len(q) {
+			break
+		}
+		if r != q[qi] {
+			continue
+		}
+
+		score++
+		if i == prev+1 {
+			score += 2
+		}
+		if i == 0 || !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1]) {
+			score += 3
+		}
+		if prev >= 0 {
+			score -= i - prev - 1
+		}
+
+		prev = i
+		qi++
+	}
+
+	if qi < len(q) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+// filter returns the indices of the candidates matching the query, the best
+// match first
+func filter(query string, candidates []string) []int {
+	ret := []int{}
+	scores := map[int]int{}
+
+	for i, c := range candidates {
+		if score, ok := Match(query, c); ok {
+			ret = append(ret, i)
+			scores[i] = score
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return scores[ret[i]] > scores[ret[j]]
+	})
+
+	return ret
+}
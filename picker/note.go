@@ -0,0 +1,148 @@
+package picker
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/pkg/errors"
+)
+
+// getNotes returns the notes in the order of the book labels. If the book label
+// is not empty, only the notes in the book are returned.
+func getNotes(db *sql.DB, bookLabel string) ([]core.NoteRef, error) {
+	query := `SELECT notes.uuid, notes.id, books.label, notes.content
+		FROM notes
+		INNER JOIN books ON books.uuid = notes.book_uuid`
+	args := []interface{}{}
+	if bookLabel != "" {
+		query = fmt.Sprintf("%s WHERE books.label = ?", query)
+		args = append(args, bookLabel)
+	}
+
+	rows, err := db.Query(query+" ORDER BY books.label ASC, notes.added_on ASC", args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying notes")
+	}
+	defer rows.Close()
+
+	ret := []core.NoteRef{}
+	for rows.Next() {
+		var note core.NoteRef
+		if err := rows.Scan(&note.UUID, &note.ID, &note.BookLabel, &note.Content); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, note)
+	}
+
+	return ret, nil
+}
+
+// noteCandidate returns the line showing the note in the picker
+func noteCandidate(note core.NoteRef) string {
+	content := strings.Replace(core.Excerpt(note.Content), "\t", " ", -1)
+
+	return fmt.Sprintf("%s  %s  %s", core.ShortUUID(note.UUID), note.BookLabel, content)
+}
+
+// pickFromNotes lets the user pick one of the notes
+func pickFromNotes(ctx infra.DnoteCtx, notes []core.NoteRef) (core.NoteRef, error) {
+	candidates := []string{}
+	for _, note := range notes {
+		candidates = append(candidates, noteCandidate(note))
+	}
+
+	idx, err := Pick(ctx, "note", candidates)
+	if err != nil {
+		return core.NoteRef{}, err
+	}
+
+	return notes[idx], nil
+}
+
+// FindNote returns the note referred to by the arguments of a command, like
+// core.FindNoteByArgs. If the arguments are a book without the id of a note, or
+// if there are no arguments, the user picks a note in the book or in all books.
+func FindNote(ctx infra.DnoteCtx, args []string) (core.NoteRef, error) {
+	if len(args) == 0 {
+		if !IsAvailable() {
+			return core.NoteRef{}, errors.New("Missing argument")
+		}
+
+		notes, err := getNotes(ctx.DB, "")
+		if err != nil {
+			return core.NoteRef{}, errors.Wrap(err, "getting notes")
+		}
+
+		return pickFromNotes(ctx, notes)
+	}
+
+	if len(args) == 1 && IsAvailable() {
+		isNote, err := core.IsNoteID(ctx, args[0])
+		if err != nil {
+			return core.NoteRef{}, errors.Wrap(err, "checking the argument")
+		}
+
+		if !isNote {
+			notes, err := getNotes(ctx.DB, args[0])
+			if err != nil {
+				return core.NoteRef{}, errors.Wrap(err, "getting notes")
+			}
+
+			if len(notes) > 0 {
+				return pickFromNotes(ctx, notes)
+			}
+		}
+	}
+
+	return core.FindNoteByArgs(ctx, args)
+}
+
+// PickBookOrNote lets the user pick a book or a note in any book. It returns the
+// label of the picked book, or the picked note.
+func PickBookOrNote(ctx infra.DnoteCtx) (string, core.NoteRef, error) {
+	rows, err := ctx.DB.Query(`SELECT books.label, count(notes.uuid)
+		FROM books
+		INNER JOIN notes ON notes.book_uuid = books.uuid
+		GROUP BY books.uuid
+		ORDER BY books.label ASC`)
+	if err != nil {
+		return "", core.NoteRef{}, errors.Wrap(err, "querying books")
+	}
+	defer rows.Close()
+
+	labels := []string{}
+	candidates := []string{}
+	for rows.Next() {
+		var label string
+		var count int
+		if err := rows.Scan(&label, &count); err != nil {
+			return "", core.NoteRef{}, errors.Wrap(err, "scanning a row")
+		}
+
+		labels = append(labels, label)
+		candidates = append(candidates, fmt.Sprintf("%s (%d)", label, count))
+	}
+
+	notes, err := getNotes(ctx.DB, "")
+	if err != nil {
+		return "", core.NoteRef{}, errors.Wrap(err, "getting notes")
+	}
+	for _, note := range notes {
+		candidates = append(candidates, noteCandidate(note))
+	}
+
+	idx, err := Pick(ctx, "book or note", candidates)
+	if err != nil {
+		return "", core.NoteRef{}, err
+	}
+
+	if idx < len(labels) {
+		return labels[idx], core.NoteRef{}, nil
+	}
+
+	return "", notes[idx-len(labels)], nil
+}
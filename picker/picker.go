@@ -0,0 +1,76 @@
+// Package picker lets the user pick a note or a book from a list by typing a
+// part of it, instead of giving its id
+package picker
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/output"
+	"github.com/dnote/cli/term"
+	"github.com/pkg/errors"
+)
+
+// ErrCancelled is returned when the user quits the picker without picking
+var ErrCancelled = errors.New("Cancelled")
+
+// IsAvailable returns true if the user can be asked to pick
+func IsAvailable() bool {
+	return output.IsText() && term.IsSupported()
+}
+
+// Pick lets the user pick one of the candidates and returns its index. The
+// picker set in the config is used if there is one.
+func Pick(ctx infra.DnoteCtx, prompt string, candidates []string) (int, error) {
+	if len(candidates) == 0 {
+		return 0, errors.New("Nothing to pick from")
+	}
+
+	config, err := core.ReadConfig(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "reading the config")
+	}
+
+	if config.Picker != "" {
+		return pickExternal(config.Picker, candidates)
+	}
+
+	return pickInline(prompt, candidates)
+}
+
+// pickExternal runs the command with the candidates in stdin, one per line, and
+// returns the index of the line it prints
+func pickExternal(command string, candidates []string) (int, error) {
+	args := strings.Fields(command)
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(candidates, "\n") + "\n")
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if _, ok := err.(*exec.ExitError); ok {
+		// Pickers like fzf exit with an error status if nothing was picked
+		return 0, ErrCancelled
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "running the picker '%s'", command)
+	}
+
+	line := strings.TrimRight(string(out), "\r\n")
+	if idx := strings.Index(line, "\n"); idx > -1 {
+		line = line[:idx]
+	}
+	if line == "" {
+		return 0, ErrCancelled
+	}
+
+	for i, c := range candidates {
+		if c == line {
+			return i, nil
+		}
+	}
+
+	return 0, errors.Errorf("the picker printed '%s' which is not one of the candidates", line)
+}
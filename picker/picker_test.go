@@ -0,0 +1,154 @@
+package picker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/cli/term"
+	"github.com/dnote/cli/testutils"
+)
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		query   string
+		text    string
+		matched bool
+	}{
+		{
+			query:   "",
+			text:    "foo",
+			matched: true,
+		},
+		{
+			query:   "jsarr",
+			text:    "0c5fe3c1  js  array destructuring",
+			matched: true,
+		},
+		{
+			query:   "ARR",
+			text:    "array",
+			matched: true,
+		},
+		{
+			query:   "yar",
+			text:    "array",
+			matched: false,
+		},
+		{
+			query:   "foo",
+			text:    "fo",
+			matched: false,
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			_, ok := Match(tc.query, tc.text)
+			testutils.AssertEqual(t, ok, tc.matched, "match mismatch")
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	candidates := []string{
+		"golang  gofmt formats the code",
+		"css  flexbox",
+		"js  fetch the data",
+		"golang  go fmt",
+	}
+
+	testutils.AssertDeepEqual(t, filter("", candidates), []int{0, 1, 2, 3}, "empty query should keep the order")
+	testutils.AssertDeepEqual(t, filter("fmt", candidates), []int{3, 0}, "consecutive match at a word start should come first")
+	testutils.AssertDeepEqual(t, filter("flex", candidates), []int{1}, "filter mismatch")
+	testutils.AssertDeepEqual(t, filter("xyz", candidates), []int{}, "filter mismatch")
+}
+
+func TestPickExternal(t *testing.T) {
+	candidates := []string{"foo", "bar", "baz"}
+
+	testCases := []struct {
+		command   string
+		expected  int
+		cancelled bool
+	}{
+		{
+			command:  "head -n 1",
+			expected: 0,
+		},
+		{
+			command:  "tail -n 1",
+			expected: 2,
+		},
+		{
+			command:  "grep ar",
+			expected: 1,
+		},
+		{
+			command:   "grep qux",
+			cancelled: true,
+		},
+		{
+			command:   "true",
+			cancelled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.command, func(t *testing.T) {
+			idx, err := pickExternal(tc.command, candidates)
+
+			if tc.cancelled {
+				testutils.AssertEqual(t, err, ErrCancelled, "error mismatch")
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			testutils.AssertEqual(t, idx, tc.expected, "index mismatch")
+		})
+	}
+
+	t.Run("unknown line", func(t *testing.T) {
+		_, err := pickExternal("echo qux", candidates)
+		testutils.AssertNotEqual(t, err, nil, "error should be returned")
+	})
+}
+
+func TestInline(t *testing.T) {
+	candidates := []string{"css (1)", "js (2)", "0c5fe3c1  js  array destructuring"}
+
+	t.Run("pick", func(t *testing.T) {
+		p := newInline("note", candidates)
+
+		for _, k := range []string{"j", "s", "x", term.KeyBackspace, term.KeyDown, term.KeyDown} {
+			testutils.AssertEqual(t, p.handleKey(k), false, fmt.Sprintf("key %s should not finish", k))
+		}
+		testutils.AssertEqual(t, p.query, "js", "query mismatch")
+		testutils.AssertEqual(t, p.cursor, 1, "cursor should stop at the last match")
+
+		lines := p.render(80, 5)
+		testutils.AssertDeepEqual(t, lines, []string{
+			"note: js",
+			"  js (2)",
+			boldStyle + "> 0c5fe3c1  js  array destructuring" + resetStyle,
+		}, "lines mismatch")
+
+		testutils.AssertEqual(t, p.handleKey(term.KeyEnter), true, "enter should finish")
+		testutils.AssertEqual(t, p.selected, 2, "selected mismatch")
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		p := newInline("note", candidates)
+		p.handleKey("q")
+
+		testutils.AssertEqual(t, p.handleKey(term.KeyEnter), false, "enter should be ignored")
+		testutils.AssertDeepEqual(t, p.render(80, 5), []string{"note: q", "  no match"}, "lines mismatch")
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		p := newInline("note", candidates)
+
+		testutils.AssertEqual(t, p.handleKey(term.KeyEsc), true, "esc should finish")
+		testutils.AssertEqual(t, p.selected, -1, "nothing should be selected")
+	})
+}
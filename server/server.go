@@ -0,0 +1,402 @@
+// Package server implements a self-hosted sync server. It stores the actions
+// of its users and reduces them into a materialized view of their notes.
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/core"
+	"github.com/dnote/cli/infra"
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/migrate"
+	"github.com/pkg/errors"
+)
+
+// Server is a sync server backed by a SQLite store in a directory
+type Server struct {
+	dir string
+	db  *sql.DB
+	mux *http.ServeMux
+	// lock serializes the syncs so that bookmarks are handed out in order
+	lock sync.Mutex
+}
+
+// User is a user of the server
+type User struct {
+	ID        int
+	Name      string
+	APIKey    string
+	CreatedOn int64
+}
+
+type syncPayload struct {
+	Bookmark int    `json:"bookmark"`
+	Actions  []byte `json:"actions"` // gziped
+}
+
+type responseData struct {
+	Actions  []actions.Action `json:"actions"`
+	Bookmark int              `json:"bookmark"`
+}
+
+// Open opens the server store in the given directory, creating it if needed
+func Open(dir string) (*Server, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "views"), 0755); err != nil {
+		return nil, errors.Wrap(err, "creating the directory")
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "server.db"))
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to db")
+	}
+	if _, err := db.Exec(sqlCreateSchema); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "creating the schema")
+	}
+
+	s := &Server{dir: dir, db: db}
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/v1/sync", s.handleSync)
+
+	return s, nil
+}
+
+// Close closes the server store
+func (s *Server) Close() error {
+	return s.db.Close()
+}
+
+// ServeHTTP serves the sync protocol
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func generateAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "reading random bytes")
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// AddUser creates a user with the given name and returns the API key
+func (s *Server) AddUser(name string) (string, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT count(*) FROM users WHERE name = ?", name).Scan(&count); err != nil {
+		return "", errors.Wrap(err, "counting users")
+	}
+	if count > 0 {
+		return "", errors.Errorf("user '%s' already exists", name)
+	}
+
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		return "", errors.Wrap(err, "generating an API key")
+	}
+
+	_, err = s.db.Exec("INSERT INTO users (name, api_key, created_on) VALUES (?, ?, ?)", name, apiKey, time.Now().Unix())
+	if err != nil {
+		return "", errors.Wrap(err, "inserting the user")
+	}
+
+	return apiKey, nil
+}
+
+// RemoveUser removes the user with the given name along with their actions and notes
+func (s *Server) RemoveUser(name string) error {
+	var userID int
+	err := s.db.QueryRow("SELECT id FROM users WHERE name = ?", name).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return errors.Errorf("user '%s' not found", name)
+	} else if err != nil {
+		return errors.Wrap(err, "querying the user")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+	if _, err := tx.Exec("DELETE FROM actions WHERE user_id = ?", userID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "deleting actions")
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", userID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "deleting the user")
+	}
+	tx.Commit()
+
+	if err := os.Remove(s.viewPath(userID)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing the view")
+	}
+
+	return nil
+}
+
+// GetUsers returns the users of the server
+func (s *Server) GetUsers() ([]User, error) {
+	ret := []User{}
+
+	rows, err := s.db.Query("SELECT id, name, api_key, created_on FROM users ORDER BY name ASC")
+	if err != nil {
+		return ret, errors.Wrap(err, "querying users")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name, &u.APIKey, &u.CreatedOn); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		ret = append(ret, u)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	return ret, nil
+}
+
+func (s *Server) viewPath(userID int) string {
+	return filepath.Join(s.dir, "views", fmt.Sprintf("%d.db", userID))
+}
+
+// OpenView returns a context holding the materialized view of the notes of the
+// given user. The caller must close the database.
+func (s *Server) OpenView(userID int) (infra.DnoteCtx, error) {
+	db, err := sql.Open("sqlite3", s.viewPath(userID))
+	if err != nil {
+		return infra.DnoteCtx{}, errors.Wrap(err, "connecting to db")
+	}
+
+	ctx := infra.DnoteCtx{
+		DnoteDir:      s.dir,
+		DB:            db,
+		KeepEncrypted: true,
+	}
+
+	if err := infra.InitDB(ctx); err != nil {
+		db.Close()
+		return ctx, errors.Wrap(err, "initializing database")
+	}
+	if err := infra.InitSystem(ctx); err != nil {
+		db.Close()
+		return ctx, errors.Wrap(err, "initializing system data")
+	}
+	if err := migrate.Run(ctx); err != nil {
+		db.Close()
+		return ctx, errors.Wrap(err, "running migration")
+	}
+
+	return ctx, nil
+}
+
+func (s *Server) authenticate(apiKey string) (User, error) {
+	var ret User
+	err := s.db.QueryRow("SELECT id, name, api_key, created_on FROM users WHERE api_key = ?", apiKey).
+		Scan(&ret.ID, &ret.Name, &ret.APIKey, &ret.CreatedOn)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying the user")
+	}
+
+	return ret, nil
+}
+
+// maxPayloadSize is the largest request body the server reads, and
+// maxActionsSize the largest the actions in it can be once decompressed, so
+// that a client cannot exhaust the memory of the server
+var (
+	maxPayloadSize int64 = 32 << 20
+	maxActionsSize int64 = 256 << 20
+)
+
+func readPayload(w http.ResponseWriter, r *http.Request) (syncPayload, []actions.Action, error) {
+	var payload syncPayload
+	body := http.MaxBytesReader(w, r.Body, maxPayloadSize)
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		return payload, nil, errors.Wrap(err, "decoding the payload")
+	}
+
+	g, err := gzip.NewReader(bytes.NewReader(payload.Actions))
+	if err != nil {
+		return payload, nil, errors.Wrap(err, "reading gzip")
+	}
+	defer g.Close()
+
+	var ret []actions.Action
+	if err := json.NewDecoder(io.LimitReader(g, maxActionsSize)).Decode(&ret); err != nil {
+		return payload, nil, errors.Wrap(err, "decoding actions")
+	}
+
+	return payload, ret, nil
+}
+
+// ingest stores the actions that have not been received yet and reduces them
+// into the view of the user. The actions that cannot be reduced are stored
+// anyway and quarantined in the view so that a client is not made to resend
+// them forever. The actions and the view are written in a single transaction
+// so that either both take effect or neither does.
+func (s *Server) ingest(user User, actionSlice []actions.Action) error {
+	view, err := s.OpenView(user.ID)
+	if err != nil {
+		return errors.Wrap(err, "opening the view")
+	}
+	defer view.DB.Close()
+
+	bg := context.Background()
+	conn, err := view.DB.Conn(bg)
+	if err != nil {
+		return errors.Wrap(err, "connecting to the view")
+	}
+	defer conn.Close()
+
+	// A transaction spans the attached database as well
+	if _, err := conn.ExecContext(bg, "ATTACH DATABASE ? AS server", filepath.Join(s.dir, "server.db")); err != nil {
+		return errors.Wrap(err, "attaching the server database")
+	}
+	defer conn.ExecContext(bg, "DETACH DATABASE server")
+
+	tx, err := conn.BeginTx(bg, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning a transaction")
+	}
+
+	if _, err := core.ReduceQuarantined(view, tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "reducing quarantined actions")
+	}
+
+	for _, action := range actionSlice {
+		// An action is received again if the client did not get the response
+		res, err := tx.Exec(`INSERT OR IGNORE INTO server.actions (user_id, uuid, schema, type, data, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?)`, user.ID, action.UUID, action.Schema, action.Type, string(action.Data), action.Timestamp)
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "inserting an action")
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "counting inserted rows")
+		}
+		if inserted == 0 {
+			continue
+		}
+
+		if _, err := core.ReduceOrQuarantine(view, tx, action); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "reducing action %s", action.UUID)
+		}
+	}
+
+	// The actions quarantined for a missing book or note can be reduced once
+	// the new actions have added it
+	if _, err := core.ReduceQuarantined(view, tx); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "reducing quarantined actions")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing the transaction")
+	}
+
+	return nil
+}
+
+// getDelta returns the actions of the user after the given bookmark and the
+// new bookmark
+func (s *Server) getDelta(user User, bookmark int) (responseData, error) {
+	ret := responseData{Actions: []actions.Action{}}
+
+	rows, err := s.db.Query(`SELECT uuid, schema, type, data, timestamp
+		FROM actions
+		WHERE user_id = ? AND id > ?
+		ORDER BY id ASC`, user.ID, bookmark)
+	if err != nil {
+		return ret, errors.Wrap(err, "querying actions")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action actions.Action
+		var data string
+		if err := rows.Scan(&action.UUID, &action.Schema, &action.Type, &data, &action.Timestamp); err != nil {
+			return ret, errors.Wrap(err, "scanning a row")
+		}
+
+		action.Data = json.RawMessage(data)
+		ret.Actions = append(ret.Actions, action)
+	}
+	if err := rows.Err(); err != nil {
+		return ret, errors.Wrap(err, "scanning rows")
+	}
+
+	err = s.db.QueryRow("SELECT coalesce(max(id), 0) FROM actions WHERE user_id = ?", user.ID).Scan(&ret.Bookmark)
+	if err != nil {
+		return ret, errors.Wrap(err, "getting the bookmark")
+	}
+
+	return ret, nil
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := s.authenticate(r.Header.Get("Authorization"))
+	if err != nil {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	payload, actionSlice, err := readPayload(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.ingest(user, actionSlice); err != nil {
+		log.Errorf("syncing for %s: %s\n", user.Name, err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	respData, err := s.getDelta(user, payload.Bookmark)
+	if err != nil {
+		log.Errorf("getting the delta for %s: %s\n", user.Name, err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(respData)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Debug("synced %d actions from %s. returning %d actions\n", len(actionSlice), user.Name, len(respData.Actions))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
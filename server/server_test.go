@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/dnote/actions"
+	"github.com/dnote/cli/testutils"
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+)
+
+func newTestServer(t *testing.T) (*Server, string) {
+	dir, err := ioutil.TempDir("", "dnote-server")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "creating a temp dir"))
+	}
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the server"))
+	}
+
+	return s, dir
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "marshalling"))
+	}
+
+	return b
+}
+
+func newSyncRequest(t *testing.T, apiKey string, bookmark int, actionSlice []actions.Action) *http.Request {
+	var buf bytes.Buffer
+	g := gzip.NewWriter(&buf)
+	if _, err := g.Write(mustMarshal(t, actionSlice)); err != nil {
+		t.Fatal(errors.Wrap(err, "compressing"))
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(errors.Wrap(err, "closing gzip"))
+	}
+
+	body := mustMarshal(t, syncPayload{Bookmark: bookmark, Actions: buf.Bytes()})
+	req := httptest.NewRequest("POST", "/v1/sync", bytes.NewReader(body))
+	req.Header.Set("Authorization", apiKey)
+
+	return req
+}
+
+func doSync(t *testing.T, s *Server, req *http.Request) (int, responseData) {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	var ret responseData
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &ret); err != nil {
+			t.Fatal(errors.Wrap(err, "unmarshalling the response"))
+		}
+	}
+
+	return w.Code, ret
+}
+
+func TestSync(t *testing.T) {
+	// Setup
+	s, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	apiKey, err := s.AddUser("alice")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "adding a user"))
+	}
+
+	addBook := actions.Action{
+		UUID:      "action-1",
+		Schema:    1,
+		Type:      actions.ActionAddBook,
+		Data:      mustMarshal(t, actions.AddBookDataV1{BookName: "js"}),
+		Timestamp: 1517629805,
+	}
+	addNote := actions.Action{
+		UUID:      "action-2",
+		Schema:    1,
+		Type:      actions.ActionAddNote,
+		Data:      mustMarshal(t, actions.AddNoteDataV1{NoteUUID: "note-uuid", BookName: "js", Content: "foo"}),
+		Timestamp: 1517629806,
+	}
+
+	// Execute
+	code, resp := doSync(t, s, newSyncRequest(t, apiKey, 0, []actions.Action{addBook, addNote}))
+
+	// Test
+	testutils.AssertEqual(t, code, http.StatusOK, "status code mismatch")
+	testutils.AssertEqual(t, len(resp.Actions), 2, "delta length mismatch")
+	testutils.AssertEqual(t, resp.Bookmark, 2, "bookmark mismatch")
+
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting users"))
+	}
+	view, err := s.OpenView(users[0].ID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the view"))
+	}
+	defer view.DB.Close()
+
+	var content string
+	testutils.MustScan(t, "getting the note", view.DB.QueryRow("SELECT content FROM notes WHERE uuid = ?", "note-uuid"), &content)
+	testutils.AssertEqual(t, content, "foo", "note content mismatch")
+
+	// Execute a sync that resends an action from the same bookmark
+	code, resp = doSync(t, s, newSyncRequest(t, apiKey, 2, []actions.Action{addNote}))
+
+	// Test that the action is stored only once
+	var actionCount, noteCount int
+	testutils.MustScan(t, "counting actions", s.db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting notes", view.DB.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+
+	testutils.AssertEqual(t, code, http.StatusOK, "status code mismatch")
+	testutils.AssertEqual(t, len(resp.Actions), 0, "delta length mismatch")
+	testutils.AssertEqual(t, resp.Bookmark, 2, "bookmark mismatch")
+	testutils.AssertEqual(t, actionCount, 2, "action count mismatch")
+	testutils.AssertEqual(t, noteCount, 1, "note count mismatch")
+}
+
+func TestSync_Unauthorized(t *testing.T) {
+	// Setup
+	s, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	// Execute
+	code, _ := doSync(t, s, newSyncRequest(t, "invalid-key", 0, []actions.Action{}))
+
+	// Test
+	testutils.AssertEqual(t, code, http.StatusUnauthorized, "status code mismatch")
+}
+
+func TestSync_TooLarge(t *testing.T) {
+	// Setup
+	s, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	apiKey, err := s.AddUser("alice")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "adding a user"))
+	}
+
+	defer func(size int64) { maxPayloadSize = size }(maxPayloadSize)
+	maxPayloadSize = 16
+
+	// Execute
+	code, _ := doSync(t, s, newSyncRequest(t, apiKey, 0, []actions.Action{}))
+
+	// Test
+	testutils.AssertEqual(t, code, http.StatusBadRequest, "status code mismatch")
+}
+
+func TestSync_Unreducible(t *testing.T) {
+	// Setup
+	s, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	apiKey, err := s.AddUser("alice")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "adding a user"))
+	}
+
+	addBook := actions.Action{
+		UUID:      "action-1",
+		Schema:    1,
+		Type:      actions.ActionAddBook,
+		Data:      mustMarshal(t, actions.AddBookDataV1{BookName: "js"}),
+		Timestamp: 1517629805,
+	}
+	orphan := actions.Action{
+		UUID:      "action-2",
+		Schema:    1,
+		Type:      actions.ActionAddNote,
+		Data:      mustMarshal(t, actions.AddNoteDataV1{NoteUUID: "note-uuid", BookName: "nonexistent", Content: "foo"}),
+		Timestamp: 1517629806,
+	}
+
+	// Execute
+	code, resp := doSync(t, s, newSyncRequest(t, apiKey, 0, []actions.Action{addBook, orphan}))
+
+	// Test that the actions are stored and the orphan is quarantined in the view
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting users"))
+	}
+	view, err := s.OpenView(users[0].ID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the view"))
+	}
+	defer view.DB.Close()
+
+	var actionCount, bookCount, noteCount, quarantineCount int
+	testutils.MustScan(t, "counting actions", s.db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+	testutils.MustScan(t, "counting books", view.DB.QueryRow("SELECT count(*) FROM books"), &bookCount)
+	testutils.MustScan(t, "counting notes", view.DB.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.MustScan(t, "counting quarantined actions", view.DB.QueryRow("SELECT count(*) FROM quarantined_actions"), &quarantineCount)
+
+	testutils.AssertEqual(t, code, http.StatusOK, "status code mismatch")
+	testutils.AssertEqual(t, len(resp.Actions), 2, "delta length mismatch")
+	testutils.AssertEqual(t, actionCount, 2, "action count mismatch")
+	testutils.AssertEqual(t, bookCount, 1, "book count mismatch")
+	testutils.AssertEqual(t, noteCount, 0, "note count mismatch")
+	testutils.AssertEqual(t, quarantineCount, 1, "quarantined action count mismatch")
+
+	// Execute a sync adding the missing book
+	addMissingBook := actions.Action{
+		UUID:      "action-3",
+		Schema:    1,
+		Type:      actions.ActionAddBook,
+		Data:      mustMarshal(t, actions.AddBookDataV1{BookName: "nonexistent"}),
+		Timestamp: 1517629807,
+	}
+	code, _ = doSync(t, s, newSyncRequest(t, apiKey, 2, []actions.Action{addMissingBook}))
+
+	// Test
+	testutils.MustScan(t, "counting notes", view.DB.QueryRow("SELECT count(*) FROM notes"), &noteCount)
+	testutils.MustScan(t, "counting quarantined actions", view.DB.QueryRow("SELECT count(*) FROM quarantined_actions"), &quarantineCount)
+
+	testutils.AssertEqual(t, code, http.StatusOK, "status code mismatch after adding the book")
+	testutils.AssertEqual(t, noteCount, 1, "note count mismatch after adding the book")
+	testutils.AssertEqual(t, quarantineCount, 0, "quarantined action count mismatch after adding the book")
+}
+
+func TestSync_ViewFailure(t *testing.T) {
+	// Setup
+	s, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	apiKey, err := s.AddUser("alice")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "adding a user"))
+	}
+	users, err := s.GetUsers()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "getting users"))
+	}
+	view, err := s.OpenView(users[0].ID)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "opening the view"))
+	}
+	defer view.DB.Close()
+
+	// Make quarantining an action fail
+	testutils.MustExec(t, "breaking the quarantine", view.DB, `DROP TABLE quarantined_actions;
+		CREATE TABLE quarantined_actions (id integer PRIMARY KEY, uuid text, schema integer, type text, data text, timestamp integer);`)
+
+	orphan := actions.Action{
+		UUID:      "action-1",
+		Schema:    1,
+		Type:      actions.ActionAddNote,
+		Data:      mustMarshal(t, actions.AddNoteDataV1{NoteUUID: "note-uuid", BookName: "nonexistent", Content: "foo"}),
+		Timestamp: 1517629805,
+	}
+
+	// Execute
+	code, _ := doSync(t, s, newSyncRequest(t, apiKey, 0, []actions.Action{orphan}))
+
+	// Test that the action is not stored without the view
+	var actionCount int
+	testutils.MustScan(t, "counting actions", s.db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+
+	testutils.AssertEqual(t, code, http.StatusInternalServerError, "status code mismatch")
+	testutils.AssertEqual(t, actionCount, 0, "action count mismatch")
+}
+
+func TestRemoveUser(t *testing.T) {
+	// Setup
+	s, dir := newTestServer(t)
+	defer os.RemoveAll(dir)
+	defer s.Close()
+
+	apiKey, err := s.AddUser("alice")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "adding a user"))
+	}
+	addBook := actions.Action{
+		UUID:      "action-1",
+		Schema:    1,
+		Type:      actions.ActionAddBook,
+		Data:      mustMarshal(t, actions.AddBookDataV1{BookName: "js"}),
+		Timestamp: 1517629805,
+	}
+	if code, _ := doSync(t, s, newSyncRequest(t, apiKey, 0, []actions.Action{addBook})); code != http.StatusOK {
+		t.Fatalf("sync failed with %d", code)
+	}
+
+	// Execute
+	if err := s.RemoveUser("alice"); err != nil {
+		t.Fatal(errors.Wrap(err, "removing the user"))
+	}
+
+	// Test
+	var userCount, actionCount int
+	testutils.MustScan(t, "counting users", s.db.QueryRow("SELECT count(*) FROM users"), &userCount)
+	testutils.MustScan(t, "counting actions", s.db.QueryRow("SELECT count(*) FROM actions"), &actionCount)
+
+	testutils.AssertEqual(t, userCount, 0, "user count mismatch")
+	testutils.AssertEqual(t, actionCount, 0, "action count mismatch")
+	testutils.AssertEqual(t, utils.FileExists(s.viewPath(1)), false, "view exists")
+}
@@ -0,0 +1,26 @@
+package server
+
+// sqlCreateSchema creates the tables of the server store. The notes of each
+// user are kept in a separate database, which is a materialized view of the
+// actions stored here.
+var sqlCreateSchema = `CREATE TABLE IF NOT EXISTS users
+		(
+			id integer PRIMARY KEY AUTOINCREMENT,
+			name text NOT NULL,
+			api_key text NOT NULL,
+			created_on integer NOT NULL
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users(name);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_api_key ON users(api_key);
+
+		CREATE TABLE IF NOT EXISTS actions
+		(
+			id integer PRIMARY KEY AUTOINCREMENT,
+			user_id integer NOT NULL,
+			uuid text NOT NULL,
+			schema integer NOT NULL,
+			type text NOT NULL,
+			data text NOT NULL,
+			timestamp integer NOT NULL
+		);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_actions_user_id_uuid ON actions(user_id, uuid);`
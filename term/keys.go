@@ -0,0 +1,102 @@
+package term
+
+import (
+	"unicode/utf8"
+)
+
+// Names of the keys that are not printable
+const (
+	KeyUp        = "up"
+	KeyDown      = "down"
+	KeyLeft      = "left"
+	KeyRight     = "right"
+	KeyEnter     = "enter"
+	KeyEsc       = "esc"
+	KeyTab       = "tab"
+	KeyBackspace = "backspace"
+	KeyCtrlC     = "ctrl-c"
+)
+
+// escapeSequences are the sequences sent by the arrow keys
+var escapeSequences = map[string]string{
+	"\x1b[A": KeyUp,
+	"\x1b[B": KeyDown,
+	"\x1b[C": KeyRight,
+	"\x1b[D": KeyLeft,
+	"\x1bOA": KeyUp,
+	"\x1bOB": KeyDown,
+	"\x1bOC": KeyRight,
+	"\x1bOD": KeyLeft,
+}
+
+// ParseKeys returns the keys in the input read from a terminal in raw mode.
+// A printable key is the character itself.
+func ParseKeys(b []byte) []string {
+	ret := []string{}
+
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			var matched bool
+			for seq, name := range escapeSequences {
+				if len(b) >= len(seq) && string(b[:len(seq)]) == seq {
+					ret = append(ret, name)
+					b = b[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+
+			// An unknown sequence is dropped as a whole
+			if len(b) > 1 && (b[1] == '[' || b[1] == 'O') {
+				end := 2
+				for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+					end++
+				}
+				b = b[min(end+1, len(b)):]
+				continue
+			}
+
+			ret = append(ret, KeyEsc)
+			b = b[1:]
+			continue
+		}
+
+		switch b[0] {
+		case '\r', '\n':
+			ret = append(ret, KeyEnter)
+			b = b[1:]
+			continue
+		case '\t':
+			ret = append(ret, KeyTab)
+			b = b[1:]
+			continue
+		case 0x7f, 0x08:
+			ret = append(ret, KeyBackspace)
+			b = b[1:]
+			continue
+		case 0x03:
+			ret = append(ret, KeyCtrlC)
+			b = b[1:]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(b)
+		if r >= 0x20 && r != utf8.RuneError {
+			ret = append(ret, string(r))
+		}
+		b = b[size:]
+	}
+
+	return ret
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
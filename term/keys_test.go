@@ -0,0 +1,43 @@
+package term_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/dnote/cli/term"
+	"github.com/dnote/cli/testutils"
+)
+
+func TestParseKeys(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			input:    "j",
+			expected: []string{"j"},
+		},
+		{
+			input:    "\x1b[A\x1b[B\x1bOC\x1b[D",
+			expected: []string{term.KeyUp, term.KeyDown, term.KeyRight, term.KeyLeft},
+		},
+		{
+			input:    "\x1b",
+			expected: []string{term.KeyEsc},
+		},
+		{
+			input:    "ab\r\t\x7f\x03",
+			expected: []string{"a", "b", term.KeyEnter, term.KeyTab, term.KeyBackspace, term.KeyCtrlC},
+		},
+		{
+			input:    "\x1b[5~é",
+			expected: []string{"é"},
+		},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("case %d", idx), func(t *testing.T) {
+			testutils.AssertDeepEqual(t, term.ParseKeys([]byte(tc.input)), tc.expected, "keys mismatch")
+		})
+	}
+}
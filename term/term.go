@@ -0,0 +1,173 @@
+// Package term reads the keys pressed on the terminal for the interactive
+// commands, and the input that must not be echoed
+package term
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+
+	"github.com/dnote/cli/log"
+	"github.com/dnote/cli/utils"
+	"github.com/pkg/errors"
+)
+
+// Terminal reads the keys as they are pressed
+type Terminal struct {
+	// state is the setting of the terminal to be restored
+	state string
+}
+
+// stty runs stty on the terminal and returns the output
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "running stty %s", strings.Join(args, " "))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// IsSupported returns true if the keys can be read from the terminal
+func IsSupported() bool {
+	return runtime.GOOS != "windows" && utils.IsStdinTerminal()
+}
+
+// Open puts the terminal in raw mode
+func Open() (*Terminal, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("the interactive mode is not supported on Windows")
+	}
+	if !utils.IsStdinTerminal() {
+		return nil, errors.New("the interactive mode needs a terminal")
+	}
+
+	state, err := stty("-g")
+	if err != nil {
+		return nil, errors.Wrap(err, "saving the terminal state")
+	}
+
+	t := &Terminal{state: state}
+	if err := t.Raw(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Raw puts the terminal in raw mode
+func (t *Terminal) Raw() error {
+	if _, err := stty("raw", "-echo"); err != nil {
+		return errors.Wrap(err, "entering raw mode")
+	}
+
+	return nil
+}
+
+// Restore restores the terminal state from before it was opened
+func (t *Terminal) Restore() error {
+	if _, err := stty(t.state); err != nil {
+		return errors.Wrap(err, "restoring the terminal state")
+	}
+
+	return nil
+}
+
+// Size returns the width and the height of the terminal
+func (t *Terminal) Size() (int, int, error) {
+	out, err := stty("size")
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "getting the terminal size")
+	}
+
+	var height, width int
+	if _, err := fmt.Sscanf(out, "%d %d", &height, &width); err != nil {
+		return 0, 0, errors.Wrap(err, "parsing the terminal size")
+	}
+
+	// The size is unknown if the terminal does not report it
+	if width == 0 || height == 0 {
+		return 80, 24, nil
+	}
+
+	return width, height, nil
+}
+
+// ReadKeys blocks until keys are pressed and returns them
+func (t *Terminal) ReadKeys() ([]string, error) {
+	buf := make([]byte, 256)
+
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading stdin")
+	}
+
+	return ParseKeys(buf[:n]), nil
+}
+
+// askSecret prompts for a line of input without echoing it on the terminal
+func askSecret(prompt string) (string, error) {
+	if runtime.GOOS == "windows" || !utils.IsStdinTerminal() {
+		return utils.Ask(prompt)
+	}
+
+	state, err := stty("-g")
+	if err != nil {
+		return "", errors.Wrap(err, "saving the terminal state")
+	}
+	if _, err := stty("-echo"); err != nil {
+		return "", errors.Wrap(err, "turning off the echo")
+	}
+	defer stty(state)
+
+	// The echo is turned back on if the prompt is interrupted
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	defer func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}()
+	go func() {
+		if _, ok := <-sigs; ok {
+			stty(state)
+			log.Plain("\n")
+			os.Exit(1)
+		}
+	}()
+
+	ret, err := utils.Ask(prompt)
+	// The line break was not echoed either
+	log.Plain("\n")
+
+	return ret, err
+}
+
+// AskPassphrase prompts for a passphrase without echoing it. If confirm is
+// true, the passphrase is asked twice to rule out a typo.
+func AskPassphrase(prompt string, confirm bool) (string, error) {
+	ret, err := askSecret(prompt)
+	if err != nil {
+		return "", err
+	}
+	if ret == "" {
+		return "", errors.New("Empty passphrase")
+	}
+
+	if confirm {
+		res, err := askSecret(fmt.Sprintf("confirm %s", prompt))
+		if err != nil {
+			return "", err
+		}
+		if res != ret {
+			return "", errors.New("Passphrases do not match")
+		}
+	}
+
+	return ret, nil
+}
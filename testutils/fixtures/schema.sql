@@ -30,3 +30,111 @@ CREATE UNIQUE INDEX idx_books_label ON books(label);
 CREATE INDEX idx_books_uuid ON books(uuid);
 CREATE INDEX idx_notes_id ON notes(id);
 CREATE INDEX idx_notes_book_uuid ON notes(book_uuid);
+CREATE VIRTUAL TABLE note_fts USING fts5(content, content=notes, content_rowid=id, tokenize="porter unicode61");
+CREATE TRIGGER notes_after_insert AFTER INSERT ON notes BEGIN
+	INSERT INTO note_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER notes_after_delete AFTER DELETE ON notes BEGIN
+	INSERT INTO note_fts(note_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+CREATE TRIGGER notes_after_update AFTER UPDATE ON notes BEGIN
+	INSERT INTO note_fts(note_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	INSERT INTO note_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TABLE tags
+	(
+		uuid text PRIMARY KEY,
+		label text NOT NULL
+	);
+CREATE TABLE note_tags
+	(
+		note_uuid text NOT NULL,
+		tag_uuid text NOT NULL
+	);
+CREATE UNIQUE INDEX idx_tags_label ON tags(label);
+CREATE UNIQUE INDEX idx_note_tags_note_uuid_tag_uuid ON note_tags(note_uuid, tag_uuid);
+CREATE INDEX idx_note_tags_tag_uuid ON note_tags(tag_uuid);
+CREATE TABLE note_revisions
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		note_uuid text NOT NULL,
+		content text NOT NULL,
+		created_on integer NOT NULL
+	);
+CREATE INDEX idx_note_revisions_note_uuid ON note_revisions(note_uuid);
+CREATE TABLE trash_notes
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		note_id integer NOT NULL,
+		uuid text NOT NULL,
+		book_uuid text NOT NULL,
+		content text NOT NULL,
+		added_on integer NOT NULL,
+		edited_on integer DEFAULT 0,
+		public bool DEFAULT false,
+		trashed_on integer NOT NULL,
+		with_book bool DEFAULT false
+	);
+CREATE TABLE trash_books
+	(
+		uuid text PRIMARY KEY,
+		label text NOT NULL,
+		trashed_on integer NOT NULL
+	);
+CREATE UNIQUE INDEX idx_trash_notes_uuid ON trash_notes(uuid);
+CREATE INDEX idx_trash_notes_book_uuid ON trash_notes(book_uuid);
+CREATE TABLE sync_journal
+	(
+		remote text NOT NULL,
+		action_uuid text NOT NULL,
+		acknowledged bool NOT NULL DEFAULT false,
+		PRIMARY KEY (remote, action_uuid)
+	);
+CREATE TABLE conflicts
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		note_uuid text NOT NULL,
+		ours text NOT NULL,
+		theirs text NOT NULL,
+		created_on integer NOT NULL
+	);
+CREATE UNIQUE INDEX idx_conflicts_note_uuid ON conflicts(note_uuid);
+CREATE TABLE reviews
+	(
+		note_uuid text PRIMARY KEY,
+		ease real NOT NULL,
+		interval integer NOT NULL,
+		repetitions integer NOT NULL,
+		due_on integer NOT NULL,
+		reviewed_on integer NOT NULL,
+		created_on integer NOT NULL
+	);
+CREATE INDEX idx_reviews_due_on ON reviews(due_on);
+CREATE TABLE quarantined_actions
+	(
+		id integer PRIMARY KEY AUTOINCREMENT,
+		uuid text NOT NULL,
+		schema integer NOT NULL,
+		type text NOT NULL,
+		data text NOT NULL,
+		timestamp integer NOT NULL,
+		quarantined_on integer NOT NULL
+	);
+CREATE TABLE book_aliases
+	(
+		label text PRIMARY KEY,
+		book_uuid text NOT NULL
+	);
+CREATE TABLE remote_books
+	(
+		remote text NOT NULL,
+		book_uuid text NOT NULL,
+		PRIMARY KEY (remote, book_uuid)
+	);
+CREATE UNIQUE INDEX idx_remote_books_book_uuid ON remote_books(book_uuid);
+CREATE TABLE pending_actions
+	(
+		remote text NOT NULL,
+		action_uuid text NOT NULL,
+		PRIMARY KEY (remote, action_uuid)
+	);
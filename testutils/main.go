@@ -303,3 +303,16 @@ func UserConfirm(stdin io.WriteCloser) error {
 
 	return nil
 }
+
+// UserInput returns a function that enters the given lines in stdin
+func UserInput(lines ...string) func(io.WriteCloser) error {
+	return func(stdin io.WriteCloser) error {
+		for _, line := range lines {
+			if _, err := io.WriteString(stdin, line+"\n"); err != nil {
+				return errors.Wrap(err, "entering a line")
+			}
+		}
+
+		return nil
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/dnote/cli/log"
 	"github.com/pkg/errors"
@@ -17,9 +18,12 @@ func GenerateUUID() string {
 	return uuid.NewV4().String()
 }
 
+// stdin is shared by the prompts so that the input buffered by one prompt is
+// not lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
 func getInput() (string, error) {
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := stdin.ReadString('\n')
 	if err != nil {
 		return "", errors.Wrap(err, "reading stdin")
 	}
@@ -27,6 +31,38 @@ func getInput() (string, error) {
 	return input, nil
 }
 
+// IsStdinTerminal returns false if stdin is redirected from a pipe or a file
+func IsStdinTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return true
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ReadStdin reads stdin until the end
+func ReadStdin() (string, error) {
+	b, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return "", errors.Wrap(err, "reading stdin")
+	}
+
+	return string(b), nil
+}
+
+// Ask prompts for a line of user input and returns it without the line break
+func Ask(prompt string) (string, error) {
+	log.Printf("%s: ", prompt)
+
+	res, err := getInput()
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get user input")
+	}
+
+	return strings.TrimRight(res, "\r\n"), nil
+}
+
 // AskConfirmation prompts for user input to confirm a choice
 func AskConfirmation(question string, optimistic bool) (bool, error) {
 	var choices string